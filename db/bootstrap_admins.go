@@ -0,0 +1,46 @@
+package db
+
+import (
+	"api/models"
+	"fmt"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PromoteBootstrapAdmins makes the verified users whose emails are listed in ADMIN_EMAILS
+// admins while there is no active admin. Nobody can pick a role when registering, so this is
+// how the first admin is made; after that roles are assigned from the admin dashboard, and a
+// listed user who was demoted there stays demoted.
+func PromoteBootstrapAdmins(db *gorm.DB) error {
+	var emails []string
+	for _, e := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			emails = append(emails, e)
+		}
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	var admins int64
+	if err := db.Model(&models.User{}).Where("role = ? AND status = ?", models.RoleAdmin, models.UserActive).
+		Count(&admins).Error; err != nil {
+		return err
+	}
+	if admins > 0 {
+		return nil
+	}
+
+	result := db.Model(&models.User{}).
+		Where("LOWER(email) IN ? AND email_verified = ? AND role <> ?", emails, true, models.RoleAdmin).
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		fmt.Printf("👑 Promoted %d user(s) from ADMIN_EMAILS to admin\n", result.RowsAffected)
+	}
+	return nil
+}
@@ -62,6 +62,10 @@ func ConnectDb() {
 
 	fmt.Println("🧱 Extensions ready")
 
+	if err := MigrateMoneyToKobo(db); err != nil {
+		log.Fatalf("❌ Money migration failed: %v", err)
+	}
+
 	// Auto-migrate models
 	if err := db.AutoMigrate(
 		&models.User{},
@@ -77,9 +81,51 @@ func ConnectDb() {
 		&models.FoodOrder{},
 		&models.ServiceBooking{},
 		&models.CommunityMessage{},
+		&models.PaystackEvent{},
+		&models.Payout{},
+		&models.TransferRecipient{},
+		&models.LedgerAccount{},
+		&models.JournalEntry{},
+		&models.JournalLine{},
+		&models.CommissionRule{},
+		&models.CartItem{},
+		&models.FoodCheckout{},
+		&models.FoodOrderItem{},
+		&models.FoodOrderStatusHistory{},
+		&models.Refund{},
+		&models.Dispute{},
+		&models.DisputeMessage{},
+		&models.RescheduleProposal{},
+		&models.Quote{},
+		&models.QuoteItem{},
+		&models.Milestone{},
+		&models.Job{},
+		&models.JobSchedule{},
+		&models.OutboxEmail{},
+		&models.NotificationOptOut{},
+		&models.Notification{},
+		&models.Conversation{},
+		&models.Session{},
+		&models.TwoFactor{},
+		&models.BackupCode{},
+		&models.TwoFactorChallenge{},
+		&models.RateLimitBucket{},
+		&models.PhoneVerification{},
+		&models.ConversationMessage{},
+		&models.ServiceSchedule{},
+		&models.AvailabilityWindow{},
+		&models.BlackoutDate{},
 	); err != nil {
 		log.Fatalf("❌ AutoMigrate failed: %v", err)
 	}
 
+	if err := IndexVerifiedPhones(db); err != nil {
+		log.Fatalf("❌ Verified phone index failed: %v", err)
+	}
+
 	fmt.Println("✅ Database migration completed")
+
+	if err := PromoteBootstrapAdmins(db); err != nil {
+		log.Fatalf("❌ Admin bootstrap failed: %v", err)
+	}
 }
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists every column that used to hold Naira as a float and now holds kobo.
+var moneyColumns = map[string][]string{
+	"products":         {"product_price", "market_price_from", "market_price_to", "delivery_fee", "old_price"},
+	"food_orders":      {"meal_price", "delivery_fee", "total_amount", "platform_fee", "vendor_payout"},
+	"service_bookings": {"booking_fee", "platform_fee", "artisan_payout"},
+	"payouts":          {"amount"},
+	"commission_rules": {"flat_fee", "min_fee", "max_fee"},
+}
+
+// MigrateMoneyToKobo converts the legacy Naira float columns to BIGINT kobo. A column is
+// only converted while it still has a floating/numeric type, so running this on every
+// start is safe. It must run before AutoMigrate, which would otherwise cast the Naira
+// values to BIGINT without scaling them.
+func MigrateMoneyToKobo(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range moneyColumns {
+			for _, column := range columns {
+				var dataType string
+				if err := tx.Raw(`
+					SELECT data_type FROM information_schema.columns
+					WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`,
+					table, column).Scan(&dataType).Error; err != nil {
+					return err
+				}
+
+				switch dataType {
+				case "double precision", "real", "numeric":
+				default:
+					continue
+				}
+
+				if err := tx.Exec(fmt.Sprintf(
+					`ALTER TABLE %q ALTER COLUMN %q TYPE bigint USING ROUND(COALESCE(%q, 0)::numeric * 100)::bigint`,
+					table, column, column)).Error; err != nil {
+					return fmt.Errorf("converting %s.%s to kobo: %w", table, column, err)
+				}
+				log.Printf("💰 Converted %s.%s from Naira to kobo", table, column)
+			}
+		}
+		return nil
+	})
+}
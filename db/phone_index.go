@@ -0,0 +1,33 @@
+package db
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// IndexVerifiedPhones makes a phone number verifiable on only one live account, backing the
+// check otp.Verify makes. Duplicates verified before the index existed keep the verification
+// on the oldest account; the others have to verify again. Running this on every start is safe.
+func IndexVerifiedPhones(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`
+			UPDATE users SET phone_verified = false
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY phone_number ORDER BY created_at, id) AS n
+					FROM users WHERE phone_verified AND deleted_at IS NULL
+				) ranked WHERE n > 1
+			)`)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Unverified %d duplicate phone numbers before indexing them\n", result.RowsAffected)
+		}
+
+		return tx.Exec(`
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone
+			ON users (phone_number) WHERE phone_verified AND deleted_at IS NULL`).Error
+	})
+}
@@ -0,0 +1,255 @@
+package emails
+
+import (
+	"api/jobs"
+	"api/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Kinds of outbox email. Each is delivered by the Send* function it is mapped to in sendFuncs,
+// and is queued with that function's arguments.
+const (
+	KindVerification         = "VERIFICATION"
+	KindUserDeactivation     = "USER_DEACTIVATION"
+	KindProductDeactivation  = "PRODUCT_DEACTIVATION"
+	KindAccountVerified      = "ACCOUNT_VERIFIED"
+	KindProductReactivation  = "PRODUCT_REACTIVATION"
+	KindProductClosure       = "PRODUCT_CLOSURE"
+	KindContact              = "CONTACT"
+	KindPasswordReset        = "PASSWORD_RESET"
+	KindPasswordResetSuccess = "PASSWORD_RESET_SUCCESS"
+	KindNewProductsBulk      = "NEW_PRODUCTS_BULK"
+	KindNewsletter           = "NEWSLETTER"
+	KindProductViewed        = "PRODUCT_VIEWED"
+	KindSearchAlert          = "SEARCH_ALERT"
+	KindVendorFoodOrder      = "VENDOR_FOOD_ORDER"
+	KindArtisanBooking       = "ARTISAN_BOOKING"
+	KindPriceSlash           = "PRICE_SLASH"
+	KindGuestProductListed   = "GUEST_PRODUCT_LISTED"
+	KindFoodOrderStatus      = "FOOD_ORDER_STATUS"
+	KindBookingCancelled     = "BOOKING_CANCELLED"
+	KindBookingRefund        = "BOOKING_REFUND"
+	KindDisputeUpdate        = "DISPUTE_UPDATE"
+	KindBookingUpdate        = "BOOKING_UPDATE"
+	KindTwoFactorEnrollment  = "TWO_FACTOR_ENROLLMENT"
+)
+
+var sendFuncs = map[string]interface{}{
+	KindVerification:         SendVerificationMail,
+	KindUserDeactivation:     SendUserDeactivationEmail,
+	KindProductDeactivation:  SendProductDeactivationEmail,
+	KindAccountVerified:      SendAccountVerifiedMail,
+	KindProductReactivation:  SendProductReactivationEmail,
+	KindProductClosure:       SendProductClosureEmail,
+	KindContact:              SendContactEmail,
+	KindPasswordReset:        SendPasswordResetMail,
+	KindPasswordResetSuccess: SendPasswordResetSuccessMail,
+	KindNewProductsBulk:      SendNewProductsBulkMail,
+	KindNewsletter:           SendCustomNewsletter,
+	KindProductViewed:        SendProductViewedMail,
+	KindSearchAlert:          SendSearchAlertNotificationMail,
+	KindVendorFoodOrder:      SendVendorFoodOrderEmail,
+	KindArtisanBooking:       SendArtisanBookingNotificationEmail,
+	KindPriceSlash:           SendPriceSlashNotificationMail,
+	KindGuestProductListed:   SendGuestProductListedEmail,
+	KindFoodOrderStatus:      SendFoodOrderStatusEmail,
+	KindBookingCancelled:     SendBookingCancelledEmail,
+	KindBookingRefund:        SendBookingRefundEmail,
+	KindDisputeUpdate:        SendDisputeUpdateEmail,
+	KindBookingUpdate:        SendBookingUpdateEmail,
+	KindTwoFactorEnrollment:  SendTwoFactorEnrollmentMail,
+}
+
+const (
+	// DeliveryJob is the background job that sends one outbox email.
+	DeliveryJob = "email-delivery"
+	// DeliveryAttempts is how many times an email is tried before it is marked FAILED.
+	DeliveryAttempts = 6
+
+	contactInbox = "Nedzlworld@gmail.com"
+	bulkBatch    = 100 // the most recipients Resend accepts in one batch
+)
+
+// DeliveryPayload identifies the email a delivery job sends.
+type DeliveryPayload struct {
+	EmailID uuid.UUID `json:"email_id"`
+}
+
+// Queue writes an email of the given kind to the outbox and enqueues its delivery. args are
+// the arguments of the kind's Send* function, in order. Call it with the transaction of the
+// change the email reports, so the email goes out only if that change commits.
+func Queue(tx *gorm.DB, kind string, args ...interface{}) (*models.OutboxEmail, error) {
+	sendFunc, ok := sendFuncs[kind]
+	if !ok {
+		return nil, fmt.Errorf("emails: unknown email kind %s", kind)
+	}
+	fn := reflect.TypeOf(sendFunc)
+	if len(args) != fn.NumIn() {
+		return nil, fmt.Errorf("emails: %s takes %d arguments, got %d", kind, fn.NumIn(), len(args))
+	}
+	for i, arg := range args {
+		if arg == nil || !reflect.TypeOf(arg).AssignableTo(fn.In(i)) {
+			return nil, fmt.Errorf("emails: %s argument %d must be a %s", kind, i+1, fn.In(i))
+		}
+	}
+
+	raw, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	email := models.OutboxEmail{
+		Kind:      kind,
+		Recipient: recipientOf(kind, args),
+		Args:      raw,
+		Status:    models.EmailPending,
+	}
+	if err := tx.Create(&email).Error; err != nil {
+		return nil, err
+	}
+	return &email, enqueueDelivery(tx, &email)
+}
+
+// RecipientBatches splits a bulk mailing into batches that are queued as separate emails, so
+// retrying a failed batch never resends the ones already delivered.
+func RecipientBatches(recipients []BulkEmailRecipient) [][]BulkEmailRecipient {
+	var batches [][]BulkEmailRecipient
+	for len(recipients) > bulkBatch {
+		batches = append(batches, recipients[:bulkBatch])
+		recipients = recipients[bulkBatch:]
+	}
+	if len(recipients) > 0 {
+		batches = append(batches, recipients)
+	}
+	return batches
+}
+
+// recipientOf is the address shown to admins for an outbox email.
+func recipientOf(kind string, args []interface{}) string {
+	if kind == KindContact {
+		return contactInbox
+	}
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			if strings.Contains(v, "@") {
+				return v
+			}
+		case []BulkEmailRecipient:
+			return fmt.Sprintf("%d recipients", len(v))
+		}
+	}
+	return ""
+}
+
+func enqueueDelivery(tx *gorm.DB, email *models.OutboxEmail) error {
+	job, err := jobs.Enqueue(tx, DeliveryJob, DeliveryPayload{EmailID: email.ID}, time.Now())
+	if err != nil {
+		return err
+	}
+	email.JobID = &job.ID
+	return tx.Model(email).Update("job_id", job.ID).Error
+}
+
+// Deliver is the handler of DeliveryJob. It sends the email and records the outcome; a
+// returned error makes the job retry it with backoff.
+func Deliver(ctx context.Context, db *gorm.DB, payload []byte) error {
+	var p DeliveryPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	var email models.OutboxEmail
+	if err := db.First(&email, "id = ?", p.EmailID).Error; err != nil {
+		return err
+	}
+	if email.Status == models.EmailSent {
+		return nil
+	}
+
+	sendErr := dispatch(email)
+	updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+	if sendErr == nil {
+		now := time.Now()
+		updates["status"] = models.EmailSent
+		updates["last_error"] = ""
+		updates["sent_at"] = &now
+	} else {
+		updates["last_error"] = sendErr.Error()
+		if finalAttempt(db, email.JobID) {
+			updates["status"] = models.EmailFailed
+		}
+	}
+	if err := db.Model(&email).Updates(updates).Error; err != nil {
+		return err
+	}
+	return sendErr
+}
+
+// finalAttempt reports whether the running delivery job has no attempts left.
+func finalAttempt(db *gorm.DB, jobID *uuid.UUID) bool {
+	if jobID == nil {
+		return true
+	}
+	var job models.Job
+	if err := db.Select("attempts", "max_attempts").First(&job, "id = ?", *jobID).Error; err != nil {
+		return false
+	}
+	return job.Attempts >= job.MaxAttempts
+}
+
+// dispatch calls the email's Send* function with its stored arguments.
+func dispatch(email models.OutboxEmail) error {
+	sendFunc, ok := sendFuncs[email.Kind]
+	if !ok {
+		return fmt.Errorf("unknown email kind %s", email.Kind)
+	}
+	fn := reflect.ValueOf(sendFunc)
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(email.Args, &raw); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	if len(raw) != fn.Type().NumIn() {
+		return fmt.Errorf("%s takes %d arguments, %d were stored", email.Kind, fn.Type().NumIn(), len(raw))
+	}
+	in := make([]reflect.Value, len(raw))
+	for i := range raw {
+		arg := reflect.New(fn.Type().In(i))
+		if err := json.Unmarshal(raw[i], arg.Interface()); err != nil {
+			return fmt.Errorf("invalid argument %d: %w", i+1, err)
+		}
+		in[i] = arg.Elem()
+	}
+
+	if err, _ := fn.Call(in)[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Retry queues a FAILED email for a fresh series of delivery attempts.
+func Retry(db *gorm.DB, id uuid.UUID) (*models.OutboxEmail, error) {
+	var email models.OutboxEmail
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&email, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if email.Status != models.EmailFailed {
+			return fmt.Errorf("only failed emails can be retried; this one is %s", email.Status)
+		}
+		email.Status = models.EmailPending
+		if err := tx.Model(&email).Update("status", email.Status).Error; err != nil {
+			return err
+		}
+		return enqueueDelivery(tx, &email)
+	})
+	return &email, err
+}
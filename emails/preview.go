@@ -0,0 +1,174 @@
+package emails
+
+import (
+	"api/models"
+	"fmt"
+	"time"
+)
+
+// previewSamples is the data each template is rendered with in the admin preview. Every
+// template must have an entry; the preview endpoint is how changes to templates are checked.
+var previewSamples = map[string]func() interface{}{
+	"verification": func() interface{} {
+		return linkData{
+			Username: "Ada Okafor",
+			Link:     "https://nedzl.com/auth/verify?email=ada%40example.com&token=sample-token",
+			Expiry:   time.Now().Add(5 * time.Minute).Format("3:04 PM MST"),
+		}
+	},
+	"user_deactivated": func() interface{} { return userData{Username: "Ada Okafor"} },
+	"product_deactivated": func() interface{} {
+		return productData{Username: "Ada Okafor", ProductName: "HP EliteBook 840 G5", Reason: "The listing breaks our prohibited items policy."}
+	},
+	"account_verified": func() interface{} { return userData{Username: "Ada Okafor"} },
+	"product_reactivated": func() interface{} {
+		return productData{Username: "Ada Okafor", ProductName: "HP EliteBook 840 G5", ProductLink: productLink("sample-product")}
+	},
+	"product_closed": func() interface{} {
+		return productData{Username: "Ada Okafor", ProductName: "HP EliteBook 840 G5"}
+	},
+	"contact": func() interface{} {
+		return contactData{
+			FirstName:   "Ada",
+			LastName:    "Okafor",
+			Email:       sampleEmail,
+			PhoneNumber: "+2348012345678",
+			Message:     "Hello,\nI can't upload images to my listing. Could you help?",
+		}
+	},
+	"password_reset": func() interface{} {
+		return linkData{
+			Username: "Ada Okafor",
+			Link:     "https://nedzl.com/auth/reset-password?email=ada%40example.com&token=sample-token",
+			Expiry:   time.Now().Add(15 * time.Minute).Format("3:04 PM MST"),
+		}
+	},
+	"password_reset_success": func() interface{} { return userData{Username: "Ada Okafor"} },
+	"two_factor_enrollment": func() interface{} {
+		return codeData{
+			Username: "Ada Okafor",
+			Code:     "48213907",
+			Expiry:   time.Now().Add(15 * time.Minute).Format("3:04 PM MST"),
+		}
+	},
+	"new_products": func() interface{} {
+		return newProductsData{
+			FirstName:      "Ada",
+			Products:       sampleProducts(),
+			UnsubscribeURL: UnsubscribePageURL(sampleEmail, models.NotifyNewProducts),
+		}
+	},
+	"newsletter": func() interface{} {
+		return newsletterData{
+			FirstName:      "Ada",
+			Body:           "Exams are around the corner!\n\nStock up on stationery from sellers on your campus.",
+			UnsubscribeURL: UnsubscribePageURL(sampleEmail, models.NotifyMarketing),
+		}
+	},
+	"product_viewed": func() interface{} {
+		return productViewedData{VendorName: "Ada Okafor", ProductName: "HP EliteBook 840 G5", ProductLink: productLink("sample-product")}
+	},
+	"search_alert": func() interface{} {
+		return searchAlertData{Keyword: "laptop", Category: "Electronics", ProductName: "HP EliteBook 840 G5", ProductLink: productLink("sample-product")}
+	},
+	"vendor_food_order": func() interface{} {
+		data := vendorFoodOrderData{
+			VendorName:      "Mama Put Kitchen",
+			OrderNumber:     "FO-10293",
+			ProductName:     "Jollof Rice & Chicken",
+			CustomerName:    "Ada Okafor",
+			CustomerPhone:   "+2348012345678",
+			DeliveryAddress: "Room 12, Block C, Moremi Hall",
+			TotalAmount:     samplePrice(4500),
+			DeliveryFee:     samplePrice(500),
+			PlatformFee:     samplePrice(400),
+			VendorPayout:    samplePrice(3600),
+		}
+		data.SubMenus, data.SubMenusText = parseSubMenus(`[{"name":"Extra plantain","price":"300"},{"name":"Coleslaw","price":"200"}]`)
+		return data
+	},
+	"artisan_booking": func() interface{} {
+		return artisanBookingData{
+			ArtisanName:    "Tunde Adeyemi",
+			BookingNumber:  "SB-20451",
+			ServiceName:    "Laptop screen repair",
+			ScheduledDate:  time.Now().AddDate(0, 0, 2).Format("Mon, 02 Jan 2006 at 03:04 PM"),
+			CustomerName:   "Ada Okafor",
+			CustomerPhone:  "+2348012345678",
+			ServiceAddress: "Room 12, Block C, Moremi Hall",
+			BookingFee:     samplePrice(15000),
+			PlatformFee:    samplePrice(1500),
+			ArtisanPayout:  samplePrice(13500),
+		}
+	},
+	"price_slash": func() interface{} {
+		return priceSlashData{
+			ProductName:    "HP EliteBook 840 G5",
+			ProductLink:    productLink("sample-product"),
+			OldPrice:       samplePrice(250000),
+			NewPrice:       samplePrice(200000),
+			DiscountPct:    20,
+			UnsubscribeURL: UnsubscribePageURL(sampleEmail, models.NotifyPriceDrops),
+		}
+	},
+	"guest_product_listed": func() interface{} {
+		return guestProductListedData{Email: sampleEmail, ProductName: "HP EliteBook 840 G5"}
+	},
+	"food_order_status": func() interface{} {
+		statusCopy := foodOrderStatusCopy["OUT_FOR_DELIVERY"]
+		return foodOrderStatusData{
+			Headline:       statusCopy[0],
+			Message:        statusCopy[1],
+			CustomerName:   "Ada Okafor",
+			OrderNumber:    "FO-10293",
+			Status:         "OUT FOR DELIVERY",
+			Note:           "The rider will call when they reach your hostel.",
+			UnsubscribeURL: UnsubscribePageURL(sampleEmail, models.NotifyOrderUpdates),
+		}
+	},
+	"booking_cancelled": func() interface{} {
+		return bookingData{Name: "Ada Okafor", BookingNumber: "SB-20451", CancelledBy: "artisan", Reason: "Spare parts are out of stock."}
+	},
+	"booking_refund": func() interface{} {
+		return bookingData{Name: "Ada Okafor", BookingNumber: "SB-20451", Amount: samplePrice(15000), Reason: "Booking cancelled by the artisan."}
+	},
+	"dispute_update": func() interface{} {
+		return bookingData{
+			Name:          "Ada Okafor",
+			BookingNumber: "SB-20451",
+			Headline:      "Dispute Resolved",
+			Message:       "Our team reviewed the evidence and refunded 50% of the booking to you.",
+		}
+	},
+	"booking_update": func() interface{} {
+		return bookingData{
+			Name:          "Ada Okafor",
+			BookingNumber: "SB-20451",
+			Headline:      "New Time Proposed",
+			Message:       "Tunde Adeyemi proposed moving your booking to Friday at 2:00 PM.",
+		}
+	},
+}
+
+const sampleEmail = "ada@example.com"
+
+func sampleProducts() []EmailProduct {
+	return []EmailProduct{
+		{ID: "sample-product", Name: "HP EliteBook 840 G5", Price: samplePrice(250000), ImageUrl: "https://res.cloudinary.com/demo/image/upload/sample.jpg"},
+		{ID: "sample-product-2", Name: "Casio fx-991ES Calculator", Price: samplePrice(12500), ImageUrl: "https://res.cloudinary.com/demo/image/upload/sample.jpg"},
+	}
+}
+
+func samplePrice(naira int64) models.Money {
+	return models.NGN(naira * 100)
+}
+
+// Preview renders the named template with sample data, returning its HTML and plain-text
+// parts.
+func Preview(name string) (string, string, error) {
+	sample, ok := previewSamples[name]
+	if !ok {
+		return "", "", fmt.Errorf("no template named %s", name)
+	}
+	return render(name, sample())
+}
@@ -0,0 +1,193 @@
+package emails
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templateFuncs = template.FuncMap{
+	"price": formatPrice,
+	"year":  func() int { return time.Now().Year() },
+}
+
+// templates holds one parsed template set per email, keyed by file name without extension.
+// Each set is the shared layout plus the email's own file, which defines "content" and may
+// override the layout's "title", "accent", "help" and "footer" blocks.
+var templates = parseTemplates()
+
+func parseTemplates() map[string]*template.Template {
+	layout := template.Must(template.New("layout.html").Funcs(templateFuncs).ParseFS(templateFS, "templates/layout.html"))
+
+	files, err := fs.Glob(templateFS, "templates/*.html")
+	if err != nil {
+		panic(err)
+	}
+	parsed := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".html")
+		if name == "layout" {
+			continue
+		}
+		parsed[name] = template.Must(template.Must(layout.Clone()).ParseFS(templateFS, file))
+	}
+	return parsed
+}
+
+// render executes the named email template with data, returning the HTML body and a
+// plain-text alternative generated from it. Values in data are escaped for the context
+// they appear in.
+func render(name string, data interface{}) (string, string, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return "", "", fmt.Errorf("emails: unknown template %s", name)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", data); err != nil {
+		return "", "", fmt.Errorf("emails: rendering %s: %w", name, err)
+	}
+	body := buf.String()
+	text, err := htmlToText(body)
+	if err != nil {
+		return "", "", fmt.Errorf("emails: converting %s to text: %w", name, err)
+	}
+	return body, text, nil
+}
+
+// TemplateNames lists the email templates, for the admin preview.
+func TemplateNames() []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	spaceRuns  = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// htmlToText turns a rendered email into its plain-text part: block elements become line
+// breaks, links are followed by their URL and images are dropped. Whitespace is collapsed as
+// a browser would, except inside elements styled white-space: pre*.
+func htmlToText(body string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node, pre bool)
+	walk = func(n *html.Node, pre bool) {
+		switch n.Type {
+		case html.TextNode:
+			text := n.Data
+			if !pre {
+				if n.Parent != nil && isTableRow(n.Parent) && strings.TrimSpace(text) == "" {
+					return
+				}
+				text = spaceRuns.ReplaceAllString(text, " ")
+				if atLineStart(&b) || strings.HasSuffix(b.String(), " ") {
+					text = strings.TrimLeft(text, " ")
+				}
+			}
+			b.WriteString(text)
+			return
+		case html.ElementNode:
+			switch n.DataAtom {
+			case atom.Head, atom.Style, atom.Script, atom.Title, atom.Img:
+				return
+			case atom.Br:
+				b.WriteString("\n")
+				return
+			case atom.Hr:
+				b.WriteString("\n----------\n")
+				return
+			case atom.Li:
+				b.WriteString("\n- ")
+			case atom.Td, atom.Th:
+				if !atLineStart(&b) && !strings.HasSuffix(b.String(), " ") {
+					b.WriteString(" ")
+				}
+			}
+			if strings.Contains(strings.ReplaceAll(attr(n, "style"), " ", ""), "white-space:pre") {
+				pre = true
+			}
+		}
+
+		block := isBlock(n)
+		if block {
+			b.WriteString("\n")
+		}
+		start := b.Len()
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre)
+		}
+		if n.DataAtom == atom.A {
+			href := attr(n, "href")
+			label := strings.TrimSpace(b.String()[start:])
+			if href != "" && href != label && !strings.HasPrefix(href, "mailto:"+label) && !strings.HasPrefix(href, "tel:") {
+				fmt.Fprintf(&b, " (%s)", href)
+			}
+		}
+		if block {
+			b.WriteString("\n")
+		}
+	}
+	walk(doc, false)
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	text := blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n", nil
+}
+
+func isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.P, atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+		atom.Table, atom.Tr, atom.Ul, atom.Ol, atom.Blockquote:
+		return true
+	}
+	return false
+}
+
+func isTableRow(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Table, atom.Thead, atom.Tbody, atom.Tfoot, atom.Tr:
+		return true
+	}
+	return false
+}
+
+func atLineStart(b *strings.Builder) bool {
+	return b.Len() == 0 || strings.HasSuffix(b.String(), "\n")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package emails
+
+import "github.com/resend/resend-go/v3"
+
+// ResendSender sends through the Resend API.
+type ResendSender struct {
+	client *resend.Client
+}
+
+func NewResendSender(apiKey string) *ResendSender {
+	return &ResendSender{client: resend.NewClient(apiKey)}
+}
+
+func (s *ResendSender) Send(msg Message) error {
+	_, err := s.client.Emails.Send(resendRequest(msg))
+	return err
+}
+
+func (s *ResendSender) SendBatch(msgs []Message) error {
+	batch := make([]*resend.SendEmailRequest, 0, len(msgs))
+	for _, msg := range msgs {
+		batch = append(batch, resendRequest(msg))
+	}
+	_, err := s.client.Batch.Send(batch)
+	return err
+}
+
+func resendRequest(msg Message) *resend.SendEmailRequest {
+	return &resend.SendEmailRequest{
+		From:    msg.From,
+		To:      msg.To,
+		ReplyTo: msg.ReplyTo,
+		Subject: msg.Subject,
+		Html:    msg.HTML,
+		Text:    msg.Text,
+		Headers: msg.Headers,
+	}
+}
@@ -0,0 +1,117 @@
+package emails
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a rendered email ready to hand to a transport.
+type Message struct {
+	From    string
+	To      []string
+	ReplyTo string
+	Subject string
+	HTML    string
+	// Text is the plain-text alternative of HTML, for clients that don't render HTML.
+	Text string
+	// Headers are extra headers, such as List-Unsubscribe.
+	Headers map[string]string
+}
+
+// Sender is an email transport.
+type Sender interface {
+	Send(msg Message) error
+	// SendBatch sends several messages at once; it fails as a whole.
+	SendBatch(msgs []Message) error
+}
+
+var (
+	sender Sender
+	once   sync.Once
+)
+
+// InitEmailClient picks the transport from EMAIL_TRANSPORT: "resend" (RESEND_API_KEY),
+// "smtp" (SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD), "file" (writes each message
+// to EMAIL_SINK_DIR, tmp/emails by default) or "memory". Without EMAIL_TRANSPORT, Resend is
+// used when RESEND_API_KEY is set. Anything else stops the server from starting rather than
+// quietly keeping emails, which carry sign-in links and codes, on disk.
+func InitEmailClient() {
+	once.Do(func() {
+		transport := strings.ToLower(os.Getenv("EMAIL_TRANSPORT"))
+		if transport == "" {
+			if os.Getenv("RESEND_API_KEY") == "" {
+				log.Fatalf("Emails: Set RESEND_API_KEY, or choose a transport with EMAIL_TRANSPORT (use \"file\" for local development)\n")
+			}
+			transport = "resend"
+		}
+
+		switch transport {
+		case "resend":
+			sender = NewResendSender(os.Getenv("RESEND_API_KEY"))
+		case "smtp":
+			port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+			sender = &SMTPSender{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     port,
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+			}
+		case "memory":
+			sender = &MemorySender{}
+		case "file":
+			dir := os.Getenv("EMAIL_SINK_DIR")
+			if dir == "" {
+				dir = "tmp/emails"
+			}
+			sender = &FileSender{Dir: dir}
+		default:
+			log.Fatalf("Emails: Unknown EMAIL_TRANSPORT %q\n", transport)
+		}
+		log.Printf("Emails: Sending through %s\n", transport)
+	})
+}
+
+// SetSender replaces the transport, e.g. with a MemorySender in tests.
+func SetSender(s Sender) {
+	once.Do(func() {})
+	sender = s
+}
+
+func currentSender() (Sender, error) {
+	InitEmailClient()
+	if sender == nil {
+		return nil, fmt.Errorf("email transport not initialized")
+	}
+	return sender, nil
+}
+
+// send delivers one message through the configured transport.
+func send(msg Message) error {
+	s, err := currentSender()
+	if err != nil {
+		return err
+	}
+	return s.Send(msg)
+}
+
+// sendBatch delivers messages in batches of bulkBatch.
+func sendBatch(msgs []Message) error {
+	s, err := currentSender()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(msgs); i += bulkBatch {
+		end := i + bulkBatch
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		if err := s.SendBatch(msgs[i:end]); err != nil {
+			return fmt.Errorf("failed to send email batch starting at index %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package emails
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// FileSender is a development transport that writes each message to Dir as an .eml file,
+// which any mail client can open, instead of sending it.
+type FileSender struct {
+	Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+func (s *FileSender) Send(msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	to := "unknown"
+	if len(msg.To) > 0 {
+		to = unsafeFileChars.ReplaceAllString(msg.To[0], "_")
+	}
+	path := filepath.Join(s.Dir, fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), to))
+	if err := os.WriteFile(path, buildMIME(msg), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Emails: %q to %v written to %s\n", msg.Subject, msg.To, path)
+	return nil
+}
+
+func (s *FileSender) SendBatch(msgs []Message) error {
+	for _, msg := range msgs {
+		if err := s.Send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemorySender keeps messages in memory instead of sending them, for tests.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (s *MemorySender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func (s *MemorySender) SendBatch(msgs []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msgs...)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the messages sent so far.
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
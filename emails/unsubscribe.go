@@ -0,0 +1,150 @@
+package emails
+
+import (
+	"api/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sources of an opt-out.
+const (
+	OptOutLink     = "LINK"     // an unsubscribe link or List-Unsubscribe header in an email
+	OptOutSettings = "SETTINGS" // the user's notification settings
+)
+
+// ValidCategory reports whether category is one recipients can opt out of.
+func ValidCategory(category string) bool {
+	for _, c := range models.NotificationCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func unsubscribeSecret() []byte {
+	if secret := os.Getenv("UNSUBSCRIBE_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte("supersecretkey")
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UnsubscribeToken signs an address and category, so an unsubscribe link works without
+// logging in but can't be forged for someone else's address. It never expires: links in old
+// emails must keep working.
+func UnsubscribeToken(email, category string) string {
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte(normalizeEmail(email) + "\n" + category))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ValidUnsubscribeToken reports whether token was issued for email and category.
+func ValidUnsubscribeToken(email, category, token string) bool {
+	if !ValidCategory(category) {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(UnsubscribeToken(email, category)))
+}
+
+func unsubscribeQuery(email, category string) string {
+	return url.Values{
+		"email":    {normalizeEmail(email)},
+		"category": {category},
+		"token":    {UnsubscribeToken(email, category)},
+	}.Encode()
+}
+
+// UnsubscribePageURL is the frontend page an unsubscribe link in an email footer opens.
+func UnsubscribePageURL(email, category string) string {
+	base := strings.TrimRight(os.Getenv("FRONTEND_URL"), "/")
+	if base == "" {
+		base = "https://nedzl.com"
+	}
+	return base + "/unsubscribe?" + unsubscribeQuery(email, category)
+}
+
+// listUnsubscribeHeaders lets mail clients show their own unsubscribe button. With API_URL
+// set the header points at the API and advertises RFC 8058 one-click unsubscribe, which
+// Gmail and Yahoo require of bulk senders; otherwise it falls back to the frontend page.
+func listUnsubscribeHeaders(email, category string) map[string]string {
+	if api := strings.TrimRight(os.Getenv("API_URL"), "/"); api != "" {
+		return map[string]string{
+			"List-Unsubscribe":      "<" + api + "/unsubscribe?" + unsubscribeQuery(email, category) + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+	}
+	return map[string]string{"List-Unsubscribe": "<" + UnsubscribePageURL(email, category) + ">"}
+}
+
+// OptOut unsubscribes an address from a category. Unsubscribing twice is not an error.
+func OptOut(db *gorm.DB, email, category, source string) error {
+	optOut := models.NotificationOptOut{Email: normalizeEmail(email), Category: category, Source: source}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&optOut).Error
+}
+
+// OptIn resubscribes an address to a category.
+func OptIn(db *gorm.DB, email, category string) error {
+	return db.Where("email = ? AND category = ?", normalizeEmail(email), category).
+		Delete(&models.NotificationOptOut{}).Error
+}
+
+// CopyOptOuts carries an address's opt-outs over to a new address, when a user changes
+// their email.
+func CopyOptOuts(db *gorm.DB, from, to string) error {
+	from, to = normalizeEmail(from), normalizeEmail(to)
+	if from == to {
+		return nil
+	}
+	return db.Exec(`INSERT INTO notification_opt_outs (email, category, source, created_at)
+		SELECT ?, category, source, NOW() FROM notification_opt_outs WHERE email = ?
+		ON CONFLICT (email, category) DO NOTHING`, to, from).Error
+}
+
+// Subscribed reports whether an address still receives a category.
+func Subscribed(db *gorm.DB, email, category string) (bool, error) {
+	var count int64
+	err := db.Model(&models.NotificationOptOut{}).
+		Where("email = ? AND category = ?", normalizeEmail(email), category).Count(&count).Error
+	return count == 0, err
+}
+
+// Preferences returns an address's subscription to every category.
+func Preferences(db *gorm.DB, email string) (models.NotificationPreferences, error) {
+	var optedOut []string
+	err := db.Model(&models.NotificationOptOut{}).Where("email = ?", normalizeEmail(email)).Pluck("category", &optedOut).Error
+	if err != nil {
+		return models.NotificationPreferences{}, err
+	}
+	out := make(map[string]bool, len(optedOut))
+	for _, c := range optedOut {
+		out[c] = true
+	}
+	return models.NotificationPreferences{
+		Marketing:    !out[models.NotifyMarketing],
+		NewProducts:  !out[models.NotifyNewProducts],
+		PriceDrops:   !out[models.NotifyPriceDrops],
+		OrderUpdates: !out[models.NotifyOrderUpdates],
+	}, nil
+}
+
+// Subscribers is a query scope that drops rows whose address, in emailColumn, opted out of
+// category. Bulk senders apply it to their recipient query.
+func Subscribers(category, emailColumn string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("LOWER("+emailColumn+") NOT IN (SELECT email FROM notification_opt_outs WHERE category = ?)", category)
+	}
+}
@@ -94,7 +94,7 @@ func GetDashboardOverview(db *gorm.DB) echo.HandlerFunc {
 		if err := db.Model(&models.Products{}).Where("status = ? AND created_at BETWEEN ? AND ?", models.StatusRejected, startDate, now).Count(&flaggedProducts).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count flagged products", err)
 		}
-		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role = ?", startDate, now, models.RoleUser).Count(&totalUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role IN ?", startDate, now, models.MarketplaceRoles).Count(&totalUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count registered users", err)
 		}
 
@@ -119,7 +119,7 @@ func GetDashboardOverview(db *gorm.DB) echo.HandlerFunc {
 		if err := db.Model(&models.Products{}).Where("status = ? AND created_at BETWEEN ? AND ?", models.StatusRejected, prevStart, prevEnd).Count(&prevFlaggedProducts).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous flagged products", err)
 		}
-		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role = ?", prevStart, prevEnd, models.RoleUser).Count(&prevTotalUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role IN ?", prevStart, prevEnd, models.MarketplaceRoles).Count(&prevTotalUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous registered users", err)
 		}
 
@@ -141,7 +141,7 @@ func GetDashboardOverview(db *gorm.DB) echo.HandlerFunc {
 			var signups, sold int64
 
 			// Count user signups by month
-			if err := db.Model((&models.User{})).Where("EXTRACT(MONTH FROM created_at) = ? AND EXTRACT(YEAR FROM created_at) = ? AND role = ?", i, currentYear, models.RoleUser).Count(&signups).Error; err != nil {
+			if err := db.Model((&models.User{})).Where("EXTRACT(MONTH FROM created_at) = ? AND EXTRACT(YEAR FROM created_at) = ? AND role IN ?", i, currentYear, models.MarketplaceRoles).Count(&signups).Error; err != nil {
 				return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch monthly signups", err)
 			}
 
@@ -211,18 +211,18 @@ func GetUserDashboardOverview(db *gorm.DB) echo.HandlerFunc {
 		// userModel := db.Model(&models.User{})
 
 		// --- Current period queries (FIXED: All filtered by date range) ---
-		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role = ?", startDate, now, models.RoleUser).Count(&totalSellers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role IN ?", startDate, now, models.MarketplaceRoles).Count(&totalSellers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count total sellers", err)
 		}
 
 		// Count users by status created in this period
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserActive, startDate, now, models.RoleUser).Count(&activeSellers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserActive, startDate, now, models.MarketplaceRoles).Count(&activeSellers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count active sellers", err)
 		}
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserSuspended, startDate, now, models.RoleUser).Count(&suspendedSellers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserSuspended, startDate, now, models.MarketplaceRoles).Count(&suspendedSellers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count suspended users", err)
 		}
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserDeactivated, startDate, now, models.RoleUser).Count(&deactivatedUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserDeactivated, startDate, now, models.MarketplaceRoles).Count(&deactivatedUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count deactivated users", err)
 		}
 
@@ -234,16 +234,16 @@ func GetUserDashboardOverview(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		// --- Previous period for growth (now consistent) ---
-		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role = ?", prevStart, prevEnd, models.RoleUser).Count(&prevSellers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("created_at BETWEEN ? AND ? AND role IN ?", prevStart, prevEnd, models.MarketplaceRoles).Count(&prevSellers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous total sellers", err)
 		}
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserActive, prevStart, prevEnd, models.RoleUser).Count(&prevActiveUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserActive, prevStart, prevEnd, models.MarketplaceRoles).Count(&prevActiveUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous active sellers", err)
 		}
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserSuspended, prevStart, prevEnd, models.RoleUser).Count(&prevSuspendedUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserSuspended, prevStart, prevEnd, models.MarketplaceRoles).Count(&prevSuspendedUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous suspended users", err)
 		}
-		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role = ?", models.UserDeactivated, prevStart, prevEnd, models.RoleUser).Count(&prevDeactivatedUsers).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("status = ? AND created_at BETWEEN ? AND ? AND role IN ?", models.UserDeactivated, prevStart, prevEnd, models.MarketplaceRoles).Count(&prevDeactivatedUsers).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count previous deactivated users", err)
 		}
 
@@ -297,7 +297,7 @@ func GetDashboardUsers(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		// Only normal users
-		query = query.Where("role = ?", models.RoleUser)
+		query = query.Where("role IN ?", models.MarketplaceRoles)
 
 		// Count total before pagination
 		var total int64
@@ -410,7 +410,7 @@ func GetActiveProductsUsers(db *gorm.DB) echo.HandlerFunc {
 
 		totalPages := int(math.Ceil(float64(total) / float64(limit)))
 
-		if err := query.Where("role = ?", models.RoleUser).Find(&users).Error; err != nil {
+		if err := query.Where("role IN ?", models.MarketplaceRoles).Find(&users).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve users", err)
 
 		}
@@ -524,8 +524,8 @@ func GetAdminProducts(db *gorm.DB) echo.HandlerFunc {
 		if startDate != "" && endDate != "" {
 			query = query.Where("created_at BETWEEN  ? AND ?", startDate, endDate)
 		}
-		if minPrice != "" && maxPrice != "" {
-			query = query.Where("product_price BETWEEN  ? AND ?", minPrice, maxPrice)
+		if minKobo, maxKobo, ok := parsePriceRange(minPrice, maxPrice); ok {
+			query = query.Where("product_price BETWEEN ? AND ?", minKobo, maxKobo)
 		}
 		if keyword != "" {
 			query = query.Where("product_name ILIKE ? OR description ILIKE ?", "%"+keyword+"%", "%"+keyword+"%")
@@ -736,7 +736,8 @@ func SendNewsletter(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		var users []models.User
-		if err := db.Where("status = ?", models.UserActive).Find(&users).Error; err != nil {
+		if err := db.Scopes(emails.Subscribers(models.NotifyMarketing, "email")).
+			Where("status = ?", models.UserActive).Find(&users).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch users", err)
 		}
 
@@ -752,12 +753,17 @@ func SendNewsletter(db *gorm.DB) echo.HandlerFunc {
 			})
 		}
 
-		// Send in a goroutine to prevent blocking the admin client
-		go func(rec []emails.BulkEmailRecipient, subj, msg string) {
-			if err := emails.SendCustomNewsletter(rec, subj, msg); err != nil {
-				fmt.Printf("Error sending custom newsletter email: %v\n", err)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, batch := range emails.RecipientBatches(recipients) {
+				if _, err := emails.Queue(tx, emails.KindNewsletter, batch, req.Subject, req.Message); err != nil {
+					return err
+				}
 			}
-		}(recipients, req.Subject, req.Message)
+			return nil
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to queue newsletter", err)
+		}
 
 		return utils.ResponseSucess(c, http.StatusOK, fmt.Sprintf("Newsletter sending initiated for %d recipients", len(users)), nil)
 	}
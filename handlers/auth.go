@@ -3,31 +3,27 @@ package handlers
 import (
 	"api/emails"
 	"api/models"
+	"api/ratelimit"
+	"api/sessions"
 	"api/utils"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
-func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return []byte("supersecretkey")
-	}
-	return []byte(secret)
-}
-
 func generateVerificationToken() (string, string) {
 	raw := uuid.NewString()
 	hashed, _ := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
@@ -89,11 +85,6 @@ func Register(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
 		}
 
-		// Validate role
-		if !models.IsValidRole(req.Role) || req.Role == "" {
-			return utils.ResponseError(c, http.StatusBadRequest, "Invalid role. Allowed - ADMIN, USER", nil)
-		}
-
 		// Check if user exists
 		var existingUser models.User
 
@@ -144,7 +135,7 @@ func Register(db *gorm.DB) echo.HandlerFunc {
 		user := models.User{
 			UserName:         req.UserName,
 			Email:            req.Email,
-			Role:             req.Role,
+			Role:             models.RoleUser, // other roles are only given by an admin
 			PhoneNumber:      req.PhoneNumber,
 			Password:         string(hash),
 			EmailToken:       token,
@@ -154,10 +145,6 @@ func Register(db *gorm.DB) echo.HandlerFunc {
 			EmailVerified:    false,
 		}
 
-		if req.Role == "ADMIN" {
-			user.EmailVerified = true
-		}
-
 		// Handle student_id_card upload
 		file, err := c.FormFile("student_id_card")
 		if err == nil && file != nil {
@@ -187,31 +174,33 @@ func Register(db *gorm.DB) echo.HandlerFunc {
 			os.Remove(tempFilePath)
 		}
 
-		if err := db.Create(&user).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			_, err := emails.Queue(tx, emails.KindVerification, req.Email, req.UserName, token, expiryTime)
+			return err
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to create user", err)
 		}
 
-		// Claim any guest-listed products created prior to registration
-		go func(uID uuid.UUID, email, phone string) {
+		// Claim any guest-listed products created prior to registration. Those listed with the
+		// phone number are claimed once the user verifies it (VerifyPhone)
+		go func(uID uuid.UUID, email string) {
 			db.Model(&models.Products{}).
-				Where("is_guest_listing = ? AND (guest_email = ? OR (guest_phone = ? AND guest_phone != ''))", true, email, phone).
+				Where("is_guest_listing = ? AND guest_email = ?", true, email).
 				Updates(map[string]interface{}{
 					"user_id":          uID,
 					"is_guest_listing": false,
 				})
-		}(user.ID, user.Email, user.PhoneNumber)
+		}(user.ID, user.Email)
 
 		if referer.ID != uuid.Nil {
 			if err := db.Model(&models.User{}).Where("id = ?", referer.ID).UpdateColumn("referral_count", gorm.Expr("referral_count + ?", 1)).Error; err != nil {
 				return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update referral count", err)
 			}
 		}
-		if req.Role != "ADMIN" {
-			err = emails.SendVerificationMail(req.Email, req.UserName, token, expiryTime)
-			if err != nil {
-				return utils.ResponseError(c, http.StatusInternalServerError, "Failed to send verification email", err)
-			}
-		}
 
 		response := map[string]string{
 			"user_name":     user.UserName,
@@ -237,11 +226,24 @@ func Login(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
 		}
 
+		// Refuse accounts locked after repeated wrong passwords, before checking this one
+		lockedUntil, err := ratelimit.LoginLockedUntil(req.Email)
+		if err != nil {
+			log.Printf("Rate limit: Error checking login lockout: %v\n", err)
+		}
+		if !lockedUntil.IsZero() {
+			return loginLockedResponse(c, lockedUntil)
+		}
+
 		// check if user email exist in database
 
 		var user models.User
 
 		if err := db.Where("email =?", req.Email).First(&user).Error; err != nil {
+			// Unknown emails count as failures too, so lockouts don't reveal which accounts exist
+			if until := recordLoginFailure(req.Email); !until.IsZero() {
+				return loginLockedResponse(c, until)
+			}
 			// c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid login credentials"})
 			return utils.ResponseError(c, http.StatusUnauthorized, "Invalid login credential", err)
 		}
@@ -253,36 +255,36 @@ func Login(db *gorm.DB) echo.HandlerFunc {
 
 		// check if password matches existing one in database
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			if until := recordLoginFailure(req.Email); !until.IsZero() {
+				return loginLockedResponse(c, until)
+			}
 			// return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid login credentials"})
 			return utils.ResponseError(c, http.StatusUnauthorized, "Invalid login credentials", err)
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": user.ID.String(),
-			"role":    string(user.Role),
-			"exp":     time.Now().Add(24 * time.Hour).Unix(), // 24 hours
-		})
+		if err := ratelimit.LoginSucceeded(req.Email); err != nil {
+			log.Printf("Rate limit: Error clearing login failures: %v\n", err)
+		}
+		return loginResponse(c, db, user)
+	}
 
-		tokenString, _ := token.SignedString(getJWTSecret())
-
-		// return c.JSON(http.StatusOK, echo.Map{"message": "Login succesfully", "token": tokenString, "user": map[string]string{
-		// 	"user_name":    user.UserName,
-		// 	"email":        user.Email,
-		// 	"phone_number": user.PhoneNumber,
-		// 	"role":         string(user.Role),
-		// }})
-		return utils.ResponseSucess(c, http.StatusOK, "Login successfully", echo.Map{
-			"token": tokenString,
-			"user": map[string]string{
-				"user_name":      user.UserName,
-				"email":          user.Email,
-				"phone_number":   user.PhoneNumber,
-				"role":           string(user.Role),
-				"referral_count": fmt.Sprintf("%d", user.ReferralCount),
-			},
-		})
+}
+
+// recordLoginFailure counts a wrong password for email and returns when its lockout ends, or
+// the zero time if it is not locked.
+func recordLoginFailure(email string) time.Time {
+	until, err := ratelimit.LoginFailed(email)
+	if err != nil {
+		log.Printf("Rate limit: Error recording login failure: %v\n", err)
 	}
+	return until
+}
 
+func loginLockedResponse(c echo.Context, until time.Time) error {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	return utils.ResponseError(c, http.StatusTooManyRequests,
+		fmt.Sprintf("Too many failed login attempts. Try again in %s", time.Duration(retryAfter)*time.Second), nil)
 }
 
 func VerifyEmail(db *gorm.DB) echo.HandlerFunc {
@@ -316,15 +318,18 @@ func VerifyEmail(db *gorm.DB) echo.HandlerFunc {
 			// Update user
 			user.EmailToken = newToken
 			user.EmailTokenExpiry = &newExpiry
-			if err := db.Save(&user).Error; err != nil {
+			// Save the new token and send a new email
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Save(&user).Error; err != nil {
+					return err
+				}
+				_, err := emails.Queue(tx, emails.KindVerification, user.Email, user.UserName, newToken, newExpiry)
+				return err
+			})
+			if err != nil {
 				return utils.ResponseError(c, http.StatusInternalServerError, "Token expired, but failed to resend new one", err)
 			}
 
-			// Send new email
-			if err := emails.SendVerificationMail(user.Email, user.UserName, newToken, newExpiry); err != nil {
-				return utils.ResponseError(c, http.StatusInternalServerError, "Token expired, but failed to send new email", err)
-			}
-
 			return utils.ResponseSucess(c, http.StatusOK, "Your verification token has expired. A new verification link has been sent to your email.", nil)
 		}
 
@@ -364,11 +369,14 @@ func ForgotPassword(db *gorm.DB) echo.HandlerFunc {
 
 		user.PasswordResetTokenExpiry = &expiryTime
 
-		if err := db.Save(&user).Error; err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to verify email", err)
-
-		}
-		if err := emails.SendPasswordResetMail(user.Email, user.UserName, token, expiryTime); err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			_, err := emails.Queue(tx, emails.KindPasswordReset, user.Email, user.UserName, token, expiryTime)
+			return err
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to send password reset email", err)
 		}
 
@@ -408,12 +416,21 @@ func ResetPassword(db *gorm.DB) echo.HandlerFunc {
 
 		user.PasswordResetTokenExpiry = nil
 
-		if err := db.Save(&user).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			// Whoever knew the old password is signed out
+			if _, err := sessions.RevokeAll(tx, user.ID, models.SessionPasswordReset); err != nil {
+				return err
+			}
+			_, err := emails.Queue(tx, emails.KindPasswordResetSuccess, user.Email, user.UserName)
+			return err
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to reset password", err)
 		}
 
-		emails.SendPasswordResetSuccessMail(user.Email, user.UserName)
-
 		return utils.ResponseSucess(c, http.StatusOK, "Password reset successfully", nil)
 
 	}
@@ -570,27 +587,7 @@ func GoogleLogin(db *gorm.DB) echo.HandlerFunc {
 			}
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": user.ID.String(),
-			"role":    string(user.Role),
-			"exp":     time.Now().Add(24 * time.Hour).Unix(),
-		})
-
-		tokenString, err := token.SignedString(getJWTSecret())
-		if err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to generate token", err)
-		}
-
-		return utils.ResponseSucess(c, http.StatusOK, "Login successfully", echo.Map{
-			"token": tokenString,
-			"user": map[string]string{
-				"user_name":      user.UserName,
-				"email":          user.Email,
-				"phone_number":   user.PhoneNumber,
-				"role":           string(user.Role),
-				"referral_count": fmt.Sprintf("%d", user.ReferralCount),
-			},
-		})
+		return loginResponse(c, db, user)
 	}
 }
 
@@ -635,26 +632,6 @@ func FacebookLogin(db *gorm.DB) echo.HandlerFunc {
 			}
 		}
 
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id": user.ID.String(),
-			"role":    string(user.Role),
-			"exp":     time.Now().Add(24 * time.Hour).Unix(),
-		})
-
-		tokenString, err := token.SignedString(getJWTSecret())
-		if err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to generate token", err)
-		}
-
-		return utils.ResponseSucess(c, http.StatusOK, "Login successfully", echo.Map{
-			"token": tokenString,
-			"user": map[string]string{
-				"user_name":      user.UserName,
-				"email":          user.Email,
-				"phone_number":   user.PhoneNumber,
-				"role":           string(user.Role),
-				"referral_count": fmt.Sprintf("%d", user.ReferralCount),
-			},
-		})
+		return loginResponse(c, db, user)
 	}
 }
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"api/models"
+	"api/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxSlotRangeDays caps how many days of open slots one request can ask for.
+const maxSlotRangeDays = 31
+
+type AvailabilityWindowRequest struct {
+	Weekday   int    `json:"weekday"`    // 0 = Sunday … 6 = Saturday
+	StartTime string `json:"start_time"` // HH:MM, Lagos time
+	EndTime   string `json:"end_time"`
+}
+
+type SetAvailabilityRequest struct {
+	SlotMinutes int                         `json:"slot_minutes"`
+	Windows     []AvailabilityWindowRequest `json:"windows"`
+}
+
+// SetServiceAvailability replaces the weekly schedule of one of the artisan's services.
+func SetServiceAvailability(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req SetAvailabilityRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+
+		var service models.Products
+		if err := db.First(&service, "id = ? AND user_id = ?", c.Param("id"), userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Service not found", err)
+		}
+		if service.ProductType != "SERVICE" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Availability can only be set on services", nil)
+		}
+
+		windows := make([]models.AvailabilityWindow, 0, len(req.Windows))
+		for _, w := range req.Windows {
+			windows = append(windows, models.AvailabilityWindow{
+				Weekday:   w.Weekday,
+				StartTime: strings.TrimSpace(w.StartTime),
+				EndTime:   strings.TrimSpace(w.EndTime),
+			})
+		}
+		if err := utils.ValidateSchedule(req.SlotMinutes, windows); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid availability", err)
+		}
+
+		schedule := models.ServiceSchedule{ServiceID: service.ID, ArtisanID: userID, SlotMinutes: req.SlotMinutes}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "service_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"slot_minutes", "updated_at"}),
+			}).Create(&schedule).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("service_id = ?", service.ID).First(&schedule).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Where("schedule_id = ?", schedule.ID).Delete(&models.AvailabilityWindow{}).Error; err != nil {
+				return err
+			}
+			for i := range windows {
+				windows[i].ScheduleID = schedule.ID
+			}
+			if len(windows) > 0 {
+				if err := tx.Create(&windows).Error; err != nil {
+					return err
+				}
+			}
+			schedule.Windows = windows
+			return nil
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to save availability", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Availability saved", schedule)
+	}
+}
+
+// GetServiceAvailability returns a service's weekly schedule and the artisan's upcoming blackout dates.
+func GetServiceAvailability(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var schedule models.ServiceSchedule
+		if err := db.Preload("Windows", func(tx *gorm.DB) *gorm.DB { return tx.Order("weekday ASC, start_time ASC") }).
+			First(&schedule, "service_id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "This service has no availability set", err)
+		}
+
+		var blackouts []models.BlackoutDate
+		db.Where("artisan_id = ? AND date >= ?", schedule.ArtisanID, time.Now().In(utils.Lagos).Format("2006-01-02")).
+			Order("date ASC").Find(&blackouts)
+
+		return utils.ResponseSucess(c, http.StatusOK, "Availability fetched successfully", echo.Map{
+			"schedule":       schedule,
+			"blackout_dates": blackouts,
+		})
+	}
+}
+
+// GetServiceSlots lists a service's open slots between the from and to dates (YYYY-MM-DD,
+// inclusive). Defaults to the next seven days.
+func GetServiceSlots(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var schedule models.ServiceSchedule
+		if err := db.Preload("Windows").First(&schedule, "service_id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "This service has no availability set", err)
+		}
+
+		from := utils.LagosDay(time.Now())
+		if v := c.QueryParam("from"); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, utils.Lagos)
+			if err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD", err)
+			}
+			from = t
+		}
+		to := from.AddDate(0, 0, 6)
+		if v := c.QueryParam("to"); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, utils.Lagos)
+			if err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD", err)
+			}
+			to = t
+		}
+		if to.Before(from) || to.Sub(from) >= maxSlotRangeDays*24*time.Hour {
+			return utils.ResponseError(c, http.StatusBadRequest, "Date range must be between 1 and 31 days", nil)
+		}
+
+		slots, err := utils.OpenSlots(db, schedule, from, to)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to compute open slots", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Open slots fetched successfully", echo.Map{
+			"slot_minutes": schedule.SlotMinutes,
+			"slots":        slots,
+		})
+	}
+}
+
+type BlackoutDateRequest struct {
+	Date   string `json:"date"` // YYYY-MM-DD
+	Reason string `json:"reason"`
+}
+
+func GetBlackoutDates(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var blackouts []models.BlackoutDate
+		if err := db.Where("artisan_id = ? AND date >= ?", userID, time.Now().In(utils.Lagos).Format("2006-01-02")).
+			Order("date ASC").Find(&blackouts).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch blackout dates", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"data": blackouts,
+		})
+	}
+}
+
+// AddBlackoutDate marks a day on which the artisan takes no bookings. Bookings already made
+// for that day are kept.
+func AddBlackoutDate(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req BlackoutDateRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+		day, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(req.Date), utils.Lagos)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD", err)
+		}
+		if day.Format("2006-01-02") < time.Now().In(utils.Lagos).Format("2006-01-02") {
+			return utils.ResponseError(c, http.StatusBadRequest, "Blackout dates cannot be in the past", nil)
+		}
+
+		blackout := models.BlackoutDate{ArtisanID: userID, Date: day.Format("2006-01-02"), Reason: req.Reason}
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "artisan_id"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason"}),
+		}).Create(&blackout).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to save blackout date", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Blackout date saved", blackout)
+	}
+}
+
+func DeleteBlackoutDate(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		result := db.Where("id = ? AND artisan_id = ?", c.Param("id"), userID).Delete(&models.BlackoutDate{})
+		if result.Error != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to delete blackout date", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return utils.ResponseError(c, http.StatusNotFound, "Blackout date not found", nil)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Blackout date deleted", nil)
+	}
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"api/ledger"
+	"api/models"
+	"api/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type AddCartItemRequest struct {
+	ProductID uuid.UUID       `json:"product_id"`
+	Quantity  int             `json:"quantity"`
+	SubMenus  json.RawMessage `json:"sub_menus"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type CheckoutCartRequest struct {
+	CustomerName    string       `json:"customer_name"`
+	CustomerPhone   string       `json:"customer_phone"`
+	DeliveryAddress string       `json:"delivery_address"`
+	TotalAmount     models.Money `json:"total_amount"`
+	CallbackURL     string       `json:"callback_url"`
+}
+
+type cartLineResponse struct {
+	ItemID      uuid.UUID              `json:"item_id"`
+	ProductID   uuid.UUID              `json:"product_id"`
+	ProductName string                 `json:"product_name"`
+	Quantity    int                    `json:"quantity"`
+	SubMenus    []models.SubMenuOption `json:"sub_menus"`
+	UnitPrice   models.Money           `json:"unit_price"`
+	LineTotal   models.Money           `json:"line_total"`
+}
+
+type cartVendorResponse struct {
+	VendorID    uuid.UUID          `json:"vendor_id"`
+	Items       []cartLineResponse `json:"items"`
+	MealPrice   models.Money       `json:"meal_price"`
+	DeliveryFee models.Money       `json:"delivery_fee"`
+	Total       models.Money       `json:"total"`
+}
+
+const cartMaxQuantity = 50
+
+// normalizedSubMenus returns the selected option names as a case-insensitive key and the
+// JSON stored on the cart item, so adding the same selection again merges into one line.
+func normalizedSubMenus(price utils.FoodOrderPrice) (string, datatypes.JSON) {
+	names := make([]string, 0, len(price.Options))
+	for _, o := range price.Options {
+		names = append(names, o.Name)
+	}
+	raw, _ := json.Marshal(names)
+	return strings.ToLower(string(raw)), datatypes.JSON(raw)
+}
+
+func loadCart(db *gorm.DB, userID uuid.UUID) ([]models.CartItem, error) {
+	var items []models.CartItem
+	err := db.Preload("Product").Where("user_id = ?", userID).Order("created_at ASC").Find(&items).Error
+	return items, err
+}
+
+func cartSummary(groups []utils.VendorSubOrder) []cartVendorResponse {
+	vendors := make([]cartVendorResponse, 0, len(groups))
+	for _, g := range groups {
+		v := cartVendorResponse{VendorID: g.VendorID, MealPrice: g.MealPrice, DeliveryFee: g.DeliveryFee, Total: g.Total}
+		for _, l := range g.Lines {
+			v.Items = append(v.Items, cartLineResponse{
+				ItemID:      l.Item.ID,
+				ProductID:   l.Item.ProductID,
+				ProductName: l.Item.Product.Name,
+				Quantity:    l.Item.Quantity,
+				SubMenus:    l.Price.Options,
+				UnitPrice:   l.Price.MealPrice,
+				LineTotal:   l.LineTotal,
+			})
+		}
+		vendors = append(vendors, v)
+	}
+	return vendors
+}
+
+func GetCart(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		items, err := loadCart(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch cart", err)
+		}
+
+		response := echo.Map{"items": items, "vendors": []cartVendorResponse{}, "total_amount": models.NGN(0)}
+		groups, total, err := utils.PriceFoodCart(db, items)
+		if err != nil {
+			// Keep the cart visible so the user can fix the item that no longer prices
+			response["pricing_error"] = err.Error()
+			var stale *utils.StaleCartError
+			if errors.As(err, &stale) {
+				response["stale_items"] = stale.Items
+			}
+		} else {
+			response["vendors"] = cartSummary(groups)
+			response["total_amount"] = total
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Cart fetched successfully", response)
+	}
+}
+
+func AddCartItem(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req AddCartItemRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request payload", err)
+		}
+		if req.ProductID == uuid.Nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Product ID is required", nil)
+		}
+		if req.Quantity == 0 {
+			req.Quantity = 1
+		}
+		if req.Quantity < 1 || req.Quantity > cartMaxQuantity {
+			return utils.ResponseError(c, http.StatusBadRequest, fmt.Sprintf("Quantity must be between 1 and %d", cartMaxQuantity), nil)
+		}
+
+		var product models.Products
+		if err := db.First(&product, "id = ? AND is_deleted_by_user = ?", req.ProductID, false).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Food product not found", err)
+		}
+		if err := utils.CheckFoodProductOrderable(product); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "This product cannot be added to the cart", err)
+		}
+		if product.UserID != nil && *product.UserID == userID {
+			return utils.ResponseError(c, http.StatusBadRequest, "You cannot order your own product", nil)
+		}
+
+		price, err := utils.PriceFoodOrder(product, req.SubMenus)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid sub menus", err)
+		}
+		key, subMenus := normalizedSubMenus(price)
+
+		var item models.CartItem
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var existing []models.CartItem
+			if err := tx.Where("user_id = ? AND product_id = ?", userID, product.ID).Find(&existing).Error; err != nil {
+				return err
+			}
+			for _, e := range existing {
+				if strings.ToLower(string(e.SubMenus)) == key {
+					item = e
+					item.Quantity += req.Quantity
+					if item.Quantity > cartMaxQuantity {
+						item.Quantity = cartMaxQuantity
+					}
+					return tx.Model(&item).Update("quantity", item.Quantity).Error
+				}
+			}
+
+			item = models.CartItem{UserID: userID, ProductID: product.ID, Quantity: req.Quantity, SubMenus: subMenus}
+			return tx.Create(&item).Error
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to add item to cart", err)
+		}
+
+		item.Product = product
+		return utils.ResponseSucess(c, http.StatusCreated, "Item added to cart", item)
+	}
+}
+
+func UpdateCartItem(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		id := c.Param("id")
+
+		var req UpdateCartItemRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request payload", err)
+		}
+		if req.Quantity < 0 || req.Quantity > cartMaxQuantity {
+			return utils.ResponseError(c, http.StatusBadRequest, fmt.Sprintf("Quantity must be between 0 and %d", cartMaxQuantity), nil)
+		}
+
+		var item models.CartItem
+		if err := db.First(&item, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Cart item not found", err)
+		}
+
+		if req.Quantity == 0 {
+			if err := db.Delete(&item).Error; err != nil {
+				return utils.ResponseError(c, http.StatusInternalServerError, "Failed to remove cart item", err)
+			}
+			return utils.ResponseSucess(c, http.StatusOK, "Item removed from cart", nil)
+		}
+
+		if err := db.Model(&item).Update("quantity", req.Quantity).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update cart item", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Cart item updated", item)
+	}
+}
+
+func RemoveCartItem(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		id := c.Param("id")
+
+		result := db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.CartItem{})
+		if result.Error != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to remove cart item", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return utils.ResponseError(c, http.StatusNotFound, "Cart item not found", nil)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Item removed from cart", nil)
+	}
+}
+
+func ClearCart(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		if err := db.Where("user_id = ?", userID).Delete(&models.CartItem{}).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to clear cart", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Cart cleared", nil)
+	}
+}
+
+// CheckoutCart turns the cart into one food order per vendor, all paid through a single
+// Paystack transaction whose reference is shared by the checkout and its orders.
+func CheckoutCart(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req CheckoutCartRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request payload", err)
+		}
+		if req.CustomerPhone == "" || req.DeliveryAddress == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Customer phone and delivery address are required", nil)
+		}
+
+		items, err := loadCart(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch cart", err)
+		}
+		if len(items) == 0 {
+			return utils.ResponseError(c, http.StatusBadRequest, "Your cart is empty", nil)
+		}
+
+		groups, total, err := utils.PriceFoodCart(db, items)
+		var stale *utils.StaleCartError
+		if errors.As(err, &stale) {
+			return c.JSON(http.StatusConflict, utils.ApiResponse{
+				Success: false,
+				Message: "Some items in your cart are no longer available, please remove them",
+				Error:   err.Error(),
+				Data:    echo.Map{"stale_items": stale.Items},
+			})
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Unable to price your cart", err)
+		}
+		if !req.TotalAmount.IsZero() && req.TotalAmount.Kobo != total.Kobo {
+			return c.JSON(http.StatusConflict, utils.ApiResponse{
+				Success: false,
+				Message: fmt.Sprintf("Cart total has changed to ₦%s, please review your order", total.Naira()),
+				Error:   fmt.Sprintf("client total %s does not match server total %s", req.TotalAmount, total),
+				Data:    echo.Map{"total_amount": total, "vendors": cartSummary(groups)},
+			})
+		}
+
+		var buyer models.User
+		db.First(&buyer, "id = ?", userID)
+
+		customerName := req.CustomerName
+		if customerName == "" {
+			customerName = buyer.UserName
+		}
+		customerEmail := buyer.Email
+		if customerEmail == "" {
+			customerEmail = "customer@nedzl.com"
+		}
+
+		stamp := time.Now().UnixNano() / 1e6
+		reference := fmt.Sprintf("NDZ-CO-%d", stamp)
+
+		callbackURL := req.CallbackURL
+		if callbackURL == "" {
+			callbackURL = fmt.Sprintf("%s/dashboard?tab=my_orders", utils.GetFrontendBaseURL(c))
+		}
+		checkoutURL, err := utils.InitializePaystackTransaction(customerEmail, total, reference, callbackURL)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadGateway, "Failed to start payment", err)
+		}
+
+		status := "PAID"
+		paymentStatus := "SUCCESS"
+		if checkoutURL != "" {
+			status = "PENDING"
+			paymentStatus = "PENDING"
+		}
+
+		checkout := models.FoodCheckout{
+			UserID:        userID,
+			Reference:     reference,
+			TotalAmount:   total,
+			PaymentStatus: paymentStatus,
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&checkout).Error; err != nil {
+				return err
+			}
+
+			for i, g := range groups {
+				first := g.Lines[0]
+				order := models.FoodOrder{
+					OrderNumber:      fmt.Sprintf("NDZ-FD-%d-%d", stamp, i+1),
+					UserID:           userID,
+					VendorID:         g.VendorID,
+					ProductID:        first.Item.ProductID,
+					SubMenus:         datatypes.JSON(first.Price.SubMenusJSON()),
+					CheckoutID:       &checkout.ID,
+					MealPrice:        g.MealPrice,
+					DeliveryFee:      g.DeliveryFee,
+					TotalAmount:      g.Total,
+					PlatformFee:      g.PlatformFee,
+					VendorPayout:     g.VendorPayout,
+					CommissionRuleID: first.CommissionRuleID,
+					CustomerName:     customerName,
+					CustomerPhone:    req.CustomerPhone,
+					DeliveryAddress:  req.DeliveryAddress,
+					PaymentReference: reference,
+					Status:           status,
+					PaymentStatus:    paymentStatus,
+				}
+				for _, l := range g.Lines {
+					order.Items = append(order.Items, models.FoodOrderItem{
+						ProductID:        l.Item.ProductID,
+						Quantity:         l.Item.Quantity,
+						SubMenus:         datatypes.JSON(l.Price.SubMenusJSON()),
+						UnitPrice:        l.Price.MealPrice,
+						LineTotal:        l.LineTotal,
+						PlatformFee:      l.PlatformFee,
+						CommissionRuleID: l.CommissionRuleID,
+					})
+				}
+				if err := tx.Create(&order).Error; err != nil {
+					return err
+				}
+				if err := utils.RecordFoodOrderPlaced(tx, order, models.ActorCustomer, &userID); err != nil {
+					return err
+				}
+				// Only in payments dev mode is there no checkout; the orders are then already paid
+				if order.PaymentStatus == "SUCCESS" {
+					if err := ledger.RecordFoodOrderCharge(tx, order); err != nil {
+						return err
+					}
+					if err := notifyVendorOfPaidFoodOrder(tx, order.ID); err != nil {
+						return err
+					}
+				}
+				checkout.Orders = append(checkout.Orders, order)
+			}
+
+			itemIDs := make([]uuid.UUID, 0, len(items))
+			for _, item := range items {
+				itemIDs = append(itemIDs, item.ID)
+			}
+			return tx.Where("id IN ? AND user_id = ?", itemIDs, userID).Delete(&models.CartItem{}).Error
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to place your order", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Checkout created successfully", echo.Map{
+			"checkout":     checkout,
+			"checkout_url": checkoutURL,
+		})
+	}
+}
+
+func GetUserFoodCheckouts(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var checkouts []models.FoodCheckout
+		if err := db.Preload("Orders.Items.Product").Preload("Orders.Vendor").
+			Where("user_id = ?", userID).Order("created_at desc").Find(&checkouts).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch checkouts", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Checkouts fetched successfully", checkouts)
+	}
+}
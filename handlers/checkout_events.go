@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"api/db"
+	"api/models"
+	"api/utils"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockCheckout loads the cart checkout that owns reference and its food orders, locking all rows.
+func lockCheckout(tx *gorm.DB, reference string) (*models.FoodCheckout, error) {
+	var checkout models.FoodCheckout
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", reference).First(&checkout).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("checkout_id = ?", checkout.ID).
+		Order("order_number ASC").Find(&checkout.Orders).Error; err != nil {
+		return nil, err
+	}
+	return &checkout, nil
+}
+
+// applyCheckoutChargeSuccess marks every vendor order in the checkout as paid and moves each
+// vendor's share into that vendor's escrow, so releases and payouts stay per vendor. Orders the
+// customer cancelled while the payment was pending are refunded instead.
+func applyCheckoutChargeSuccess(tx *gorm.DB, checkout *models.FoodCheckout, paid models.Money) (paystackEventOutcome, error) {
+	if checkout.PaymentStatus == "SUCCESS" {
+		return processedOutcome(fmt.Sprintf("Checkout %s already marked as paid", checkout.Reference)), nil
+	}
+	if checkout.PaymentStatus == "REFUNDED" {
+		return ignoredOutcome(fmt.Sprintf("Checkout %s was refunded; charge ignored", checkout.Reference)), nil
+	}
+	if reason := paidShortfall(paid, checkout.TotalAmount); reason != "" {
+		return failedOutcome(fmt.Sprintf("%s for checkout %s", reason, checkout.Reference)), nil
+	}
+
+	if err := tx.Model(checkout).Update("payment_status", "SUCCESS").Error; err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	var paidOrders, movedOrders []uuid.UUID
+	var refunds []func()
+	for i := range checkout.Orders {
+		order := &checkout.Orders[i]
+		if order.PaymentStatus == "SUCCESS" {
+			continue
+		}
+		transitioned, err := markFoodOrderPaid(tx, order)
+		if err != nil {
+			return paystackEventOutcome{}, err
+		}
+		if order.Status == models.FoodOrderCancelled {
+			// Cancelled before the payment landed: give that vendor's share straight back
+			refund, err := utils.RequestFoodOrderRefund(tx, order, "Order was cancelled before payment completed", models.ActorSystem, nil)
+			if err != nil {
+				return paystackEventOutcome{}, err
+			}
+			refunds = append(refunds, func() { utils.ProcessRefund(db.DB, refund.ID) })
+			continue
+		}
+		paidOrders = append(paidOrders, order.ID)
+		if transitioned {
+			movedOrders = append(movedOrders, order.ID)
+		}
+	}
+
+	for _, id := range paidOrders {
+		if err := notifyVendorOfPaidFoodOrder(tx, id); err != nil {
+			return paystackEventOutcome{}, err
+		}
+	}
+	for _, id := range movedOrders {
+		if err := utils.NotifyFoodOrderStatus(tx, id, ""); err != nil {
+			return paystackEventOutcome{}, err
+		}
+	}
+	outcome := processedOutcome(fmt.Sprintf("Checkout %s paid (%d vendor orders)", checkout.Reference, len(paidOrders)))
+	if len(refunds) > 0 {
+		outcome.note = fmt.Sprintf("Checkout %s paid (%d vendor orders); %d cancelled before payment, refunds requested",
+			checkout.Reference, len(paidOrders), len(refunds))
+		outcome.afterCommit = refunds
+	}
+	return outcome, nil
+}
+
+func applyCheckoutChargeFailed(tx *gorm.DB, checkout *models.FoodCheckout, reason string) (paystackEventOutcome, error) {
+	if checkout.PaymentStatus != "PENDING" {
+		return ignoredOutcome(fmt.Sprintf("Checkout %s payment is %s; failed charge ignored", checkout.Reference, checkout.PaymentStatus)), nil
+	}
+
+	if err := tx.Model(checkout).Update("payment_status", "FAILED").Error; err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if err := tx.Model(&models.FoodOrder{}).Where("checkout_id = ? AND payment_status = ?", checkout.ID, "PENDING").
+		Update("payment_status", "FAILED").Error; err != nil {
+		return paystackEventOutcome{}, err
+	}
+	return processedOutcome(fmt.Sprintf("Checkout %s charge failed: %s", checkout.Reference, reason)), nil
+}
+
+// applyCheckoutRefund refunds every vendor order in the checkout that is not refunded yet.
+// A refund smaller than what remains cannot be attributed to a vendor and is left for review.
+func applyCheckoutRefund(tx *gorm.DB, checkout *models.FoodCheckout, refunded models.Money) (paystackEventOutcome, error) {
+	outstanding := models.NGN(0)
+	var pending []*models.FoodOrder
+	for i := range checkout.Orders {
+		order := &checkout.Orders[i]
+		if order.PaymentStatus == "REFUNDED" {
+			continue
+		}
+		outstanding = outstanding.Add(order.TotalAmount)
+		pending = append(pending, order)
+	}
+
+	if len(pending) == 0 {
+		return processedOutcome(fmt.Sprintf("Checkout %s already refunded", checkout.Reference)), nil
+	}
+	if refunded.IsPositive() && refunded.Kobo < outstanding.Kobo {
+		return failedOutcome(fmt.Sprintf("Partial refund of %d kobo on checkout %s (%d kobo outstanding) needs manual reconciliation",
+			refunded.Kobo, checkout.Reference, outstanding.Kobo)), nil
+	}
+
+	for _, order := range pending {
+		transitioned, err := utils.MarkFoodOrderRefunded(tx, order, "Refund processed by Paystack")
+		if err != nil {
+			return paystackEventOutcome{}, err
+		}
+		if transitioned {
+			if err := utils.NotifyFoodOrderStatus(tx, order.ID, ""); err != nil {
+				return paystackEventOutcome{}, err
+			}
+		}
+	}
+	if err := tx.Model(checkout).Update("payment_status", "REFUNDED").Error; err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	return processedOutcome(fmt.Sprintf("Checkout %s refunded (%d vendor orders)", checkout.Reference, len(pending))), nil
+}
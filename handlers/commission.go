@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"api/models"
+	"api/utils"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type CommissionRuleRequest struct {
+	Name         string       `json:"name"`
+	ProductType  string       `json:"product_type"`
+	CategoryName string       `json:"category_name"`
+	VendorID     *uuid.UUID   `json:"vendor_id"`
+	Percent      float64      `json:"percent"`
+	FlatFee      models.Money `json:"flat_fee"`
+	MinFee       models.Money `json:"min_fee"`
+	MaxFee       models.Money `json:"max_fee"`
+	StartsAt     *time.Time   `json:"starts_at"`
+	EndsAt       *time.Time   `json:"ends_at"`
+	Priority     int          `json:"priority"`
+	IsActive     *bool        `json:"is_active"`
+}
+
+func (r CommissionRuleRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch r.ProductType {
+	case "", "MARKET", "FOOD", "SERVICE":
+	default:
+		return fmt.Errorf("product_type must be MARKET, FOOD, SERVICE or empty")
+	}
+	if r.Percent < 0 || r.Percent > 100 {
+		return fmt.Errorf("percent must be between 0 and 100")
+	}
+	if r.FlatFee.Kobo < 0 || r.MinFee.Kobo < 0 || r.MaxFee.Kobo < 0 {
+		return fmt.Errorf("fees cannot be negative")
+	}
+	if r.MaxFee.IsPositive() && r.MinFee.Kobo > r.MaxFee.Kobo {
+		return fmt.Errorf("min_fee cannot exceed max_fee")
+	}
+	if r.StartsAt != nil && r.EndsAt != nil && !r.EndsAt.After(*r.StartsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+func (r CommissionRuleRequest) apply(rule *models.CommissionRule) {
+	rule.Name = strings.TrimSpace(r.Name)
+	rule.ProductType = r.ProductType
+	rule.CategoryName = strings.TrimSpace(r.CategoryName)
+	rule.VendorID = r.VendorID
+	rule.Percent = r.Percent
+	rule.FlatFee = r.FlatFee
+	rule.MinFee = r.MinFee
+	rule.MaxFee = r.MaxFee
+	rule.StartsAt = r.StartsAt
+	rule.EndsAt = r.EndsAt
+	rule.Priority = r.Priority
+	if r.IsActive != nil {
+		rule.IsActive = *r.IsActive
+	}
+}
+
+func GetCommissionRules(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.CommissionRule{})
+
+		if productType := c.QueryParam("product_type"); productType != "" {
+			query = query.Where("product_type = ?", productType)
+		}
+		if vendorID := c.QueryParam("vendor_id"); vendorID != "" {
+			query = query.Where("vendor_id = ?", vendorID)
+		}
+		if active := c.QueryParam("is_active"); active != "" {
+			query = query.Where("is_active = ?", active == "true")
+		}
+
+		var rules []models.CommissionRule
+		if err := query.Order("created_at DESC").Find(&rules).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve commission rules", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Commission rules retrieved successfully", rules)
+	}
+}
+
+func CreateCommissionRule(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req CommissionRuleRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+		if err := req.validate(); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, err.Error(), err)
+		}
+
+		rule := models.CommissionRule{IsActive: true}
+		req.apply(&rule)
+
+		if err := db.Create(&rule).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to create commission rule", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Commission rule created successfully", rule)
+	}
+}
+
+func UpdateCommissionRule(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var rule models.CommissionRule
+		if err := db.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Commission rule not found", err)
+		}
+
+		var req CommissionRuleRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+		if err := req.validate(); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, err.Error(), err)
+		}
+
+		req.apply(&rule)
+
+		if err := db.Save(&rule).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update commission rule", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Commission rule updated successfully", rule)
+	}
+}
+
+func DeleteCommissionRule(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var rule models.CommissionRule
+		if err := db.First(&rule, "id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Commission rule not found", err)
+		}
+
+		if err := db.Delete(&rule).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to delete commission rule", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Commission rule deleted successfully", nil)
+	}
+}
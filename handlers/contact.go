@@ -4,7 +4,6 @@ import (
 	"api/emails"
 	"api/models"
 	"api/utils"
-	"fmt"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -21,15 +20,17 @@ func Contact(db *gorm.DB) echo.HandlerFunc {
 
 		}
 
-		if err := db.Create(&contact).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&contact).Error; err != nil {
+				return err
+			}
+			_, err := emails.Queue(tx, emails.KindContact, contact.FirstName, contact.LastName, contact.Email, contact.PhoneNumber, contact.Message)
+			return err
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to create a contact mail", err)
 		}
 
-		if err := emails.SendContactEmail(contact.FirstName, contact.LastName, contact.Email, contact.PhoneNumber, contact.Message); err != nil {
-			// We log the error but don't fail the request since the contact was saved to DB
-			fmt.Printf("❌ Failed to send contact email: %v\n", err)
-		}
-
 		return utils.ResponseSucess(c, http.StatusOK, "Contact mail created successfully", nil)
 	}
 
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"api/models"
+	"api/notifications"
+	"api/utils"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxMessageImages caps how many images can be attached to one message.
+const maxMessageImages = 5
+
+const (
+	conversationBuyer  = "BUYER"
+	conversationSeller = "SELLER"
+)
+
+// loadConversation fetches a conversation the user is part of, with both participants.
+func loadConversation(db *gorm.DB, id string, userID uuid.UUID) (models.Conversation, error) {
+	var conversation models.Conversation
+	err := db.Preload("Buyer").Preload("Seller").
+		First(&conversation, "id = ? AND (buyer_id = ? OR seller_id = ?)", id, userID, userID).Error
+	return conversation, err
+}
+
+// unreadMessages selects the messages sent to the user after they last read their side of
+// the conversation.
+func unreadMessages(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	return db.Table("conversation_messages AS m").
+		Joins("JOIN conversations c ON c.id = m.conversation_id").
+		Where("m.sender_id <> ?", userID).
+		Where("(c.buyer_id = ? AND m.created_at > COALESCE(c.buyer_last_read_at, '-infinity')) OR "+
+			"(c.seller_id = ? AND m.created_at > COALESCE(c.seller_last_read_at, '-infinity'))", userID, userID)
+}
+
+func participant(u models.User) models.ConversationParticipant {
+	return models.ConversationParticipant{ID: u.ID, UserName: u.UserName, ImageUrl: u.ImageUrl, IsVerified: u.IsVerified}
+}
+
+// summarizeConversations builds the inbox entries for conversations loaded with their
+// product and participants.
+func summarizeConversations(db *gorm.DB, userID uuid.UUID, conversations []models.Conversation) ([]models.ConversationSummary, error) {
+	summaries := make([]models.ConversationSummary, 0, len(conversations))
+	if len(conversations) == 0 {
+		return summaries, nil
+	}
+
+	ids := make([]uuid.UUID, len(conversations))
+	for i, conv := range conversations {
+		ids[i] = conv.ID
+	}
+
+	var counts []struct {
+		ConversationID uuid.UUID
+		Unread         int64
+	}
+	if err := unreadMessages(db, userID).Where("m.conversation_id IN ?", ids).
+		Select("m.conversation_id, COUNT(*) AS unread").Group("m.conversation_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	unread := make(map[uuid.UUID]int64, len(counts))
+	for _, row := range counts {
+		unread[row.ConversationID] = row.Unread
+	}
+
+	var latest []models.ConversationMessage
+	if err := db.Raw("SELECT DISTINCT ON (conversation_id) * FROM conversation_messages WHERE conversation_id IN ? ORDER BY conversation_id, created_at DESC", ids).
+		Scan(&latest).Error; err != nil {
+		return nil, err
+	}
+	lastMessage := make(map[uuid.UUID]*models.ConversationMessage, len(latest))
+	for i := range latest {
+		lastMessage[latest[i].ConversationID] = &latest[i]
+	}
+
+	for _, conv := range conversations {
+		role, counterpart := conversationBuyer, conv.Seller
+		if conv.SellerID == userID {
+			role, counterpart = conversationSeller, conv.Buyer
+		}
+		summaries = append(summaries, models.ConversationSummary{
+			ID:   conv.ID,
+			Role: role,
+			Product: models.ConversationProduct{
+				ID:           conv.Product.ID,
+				Name:         conv.Product.Name,
+				ProductPrice: conv.Product.ProductPrice,
+				ImageUrls:    conv.Product.ImageUrls,
+				Status:       conv.Product.Status,
+			},
+			Counterpart:   participant(counterpart),
+			LastMessage:   lastMessage[conv.ID],
+			Unread:        unread[conv.ID],
+			LastMessageAt: conv.LastMessageAt,
+			CreatedAt:     conv.CreatedAt,
+		})
+	}
+	return summaries, nil
+}
+
+// StartConversation opens the buyer's conversation with the seller of a product, or returns
+// the one they already have.
+func StartConversation(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		buyerID := c.Get("user_id").(uuid.UUID)
+		productID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid product ID", err)
+		}
+
+		var product models.Products
+		if err := db.First(&product, "id = ? AND is_deleted_by_user = ?", productID, false).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Product not found", err)
+		}
+		if product.UserID == nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "This listing has no seller account to message yet", nil)
+		}
+		if *product.UserID == buyerID {
+			return utils.ResponseError(c, http.StatusBadRequest, "You cannot message yourself about your own listing", nil)
+		}
+
+		conversation := models.Conversation{ProductID: product.ID, BuyerID: buyerID, SellerID: *product.UserID}
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "product_id"}, {Name: "buyer_id"}},
+			DoNothing: true,
+		}).Create(&conversation).Error
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to start conversation", err)
+		}
+
+		var conversations []models.Conversation
+		if err := db.Preload("Product").Preload("Buyer").Preload("Seller").
+			Where("product_id = ? AND buyer_id = ?", product.ID, buyerID).Find(&conversations).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch conversation", err)
+		}
+		summaries, err := summarizeConversations(db, buyerID, conversations)
+		if err != nil || len(summaries) == 0 {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch conversation", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Conversation fetched successfully", summaries[0])
+	}
+}
+
+// GetConversations lists the user's conversations as buyer or seller, most recent first.
+// Sellers only see conversations once the buyer has written something.
+func GetConversations(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		query := db.Model(&models.Conversation{}).
+			Where("buyer_id = ? OR (seller_id = ? AND last_message_at IS NOT NULL)", userID, userID)
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count conversations", err)
+		}
+
+		var conversations []models.Conversation
+		if err := query.Preload("Product").Preload("Buyer").Preload("Seller").
+			Offset(offset).Limit(limit).Order("COALESCE(last_message_at, created_at) DESC").
+			Find(&conversations).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve conversations", err)
+		}
+
+		summaries, err := summarizeConversations(db, userID, conversations)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve conversations", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Conversations fetched successfully", echo.Map{
+			"data":  summaries,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// GetUnreadMessageCount returns how many messages sent to the user are unread, across all
+// their conversations.
+func GetUnreadMessageCount(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var unread int64
+		if err := unreadMessages(db, userID).Count(&unread).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count unread messages", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Unread count fetched successfully", echo.Map{"unread": unread})
+	}
+}
+
+// GetConversationMessages pages through a conversation's messages, newest first.
+func GetConversationMessages(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		conversation, err := loadConversation(db, c.Param("id"), userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Conversation not found", err)
+		}
+		query := db.Model(&models.ConversationMessage{}).Where("conversation_id = ?", conversation.ID)
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 50
+		}
+		offset := (page - 1) * limit
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count messages", err)
+		}
+
+		var messages []models.ConversationMessage
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&messages).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve messages", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Messages fetched successfully", echo.Map{
+			"data":  messages,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// SendConversationMessage posts to a conversation. Accepts a multipart form with "message"
+// and up to five "images"; links are blocked as in the community chat.
+func SendConversationMessage(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		conversation, err := loadConversation(db, c.Param("id"), userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Conversation not found", err)
+		}
+
+		message := strings.TrimSpace(c.FormValue("message"))
+		if linkRegex.MatchString(message) {
+			return utils.ResponseError(c, http.StatusBadRequest, "Sharing links or web URLs is not allowed in messages", nil)
+		}
+
+		urls, err := uploadFormImages(c, "images", fmt.Sprintf("conversations/%s", conversation.ID), maxMessageImages)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to upload images", err)
+		}
+		if message == "" && len(urls) == 0 {
+			return utils.ResponseError(c, http.StatusBadRequest, "A message or image is required", nil)
+		}
+
+		sender, recipient, readColumn := conversation.Buyer, conversation.Seller, "buyer_last_read_at"
+		if conversation.SellerID == userID {
+			sender, recipient, readColumn = conversation.Seller, conversation.Buyer, "seller_last_read_at"
+		}
+
+		entry := models.ConversationMessage{
+			ConversationID: conversation.ID,
+			SenderID:       userID,
+			Message:        message,
+			Images:         imageURLsJSON(urls),
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&entry).Error; err != nil {
+				return err
+			}
+			// Writing to a conversation means the sender has read it
+			if err := tx.Model(&conversation).Updates(map[string]interface{}{
+				"last_message_at": entry.CreatedAt,
+				readColumn:        entry.CreatedAt,
+			}).Error; err != nil {
+				return err
+			}
+
+			preview := message
+			if utf8.RuneCountInString(preview) > 100 {
+				preview = string([]rune(preview)[:100]) + "…"
+			}
+			if preview == "" {
+				preview = "Sent a photo"
+			}
+			return notifications.Notify(tx, models.Notification{
+				UserID:   recipient.ID,
+				Kind:     models.NotificationMessage,
+				Title:    "New message from " + sender.UserName,
+				Body:     preview,
+				Link:     "/messages/" + conversation.ID.String(),
+				EntityID: &conversation.ID,
+			})
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to send message", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Message sent", entry)
+	}
+}
+
+// MarkConversationRead marks every message in a conversation read for the user.
+func MarkConversationRead(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		conversation, err := loadConversation(db, c.Param("id"), userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Conversation not found", err)
+		}
+
+		readColumn := "buyer_last_read_at"
+		if conversation.SellerID == userID {
+			readColumn = "seller_last_read_at"
+		}
+		if err := db.Model(&conversation).Update(readColumn, time.Now()).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to mark conversation read", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Conversation marked read", nil)
+	}
+}
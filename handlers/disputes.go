@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"api/emails"
+	"api/models"
+	"api/notifications"
+	"api/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxEvidenceImages caps how many images can be attached to one dispute message.
+const maxEvidenceImages = 5
+
+// uploadFormImages uploads the images sent in a multipart field to Cloudinary and returns
+// their URLs. Requests without a multipart body carry no images.
+func uploadFormImages(c echo.Context, field, folder string, limit int) ([]string, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, nil
+	}
+
+	files := form.File[field]
+	if len(files) > limit {
+		return nil, fmt.Errorf("at most %d images can be attached", limit)
+	}
+
+	var urls []string
+	for _, file := range files {
+		src, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		tempFilePath := filepath.Join(os.TempDir(), uuid.New().String()+"_"+filepath.Base(file.Filename))
+		out, err := os.Create(tempFilePath)
+		if err != nil {
+			src.Close()
+			return nil, err
+		}
+		_, err = io.Copy(out, src)
+		src.Close()
+		out.Close()
+		if err != nil {
+			os.Remove(tempFilePath)
+			return nil, err
+		}
+
+		url, err := utils.UploadToCloudinary(tempFilePath, folder)
+		os.Remove(tempFilePath)
+		if err != nil {
+			return nil, err
+		}
+		if url == "" {
+			return nil, fmt.Errorf("received empty URL from Cloudinary")
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// imageURLsJSON stores uploaded image URLs as a JSON array, empty rather than null.
+func imageURLsJSON(urls []string) datatypes.JSON {
+	if len(urls) == 0 {
+		return datatypes.JSON("[]")
+	}
+	raw, _ := json.Marshal(urls)
+	return datatypes.JSON(raw)
+}
+
+// RaiseBookingDispute lets the customer contest a booking the artisan marked as completed or
+// reported as a customer no-show, and the artisan contest a report that they did not show.
+// Accepts a multipart form with "reason" and up to five "evidence" images.
+func RaiseBookingDispute(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		bookingID := c.Param("id")
+
+		reason := strings.TrimSpace(c.FormValue("reason"))
+		if reason == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Reason is required", nil)
+		}
+
+		var booking models.ServiceBooking
+		if err := db.First(&booking, "id = ? AND (user_id = ? OR artisan_id = ?)", bookingID, userID, userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+		party := utils.BookingParty(booking, userID)
+		if err := utils.CanDispute(booking, party); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "This booking cannot be disputed", err)
+		}
+
+		urls, err := uploadFormImages(c, "evidence", fmt.Sprintf("disputes/%s", booking.ID), maxEvidenceImages)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to upload evidence", err)
+		}
+
+		var dispute *models.Dispute
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, booking.ID.String()).First(&booking).Error; err != nil {
+				return err
+			}
+			var err error
+			dispute, err = utils.OpenDispute(tx, &booking, party, reason, imageURLsJSON(urls))
+			if err != nil {
+				return err
+			}
+			if party == models.ActorVendor {
+				return notifyDisputeParties(tx, dispute.ID, "Booking Disputed",
+					"The artisan has disputed your no-show report. The payment stays in escrow while our team reviews the dispute.", true, false)
+			}
+			return notifyDisputeParties(tx, dispute.ID, "Booking Disputed",
+				"The customer has disputed this booking. The payment stays in escrow while our team reviews the dispute.", false, true)
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to raise dispute", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Dispute raised. Payment is on hold while we review it.", dispute)
+	}
+}
+
+// loadDispute fetches a dispute with its booking and message thread.
+func loadDispute(query *gorm.DB) (models.Dispute, error) {
+	var dispute models.Dispute
+	err := query.Preload("Booking").
+		Preload("Messages", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at ASC") }).
+		Preload("Messages.Sender").
+		First(&dispute).Error
+	return dispute, err
+}
+
+// GetBookingDispute returns the dispute on a booking to its customer or artisan.
+func GetBookingDispute(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		dispute, err := loadDispute(db.Where("booking_id = ? AND (customer_id = ? OR artisan_id = ?)", c.Param("id"), userID, userID))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Dispute not found", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Dispute fetched successfully", dispute)
+	}
+}
+
+// postDisputeMessage adds a message with optional evidence to an open dispute.
+func postDisputeMessage(c echo.Context, db *gorm.DB, dispute models.Dispute, senderID uuid.UUID, role string) error {
+	message := strings.TrimSpace(c.FormValue("message"))
+
+	urls, err := uploadFormImages(c, "evidence", fmt.Sprintf("disputes/%s", dispute.BookingID), maxEvidenceImages)
+	if err != nil {
+		return utils.ResponseError(c, http.StatusBadRequest, "Failed to upload evidence", err)
+	}
+	if message == "" && len(urls) == 0 {
+		return utils.ResponseError(c, http.StatusBadRequest, "A message or evidence image is required", nil)
+	}
+
+	entry := models.DisputeMessage{
+		DisputeID:  dispute.ID,
+		SenderID:   senderID,
+		SenderRole: role,
+		Message:    message,
+		Evidence:   imageURLsJSON(urls),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var current models.Dispute
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, "id = ?", dispute.ID).Error; err != nil {
+			return err
+		}
+		if current.Status != models.DisputeOpen {
+			return fmt.Errorf("dispute is already %s", strings.ToLower(current.Status))
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		return notifyDisputeParties(tx, dispute.ID, "New Message on Your Dispute", "There is a new message on the dispute for this booking.",
+			role != models.ActorCustomer, role != models.ActorVendor)
+	})
+	if err != nil {
+		return utils.ResponseError(c, http.StatusBadRequest, "Failed to add message", err)
+	}
+
+	return utils.ResponseSucess(c, http.StatusCreated, "Message added", entry)
+}
+
+// AddDisputeMessage lets the customer or artisan post to their dispute.
+func AddDisputeMessage(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var dispute models.Dispute
+		if err := db.First(&dispute, "id = ? AND (customer_id = ? OR artisan_id = ?)", c.Param("id"), userID, userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Dispute not found", err)
+		}
+
+		role := models.ActorCustomer
+		if dispute.ArtisanID == userID {
+			role = models.ActorVendor
+		}
+		return postDisputeMessage(c, db, dispute, userID, role)
+	}
+}
+
+// AdminAddDisputeMessage lets an admin post to a dispute, e.g. to ask for more evidence.
+func AdminAddDisputeMessage(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID := c.Get("user_id").(uuid.UUID)
+
+		var dispute models.Dispute
+		if err := db.First(&dispute, "id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Dispute not found", err)
+		}
+		return postDisputeMessage(c, db, dispute, adminID, models.ActorAdmin)
+	}
+}
+
+func GetAdminDisputes(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.Dispute{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count disputes", err)
+		}
+
+		var disputes []models.Dispute
+		if err := query.Preload("Booking").Offset(offset).Limit(limit).Order("created_at DESC").Find(&disputes).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve disputes", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Disputes fetched successfully", echo.Map{
+			"data":  disputes,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+func GetAdminDispute(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dispute, err := loadDispute(db.Where("id = ?", c.Param("id")))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Dispute not found", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Dispute fetched successfully", dispute)
+	}
+}
+
+type ResolveDisputeRequest struct {
+	Resolution   string       `json:"resolution"`    // RELEASE, PARTIAL_REFUND, FULL_REFUND
+	RefundAmount models.Money `json:"refund_amount"` // PARTIAL_REFUND only
+	Note         string       `json:"note"`
+}
+
+// ResolveDispute settles a dispute by releasing the escrow to the artisan, refunding part of
+// it to the customer, or refunding it in full.
+func ResolveDispute(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID := c.Get("user_id").(uuid.UUID)
+
+		var req ResolveDisputeRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+		req.Resolution = strings.ToUpper(strings.TrimSpace(req.Resolution))
+
+		var dispute models.Dispute
+		var payout *models.Payout
+		var refund *models.Refund
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&dispute, "id = ?", c.Param("id")).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			var err error
+			payout, refund, err = utils.ResolveDispute(tx, &dispute, req.Resolution, req.RefundAmount, req.Note, adminID)
+			if err != nil {
+				return err
+			}
+			return notifyDisputeParties(tx, dispute.ID, "Dispute Resolved", disputeOutcomeMessage(dispute), true, true)
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Dispute not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to resolve dispute", err)
+		}
+
+		if payout != nil {
+			go utils.ProcessPayout(db, payout.ID)
+		}
+		if refund != nil {
+			go utils.ProcessRefund(db, refund.ID)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Dispute resolved", echo.Map{
+			"dispute": dispute,
+			"payout":  payout,
+			"refund":  refund,
+		})
+	}
+}
+
+func disputeOutcomeMessage(dispute models.Dispute) string {
+	var outcome string
+	switch dispute.Resolution {
+	case models.DisputeRelease:
+		outcome = "The payment has been released to the artisan."
+	case models.DisputeFullRefund:
+		outcome = "The full booking fee will be refunded to the customer."
+	case models.DisputePartialRefund:
+		outcome = fmt.Sprintf("₦%s will be refunded to the customer and the rest paid to the artisan.", dispute.RefundAmount.Naira())
+	}
+	if dispute.ResolutionNote != "" {
+		outcome += " Note from our team: " + dispute.ResolutionNote
+	}
+	return "Our team has reviewed the dispute on this booking. " + outcome
+}
+
+// notifyDisputeParties tells the dispute's customer and/or artisan, by email and in the app.
+func notifyDisputeParties(tx *gorm.DB, disputeID uuid.UUID, headline, message string, toCustomer, toArtisan bool) error {
+	var dispute models.Dispute
+	if err := tx.Preload("Booking").First(&dispute, "id = ?", disputeID).Error; err != nil {
+		return err
+	}
+
+	var recipients []uuid.UUID
+	if toCustomer {
+		recipients = append(recipients, dispute.CustomerID)
+	}
+	if toArtisan {
+		recipients = append(recipients, dispute.ArtisanID)
+	}
+
+	var users []models.User
+	if err := tx.Where("id IN ?", recipients).Find(&users).Error; err != nil {
+		return err
+	}
+	for _, u := range users {
+		err := notifications.Notify(tx, models.Notification{
+			UserID:   u.ID,
+			Kind:     models.NotificationDispute,
+			Title:    headline,
+			Body:     message,
+			Link:     "/dashboard?tab=service_bookings",
+			EntityID: &dispute.BookingID,
+		})
+		if err != nil {
+			return err
+		}
+		if u.Email == "" {
+			continue
+		}
+		if _, err := emails.Queue(tx, emails.KindDisputeUpdate, u.Email, u.UserName, dispute.Booking.BookingNumber, headline, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"api/emails"
+	"api/models"
+	"api/utils"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetAdminEmails lists outbox emails, newest first, optionally filtered by status (PENDING,
+// SENT, FAILED), kind and recipient.
+func GetAdminEmails(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.OutboxEmail{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if kind := c.QueryParam("kind"); kind != "" {
+			query = query.Where("kind = ?", kind)
+		}
+		if recipient := c.QueryParam("recipient"); recipient != "" {
+			query = query.Where("recipient ILIKE ?", "%"+recipient+"%")
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count emails", err)
+		}
+
+		var outbox []models.OutboxEmail
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&outbox).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve emails", err)
+		}
+
+		var counts []struct {
+			Status string `json:"status"`
+			Count  int64  `json:"count"`
+		}
+		db.Model(&models.OutboxEmail{}).Select("status, COUNT(*) AS count").Group("status").Scan(&counts)
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Emails fetched successfully", echo.Map{
+			"data":   outbox,
+			"total":  total,
+			"counts": counts,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// RetryEmail queues a failed email for another round of delivery attempts.
+func RetryEmail(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid email ID", err)
+		}
+
+		email, err := emails.Retry(db, id)
+		if err == gorm.ErrRecordNotFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Email not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to requeue email", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Email requeued", email)
+	}
+}
+
+// GetEmailTemplates lists the email templates that can be previewed.
+func GetEmailTemplates() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return utils.ResponseSucess(c, http.StatusOK, "Email templates fetched successfully", emails.TemplateNames())
+	}
+}
+
+// PreviewEmailTemplate renders a template with sample data. The page is served as HTML so it
+// can be opened in a browser; ?format=text returns the plain-text part instead.
+func PreviewEmailTemplate() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		html, text, err := emails.Preview(c.Param("name"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Email template not found", err)
+		}
+
+		// The global middleware defaults every response to JSON, and c.HTML/c.String only set a
+		// content type when none is set yet
+		if c.QueryParam("format") == "text" {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+			return c.String(http.StatusOK, text)
+		}
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		return c.HTML(http.StatusOK, html)
+	}
+}
@@ -90,7 +90,7 @@ func GetFacebookProductFeed(db *gorm.DB) echo.HandlerFunc {
 				Brand:        p.BrandName,
 				Condition:    condition,
 				Availability: "in stock",
-				Price:        fmt.Sprintf("%.2f NGN", p.ProductPrice),
+				Price:        fmt.Sprintf("%s %s", p.ProductPrice.Naira(), p.ProductPrice.CurrencyCode()),
 			}
 
 			// Add more mapping logic if you have specific categories
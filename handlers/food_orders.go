@@ -2,17 +2,21 @@ package handlers
 
 import (
 	"api/emails"
+	"api/ledger"
 	"api/models"
+	"api/notifications"
 	"api/utils"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateFoodOrderRequest struct {
@@ -22,7 +26,7 @@ type CreateFoodOrderRequest struct {
 	CustomerPhone    string          `json:"customer_phone"`
 	DeliveryAddress  string          `json:"delivery_address"`
 	PaymentReference string          `json:"payment_reference"`
-	TotalAmount      float64         `json:"total_amount"`
+	TotalAmount      models.Money    `json:"total_amount"`
 	CallbackURL      string          `json:"callback_url"`
 }
 
@@ -45,14 +49,34 @@ func CreateFoodOrder(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusNotFound, "Food product not found", err)
 		}
 
-		// Calculate platform fee (10%) and vendor payout (90% + delivery fee)
-		mealPrice := req.TotalAmount - product.DeliveryFee
-		if mealPrice < 0 {
-			mealPrice = product.ProductPrice
+		// Price the order from the product as stored; the client's total is only a consistency check
+		price, err := utils.PriceFoodOrder(product, req.SubMenus)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Unable to price this order", err)
 		}
+		if !req.TotalAmount.IsZero() && req.TotalAmount.Kobo != price.Total.Kobo {
+			return c.JSON(http.StatusConflict, utils.ApiResponse{
+				Success: false,
+				Message: fmt.Sprintf("Order total has changed to ₦%s, please review your order", price.Total.Naira()),
+				Error:   fmt.Sprintf("client total %s does not match server total %s", req.TotalAmount, price.Total),
+				Data:    echo.Map{"total_amount": price.Total, "meal_price": price.MealPrice, "delivery_fee": price.DeliveryFee},
+			})
+		}
+		mealPrice := price.MealPrice
+
+		// Platform fee comes from the applicable commission rule; vendor keeps the rest plus delivery fee
+		rule, err := utils.ResolveCommissionRule(db, product, time.Now())
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to resolve commission", err)
+		}
+
+		platformFee := utils.CalculateCommission(rule, mealPrice)
+		vendorPayout := mealPrice.Sub(platformFee).Add(price.DeliveryFee)
 
-		platformFee := mealPrice * 0.10
-		vendorPayout := (mealPrice * 0.90) + product.DeliveryFee
+		var commissionRuleID *uuid.UUID
+		if rule.ID != uuid.Nil {
+			commissionRuleID = &rule.ID
+		}
 
 		orderNumber := fmt.Sprintf("NDZ-FD-%d", time.Now().UnixNano()/1e6)
 
@@ -72,7 +96,10 @@ func CreateFoodOrder(db *gorm.DB) echo.HandlerFunc {
 		if callbackURL == "" {
 			callbackURL = fmt.Sprintf("%s/dashboard?tab=my_orders", utils.GetFrontendBaseURL(c))
 		}
-		checkoutURL, _ := utils.InitializePaystackTransaction(customerEmail, req.TotalAmount, orderNumber, callbackURL)
+		checkoutURL, err := utils.InitializePaystackTransaction(customerEmail, price.Total, orderNumber, callbackURL)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadGateway, "Failed to start payment", err)
+		}
 
 		status := "PAID"
 		paymentStatus := "SUCCESS"
@@ -81,10 +108,11 @@ func CreateFoodOrder(db *gorm.DB) echo.HandlerFunc {
 			paymentStatus = "PENDING"
 		}
 
-		// Verify Paystack payment reference if provided
-		paymentRef := req.PaymentReference
-		if paymentRef == "" {
-			paymentRef = orderNumber
+		// Paystack knows the payment by the reference the checkout was started with; webhooks
+		// and refunds find it by that, so a client-supplied one only counts without a checkout
+		paymentRef := orderNumber
+		if checkoutURL == "" && req.PaymentReference != "" {
+			paymentRef = req.PaymentReference
 		}
 
 		var vendorID uuid.UUID
@@ -97,12 +125,13 @@ func CreateFoodOrder(db *gorm.DB) echo.HandlerFunc {
 			UserID:           userID,
 			VendorID:         vendorID,
 			ProductID:        product.ID,
-			SubMenus:         datatypes.JSON(req.SubMenus),
+			SubMenus:         datatypes.JSON(price.SubMenusJSON()),
 			MealPrice:        mealPrice,
-			DeliveryFee:      product.DeliveryFee,
-			TotalAmount:      req.TotalAmount,
+			DeliveryFee:      price.DeliveryFee,
+			TotalAmount:      price.Total,
 			PlatformFee:      platformFee,
 			VendorPayout:     vendorPayout,
+			CommissionRuleID: commissionRuleID,
 			CustomerName:     customerName,
 			CustomerPhone:    req.CustomerPhone,
 			DeliveryAddress:  req.DeliveryAddress,
@@ -111,31 +140,50 @@ func CreateFoodOrder(db *gorm.DB) echo.HandlerFunc {
 			PaymentStatus:    paymentStatus,
 		}
 
-		if err := db.Create(&order).Error; err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to record food order", err)
-		}
-
-		// Send email notification to vendor
-		go func() {
-			if product.User.Email != "" {
-				submenusStr := "None"
-				if len(req.SubMenus) > 0 {
-					submenusStr = string(req.SubMenus)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			if err := utils.RecordFoodOrderPlaced(tx, order, models.ActorCustomer, &userID); err != nil {
+				return err
+			}
+			// Only in payments dev mode is there no checkout; the order is then already paid
+			if order.PaymentStatus == "SUCCESS" {
+				if err := ledger.RecordFoodOrderCharge(tx, order); err != nil {
+					return err
 				}
-				_ = emails.SendVendorFoodOrderEmail(
-					product.User.Email,
-					product.User.UserName,
-					orderNumber,
-					product.Name,
-					customerName,
-					req.CustomerPhone,
-					req.DeliveryAddress,
-					submenusStr,
-					req.TotalAmount,
-					product.DeliveryFee,
-				)
 			}
-		}()
+
+			// Notify the vendor by email and in the app
+			if product.User.Email == "" {
+				return nil
+			}
+			submenusStr := "None"
+			if len(price.Options) > 0 {
+				submenusStr = string(price.SubMenusJSON())
+			}
+			_, err := emails.Queue(tx, emails.KindVendorFoodOrder,
+				product.User.Email,
+				product.User.UserName,
+				orderNumber,
+				product.Name,
+				customerName,
+				req.CustomerPhone,
+				req.DeliveryAddress,
+				submenusStr,
+				order.TotalAmount,
+				order.DeliveryFee,
+				order.PlatformFee,
+				order.VendorPayout,
+			)
+			if err != nil {
+				return err
+			}
+			return notifyVendorOfFoodOrder(tx, order, product.Name)
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to record food order", err)
+		}
 
 		return utils.ResponseSucess(c, http.StatusCreated, "Food order placed successfully", echo.Map{
 			"order":        order,
@@ -149,7 +197,7 @@ func GetUserFoodOrders(db *gorm.DB) echo.HandlerFunc {
 		userID := c.Get("user_id").(uuid.UUID)
 
 		var orders []models.FoodOrder
-		if err := db.Preload("Product").Preload("Vendor").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error; err != nil {
+		if err := db.Preload("Product").Preload("Items.Product").Preload("Vendor").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch user food orders", err)
 		}
 
@@ -164,7 +212,7 @@ func GetVendorFoodOrders(db *gorm.DB) echo.HandlerFunc {
 		vendorID := c.Get("user_id").(uuid.UUID)
 
 		var orders []models.FoodOrder
-		if err := db.Preload("Product").Preload("User").Where("vendor_id = ?", vendorID).Order("created_at desc").Find(&orders).Error; err != nil {
+		if err := db.Preload("Product").Preload("Items.Product").Preload("User").Where("vendor_id = ?", vendorID).Order("created_at desc").Find(&orders).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch vendor food orders", err)
 		}
 
@@ -174,31 +222,283 @@ func GetVendorFoodOrders(db *gorm.DB) echo.HandlerFunc {
 	}
 }
 
+type UpdateFoodOrderStatusRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// changeFoodOrderStatus moves the order matched by scope to status. actorFor decides, from
+// the locked order, on whose behalf the change is made.
+func changeFoodOrderStatus(c echo.Context, db *gorm.DB, status, note string, actorFor func(models.FoodOrder) string, scope func(*gorm.DB) *gorm.DB) error {
+	actorID := c.Get("user_id").(uuid.UUID)
+	orderID := c.Param("id")
+	status = strings.ToUpper(strings.TrimSpace(status))
+
+	var order models.FoodOrder
+	var effects utils.FoodOrderEffects
+	var notFound bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"})).First(&order, "id = ?", orderID).Error; err != nil {
+			notFound = err == gorm.ErrRecordNotFound
+			return err
+		}
+
+		var err error
+		effects, err = utils.TransitionFoodOrder(tx, &order, status, actorFor(order), &actorID, note)
+		if err != nil {
+			return err
+		}
+		return utils.NotifyFoodOrderStatus(tx, order.ID, note)
+	})
+	if notFound {
+		return utils.ResponseError(c, http.StatusNotFound, "Food order not found", err)
+	}
+	if err != nil {
+		return utils.ResponseError(c, http.StatusBadRequest, "Failed to update order status", err)
+	}
+
+	if effects.Payout != nil {
+		go utils.ProcessPayout(db, effects.Payout.ID)
+	}
+	if effects.Refund != nil {
+		go utils.ProcessRefund(db, effects.Refund.ID)
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"message": "Order status updated",
+		"order":   order,
+		"refund":  effects.Refund,
+	})
+}
+
+// actorIs returns an actorFor func that always acts as actor.
+func actorIs(actor string) func(models.FoodOrder) string {
+	return func(models.FoodOrder) string { return actor }
+}
+
+// UpdateFoodOrderStatus lets the vendor move their order along its lifecycle.
 func UpdateFoodOrderStatus(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		vendorID := c.Get("user_id").(uuid.UUID)
-		orderID := c.Param("id")
 
-		var body struct {
-			Status string `json:"status"`
+		var body UpdateFoodOrderStatusRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+		return changeFoodOrderStatus(c, db, body.Status, body.Note, actorIs(models.ActorVendor), func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("vendor_id = ?", vendorID)
+		})
+	}
+}
+
+// CustomerUpdateFoodOrderStatus lets the customer cancel an order or confirm its delivery.
+func CustomerUpdateFoodOrderStatus(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body UpdateFoodOrderStatusRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
 		}
+		return changeFoodOrderStatus(c, db, body.Status, body.Note, actorIs(models.ActorCustomer), func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("user_id = ?", userID)
+		})
+	}
+}
+
+// AdminUpdateFoodOrderStatus lets an admin move any order along its lifecycle.
+func AdminUpdateFoodOrderStatus(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var body UpdateFoodOrderStatusRequest
 		if err := c.Bind(&body); err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
 		}
+		return changeFoodOrderStatus(c, db, body.Status, body.Note, actorIs(models.ActorAdmin), func(tx *gorm.DB) *gorm.DB {
+			return tx
+		})
+	}
+}
+
+type CancelRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelFoodOrder lets the customer (within the cancellation window) or the vendor cancel an
+// order. Paid orders are refunded to the customer.
+func CancelFoodOrder(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+
+		actorFor := func(order models.FoodOrder) string {
+			if order.VendorID == userID {
+				return models.ActorVendor
+			}
+			return models.ActorCustomer
+		}
+		return changeFoodOrderStatus(c, db, models.FoodOrderCancelled, body.Reason, actorFor, func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("user_id = ? OR vendor_id = ?", userID, userID)
+		})
+	}
+}
+
+// AdminRefundFoodOrder refunds a paid order in full, including one already delivered whose
+// payout to the vendor has not gone out.
+func AdminRefundFoodOrder(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+		return changeFoodOrderStatus(c, db, models.FoodOrderRefunded, body.Reason, actorIs(models.ActorAdmin), func(tx *gorm.DB) *gorm.DB {
+			return tx
+		})
+	}
+}
+
+// settleHeldFoodOrder runs settle on the held delivery matched by scope and processes the
+// payout it queues.
+func settleHeldFoodOrder(c echo.Context, db *gorm.DB, message string, scope func(*gorm.DB) *gorm.DB, settle func(tx *gorm.DB, order *models.FoodOrder) (*models.Payout, error)) error {
+	var order models.FoodOrder
+	var payout *models.Payout
+	var notFound bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"})).First(&order, "id = ?", c.Param("id")).Error; err != nil {
+			notFound = err == gorm.ErrRecordNotFound
+			return err
+		}
+		if !utils.FoodOrderAwaitingRelease(order) {
+			return fmt.Errorf("order %s is not awaiting delivery confirmation", order.OrderNumber)
+		}
+
+		var err error
+		payout, err = settle(tx, &order)
+		return err
+	})
+	if notFound {
+		return utils.ResponseError(c, http.StatusNotFound, "Food order not found", err)
+	}
+	if err != nil {
+		return utils.ResponseError(c, http.StatusBadRequest, "Failed to update order", err)
+	}
+
+	if payout != nil {
+		go utils.ProcessPayout(db, payout.ID)
+	}
+	return utils.ResponseSucess(c, http.StatusOK, message, echo.Map{"order": order})
+}
+
+// releaseHeldFoodOrder releases a held delivery to the vendor and tells them.
+func releaseHeldFoodOrder(tx *gorm.DB, order *models.FoodOrder) (*models.Payout, error) {
+	payout, err := utils.ReleaseFoodOrder(tx, order)
+	if err != nil {
+		return nil, err
+	}
+	return payout, notifications.Notify(tx, models.Notification{
+		UserID:   order.VendorID,
+		Kind:     models.NotificationFoodOrder,
+		Title:    "Delivery confirmed for order " + order.OrderNumber,
+		Body:     "Your payout for this order is on its way.",
+		Link:     "/dashboard?tab=food_orders",
+		EntityID: &order.ID,
+	})
+}
+
+// ConfirmFoodOrderDelivery lets the customer confirm an order its vendor marked delivered,
+// releasing the vendor's share without waiting for the hold to lapse.
+func ConfirmFoodOrderDelivery(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		return settleHeldFoodOrder(c, db, "Delivery confirmed", func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("user_id = ?", userID)
+		}, releaseHeldFoodOrder)
+	}
+}
+
+// ReportFoodOrderProblem lets the customer object to an order its vendor marked delivered
+// before the hold lapses. The vendor's share stays held until an admin releases or refunds it.
+func ReportFoodOrderProblem(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+		reason := strings.TrimSpace(body.Reason)
+		if reason == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Tell us what went wrong with the delivery", nil)
+		}
+
+		return settleHeldFoodOrder(c, db, "Problem reported, our team will review the order", func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("user_id = ?", userID)
+		}, func(tx *gorm.DB, order *models.FoodOrder) (*models.Payout, error) {
+			if order.ReleaseAt == nil {
+				return nil, fmt.Errorf("a problem has already been reported for order %s", order.OrderNumber)
+			}
+			order.ReleaseAt = nil
+			order.DeliveryIssue = reason
+			if err := tx.Model(order).Updates(map[string]interface{}{"release_at": nil, "delivery_issue": reason}).Error; err != nil {
+				return nil, err
+			}
+			return nil, notifications.Notify(tx, models.Notification{
+				UserID:   order.VendorID,
+				Kind:     models.NotificationFoodOrder,
+				Title:    "Problem reported with order " + order.OrderNumber,
+				Body:     "The customer reported a problem with the delivery: " + reason,
+				Link:     "/dashboard?tab=food_orders",
+				EntityID: &order.ID,
+			})
+		})
+	}
+}
+
+// AdminReleaseFoodOrder releases a held delivery to the vendor, e.g. once a problem the
+// customer reported has been looked into. Refund it with AdminRefundFoodOrder instead.
+func AdminReleaseFoodOrder(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return settleHeldFoodOrder(c, db, "Order released to the vendor", func(tx *gorm.DB) *gorm.DB {
+			return tx
+		}, releaseHeldFoodOrder)
+	}
+}
+
+// GetFoodOrderHistory returns the status history of an order to its customer, its vendor or staff who manage orders.
+func GetFoodOrderHistory(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		role, _ := c.Get("role").(string)
+		staff := models.HasPermission(models.Role(role), models.PermOrdersManage)
 
 		var order models.FoodOrder
-		if err := db.First(&order, "id = ? AND vendor_id = ?", orderID, vendorID).Error; err != nil {
+		query := db.Where("id = ?", c.Param("id"))
+		if !staff {
+			query = query.Where("user_id = ? OR vendor_id = ?", userID, userID)
+		}
+		if err := query.First(&order).Error; err != nil {
 			return utils.ResponseError(c, http.StatusNotFound, "Food order not found", err)
 		}
 
-		order.Status = body.Status
-		if err := db.Save(&order).Error; err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update order status", err)
+		var history []models.FoodOrderStatusHistory
+		if err := db.Where("food_order_id = ?", order.ID).Order("created_at ASC").Find(&history).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch order history", err)
 		}
 
-		return c.JSON(http.StatusOK, echo.Map{
-			"message": "Order status updated",
-			"order":   order,
+		actor := models.ActorCustomer
+		if staff {
+			actor = models.ActorAdmin
+		} else if order.VendorID == userID {
+			actor = models.ActorVendor
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Order history fetched successfully", echo.Map{
+			"status":         order.Status,
+			"history":        history,
+			"allowed_status": models.NextFoodOrderStatuses(order.Status, actor),
 		})
 	}
 }
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"api/jobs"
+	"api/models"
+	"api/utils"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetAdminJobRuns lists background job runs, newest first, optionally filtered by job name
+// and status (QUEUED, RUNNING, SUCCEEDED, DEAD).
+func GetAdminJobRuns(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.Job{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if name := c.QueryParam("name"); name != "" {
+			query = query.Where("name = ?", name)
+		}
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count job runs", err)
+		}
+
+		var runs []models.Job
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&runs).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve job runs", err)
+		}
+
+		var schedules []models.JobSchedule
+		db.Order("name ASC").Find(&schedules)
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Job runs fetched successfully", echo.Map{
+			"data":      runs,
+			"total":     total,
+			"schedules": schedules,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// RetryJobRun requeues a dead-lettered job run.
+func RetryJobRun(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid job run ID", err)
+		}
+
+		job, err := jobs.Retry(db, id)
+		if err == gorm.ErrRecordNotFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Job run not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to requeue job run", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Job run requeued", job)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"api/ledger"
+	"api/models"
+	"api/utils"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetMyLedgerBalance returns the authenticated vendor/artisan's escrow, payable and paid-out totals.
+func GetMyLedgerBalance(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		balance, err := ledger.GetVendorBalance(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to compute balance", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Balance retrieved successfully", balance)
+	}
+}
+
+func GetVendorLedgerBalance(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		vendorID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid vendor ID", err)
+		}
+
+		balance, err := ledger.GetVendorBalance(db, vendorID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to compute balance", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Balance retrieved successfully", balance)
+	}
+}
+
+// GetLedgerSummary returns the platform-wide balance of every account type. The totals
+// always sum to zero; a non-zero "imbalance" means the ledger has been tampered with.
+func GetLedgerSummary(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		accountTypes := []string{
+			ledger.AccountCustomer,
+			ledger.AccountEscrow,
+			ledger.AccountPlatformRevenue,
+			ledger.AccountVendorPayable,
+			ledger.AccountPayoutSettlement,
+		}
+
+		balances := map[string]int64{}
+		var imbalance int64
+		for _, t := range accountTypes {
+			total, err := ledger.Balance(db, t, nil)
+			if err != nil {
+				return utils.ResponseError(c, http.StatusInternalServerError, "Failed to compute ledger summary", err)
+			}
+			balances[t] = total
+			imbalance += total
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Ledger summary retrieved successfully", echo.Map{
+			"balances":  balances,
+			"imbalance": imbalance,
+			"currency":  "NGN",
+		})
+	}
+}
+
+func GetJournalEntries(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.JournalEntry{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if kind := c.QueryParam("kind"); kind != "" {
+			query = query.Where("kind = ?", kind)
+		}
+		if sourceType := c.QueryParam("source_type"); sourceType != "" {
+			query = query.Where("source_type = ?", sourceType)
+		}
+		if sourceID := c.QueryParam("source_id"); sourceID != "" {
+			query = query.Where("source_id = ?", sourceID)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count journal entries", err)
+		}
+
+		var entries []models.JournalEntry
+		if err := query.Preload("Lines.Account").Offset(offset).Limit(limit).Order("created_at DESC").Find(&entries).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve journal entries", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Journal entries fetched successfully", echo.Map{
+			"data":  entries,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"api/db"
+	"api/models"
+	"api/utils"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// lockMilestone loads the quoted-booking milestone whose current payment attempt is reference,
+// locking the row.
+func lockMilestone(tx *gorm.DB, reference string) (*models.Milestone, error) {
+	var milestone models.Milestone
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_reference = ?", reference).First(&milestone).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &milestone, nil
+}
+
+// applyMilestoneChargeSuccess holds a milestone payment in the artisan's escrow until the
+// customer releases it.
+func applyMilestoneChargeSuccess(tx *gorm.DB, milestone *models.Milestone, paid models.Money) (paystackEventOutcome, error) {
+	if milestone.PaymentStatus != "PENDING" && milestone.PaymentStatus != "FAILED" {
+		return processedOutcome(fmt.Sprintf("Milestone %s payment already recorded (%s)", milestone.ID, milestone.PaymentStatus)), nil
+	}
+	if reason := paidShortfall(paid, milestone.Amount); reason != "" {
+		return failedOutcome(fmt.Sprintf("%s for milestone %s", reason, milestone.ID)), nil
+	}
+
+	if err := utils.FundMilestone(tx, milestone); err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	if milestone.Status == models.MilestoneCancelled {
+		// The booking was cancelled before the payment landed: give the money straight back
+		refund, err := utils.RequestMilestoneRefund(tx, milestone, "Booking was cancelled before payment completed", models.ActorSystem, nil)
+		if err != nil {
+			return paystackEventOutcome{}, err
+		}
+		outcome := processedOutcome(fmt.Sprintf("Milestone %s paid after cancellation; refund requested", milestone.ID))
+		outcome.afterCommit = append(outcome.afterCommit, func() { utils.ProcessRefund(db.DB, refund.ID) })
+		return outcome, nil
+	}
+
+	if err := notifyBookingCounterparty(tx, milestone.BookingID, models.ActorCustomer, "Milestone funded",
+		fmt.Sprintf("The customer has paid milestone %d (%s). The money is held in escrow until they approve the work.", milestone.Sequence, milestone.Title)); err != nil {
+		return paystackEventOutcome{}, err
+	}
+	return processedOutcome(fmt.Sprintf("Milestone %s paid and held in escrow", milestone.ID)), nil
+}
+
+func applyMilestoneChargeFailed(tx *gorm.DB, milestone *models.Milestone, reason string) (paystackEventOutcome, error) {
+	if milestone.PaymentStatus != "PENDING" {
+		return ignoredOutcome(fmt.Sprintf("Milestone %s payment is %s; failed charge ignored", milestone.ID, milestone.PaymentStatus)), nil
+	}
+	if err := tx.Model(milestone).Update("payment_status", "FAILED").Error; err != nil {
+		return paystackEventOutcome{}, err
+	}
+	return processedOutcome(fmt.Sprintf("Milestone %s charge failed: %s", milestone.ID, reason)), nil
+}
+
+// applyMilestoneRefund records a refund of a milestone that was not requested through the platform.
+func applyMilestoneRefund(tx *gorm.DB, milestone *models.Milestone) (paystackEventOutcome, error) {
+	if milestone.PaymentStatus == "REFUNDED" {
+		return processedOutcome(fmt.Sprintf("Milestone %s already refunded", milestone.ID)), nil
+	}
+	if err := utils.MarkMilestoneRefunded(tx, milestone); err != nil {
+		return paystackEventOutcome{}, err
+	}
+	return processedOutcome(fmt.Sprintf("Milestone %s refunded", milestone.ID)), nil
+}
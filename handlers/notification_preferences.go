@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"api/emails"
+	"api/models"
+	"api/utils"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetNotificationPreferences returns which optional emails the user receives.
+func GetNotificationPreferences(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var user models.User
+		if err := db.Select("id", "email").First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+
+		prefs, err := emails.Preferences(db, user.Email)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch notification preferences", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Notification preferences fetched successfully", prefs)
+	}
+}
+
+// UpdateNotificationPreferences turns categories of optional email on or off. Categories
+// left out of the body are unchanged.
+func UpdateNotificationPreferences(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req struct {
+			Marketing    *bool `json:"marketing"`
+			NewProducts  *bool `json:"new_products"`
+			PriceDrops   *bool `json:"price_drops"`
+			OrderUpdates *bool `json:"order_updates"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input request", err)
+		}
+
+		var user models.User
+		if err := db.Select("id", "email").First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+
+		changes := map[string]*bool{
+			models.NotifyMarketing:    req.Marketing,
+			models.NotifyNewProducts:  req.NewProducts,
+			models.NotifyPriceDrops:   req.PriceDrops,
+			models.NotifyOrderUpdates: req.OrderUpdates,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for category, subscribed := range changes {
+				if subscribed == nil {
+					continue
+				}
+				var err error
+				if *subscribed {
+					err = emails.OptIn(tx, user.Email, category)
+				} else {
+					err = emails.OptOut(tx, user.Email, category, emails.OptOutSettings)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update notification preferences", err)
+		}
+
+		prefs, err := emails.Preferences(db, user.Email)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch notification preferences", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Notification preferences updated", prefs)
+	}
+}
+
+// unsubscribeRequest reads the signed email, category and token of an unsubscribe link. They
+// come in the query string, or in a form body from the frontend page.
+func unsubscribeRequest(c echo.Context) (string, string, bool) {
+	email, category, token := c.FormValue("email"), c.FormValue("category"), c.FormValue("token")
+	return email, category, email != "" && emails.ValidUnsubscribeToken(email, category, token)
+}
+
+// GetUnsubscribeStatus tells the unsubscribe page whether the address in a link still
+// receives its category.
+func GetUnsubscribeStatus(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, category, ok := unsubscribeRequest(c)
+		if !ok {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid or tampered unsubscribe link", nil)
+		}
+
+		subscribed, err := emails.Subscribed(db, email, category)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch subscription", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Subscription fetched successfully", echo.Map{
+			"email":      email,
+			"category":   category,
+			"subscribed": subscribed,
+		})
+	}
+}
+
+// Unsubscribe opts the address in a signed link out of its category. It is also the target
+// of the List-Unsubscribe header, which mail clients POST to for one-click unsubscribe.
+func Unsubscribe(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, category, ok := unsubscribeRequest(c)
+		if !ok {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid or tampered unsubscribe link", nil)
+		}
+
+		if err := emails.OptOut(db, email, category, emails.OptOutLink); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to unsubscribe", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "You have been unsubscribed", echo.Map{
+			"email":      email,
+			"category":   category,
+			"subscribed": false,
+		})
+	}
+}
+
+// Resubscribe undoes Unsubscribe for the address in a signed link.
+func Resubscribe(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email, category, ok := unsubscribeRequest(c)
+		if !ok {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid or tampered unsubscribe link", nil)
+		}
+
+		if err := emails.OptIn(db, email, category); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to resubscribe", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "You have been resubscribed", echo.Map{
+			"email":      email,
+			"category":   category,
+			"subscribed": true,
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"api/models"
+	"api/notifications"
+	"api/utils"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetNotifications lists the user's notifications, newest first; ?unread=true lists only
+// unread ones.
+func GetNotifications(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		query := db.Model(&models.Notification{}).Where("user_id = ?", userID)
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 || limit > 100 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if c.QueryParam("unread") == "true" {
+			query = query.Where("read_at IS NULL")
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count notifications", err)
+		}
+
+		var list []models.Notification
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&list).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve notifications", err)
+		}
+
+		unread, err := notifications.UnreadCount(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count unread notifications", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Notifications fetched successfully", echo.Map{
+			"data":   list,
+			"total":  total,
+			"unread": unread,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// GetUnreadNotificationCount returns how many of the user's notifications are unread, for
+// the badge on the bell icon.
+func GetUnreadNotificationCount(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		unread, err := notifications.UnreadCount(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count unread notifications", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Unread count fetched successfully", echo.Map{"unread": unread})
+	}
+}
+
+// MarkNotificationRead marks one of the user's notifications read.
+func MarkNotificationRead(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid notification ID", err)
+		}
+
+		n, err := notifications.MarkRead(db, userID, id)
+		if err == gorm.ErrRecordNotFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Notification not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to mark notification read", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Notification marked read", n)
+	}
+}
+
+// MarkAllNotificationsRead marks all of the user's notifications read.
+func MarkAllNotificationsRead(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		updated, err := notifications.MarkAllRead(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to mark notifications read", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Notifications marked read", echo.Map{"updated": updated})
+	}
+}
+
+// streamHeartbeat keeps idle streams from being closed by proxies.
+const streamHeartbeat = 25 * time.Second
+
+// StreamNotifications is a Server-Sent Events stream of the user's new notifications. It
+// starts with an "unread" event carrying the unread count, then sends a "notification" event
+// for each new one. Browsers' EventSource can't send the Authorization header, so web clients
+// use a fetch-based EventSource.
+func StreamNotifications(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		unread, err := notifications.UnreadCount(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count unread notifications", err)
+		}
+
+		stream, unsubscribe := notifications.Subscribe(userID)
+		defer unsubscribe()
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set(echo.HeaderCacheControl, "no-cache")
+		res.Header().Set(echo.HeaderConnection, "keep-alive")
+		res.Header().Set("X-Accel-Buffering", "no") // stop nginx buffering the stream
+		res.WriteHeader(http.StatusOK)
+
+		send := func(event string, data interface{}) error {
+			raw, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, raw); err != nil {
+				return err
+			}
+			res.Flush()
+			return nil
+		}
+		if err := send("unread", echo.Map{"unread": unread}); err != nil {
+			return nil
+		}
+
+		heartbeat := time.NewTicker(streamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case n := <-stream:
+				if err := send("notification", n); err != nil {
+					return nil
+				}
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	}
+}
+
+// notifyVendorOfFoodOrder tells the vendor about a new order alongside their email.
+func notifyVendorOfFoodOrder(tx *gorm.DB, order models.FoodOrder, productName string) error {
+	return notifications.Notify(tx, models.Notification{
+		UserID:   order.VendorID,
+		Kind:     models.NotificationFoodOrder,
+		Title:    "New food order " + order.OrderNumber,
+		Body:     fmt.Sprintf("%s ordered %s.", order.CustomerName, productName),
+		Link:     "/dashboard?tab=food_orders",
+		EntityID: &order.ID,
+	})
+}
+
+// notifyArtisanOfBooking tells the artisan about a new booking alongside their email.
+func notifyArtisanOfBooking(tx *gorm.DB, booking models.ServiceBooking, serviceName string) error {
+	return notifications.Notify(tx, models.Notification{
+		UserID:   booking.ArtisanID,
+		Kind:     models.NotificationBooking,
+		Title:    "New booking " + booking.BookingNumber,
+		Body:     fmt.Sprintf("%s is booked for %s.", serviceName, booking.ScheduledDate.Format("Mon, 02 Jan 2006 at 03:04 PM")),
+		Link:     "/dashboard?tab=service_bookings",
+		EntityID: &booking.ID,
+	})
+}
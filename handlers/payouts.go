@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"api/models"
+	"api/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetUserPayouts lists payouts made to the authenticated vendor/artisan.
+func GetUserPayouts(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var payouts []models.Payout
+		if err := db.Where("user_id = ?", userID).Order("created_at desc").Find(&payouts).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch payouts", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"data": payouts,
+		})
+	}
+}
+
+func GetAdminPayouts(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.Payout{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if sourceType := c.QueryParam("source_type"); sourceType != "" {
+			query = query.Where("source_type = ?", sourceType)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count payouts", err)
+		}
+
+		var payouts []models.Payout
+		if err := query.Preload("User").Offset(offset).Limit(limit).Order("created_at DESC").Find(&payouts).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve payouts", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Payouts fetched successfully", echo.Map{
+			"data":  payouts,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// RetryPayout puts a FAILED payout, or a REVERSED one finance has looked into, back in the
+// queue and submits it immediately.
+func RetryPayout(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+
+		var payout models.Payout
+		if err := db.First(&payout, "id = ?", id).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Payout not found", err)
+		}
+
+		if payout.Status != models.PayoutFailed && payout.Status != models.PayoutPending && payout.Status != models.PayoutReversed {
+			return utils.ResponseError(c, http.StatusBadRequest, "Only failed, reversed or pending payouts can be retried", nil)
+		}
+
+		now := time.Now()
+		if err := db.Model(&payout).Updates(map[string]interface{}{
+			"status":          models.PayoutPending,
+			"attempts":        0,
+			"next_attempt_at": &now,
+		}).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to requeue payout", err)
+		}
+
+		if err := utils.ProcessPayout(db, payout.ID); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to submit payout", err)
+		}
+
+		db.First(&payout, "id = ?", payout.ID)
+		return utils.ResponseSucess(c, http.StatusOK, "Payout resubmitted", payout)
+	}
+}
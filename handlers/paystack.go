@@ -8,30 +8,38 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"time"
 
 	"api/db"
-	"api/emails"
 	"api/models"
 	"api/utils"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PaystackWebhookPayload struct {
 	Event string `json:"event"`
 	Data  struct {
-		ID              int64   `json:"id"`
-		Reference       string  `json:"reference"`
-		Amount          float64 `json:"amount"` // in kobo
-		Status          string  `json:"status"`
-		GatewayResponse string  `json:"gateway_response"`
-		Customer        struct {
+		ID                   json.RawMessage `json:"id"`
+		Reference            string          `json:"reference"`
+		TransactionReference string          `json:"transaction_reference"` // refund events
+		TransferCode         string          `json:"transfer_code"`         // transfer events
+		Amount               paystackAmount  `json:"amount"`                // in kobo
+		Currency             string          `json:"currency"`
+		Status               string          `json:"status"`
+		GatewayResponse      string          `json:"gateway_response"`
+		Reason               string          `json:"reason"`
+		Customer             struct {
 			Email string `json:"email"`
 		} `json:"customer"`
 	} `json:"data"`
 }
 
 // HandlePaystackWebhook handles incoming webhook events from Paystack.
+// Every verified delivery is logged to paystack_events and applied at most once.
 func HandlePaystackWebhook(c echo.Context) error {
 	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
 
@@ -70,65 +78,69 @@ func HandlePaystackWebhook(c echo.Context) error {
 		})
 	}
 
-	// Handle successful charge event
-	if payload.Event == "charge.success" && payload.Data.Status == "success" {
-		reference := payload.Data.Reference
-
-		// 1. Check if reference belongs to a FoodOrder
-		var foodOrder models.FoodOrder
-		if err := db.DB.Preload("Product").Preload("Vendor").Where("payment_reference = ?", reference).First(&foodOrder).Error; err == nil {
-			if foodOrder.Status != "PAID" {
-				foodOrder.Status = "PAID"
-				db.DB.Save(&foodOrder)
-
-				// Send Email to Vendor
-				go func(order models.FoodOrder) {
-					subMenusStr := string(order.SubMenus)
-					_ = emails.SendVendorFoodOrderEmail(
-						order.Vendor.Email,
-						order.Vendor.UserName,
-						order.OrderNumber,
-						order.Product.Name,
-						order.CustomerName,
-						order.CustomerPhone,
-						order.DeliveryAddress,
-						subMenusStr,
-						order.TotalAmount,
-						order.Product.DeliveryFee,
-					)
-				}(foodOrder)
-			}
+	// Log the delivery. Retries hit the unique event_key and only bump the delivery counter.
+	event := models.PaystackEvent{
+		EventKey:  payload.eventKey(),
+		Event:     payload.Event,
+		Reference: payload.reference(),
+		Payload:   datatypes.JSON(bodyBytes),
+		Status:    models.PaystackEventReceived,
+	}
+	result := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+	if result.Error != nil {
+		return utils.ResponseError(c, http.StatusInternalServerError, "Failed to record webhook event", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		db.DB.Model(&models.PaystackEvent{}).Where("event_key = ?", event.EventKey).
+			UpdateColumn("deliveries", gorm.Expr("deliveries + 1"))
+	}
+
+	var outcome paystackEventOutcome
+	duplicate := false
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the event row so concurrent deliveries of the same event are serialized
+		var stored models.PaystackEvent
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("event_key = ?", event.EventKey).First(&stored).Error; err != nil {
+			return err
 		}
 
-		// 2. Check if reference belongs to a ServiceBooking
-		var serviceBooking models.ServiceBooking
-		if err := db.DB.Preload("Service").Preload("Artisan").Preload("User").Where("payment_reference = ?", reference).First(&serviceBooking).Error; err == nil {
-			if serviceBooking.Status != "BOOKED" {
-				serviceBooking.Status = "BOOKED"
-				serviceBooking.PaymentStatus = "HELD_IN_ESCROW"
-				db.DB.Save(&serviceBooking)
-
-				// Send Email to Artisan
-				go func(booking models.ServiceBooking) {
-					customerName := booking.User.UserName
-					if customerName == "" {
-						customerName = "Nedzl Customer"
-					}
-
-					_ = emails.SendArtisanBookingNotificationEmail(
-						booking.Artisan.Email,
-						booking.Artisan.UserName,
-						booking.BookingNumber,
-						booking.Service.Name,
-						customerName,
-						booking.CustomerPhone,
-						booking.ServiceAddress,
-						booking.ScheduledDate,
-						booking.BookingFee,
-					)
-				}(serviceBooking)
-			}
+		if stored.Status == models.PaystackEventProcessed || stored.Status == models.PaystackEventIgnored {
+			duplicate = true
+			return nil
+		}
+
+		var err error
+		outcome, err = applyPaystackEvent(tx, payload)
+		if err != nil {
+			return err
 		}
+
+		now := time.Now()
+		return tx.Model(&stored).Updates(map[string]interface{}{
+			"status":       outcome.status,
+			"note":         outcome.note,
+			"processed_at": &now,
+		}).Error
+	})
+
+	if err != nil {
+		// Leave the event retryable; a non-2xx response makes Paystack redeliver it
+		db.DB.Model(&models.PaystackEvent{}).Where("event_key = ?", event.EventKey).Updates(map[string]interface{}{
+			"status": models.PaystackEventFailed,
+			"note":   err.Error(),
+		})
+		return utils.ResponseError(c, http.StatusInternalServerError, "Failed to process webhook event", err)
+	}
+
+	if duplicate {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"status":  true,
+			"message": "Webhook already processed",
+		})
+	}
+
+	for _, notify := range outcome.afterCommit {
+		go notify()
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/db"
+	"api/emails"
+	"api/ledger"
+	"api/models"
+	"api/notifications"
+	"api/utils"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// paystackAmount accepts amounts sent either as JSON numbers or as quoted strings
+// (refund events send "amount": "10000"). Paystack amounts are always whole kobo.
+type paystackAmount int64
+
+func (a *paystackAmount) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*a = 0
+		return nil
+	}
+	kobo, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*a = paystackAmount(kobo)
+	return nil
+}
+
+// reference returns the transaction reference the event refers to.
+func (p PaystackWebhookPayload) reference() string {
+	if p.Data.TransactionReference != "" {
+		return p.Data.TransactionReference
+	}
+	return p.Data.Reference
+}
+
+// eventKey identifies a single Paystack event across redeliveries.
+func (p PaystackWebhookPayload) eventKey() string {
+	id := strings.Trim(string(p.Data.ID), `"`)
+	return fmt.Sprintf("%s:%s:%s", p.Event, p.reference(), id)
+}
+
+type paystackEventOutcome struct {
+	status      string
+	note        string
+	afterCommit []func()
+}
+
+func processedOutcome(note string) paystackEventOutcome {
+	return paystackEventOutcome{status: models.PaystackEventProcessed, note: note}
+}
+
+func ignoredOutcome(note string) paystackEventOutcome {
+	return paystackEventOutcome{status: models.PaystackEventIgnored, note: note}
+}
+
+func failedOutcome(note string) paystackEventOutcome {
+	return paystackEventOutcome{status: models.PaystackEventFailed, note: note}
+}
+
+// applyPaystackEvent applies a webhook event inside tx. A returned error rolls the
+// transaction back and leaves the event open for redelivery; business rejections
+// (e.g. amount mismatch) are reported through the outcome instead.
+func applyPaystackEvent(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	switch payload.Event {
+	case "charge.success":
+		return applyChargeSuccess(tx, payload)
+	case "charge.failed":
+		return applyChargeFailed(tx, payload)
+	case "refund.processed":
+		return applyRefundProcessed(tx, payload)
+	case "refund.failed":
+		return applyRefundFailed(tx, payload)
+	case "transfer.success", "transfer.failed", "transfer.reversed":
+		return applyTransferEvent(tx, payload)
+	default:
+		return ignoredOutcome(fmt.Sprintf("Unhandled event type %q", payload.Event)), nil
+	}
+}
+
+// lockPaymentTarget loads the food order or service booking that owns reference, locking the row.
+func lockPaymentTarget(tx *gorm.DB, reference string) (*models.FoodOrder, *models.ServiceBooking, error) {
+	var order models.FoodOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_reference = ?", reference).First(&order).Error
+	if err == nil {
+		return &order, nil, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, nil, err
+	}
+
+	var booking models.ServiceBooking
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_reference = ?", reference).First(&booking).Error
+	if err == nil {
+		return nil, &booking, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, nil, err
+	}
+
+	return nil, nil, nil
+}
+
+// systemTransitionFoodOrder applies a webhook-driven status change when the lifecycle allows
+// it from the order's current status, and reports whether it did.
+func systemTransitionFoodOrder(tx *gorm.DB, order *models.FoodOrder, to, note string) (bool, error) {
+	if models.CanTransitionFoodOrder(order.Status, to, models.ActorSystem) != nil {
+		return false, nil
+	}
+	if _, err := utils.TransitionFoodOrder(tx, order, to, models.ActorSystem, nil, note); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// markFoodOrderPaid records a confirmed charge on an order and moves it to PAID.
+func markFoodOrderPaid(tx *gorm.DB, order *models.FoodOrder) (bool, error) {
+	if err := tx.Model(order).Update("payment_status", "SUCCESS").Error; err != nil {
+		return false, err
+	}
+	order.PaymentStatus = "SUCCESS"
+	if err := ledger.RecordFoodOrderCharge(tx, *order); err != nil {
+		return false, err
+	}
+	return systemTransitionFoodOrder(tx, order, models.FoodOrderPaid, "Payment confirmed by Paystack")
+}
+
+// paidShortfall explains why a charge does not cover the expected amount, or returns "".
+func paidShortfall(paid, expected models.Money) string {
+	if paid.Currency != "" && paid.Currency != expected.CurrencyCode() {
+		return fmt.Sprintf("Paid in %s but expected %s", paid.Currency, expected.CurrencyCode())
+	}
+	if paid.Kobo < expected.Kobo {
+		return fmt.Sprintf("Paid amount (%d kobo) is less than the expected %d kobo", paid.Kobo, expected.Kobo)
+	}
+	return ""
+}
+
+func applyChargeSuccess(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	if payload.Data.Status != "success" {
+		return ignoredOutcome(fmt.Sprintf("Charge status is %q", payload.Data.Status)), nil
+	}
+
+	reference := payload.reference()
+	paid := models.Money{Kobo: int64(payload.Data.Amount), Currency: payload.Data.Currency}
+
+	checkout, err := lockCheckout(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if checkout != nil {
+		return applyCheckoutChargeSuccess(tx, checkout, paid)
+	}
+
+	milestone, err := lockMilestone(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if milestone != nil {
+		return applyMilestoneChargeSuccess(tx, milestone, paid)
+	}
+
+	order, booking, err := lockPaymentTarget(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	switch {
+	case order != nil:
+		if order.PaymentStatus == "SUCCESS" {
+			return processedOutcome(fmt.Sprintf("Food order %s already marked as paid", order.OrderNumber)), nil
+		}
+		if reason := paidShortfall(paid, order.TotalAmount); reason != "" {
+			return failedOutcome(fmt.Sprintf("%s for food order %s", reason, order.OrderNumber)), nil
+		}
+
+		transitioned, err := markFoodOrderPaid(tx, order)
+		if err != nil {
+			return paystackEventOutcome{}, err
+		}
+
+		outcome := processedOutcome(fmt.Sprintf("Food order %s marked as paid", order.OrderNumber))
+		orderID := order.ID
+		if order.Status == models.FoodOrderCancelled {
+			// Cancelled before the payment landed: give the money straight back
+			refund, err := utils.RequestFoodOrderRefund(tx, order, "Order was cancelled before payment completed", models.ActorSystem, nil)
+			if err != nil {
+				return paystackEventOutcome{}, err
+			}
+			outcome.note = fmt.Sprintf("Food order %s paid after cancellation; refund requested", order.OrderNumber)
+			outcome.afterCommit = append(outcome.afterCommit, func() { utils.ProcessRefund(db.DB, refund.ID) })
+			return outcome, nil
+		}
+		if err := notifyVendorOfPaidFoodOrder(tx, orderID); err != nil {
+			return paystackEventOutcome{}, err
+		}
+		if transitioned {
+			if err := utils.NotifyFoodOrderStatus(tx, orderID, ""); err != nil {
+				return paystackEventOutcome{}, err
+			}
+		} else {
+			outcome.note = fmt.Sprintf("Food order %s paid while %s; status left unchanged", order.OrderNumber, order.Status)
+		}
+		return outcome, nil
+
+	case booking != nil:
+		if booking.PaymentStatus != "PENDING" && booking.PaymentStatus != "FAILED" {
+			return processedOutcome(fmt.Sprintf("Booking %s payment already recorded (%s)", booking.BookingNumber, booking.PaymentStatus)), nil
+		}
+		if reason := paidShortfall(paid, booking.BookingFee); reason != "" {
+			return failedOutcome(fmt.Sprintf("%s for booking %s", reason, booking.BookingNumber)), nil
+		}
+
+		cancelled := booking.Status == "CANCELLED"
+		slotLost := false
+		if booking.Status == "PENDING" {
+			// The payment may land after the slot hold lapsed and someone else booked the time
+			if err := utils.ConfirmPaidSlot(tx, booking); err != nil {
+				if !errors.Is(err, utils.ErrSlotTaken) {
+					return paystackEventOutcome{}, err
+				}
+				slotLost = true
+			}
+		}
+		updates := map[string]interface{}{"payment_status": "HELD_IN_ESCROW"}
+		switch {
+		case slotLost:
+			updates["status"] = "CANCELLED"
+		case !cancelled:
+			updates["status"] = "BOOKED"
+		}
+		if err := tx.Model(booking).Updates(updates).Error; err != nil {
+			return paystackEventOutcome{}, err
+		}
+		booking.PaymentStatus = "HELD_IN_ESCROW"
+		if err := ledger.RecordBookingCharge(tx, *booking); err != nil {
+			return paystackEventOutcome{}, err
+		}
+
+		if cancelled {
+			// Cancelled before the payment landed: give the money straight back
+			refund, err := utils.RequestBookingRefund(tx, booking, "Booking was cancelled before payment completed", models.ActorSystem, nil)
+			if err != nil {
+				return paystackEventOutcome{}, err
+			}
+			outcome := processedOutcome(fmt.Sprintf("Booking %s paid after cancellation; refund requested", booking.BookingNumber))
+			outcome.afterCommit = append(outcome.afterCommit, func() { utils.ProcessRefund(db.DB, refund.ID) })
+			return outcome, nil
+		}
+		if slotLost {
+			refund, err := utils.RequestBookingRefund(tx, booking, "The time slot was booked by someone else before payment completed", models.ActorSystem, nil)
+			if err != nil {
+				return paystackEventOutcome{}, err
+			}
+			err = notifications.Notify(tx, models.Notification{
+				UserID:   booking.UserID,
+				Kind:     models.NotificationBooking,
+				Title:    "Booking " + booking.BookingNumber + " was cancelled",
+				Body:     "Your payment came through after the time slot was booked by someone else, so it is being refunded. Please pick another time.",
+				Link:     "/dashboard?tab=service_bookings",
+				EntityID: &booking.ID,
+			})
+			if err != nil {
+				return paystackEventOutcome{}, err
+			}
+			outcome := processedOutcome(fmt.Sprintf("Booking %s paid after its slot was taken; cancelled and refund requested", booking.BookingNumber))
+			outcome.afterCommit = append(outcome.afterCommit, func() { utils.ProcessRefund(db.DB, refund.ID) })
+			return outcome, nil
+		}
+
+		if err := notifyArtisanOfPaidBooking(tx, booking.ID); err != nil {
+			return paystackEventOutcome{}, err
+		}
+		return processedOutcome(fmt.Sprintf("Booking %s paid and held in escrow", booking.BookingNumber)), nil
+	}
+
+	return ignoredOutcome("No food order or service booking matches reference " + reference), nil
+}
+
+func applyChargeFailed(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	reference := payload.reference()
+	reason := payload.Data.GatewayResponse
+	if reason == "" {
+		reason = "no gateway response"
+	}
+
+	checkout, err := lockCheckout(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if checkout != nil {
+		return applyCheckoutChargeFailed(tx, checkout, reason)
+	}
+
+	milestone, err := lockMilestone(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if milestone != nil {
+		return applyMilestoneChargeFailed(tx, milestone, reason)
+	}
+
+	order, booking, err := lockPaymentTarget(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	switch {
+	case order != nil:
+		if order.PaymentStatus != "PENDING" {
+			return ignoredOutcome(fmt.Sprintf("Food order %s payment is %s; failed charge ignored", order.OrderNumber, order.PaymentStatus)), nil
+		}
+		if err := tx.Model(order).Update("payment_status", "FAILED").Error; err != nil {
+			return paystackEventOutcome{}, err
+		}
+		return processedOutcome(fmt.Sprintf("Food order %s charge failed: %s", order.OrderNumber, reason)), nil
+
+	case booking != nil:
+		if booking.PaymentStatus != "PENDING" {
+			return ignoredOutcome(fmt.Sprintf("Booking %s payment is %s; failed charge ignored", booking.BookingNumber, booking.PaymentStatus)), nil
+		}
+		if err := tx.Model(booking).Update("payment_status", "FAILED").Error; err != nil {
+			return paystackEventOutcome{}, err
+		}
+		return processedOutcome(fmt.Sprintf("Booking %s charge failed: %s", booking.BookingNumber, reason)), nil
+	}
+
+	return ignoredOutcome("No food order or service booking matches reference " + reference), nil
+}
+
+// applyRefundOutcome settles a refund requested through the platform. It reports false when
+// the event does not match one, e.g. a refund started from the Paystack dashboard.
+func applyRefundOutcome(tx *gorm.DB, payload PaystackWebhookPayload, succeeded bool) (paystackEventOutcome, bool, error) {
+	reason := payload.Data.Reason
+	if reason == "" {
+		reason = "Paystack reported " + payload.Event
+	}
+	amount := models.Money{Kobo: int64(payload.Data.Amount), Currency: payload.Data.Currency}
+	refundID := strings.Trim(string(payload.Data.ID), `"`)
+
+	refund, err := utils.ApplyRefundOutcome(tx, payload.reference(), refundID, amount, succeeded, reason)
+	if err != nil || refund == nil {
+		return paystackEventOutcome{}, false, err
+	}
+	return processedOutcome(fmt.Sprintf("Refund %s is now %s", refund.ID, refund.Status)), true, nil
+}
+
+func applyRefundProcessed(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	reference := payload.reference()
+
+	if outcome, matched, err := applyRefundOutcome(tx, payload, true); err != nil || matched {
+		return outcome, err
+	}
+
+	checkout, err := lockCheckout(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if checkout != nil {
+		return applyCheckoutRefund(tx, checkout, models.Money{Kobo: int64(payload.Data.Amount), Currency: payload.Data.Currency})
+	}
+
+	milestone, err := lockMilestone(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if milestone != nil {
+		return applyMilestoneRefund(tx, milestone)
+	}
+
+	order, booking, err := lockPaymentTarget(tx, reference)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+
+	switch {
+	case order != nil:
+		if order.PaymentStatus == "REFUNDED" {
+			return processedOutcome(fmt.Sprintf("Food order %s already refunded", order.OrderNumber)), nil
+		}
+		transitioned, err := utils.MarkFoodOrderRefunded(tx, order, "Refund processed by Paystack")
+		if err != nil {
+			return paystackEventOutcome{}, err
+		}
+
+		if transitioned {
+			if err := utils.NotifyFoodOrderStatus(tx, order.ID, ""); err != nil {
+				return paystackEventOutcome{}, err
+			}
+		}
+		return processedOutcome(fmt.Sprintf("Food order %s refunded", order.OrderNumber)), nil
+
+	case booking != nil:
+		if booking.PaymentStatus == "REFUNDED" {
+			return processedOutcome(fmt.Sprintf("Booking %s already refunded", booking.BookingNumber)), nil
+		}
+		if err := utils.MarkBookingRefunded(tx, booking, booking.BookingFee); err != nil {
+			return paystackEventOutcome{}, err
+		}
+		return processedOutcome(fmt.Sprintf("Booking %s refunded", booking.BookingNumber)), nil
+	}
+
+	return ignoredOutcome("No food order or service booking matches reference " + reference), nil
+}
+
+func applyRefundFailed(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	outcome, matched, err := applyRefundOutcome(tx, payload, false)
+	if err != nil || matched {
+		return outcome, err
+	}
+	return ignoredOutcome("No refund matches reference " + payload.reference()), nil
+}
+
+// applyTransferEvent settles the payout whose current transfer reference matches the event.
+func applyTransferEvent(tx *gorm.DB, payload PaystackWebhookPayload) (paystackEventOutcome, error) {
+	reference := payload.reference()
+	succeeded := payload.Event == "transfer.success"
+
+	reason := payload.Data.Reason
+	if reason == "" {
+		reason = "Paystack reported " + payload.Event
+	}
+
+	payout, err := utils.ApplyTransferOutcome(tx, reference, succeeded, reason)
+	if err != nil {
+		return paystackEventOutcome{}, err
+	}
+	if payout == nil {
+		return ignoredOutcome("No payout transfer matches reference " + reference), nil
+	}
+
+	return processedOutcome(fmt.Sprintf("Payout %s is now %s", payout.ID, payout.Status)), nil
+}
+
+// notifyVendorOfPaidFoodOrder tells the vendor about a newly paid order by email and in the app.
+func notifyVendorOfPaidFoodOrder(tx *gorm.DB, orderID uuid.UUID) error {
+	var order models.FoodOrder
+	if err := tx.Preload("Product").Preload("Vendor").Preload("Items.Product").First(&order, "id = ?", orderID).Error; err != nil {
+		return err
+	}
+
+	productName := order.Product.Name
+	subMenus := string(order.SubMenus)
+	if len(order.Items) > 0 {
+		// Cart orders list every line; options from all lines are shown together
+		var names []string
+		var options []models.SubMenuOption
+		for _, item := range order.Items {
+			names = append(names, fmt.Sprintf("%d× %s", item.Quantity, item.Product.Name))
+			itemOptions, _ := models.ParseSubMenuOptions(item.SubMenus)
+			options = append(options, itemOptions...)
+		}
+		productName = strings.Join(names, ", ")
+		if raw, err := json.Marshal(options); err == nil && len(options) > 0 {
+			subMenus = string(raw)
+		} else {
+			subMenus = "None"
+		}
+	}
+
+	_, err := emails.Queue(tx, emails.KindVendorFoodOrder,
+		order.Vendor.Email,
+		order.Vendor.UserName,
+		order.OrderNumber,
+		productName,
+		order.CustomerName,
+		order.CustomerPhone,
+		order.DeliveryAddress,
+		subMenus,
+		order.TotalAmount,
+		order.DeliveryFee,
+		order.PlatformFee,
+		order.VendorPayout,
+	)
+	if err != nil {
+		return err
+	}
+	return notifyVendorOfFoodOrder(tx, order, productName)
+}
+
+// notifyArtisanOfPaidBooking tells the artisan about a newly paid booking by email and in the app.
+func notifyArtisanOfPaidBooking(tx *gorm.DB, bookingID uuid.UUID) error {
+	var booking models.ServiceBooking
+	if err := tx.Preload("Service").Preload("Artisan").Preload("User").First(&booking, "id = ?", bookingID).Error; err != nil {
+		return err
+	}
+
+	customerName := booking.User.UserName
+	if customerName == "" {
+		customerName = "Nedzl Customer"
+	}
+
+	_, err := emails.Queue(tx, emails.KindArtisanBooking,
+		booking.Artisan.Email,
+		booking.Artisan.UserName,
+		booking.BookingNumber,
+		booking.Service.Name,
+		customerName,
+		booking.CustomerPhone,
+		booking.ServiceAddress,
+		booking.ScheduledDate,
+		booking.BookingFee,
+		booking.PlatformFee,
+		booking.ArtisanPayout,
+	)
+	if err != nil {
+		return err
+	}
+	return notifyArtisanOfBooking(tx, booking, booking.Service.Name)
+}
+
+// GetPaystackEvents lists logged webhook deliveries for admins, newest first.
+func GetPaystackEvents(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.PaystackEvent{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if event := c.QueryParam("event"); event != "" {
+			query = query.Where("event = ?", event)
+		}
+		if reference := c.QueryParam("reference"); reference != "" {
+			query = query.Where("reference = ?", reference)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count webhook events", err)
+		}
+
+		var events []models.PaystackEvent
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&events).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve webhook events", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Webhook events fetched successfully", echo.Map{
+			"data":  events,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"api/models"
+	"api/otp"
+	"api/utils"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// SendPhoneCode texts a verification code to the phone number given, or to the user's own
+// number if none is.
+func SendPhoneCode(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		var req struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+
+		phone := req.PhoneNumber
+		if phone == "" {
+			var user models.User
+			if err := db.Select("phone_number").First(&user, "id = ?", userID).Error; err != nil {
+				return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+			}
+			phone = user.PhoneNumber
+		}
+
+		verification, err := otp.Send(db, userID, phone)
+		switch err {
+		case nil:
+		case otp.ErrInvalidPhone:
+			return utils.ResponseError(c, http.StatusBadRequest, "Enter a valid phone number", err)
+		case otp.ErrPhoneTaken:
+			return utils.ResponseError(c, http.StatusConflict, "This phone number is already verified on another account", err)
+		case otp.ErrTooSoon, otp.ErrTooMany:
+			return utils.ResponseError(c, http.StatusTooManyRequests, "Please wait before requesting another code", err)
+		default:
+			if errors.Is(err, otp.ErrNoProvider) {
+				return utils.ResponseError(c, http.StatusServiceUnavailable, "Phone verification is not available right now", err)
+			}
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to send verification code", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Verification code sent", echo.Map{
+			"phone_number": verification.PhoneNumber,
+			"expires_at":   verification.ExpiresAt,
+			"resend_after": otp.ResendAfter.Seconds(),
+		})
+	}
+}
+
+// VerifyPhone checks the code the user received. Once their number is verified, products
+// listed as a guest with it become theirs.
+func VerifyPhone(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		var req struct {
+			Code string `json:"code"`
+		}
+		if err := c.Bind(&req); err != nil || req.Code == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Enter the code sent to your phone", err)
+		}
+
+		phone, err := otp.Verify(db, userID, req.Code)
+		switch err {
+		case nil:
+		case otp.ErrInvalidCode:
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid verification code", err)
+		case otp.ErrNoCode:
+			return utils.ResponseError(c, http.StatusBadRequest, "Your code has expired. Request a new one", err)
+		case otp.ErrPhoneTaken:
+			return utils.ResponseError(c, http.StatusConflict, "This phone number is already verified on another account", err)
+		default:
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to verify phone number", err)
+		}
+
+		claimed, err := claimGuestListingsByPhone(db, userID, phone)
+		if err != nil {
+			// The number is verified either way; the listings can be claimed by verifying again
+			log.Printf("Failed to claim guest listings for user %s: %v\n", userID, err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Phone number verified", echo.Map{
+			"phone_number":     phone,
+			"phone_verified":   true,
+			"claimed_listings": claimed,
+		})
+	}
+}
+
+// claimGuestListingsByPhone gives the user the products listed as a guest with their verified
+// phone number, however it was typed.
+func claimGuestListingsByPhone(db *gorm.DB, userID uuid.UUID, phone string) (int64, error) {
+	result := db.Model(&models.Products{}).
+		Where("is_guest_listing = ? AND regexp_replace(guest_phone, '[^0-9]', '', 'g') IN ?", true, otp.PhoneDigitForms(phone)).
+		Updates(map[string]interface{}{
+			"user_id":          userID,
+			"is_guest_listing": false,
+		})
+	return result.RowsAffected, result.Error
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"api/emails"
 	"api/models"
+	"api/notifications"
 	"api/utils"
 	"encoding/json"
 	"fmt"
@@ -25,16 +26,15 @@ import (
 
 // ProductResponse represents a safe product response without sensitive user data
 
-// convertToProductResponse converts a Products model to a safe ProductResponse
+// convertToProductResponse converts a Products model to a safe ProductResponse. It leaves out
+// the seller's email and phone number; buyers reach them through conversations.
 func ConvertToProductResponse(product models.Products, isLiked bool) models.ProductResponse {
 	var publicUserPtr *models.PublicUser
 	if product.User.ID != uuid.Nil {
 		publicUserPtr = &models.PublicUser{
 			ID:            product.User.ID,
 			UserName:      product.User.UserName,
-			Email:         product.User.Email,
 			Role:          string(product.User.Role),
-			PhoneNumber:   product.User.PhoneNumber,
 			ImageUrl:      product.User.ImageUrl,
 			Location:      product.User.Location,
 			IsVerified:    product.User.IsVerified,
@@ -47,11 +47,9 @@ func ConvertToProductResponse(product models.Products, isLiked bool) models.Prod
 		}
 	} else if product.IsGuestListing || product.GuestPhone != "" || product.GuestEmail != "" {
 		publicUserPtr = &models.PublicUser{
-			UserName:    "Nedzl Vendor",
-			Email:       product.GuestEmail,
-			PhoneNumber: product.GuestPhone,
-			IsVerified:  false,
-			CreatedAt:   product.CreatedAt,
+			UserName:   "Nedzl Vendor",
+			IsVerified: false,
+			CreatedAt:  product.CreatedAt,
 		}
 	}
 
@@ -86,13 +84,27 @@ func ConvertToProductResponse(product models.Products, isLiked bool) models.Prod
 		DeliveryFee:       product.DeliveryFee,
 		OldPrice:          product.OldPrice,
 		DiscountPercent:   product.DiscountPercent,
-		GuestEmail:        product.GuestEmail,
-		GuestPhone:        product.GuestPhone,
 		IsGuestListing:    product.IsGuestListing,
 		ServiceType:       product.ServiceType,
 	}
 }
 
+// parsePriceRange converts the min_price/max_price query params (in Naira) to kobo.
+func parsePriceRange(minPrice, maxPrice string) (models.Money, models.Money, bool) {
+	if minPrice == "" || maxPrice == "" {
+		return models.Money{}, models.Money{}, false
+	}
+	min, err := models.ParseNaira(minPrice)
+	if err != nil {
+		return models.Money{}, models.Money{}, false
+	}
+	max, err := models.ParseNaira(maxPrice)
+	if err != nil {
+		return models.Money{}, models.Money{}, false
+	}
+	return min, max, true
+}
+
 func CreateProduct(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
@@ -120,24 +132,30 @@ func CreateProduct(db *gorm.DB) echo.HandlerFunc {
 			productType = "MARKET"
 		}
 
-		var deliveryFee float64
+		var deliveryFee models.Money
 		if deliveryFeeStr != "" {
-			deliveryFee, _ = strconv.ParseFloat(deliveryFeeStr, 64)
+			deliveryFee, _ = models.ParseNaira(deliveryFeeStr)
+		}
+
+		if subMenusRaw != "" {
+			if _, err := models.ParseSubMenuOptions([]byte(subMenusRaw)); err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Invalid sub menus", err)
+			}
 		}
 
 		// if name == "" || productPriceStr == "" || marketPriceFromStr == "" || marketPriceToStr == "" || categoryName == "" || isNegotiableStr == "" || description == "" || state == "" || addressInState == "" || outstandingIssues == "" || condition == "" || brandName == "" {
 		// 	return c.JSON(http.StatusBadRequest, echo.Map{"error": "All fields are required"})
 		// }
-		// Convert string values to float64
-		productPrice, err := strconv.ParseFloat(productPriceStr, 64)
+		// Convert string values to kobo amounts
+		productPrice, err := models.ParseNaira(productPriceStr)
 		if err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid product price", err)
 		}
-		marketPriceFrom, err := strconv.ParseFloat(marketPriceFromStr, 64)
+		marketPriceFrom, err := models.ParseNaira(marketPriceFromStr)
 		if err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid market price (from)", err)
 		}
-		marketPriceTo, err := strconv.ParseFloat(marketPriceToStr, 64)
+		marketPriceTo, err := models.ParseNaira(marketPriceToStr)
 		if err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid market price (to)", err)
 		}
@@ -223,7 +241,13 @@ func CreateProduct(db *gorm.DB) echo.HandlerFunc {
 			ServiceType:       serviceType,
 		}
 
-		if err := db.Create(&products).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&products).Error; err != nil {
+				return err
+			}
+			return queueSearchAlertEmails(tx, products)
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to save product", err)
 		}
 
@@ -235,10 +259,10 @@ func CreateProduct(db *gorm.DB) echo.HandlerFunc {
 		// Convert to safe response without password
 		response := ConvertToProductResponse(products, false)
 
-		// Trigger Facebook Auto-Post and Search Alerts in background
+		// Trigger Facebook Auto-Post in background
 		go func(p models.Products) {
-			// 1. Facebook/Instagram Auto Post
-			message := fmt.Sprintf("🛍️ New Product Alert: %s\n\nPrice: ₦%.2f\nCondition: %s\n\nCheck it out on Nedzl!", p.Name, p.ProductPrice, p.Condition)
+			// Facebook/Instagram Auto Post
+			message := fmt.Sprintf("🛍️ New Product Alert: %s\n\nPrice: ₦%s\nCondition: %s\n\nCheck it out on Nedzl!", p.Name, p.ProductPrice.Naira(), p.Condition)
 			link := fmt.Sprintf("https://nedzl.com/product-details/%s", p.ID.String())
 			igCaption := fmt.Sprintf("%s\n\nLink in bio or copy: %s", message, link)
 			if len(imageUrls) > 0 {
@@ -250,28 +274,32 @@ func CreateProduct(db *gorm.DB) echo.HandlerFunc {
 					log.Printf("Instagram auto-post failed for product %s: %v", p.ID, err)
 				}
 			}
-
-			// 2. Search Alerts Matching
-			var alerts []models.SearchAlert
-			err := db.Where("(category = '' OR category = ?) AND (keyword = '' OR ? ILIKE '%' || keyword || '%')",
-				p.CategoryName, p.Name).Find(&alerts).Error
-			if err != nil {
-				log.Printf("Failed to fetch search alerts: %v", err)
-				return
-			}
-			for _, alert := range alerts {
-				err := emails.SendSearchAlertNotificationMail(alert.Email, alert.Keyword, alert.Category, p.Name, p.ID.String())
-				if err != nil {
-					log.Printf("Failed to send search alert email to %s: %v", alert.Email, err)
-				} else {
-					db.Delete(&alert)
-				}
-			}
 		}(products)
 
 		return utils.ResponseSucess(c, http.StatusCreated, "Product created successfully", echo.Map{"products": response})
 	}
 }
+
+// queueSearchAlertEmails queues an email for every search alert a new product matches. Alerts
+// fire once, so the matched ones are removed.
+func queueSearchAlertEmails(tx *gorm.DB, p models.Products) error {
+	var alerts []models.SearchAlert
+	err := tx.Where("(category = '' OR category = ?) AND (keyword = '' OR ? ILIKE '%' || keyword || '%')",
+		p.CategoryName, p.Name).Find(&alerts).Error
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if _, err := emails.Queue(tx, emails.KindSearchAlert, alert.Email, alert.Keyword, alert.Category, p.Name, p.ID.String()); err != nil {
+			return err
+		}
+		if err := tx.Delete(&alert).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func UpdateUserProduct(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		userId := c.Get("user_id").(uuid.UUID)
@@ -306,16 +334,22 @@ func UpdateUserProduct(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusBadRequest, "Required fields are missing", nil)
 		}
 
-		productP, err := strconv.ParseFloat(productPrice, 64)
+		if subMenusRaw != "" {
+			if _, err := models.ParseSubMenuOptions([]byte(subMenusRaw)); err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Invalid sub menus", err)
+			}
+		}
+
+		productP, err := models.ParseNaira(productPrice)
 		if err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid product price", err)
 		}
-		marketPFrom, _ := strconv.ParseFloat(marketPriceFrom, 64)
-		if marketPFrom == 0 {
+		marketPFrom, _ := models.ParseNaira(marketPriceFrom)
+		if marketPFrom.IsZero() {
 			marketPFrom = productP
 		}
-		marketPTo, _ := strconv.ParseFloat(marketPriceTo, 64)
-		if marketPTo == 0 {
+		marketPTo, _ := models.ParseNaira(marketPriceTo)
+		if marketPTo.IsZero() {
 			marketPTo = productP
 		}
 
@@ -378,20 +412,13 @@ func UpdateUserProduct(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		// Detect Price Reduction / Price Slash
-		if productP < existingProduct.ProductPrice && existingProduct.ProductPrice > 0 {
+		priceSlashed := productP.Kobo < existingProduct.ProductPrice.Kobo && existingProduct.ProductPrice.IsPositive()
+		if priceSlashed {
 			oldP := existingProduct.ProductPrice
-			disc := int(math.Round(((oldP - productP) / oldP) * 100))
+			disc := int(math.Round(float64(oldP.Kobo-productP.Kobo) / float64(oldP.Kobo) * 100))
 			existingProduct.OldPrice = oldP
 			existingProduct.DiscountPercent = disc
 
-			// Notify users who searched for or viewed this product category in background
-			go func(p models.Products, oldPrice float64, newPrice float64, discountPct int) {
-				var alerts []models.SearchAlert
-				_ = db.Where("(category = '' OR category = ?) AND (keyword = '' OR ? ILIKE '%' || keyword || '%')", p.CategoryName, p.Name).Find(&alerts).Error
-				for _, alert := range alerts {
-					_ = emails.SendPriceSlashNotificationMail(alert.Email, p.Name, p.ID.String(), oldPrice, newPrice, discountPct)
-				}
-			}(existingProduct, oldP, productP, disc)
 		}
 
 		existingProduct.Name = productName
@@ -421,7 +448,7 @@ func UpdateUserProduct(db *gorm.DB) echo.HandlerFunc {
 			existingProduct.SubMenus = datatypes.JSON([]byte(subMenusRaw))
 		}
 		if deliveryFeeStr != "" {
-			deliveryFee, _ := strconv.ParseFloat(deliveryFeeStr, 64)
+			deliveryFee, _ := models.ParseNaira(deliveryFeeStr)
 			existingProduct.DeliveryFee = deliveryFee
 		}
 
@@ -429,7 +456,29 @@ func UpdateUserProduct(db *gorm.DB) echo.HandlerFunc {
 			existingProduct.Status = models.Status(status)
 		}
 		// Update only fields that were provided (prevent zero overwrite)
-		if err := db.Save(&existingProduct).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&existingProduct).Error; err != nil {
+				return err
+			}
+			if !priceSlashed {
+				return nil
+			}
+			// Notify users who searched for or viewed this product category
+			var alerts []models.SearchAlert
+			if err := tx.Scopes(emails.Subscribers(models.NotifyPriceDrops, "email")).
+				Where("(category = '' OR category = ?) AND (keyword = '' OR ? ILIKE '%' || keyword || '%')",
+					existingProduct.CategoryName, existingProduct.Name).Find(&alerts).Error; err != nil {
+				return err
+			}
+			for _, alert := range alerts {
+				if _, err := emails.Queue(tx, emails.KindPriceSlash, alert.Email, existingProduct.Name, existingProduct.ID.String(),
+					existingProduct.OldPrice, existingProduct.ProductPrice, existingProduct.DiscountPercent); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update product", err)
 		}
 
@@ -517,8 +566,8 @@ func GetAllProducts(db *gorm.DB) echo.HandlerFunc {
 		if startDate != "" && endDate != "" {
 			query = query.Where("created_at BETWEEN  ? AND ?", startDate, endDate)
 		}
-		if minPrice != "" && maxPrice != "" {
-			query = query.Where("product_price BETWEEN  ? AND ?", minPrice, maxPrice)
+		if minKobo, maxKobo, ok := parsePriceRange(minPrice, maxPrice); ok {
+			query = query.Where("product_price BETWEEN ? AND ?", minKobo, maxKobo)
 		}
 		serviceType := c.QueryParam("service_type")
 		if serviceType != "" {
@@ -669,8 +718,8 @@ func GetUserProducts(db *gorm.DB) echo.HandlerFunc {
 		if startDate != "" && endDate != "" {
 			query = query.Where("created_at BETWEEN ? AND ?", startDate, endDate)
 		}
-		if minPrice != "" && maxPrice != "" {
-			query = query.Where("product_price BETWEEN ? AND ?", minPrice, maxPrice)
+		if minKobo, maxKobo, ok := parsePriceRange(minPrice, maxPrice); ok {
+			query = query.Where("product_price BETWEEN ? AND ?", minKobo, maxKobo)
 		}
 		if keyword != "" {
 			query = query.Where("name ILIKE ? OR description ILIKE ?", "%"+keyword+"%", "%"+keyword+"%")
@@ -752,10 +801,26 @@ func GetSingleProduct(db *gorm.DB) echo.HandlerFunc {
 
 		// Send email if first view and is_notified is false
 		if !product.IsNotified && product.User.Email != "" {
-			db.Model(&product).Update("is_notified", true)
-			go func(email, uName, pName string, pID uuid.UUID) {
-				_ = emails.SendProductViewedMail(email, uName, pName, pID.String())
-			}(product.User.Email, product.User.UserName, product.Name, product.ID)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				result := tx.Model(&product).Where("is_notified = ?", false).Update("is_notified", true)
+				if result.Error != nil || result.RowsAffected == 0 {
+					return result.Error
+				}
+				if _, err := emails.Queue(tx, emails.KindProductViewed, product.User.Email, product.User.UserName, product.Name, product.ID.String()); err != nil {
+					return err
+				}
+				return notifications.Notify(tx, models.Notification{
+					UserID:   product.User.ID,
+					Kind:     models.NotificationProduct,
+					Title:    "Someone viewed your listing",
+					Body:     fmt.Sprintf("%s just got its first view.", product.Name),
+					Link:     "/product-details/" + product.ID.String(),
+					EntityID: &product.ID,
+				})
+			})
+			if err != nil {
+				log.Printf("Failed to notify owner of first view of %s: %v", product.ID, err)
+			}
 		}
 
 		// Check if user has liked this product
@@ -1105,7 +1170,7 @@ func GetPublicStats(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count products", err)
 		}
 
-		if err := db.Model(&models.User{}).Where("role = ? AND status = ?", models.RoleUser, models.UserActive).Count(&sellerCount).Error; err != nil {
+		if err := db.Model(&models.User{}).Where("role IN ? AND status = ?", models.MarketplaceRoles, models.UserActive).Count(&sellerCount).Error; err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count vendors", err)
 		}
 
@@ -1157,16 +1222,16 @@ func CreateGuestProduct(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusBadRequest, "Required fields are missing", nil)
 		}
 
-		productPrice, err := strconv.ParseFloat(productPriceStr, 64)
+		productPrice, err := models.ParseNaira(productPriceStr)
 		if err != nil {
 			return utils.ResponseError(c, http.StatusBadRequest, "Invalid product price", err)
 		}
-		marketPriceFrom, _ := strconv.ParseFloat(marketPriceFromStr, 64)
-		if marketPriceFrom == 0 {
+		marketPriceFrom, _ := models.ParseNaira(marketPriceFromStr)
+		if marketPriceFrom.IsZero() {
 			marketPriceFrom = productPrice
 		}
-		marketPriceTo, _ := strconv.ParseFloat(marketPriceToStr, 64)
-		if marketPriceTo == 0 {
+		marketPriceTo, _ := models.ParseNaira(marketPriceToStr)
+		if marketPriceTo.IsZero() {
 			marketPriceTo = productPrice
 		}
 
@@ -1236,20 +1301,23 @@ func CreateGuestProduct(db *gorm.DB) echo.HandlerFunc {
 			IsGuestListing:    true,
 		}
 
-		if err := db.Create(&product).Error; err != nil {
+		// Email the guest user informing them of the listing and encouraging account registration
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
+			_, err := emails.Queue(tx, emails.KindGuestProductListed, guestEmail, name, product.ID.String())
+			return err
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to save guest product", err)
 		}
 
-		// Send Email to Guest User informing them of listing and encouraging account registration
-		go func(email, pName, pID string) {
-			_ = emails.SendGuestProductListedEmail(email, pName, pID)
-		}(guestEmail, name, product.ID.String())
-
 		response := ConvertToProductResponse(product, false)
 
 		func(p models.Products) {
-			// 1. Facebook/Instagram Auto Post
-			message := fmt.Sprintf("🛍️ New Product Alert: %s\n\nPrice: ₦%.2f\nCondition: %s\n\nCheck it out on Nedzl!", p.Name, p.ProductPrice, p.Condition)
+			// Facebook/Instagram Auto Post
+			message := fmt.Sprintf("🛍️ New Product Alert: %s\n\nPrice: ₦%s\nCondition: %s\n\nCheck it out on Nedzl!", p.Name, p.ProductPrice.Naira(), p.Condition)
 			link := fmt.Sprintf("https://nedzl.com/product-details/%s", p.ID.String())
 			igCaption := fmt.Sprintf("%s\n\nLink in bio or copy: %s", message, link)
 			if len(imageUrls) > 0 {
@@ -3,9 +3,12 @@ package handlers
 import (
 	"api/emails"
 	"api/models"
+	"api/notifications"
 	"api/utils"
+	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
 )
@@ -46,27 +49,99 @@ func UpdateProductStatus(db *gorm.DB) echo.HandlerFunc {
 		// Store original status for reactivation check
 		oldStatus := product.Status
 
-		// Update with all fields
-		result := db.Model(&models.Products{}).Where("id = ?", id).Updates(updateData)
-		if result.Error != nil {
-			return utils.ResponseError(c, 500, "Failed to update product status", result.Error)
+		// Update with all fields, queueing the owner's email with the change
+		var result *gorm.DB
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result = tx.Model(&models.Products{}).Where("id = ?", id).Updates(updateData)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			var err error
+			var title, message string
+			switch {
+			case models.Status(body.Status) == models.StatusRejected:
+				_, err = emails.Queue(tx, emails.KindProductDeactivation, product.User.Email, product.User.UserName, product.Name, body.Reason)
+				title, message = "Your listing was removed", fmt.Sprintf("%s was removed from the marketplace. Reason: %s", product.Name, body.Reason)
+			case models.Status(body.Status) == models.StatusClosed:
+				_, err = emails.Queue(tx, emails.KindProductClosure, product.User.Email, product.User.UserName, product.Name)
+				title, message = "Your listing was closed", fmt.Sprintf("%s is no longer visible to buyers.", product.Name)
+			// Check if status was CLOSED and now is REACTIVATED
+			case oldStatus == models.StatusClosed && models.Status(body.Status) == models.StatusOngoing:
+				_, err = emails.Queue(tx, emails.KindProductReactivation, product.User.Email, product.User.UserName, product.Name, id)
+				title, message = "Your listing is live again", fmt.Sprintf("%s has been reactivated and is visible to buyers.", product.Name)
+			}
+			if err != nil || title == "" || product.UserID == nil {
+				return err
+			}
+			return notifications.Notify(tx, models.Notification{
+				UserID:   *product.UserID,
+				Kind:     models.NotificationProduct,
+				Title:    title,
+				Body:     message,
+				Link:     "/product-details/" + product.ID.String(),
+				EntityID: &product.ID,
+			})
+		})
+		if err != nil {
+			return utils.ResponseError(c, 500, "Failed to update product status", err)
 		}
 
-		if models.Status(body.Status) == models.StatusRejected {
-			go emails.SendProductDeactivationEmail(product.User.Email, product.User.UserName, product.Name, body.Reason)
+		if result.RowsAffected == 0 {
+			return utils.ResponseError(c, 404, "Product not found", nil)
 		}
 
-		if models.Status(body.Status) == models.StatusClosed {
-			go emails.SendProductClosureEmail(product.User.Email, product.User.UserName, product.Name)
+		return utils.ResponseSucess(c, 200, "Product status updated", map[string]string{"status": body.Status})
+	}
+}
+
+// UpdateOwnProductStatus lets a seller close their own listing or reopen one
+// they closed. Rejections and review decisions stay with moderators on the
+// admin route.
+func UpdateOwnProductStatus(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, 400, "Invalid input", err)
+		}
+
+		status := models.Status(body.Status)
+		if status != models.StatusClosed && status != models.StatusOngoing {
+			return utils.ResponseError(c, 400, "Status must be CLOSED or ONGOING", nil)
+		}
+
+		var product models.Products
+		if err := db.Where("id = ? AND user_id = ? AND is_deleted_by_user = ?", id, userID, false).First(&product).Error; err != nil {
+			return utils.ResponseError(c, 404, "Product not found", err)
 		}
 
-		// Check if status was CLOSED and now is REACTIVATED
-		if oldStatus == models.StatusClosed && models.Status(body.Status) == models.StatusOngoing {
-			go emails.SendProductReactivationEmail(product.User.Email, product.User.UserName, product.Name, id)
+		updateData := map[string]interface{}{"status": status}
+		switch status {
+		case models.StatusClosed:
+			if product.Status != models.StatusOngoing {
+				return utils.ResponseError(c, 409, "Only live listings can be closed", nil)
+			}
+			now := time.Now()
+			updateData["closed_at"] = &now
+		case models.StatusOngoing:
+			if product.Status != models.StatusClosed {
+				return utils.ResponseError(c, 409, "Only closed listings can be reopened", nil)
+			}
 		}
 
+		// Guard on the status we read so a moderator's concurrent decision is
+		// not overwritten.
+		result := db.Model(&models.Products{}).Where("id = ? AND status = ?", product.ID, product.Status).Updates(updateData)
+		if result.Error != nil {
+			return utils.ResponseError(c, 500, "Failed to update product status", result.Error)
+		}
 		if result.RowsAffected == 0 {
-			return utils.ResponseError(c, 404, "Product not found", nil)
+			return utils.ResponseError(c, 409, "Product status changed, please retry", nil)
 		}
 
 		return utils.ResponseSucess(c, 200, "Product status updated", map[string]string{"status": body.Status})
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"api/models"
+	"api/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuoteRequest struct {
+	ServiceID      uuid.UUID `json:"service_id"`
+	ScheduledDate  time.Time `json:"scheduled_date"` // preferred start date
+	ServiceAddress string    `json:"service_address"`
+	CustomerPhone  string    `json:"customer_phone"`
+	Notes          string    `json:"notes"` // what the customer needs done
+}
+
+type QuoteItemRequest struct {
+	Description string       `json:"description"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   models.Money `json:"unit_price"`
+}
+
+type MilestoneRequest struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Amount      models.Money `json:"amount"`
+	DueDate     *time.Time   `json:"due_date"`
+}
+
+type SendQuoteRequest struct {
+	Items      []QuoteItemRequest `json:"items"`
+	Milestones []MilestoneRequest `json:"milestones"`
+	Notes      string             `json:"notes"`
+	ValidUntil *time.Time         `json:"valid_until"`
+}
+
+type PayMilestoneRequest struct {
+	CallbackURL string `json:"callback_url"`
+}
+
+// RequestServiceQuote opens a quoted booking: the customer describes the job and the artisan
+// replies with a quote instead of the service's fixed price.
+func RequestServiceQuote(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req QuoteRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+		if req.ServiceID == uuid.Nil || req.ServiceAddress == "" || req.CustomerPhone == "" || strings.TrimSpace(req.Notes) == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Service ID, address, customer phone and a description of the job are required", nil)
+		}
+
+		var service models.Products
+		if err := db.First(&service, "id = ?", req.ServiceID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Service not found", err)
+		}
+		if service.ProductType != "SERVICE" || service.UserID == nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Quotes can only be requested for services", nil)
+		}
+		if *service.UserID == userID {
+			return utils.ResponseError(c, http.StatusBadRequest, "You cannot request a quote for your own service", nil)
+		}
+
+		if req.ScheduledDate.IsZero() {
+			req.ScheduledDate = time.Now().Add(24 * time.Hour)
+		}
+
+		booking := models.ServiceBooking{
+			BookingNumber:  fmt.Sprintf("NDZ-BK-%d", time.Now().UnixNano()/1e6),
+			UserID:         userID,
+			ArtisanID:      *service.UserID,
+			ServiceID:      service.ID,
+			PricingType:    models.PricingQuote,
+			BookingFee:     models.NGN(0),
+			PlatformFee:    models.NGN(0),
+			ArtisanPayout:  models.NGN(0),
+			ScheduledDate:  req.ScheduledDate,
+			ServiceAddress: req.ServiceAddress,
+			CustomerPhone:  req.CustomerPhone,
+			Notes:          req.Notes,
+			Status:         models.BookingQuoteRequested,
+			PaymentStatus:  models.PaymentByMilestone,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&booking).Error; err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, models.ActorCustomer, "Quote requested",
+				fmt.Sprintf("A customer has asked for a quote for %s: %s", service.Name, req.Notes))
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to request quote", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Quote requested", booking)
+	}
+}
+
+// SendServiceQuote lets the artisan price a quoted booking with line items and milestones.
+func SendServiceQuote(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		artisanID := c.Get("user_id").(uuid.UUID)
+
+		var req SendQuoteRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+
+		quote := models.Quote{Notes: req.Notes, ValidUntil: req.ValidUntil}
+		for _, item := range req.Items {
+			quote.Items = append(quote.Items, models.QuoteItem{
+				Description: strings.TrimSpace(item.Description),
+				Quantity:    item.Quantity,
+				UnitPrice:   item.UnitPrice,
+			})
+		}
+		for _, m := range req.Milestones {
+			quote.Milestones = append(quote.Milestones, models.Milestone{
+				Title:       strings.TrimSpace(m.Title),
+				Description: m.Description,
+				Amount:      m.Amount,
+				DueDate:     m.DueDate,
+			})
+		}
+
+		var booking models.ServiceBooking
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, c.Param("id")).Where("artisan_id = ?", artisanID).First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := utils.SendQuote(tx, &booking, &quote); err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, models.ActorVendor, "Quote received",
+				fmt.Sprintf("The artisan has quoted %s for this job, paid in %d milestone(s). Review and accept it from your dashboard.",
+					quote.Total, len(quote.Milestones)))
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to send quote", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Quote sent", quote)
+	}
+}
+
+// GetBookingQuotes lists every quote sent for a booking, newest first.
+func GetBookingQuotes(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var booking models.ServiceBooking
+		if err := db.Where("id = ? AND (user_id = ? OR artisan_id = ?)", c.Param("id"), userID, userID).
+			First(&booking).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+
+		var quotes []models.Quote
+		if err := db.Preload("Items").
+			Preload("Milestones", func(tx *gorm.DB) *gorm.DB { return tx.Order("sequence ASC") }).
+			Where("booking_id = ?", booking.ID).Order("created_at DESC").Find(&quotes).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch quotes", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"data": quotes,
+		})
+	}
+}
+
+func AcceptServiceQuote(db *gorm.DB) echo.HandlerFunc {
+	return respondToServiceQuote(db, true)
+}
+
+func DeclineServiceQuote(db *gorm.DB) echo.HandlerFunc {
+	return respondToServiceQuote(db, false)
+}
+
+// respondToServiceQuote lets the customer accept a quote, booking the job at the quoted
+// price, or decline it so the artisan can send another.
+func respondToServiceQuote(db *gorm.DB, accept bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var quote models.Quote
+		var booking models.ServiceBooking
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				First(&quote, "id = ? AND customer_id = ?", c.Param("id"), userID).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := lockBooking(tx, quote.BookingID.String()).First(&booking).Error; err != nil {
+				return err
+			}
+			if !accept {
+				if err := utils.DeclineQuote(tx, &quote); err != nil {
+					return err
+				}
+				return notifyBookingCounterparty(tx, booking.ID, models.ActorCustomer, "Quote declined",
+					"The customer declined your quote. You can send a revised one from your dashboard.")
+			}
+			if err := utils.AcceptQuote(tx, &quote, &booking); err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, models.ActorCustomer, "Quote accepted",
+				fmt.Sprintf("The customer accepted your quote of %s. You will be notified as each milestone is paid.", quote.Total))
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Quote not found", err)
+		}
+		if errors.Is(err, utils.ErrSlotTaken) || errors.Is(err, utils.ErrSlotUnavailable) {
+			return slotError(c, err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to respond to quote", err)
+		}
+
+		result := "declined"
+		if accept {
+			result = "accepted"
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message": "Quote " + result,
+			"quote":   quote,
+			"booking": booking,
+		})
+	}
+}
+
+// GetBookingMilestones lists the milestones of a quoted booking's accepted quote.
+func GetBookingMilestones(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var booking models.ServiceBooking
+		if err := db.Where("id = ? AND (user_id = ? OR artisan_id = ?)", c.Param("id"), userID, userID).
+			First(&booking).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+
+		milestones, err := utils.BookingMilestones(db, booking)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch milestones", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"data": milestones,
+		})
+	}
+}
+
+// lockMilestoneFor scopes tx to the milestone with id, locking its row, for the user on the
+// given side of it ("customer_id" or "artisan_id"), or for anyone when column is empty.
+func lockMilestoneFor(tx *gorm.DB, id string, column string, userID uuid.UUID) (models.Milestone, models.ServiceBooking, error) {
+	var milestone models.Milestone
+	var booking models.ServiceBooking
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id)
+	if column != "" {
+		query = query.Where(column+" = ?", userID)
+	}
+	if err := query.First(&milestone).Error; err != nil {
+		return milestone, booking, err
+	}
+	err := lockBooking(tx, milestone.BookingID.String()).First(&booking).Error
+	return milestone, booking, err
+}
+
+// PayMilestone starts the Paystack payment of the next unpaid milestone of a quoted booking.
+func PayMilestone(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req PayMilestoneRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+
+		var milestone models.Milestone
+		if err := db.First(&milestone, "id = ? AND customer_id = ?", c.Param("id"), userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Milestone not found", err)
+		}
+		var booking models.ServiceBooking
+		if err := db.First(&booking, "id = ?", milestone.BookingID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+		if err := utils.CanPayMilestone(db, milestone, booking); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "This milestone cannot be paid", err)
+		}
+
+		var customer models.User
+		db.First(&customer, "id = ?", userID)
+		customerEmail := customer.Email
+		if customerEmail == "" {
+			customerEmail = "customer@nedzl.com"
+		}
+
+		callbackURL := req.CallbackURL
+		if callbackURL == "" {
+			callbackURL = fmt.Sprintf("%s/dashboard?tab=service_bookings", utils.GetFrontendBaseURL(c))
+		}
+		reference := utils.NewMilestoneReference(booking, milestone)
+		checkoutURL, err := utils.InitializePaystackTransaction(customerEmail, milestone.Amount, reference, callbackURL)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadGateway, "Failed to start payment", err)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			milestone, booking, err = lockMilestoneFor(tx, milestone.ID.String(), "customer_id", userID)
+			if err != nil {
+				return err
+			}
+			if err := utils.CanPayMilestone(tx, milestone, booking); err != nil {
+				return err
+			}
+
+			milestone.PaymentReference = reference
+			milestone.PaymentStatus = "PENDING"
+			if err := tx.Model(&milestone).Updates(map[string]interface{}{
+				"payment_reference": reference,
+				"payment_status":    "PENDING",
+			}).Error; err != nil {
+				return err
+			}
+			// Only in payments dev mode is there no checkout; the milestone goes straight into escrow
+			if checkoutURL == "" {
+				return utils.FundMilestone(tx, &milestone)
+			}
+			return nil
+		})
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to start milestone payment", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Milestone payment started", echo.Map{
+			"milestone":    milestone,
+			"checkout_url": checkoutURL,
+		})
+	}
+}
+
+// ArtisanCompleteMilestone lets the artisan mark the work a funded milestone covers as done,
+// asking the customer to release it.
+func ArtisanCompleteMilestone(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		artisanID := c.Get("user_id").(uuid.UUID)
+
+		var milestone models.Milestone
+		var booking models.ServiceBooking
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			milestone, booking, err = lockMilestoneFor(tx, c.Param("id"), "artisan_id", artisanID)
+			if err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := utils.CompleteMilestone(tx, &milestone); err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, models.ActorVendor, "Milestone completed",
+				fmt.Sprintf("The artisan has marked milestone %d (%s) as done. Release the payment once you are happy with the work.",
+					milestone.Sequence, milestone.Title))
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Milestone not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to complete milestone", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message":   "Milestone marked as completed. Waiting for the customer to release payment.",
+			"milestone": milestone,
+		})
+	}
+}
+
+// ReleaseMilestonePayment lets the customer release a milestone's escrow to the artisan.
+func ReleaseMilestonePayment(db *gorm.DB) echo.HandlerFunc {
+	return releaseMilestone(db, models.ActorCustomer)
+}
+
+// AdminReleaseMilestone releases a milestone's escrow to the artisan on the customer's behalf.
+func AdminReleaseMilestone(db *gorm.DB) echo.HandlerFunc {
+	return releaseMilestone(db, models.ActorAdmin)
+}
+
+func releaseMilestone(db *gorm.DB, actor string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		column := "customer_id"
+		if actor == models.ActorAdmin {
+			column = ""
+		}
+
+		var milestone models.Milestone
+		var booking models.ServiceBooking
+		var payout *models.Payout
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			milestone, booking, err = lockMilestoneFor(tx, c.Param("id"), column, userID)
+			if err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			payout, err = utils.ReleaseMilestone(tx, &milestone, &booking)
+			if err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, models.ActorCustomer, "Milestone payment released",
+				fmt.Sprintf("Payment for milestone %d (%s) has been released to you: %s after fees.",
+					milestone.Sequence, milestone.Title, milestone.ArtisanPayout))
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Milestone not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to release milestone", err)
+		}
+
+		go utils.ProcessPayout(db, payout.ID)
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message":   "Milestone payment released to artisan.",
+			"milestone": milestone,
+			"booking":   booking,
+		})
+	}
+}
+
+// AdminRefundMilestone refunds a paid milestone in full, whether its payment is still in
+// escrow or was released to the artisan, as long as the payout has not gone out.
+func AdminRefundMilestone(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+
+		var milestone models.Milestone
+		var refund *models.Refund
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var booking models.ServiceBooking
+			var err error
+			milestone, booking, err = lockMilestoneFor(tx, c.Param("id"), "", adminID)
+			if err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+
+			reason := body.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("Milestone %d of booking %s refunded by Nedzl", milestone.Sequence, booking.BookingNumber)
+			}
+			refund, err = utils.RequestMilestoneRefund(tx, &milestone, reason, models.ActorAdmin, &adminID)
+			return err
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Milestone not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to refund milestone", err)
+		}
+
+		go utils.ProcessRefund(db, refund.ID)
+
+		return utils.ResponseSucess(c, http.StatusOK, "Refund requested", echo.Map{
+			"milestone": milestone,
+			"refund":    refund,
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"api/models"
+	"api/utils"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// GetAdminRefunds lists refunds, newest first, optionally filtered by status and source type.
+func GetAdminRefunds(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := db.Model(&models.Refund{})
+
+		page, _ := strconv.Atoi(c.QueryParam("page"))
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		if page < 1 {
+			page = 1
+		}
+		if limit < 1 {
+			limit = 20
+		}
+		offset := (page - 1) * limit
+
+		if status := c.QueryParam("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if sourceType := c.QueryParam("source_type"); sourceType != "" {
+			query = query.Where("source_type = ?", sourceType)
+		}
+		if reference := c.QueryParam("reference"); reference != "" {
+			query = query.Where("transaction_reference = ?", reference)
+		}
+
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to count refunds", err)
+		}
+
+		var refunds []models.Refund
+		if err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&refunds).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve refunds", err)
+		}
+
+		totalPages := int(math.Ceil(float64(total) / float64(limit)))
+
+		return utils.ResponseSucess(c, http.StatusOK, "Refunds fetched successfully", echo.Map{
+			"data":  refunds,
+			"total": total,
+			"meta": map[string]interface{}{
+				"page":       page,
+				"limit":      limit,
+				"totalPages": totalPages,
+			},
+		})
+	}
+}
+
+// RetryRefund resubmits a FAILED or stuck PENDING refund to Paystack.
+func RetryRefund(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var refund models.Refund
+		if err := db.First(&refund, "id = ?", c.Param("id")).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Refund not found", err)
+		}
+
+		if refund.Status != models.RefundFailed && refund.Status != models.RefundPending {
+			return utils.ResponseError(c, http.StatusBadRequest, "Only failed or pending refunds can be retried", nil)
+		}
+
+		if err := utils.ProcessRefund(db, refund.ID); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to submit refund", err)
+		}
+
+		db.First(&refund, "id = ?", refund.ID)
+		return utils.ResponseSucess(c, http.StatusOK, "Refund resubmitted", refund)
+	}
+}
+
+// AdminRefundServiceBooking refunds a paid booking in full, whether its payment is still in
+// escrow or was released to the artisan, as long as the payout has not gone out.
+func AdminRefundServiceBooking(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+
+		var booking models.ServiceBooking
+		var refund *models.Refund
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, c.Param("id")).First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+
+			reason := body.Reason
+			if reason == "" {
+				reason = "Booking " + booking.BookingNumber + " refunded by Nedzl"
+			}
+			var err error
+			refund, err = utils.RequestBookingRefund(tx, &booking, reason, models.ActorAdmin, &adminID)
+			return err
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to refund booking", err)
+		}
+
+		go utils.ProcessRefund(db, refund.ID)
+
+		return utils.ResponseSucess(c, http.StatusOK, "Refund requested", echo.Map{
+			"booking": booking,
+			"refund":  refund,
+		})
+	}
+}
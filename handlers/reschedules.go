@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"api/emails"
+	"api/models"
+	"api/notifications"
+	"api/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RescheduleRequest struct {
+	ScheduledDate time.Time `json:"scheduled_date"`
+	Reason        string    `json:"reason"`
+}
+
+// bookingUpdateError reports a failed reschedule or no-show, keeping slot conflicts distinct.
+func bookingUpdateError(c echo.Context, notFound bool, message string, err error) error {
+	switch {
+	case notFound:
+		return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+	case errors.Is(err, utils.ErrSlotTaken), errors.Is(err, utils.ErrSlotUnavailable):
+		return slotError(c, err)
+	}
+	return utils.ResponseError(c, http.StatusBadRequest, message, err)
+}
+
+// ProposeBookingReschedule lets the customer or artisan ask to move a booked service to a new
+// time. The booking keeps its current date until the other party accepts.
+func ProposeBookingReschedule(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req RescheduleRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid request body", err)
+		}
+		if req.ScheduledDate.IsZero() {
+			return utils.ResponseError(c, http.StatusBadRequest, "scheduled_date is required", nil)
+		}
+
+		var booking models.ServiceBooking
+		var proposal *models.RescheduleProposal
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, c.Param("id")).Where("user_id = ? OR artisan_id = ?", userID, userID).
+				First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			var err error
+			proposal, err = utils.ProposeReschedule(tx, &booking, utils.BookingParty(booking, userID), userID, req.ScheduledDate, req.Reason)
+			if err != nil {
+				return err
+			}
+			return notifyBookingCounterparty(tx, booking.ID, proposal.ProposedBy, "New time proposed",
+				fmt.Sprintf("The %s has asked to move this booking to %s. Accept or decline the proposal from your dashboard.",
+					partyName(proposal.ProposedBy), proposal.ProposedDate.In(utils.Lagos).Format("Mon 2 Jan 2006, 3:04 PM")))
+		})
+		if err != nil {
+			return bookingUpdateError(c, notFound, "Failed to propose new time", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusCreated, "Reschedule proposed", proposal)
+	}
+}
+
+// GetBookingReschedules lists every reschedule proposal made on a booking, newest first.
+func GetBookingReschedules(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var booking models.ServiceBooking
+		if err := db.Where("id = ? AND (user_id = ? OR artisan_id = ?)", c.Param("id"), userID, userID).
+			First(&booking).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+
+		var proposals []models.RescheduleProposal
+		if err := db.Where("booking_id = ?", booking.ID).Order("created_at DESC").Find(&proposals).Error; err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch reschedule proposals", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"data":             proposals,
+			"reschedule_count": booking.RescheduleCount,
+			"reschedule_limit": utils.BookingRescheduleLimit(),
+		})
+	}
+}
+
+func AcceptBookingReschedule(db *gorm.DB) echo.HandlerFunc {
+	return respondToBookingReschedule(db, true)
+}
+
+func DeclineBookingReschedule(db *gorm.DB) echo.HandlerFunc {
+	return respondToBookingReschedule(db, false)
+}
+
+// respondToBookingReschedule accepts or declines a proposal on behalf of the party that did
+// not make it.
+func respondToBookingReschedule(db *gorm.DB, accept bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var proposal models.RescheduleProposal
+		var booking models.ServiceBooking
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&proposal, "id = ?", c.Param("id")).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := lockBooking(tx, proposal.BookingID.String()).Where("user_id = ? OR artisan_id = ?", userID, userID).
+				First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := utils.RespondToReschedule(tx, &proposal, &booking, accept, userID); err != nil {
+				return err
+			}
+
+			responder := utils.BookingParty(booking, userID)
+			headline, message := "New time declined",
+				fmt.Sprintf("The %s declined your proposal to move this booking. It stays on %s.",
+					partyName(responder), booking.ScheduledDate.In(utils.Lagos).Format("Mon 2 Jan 2006, 3:04 PM"))
+			if accept {
+				headline, message = "Booking rescheduled",
+					fmt.Sprintf("The %s accepted your proposal. This booking is now on %s.",
+						partyName(responder), booking.ScheduledDate.In(utils.Lagos).Format("Mon 2 Jan 2006, 3:04 PM"))
+			}
+			return notifyBookingCounterparty(tx, booking.ID, responder, headline, message)
+		})
+		if err != nil {
+			return bookingUpdateError(c, notFound, "Failed to respond to reschedule proposal", err)
+		}
+
+		result := "declined"
+		if accept {
+			result = "accepted"
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message":  "Reschedule proposal " + result,
+			"proposal": proposal,
+			"booking":  booking,
+		})
+	}
+}
+
+// ReportBookingNoShow lets either party report that the other missed a booked service. The
+// escrow is refunded to the customer (artisan no-show) or released to the artisan (customer
+// no-show) after 24 hours, unless the reported party disputes it first.
+func ReportBookingNoShow(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+
+		var booking models.ServiceBooking
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, c.Param("id")).Where("user_id = ? OR artisan_id = ?", userID, userID).
+				First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+			if err := utils.ReportNoShow(tx, &booking, userID); err != nil {
+				return err
+			}
+
+			reporter := utils.BookingParty(booking, userID)
+			message := "The artisan reported that you missed this booking. The payment will be released to them in 24 hours unless you raise a dispute before then."
+			switch {
+			case reporter == models.ActorCustomer:
+				message = "The customer reported that you did not show up for this booking. The payment will be refunded to them in 24 hours unless you raise a dispute before then."
+				if booking.PricingType == models.PricingQuote {
+					message = "The customer reported that you did not show up for this booking. Milestone payments stay in escrow until our team settles the booking."
+				}
+			case booking.PricingType == models.PricingQuote:
+				message = "The artisan reported that you missed this booking. Milestone payments stay in escrow until our team settles the booking."
+			}
+			if body.Reason != "" {
+				message += " Reason given: " + body.Reason
+			}
+			return notifyBookingCounterparty(tx, booking.ID, reporter, "No-show reported", message)
+		})
+		if err != nil {
+			return bookingUpdateError(c, notFound, "Failed to report no-show", err)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message": "No-show reported",
+			"booking": booking,
+		})
+	}
+}
+
+// partyName names a booking party the way customers and artisans see it.
+func partyName(actor string) string {
+	if actor == models.ActorVendor {
+		return "artisan"
+	}
+	return "customer"
+}
+
+// notifyBookingCounterparty tells the party on a booking other than actor, by email and in
+// the app.
+func notifyBookingCounterparty(tx *gorm.DB, bookingID uuid.UUID, actor, headline, message string) error {
+	var booking models.ServiceBooking
+	if err := tx.Preload("User").Preload("Artisan").First(&booking, "id = ?", bookingID).Error; err != nil {
+		return err
+	}
+
+	recipient := booking.Artisan
+	if actor == models.ActorVendor {
+		recipient = booking.User
+	}
+	if recipient.Email == "" {
+		return nil
+	}
+	if _, err := emails.Queue(tx, emails.KindBookingUpdate, recipient.Email, recipient.UserName, booking.BookingNumber, headline, message); err != nil {
+		return err
+	}
+	return notifications.Notify(tx, models.Notification{
+		UserID:   recipient.ID,
+		Kind:     models.NotificationBooking,
+		Title:    headline,
+		Body:     message,
+		Link:     "/dashboard?tab=service_bookings",
+		EntityID: &booking.ID,
+	})
+}
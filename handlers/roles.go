@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"api/models"
+	"api/notifications"
+	"api/utils"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errLastAdmin   = errors.New("the last active admin cannot be demoted, suspended or deleted")
+	errStaffTarget = errors.New("changing a staff account requires the roles:manage permission")
+)
+
+// guardAccountChange is checked before staff change another user's role or status or delete
+// them, with the user's row locked. Staff accounts can only be changed by those who manage
+// roles, so a moderator cannot suspend an admin, and removesAdmin is refused for the last
+// active admin.
+func guardAccountChange(tx *gorm.DB, c echo.Context, target models.User, removesAdmin bool) error {
+	role, _ := c.Get("role").(string)
+	if models.IsStaff(target.Role) && !models.HasPermission(models.Role(role), models.PermRolesManage) {
+		return errStaffTarget
+	}
+	if !removesAdmin || target.Role != models.RoleAdmin {
+		return nil
+	}
+
+	// Lock the other admins so two changes at once cannot leave none
+	var others []uuid.UUID
+	if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("role = ? AND status = ? AND id <> ?", models.RoleAdmin, models.UserActive, target.ID).
+		Pluck("id", &others).Error; err != nil {
+		return err
+	}
+	if len(others) == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// accountChangeError responds to an error from guardAccountChange. It returns false for other
+// errors, which the caller handles.
+func accountChangeError(c echo.Context, err error) (bool, error) {
+	switch err {
+	case errStaffTarget:
+		return true, utils.ResponseError(c, http.StatusForbidden, "You do not have permission to change staff accounts", err)
+	case errLastAdmin:
+		return true, utils.ResponseError(c, http.StatusConflict, "At least one active admin must remain", err)
+	}
+	return false, nil
+}
+
+// GetRoles returns every role with the back-office permissions it grants.
+func GetRoles(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		roles := []models.Role{
+			models.RoleUser, models.RoleVendor, models.RoleModerator,
+			models.RoleSupport, models.RoleFinance, models.RoleAdmin,
+		}
+
+		type roleEntry struct {
+			Role        models.Role         `json:"role"`
+			Staff       bool                `json:"staff"`
+			Permissions []models.Permission `json:"permissions"`
+		}
+		list := make([]roleEntry, len(roles))
+		for i, role := range roles {
+			perms := models.RolePermissions[role]
+			if perms == nil {
+				perms = []models.Permission{}
+			}
+			list[i] = roleEntry{Role: role, Staff: models.IsStaff(role), Permissions: perms}
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Roles fetched successfully", echo.Map{
+			"roles":       list,
+			"permissions": models.AllPermissions,
+		})
+	}
+}
+
+// AssignUserRole changes a user's role. It applies to their next request, since roles are
+// read from the database rather than the access token.
+func AssignUserRole(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		adminID := c.Get("user_id").(uuid.UUID)
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid user ID", err)
+		}
+
+		var body struct {
+			Role models.Role `json:"role"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+		if !models.IsValidRole(body.Role) {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid role", nil)
+		}
+		if id == adminID {
+			return utils.ResponseError(c, http.StatusForbidden, "You cannot change your own role", nil)
+		}
+
+		var user models.User
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", id).Error; err != nil {
+				return err
+			}
+			if user.Role == body.Role {
+				return nil
+			}
+
+			if err := guardAccountChange(tx, c, user, body.Role != models.RoleAdmin); err != nil {
+				return err
+			}
+
+			if err := tx.Model(&user).Update("role", body.Role).Error; err != nil {
+				return err
+			}
+			return notifications.Notify(tx, models.Notification{
+				UserID: user.ID,
+				Kind:   models.NotificationAccount,
+				Title:  "Your role has changed",
+				Body:   fmt.Sprintf("Your NedZl account role is now %s.", body.Role),
+			})
+		})
+		if err == gorm.ErrRecordNotFound {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+		if handled, resp := accountChangeError(c, err); handled {
+			return resp
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update role", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "User role updated", echo.Map{
+			"user_id":     user.ID,
+			"role":        body.Role,
+			"permissions": models.RolePermissions[body.Role],
+		})
+	}
+}
@@ -2,26 +2,31 @@ package handlers
 
 import (
 	"api/emails"
+	"api/ledger"
 	"api/models"
+	"api/notifications"
 	"api/utils"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type CreateServiceBookingRequest struct {
-	ServiceID        uuid.UUID `json:"service_id"`
-	ScheduledDate    time.Time `json:"scheduled_date"`
-	ServiceAddress   string    `json:"service_address"`
-	CustomerPhone    string    `json:"customer_phone"`
-	Notes            string    `json:"notes"`
-	BookingFee       float64   `json:"booking_fee"`
-	PaymentReference string    `json:"payment_reference"`
-	CallbackURL      string    `json:"callback_url"`
+	ServiceID        uuid.UUID    `json:"service_id"`
+	ScheduledDate    time.Time    `json:"scheduled_date"`
+	ServiceAddress   string       `json:"service_address"`
+	CustomerPhone    string       `json:"customer_phone"`
+	Notes            string       `json:"notes"`
+	BookingFee       models.Money `json:"booking_fee"`
+	PaymentReference string       `json:"payment_reference"`
+	CallbackURL      string       `json:"callback_url"`
 }
 
 func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
@@ -44,12 +49,41 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		fee := req.BookingFee
-		if fee <= 0 {
+		if !fee.IsPositive() {
 			fee = service.ProductPrice
 		}
 
-		platformFee := fee * 0.10
-		artisanPayout := fee * 0.90
+		rule, err := utils.ResolveCommissionRule(db, service, time.Now())
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to resolve commission", err)
+		}
+
+		platformFee := utils.CalculateCommission(rule, fee)
+		artisanPayout := fee.Sub(platformFee)
+
+		var commissionRuleID *uuid.UUID
+		if rule.ID != uuid.Nil {
+			commissionRuleID = &rule.ID
+		}
+
+		var artisanID uuid.UUID
+		if service.UserID != nil {
+			artisanID = *service.UserID
+		}
+
+		if req.ScheduledDate.IsZero() {
+			var scheduled int64
+			db.Model(&models.ServiceSchedule{}).Where("service_id = ?", service.ID).Count(&scheduled)
+			if scheduled > 0 {
+				return utils.ResponseError(c, http.StatusBadRequest, "Pick one of the artisan's open slots as the scheduled date", nil)
+			}
+			req.ScheduledDate = time.Now().Add(24 * time.Hour)
+		}
+
+		// Check the slot before starting a payment; it is reserved for real when the booking is saved
+		if _, err := utils.ReserveSlot(db, service.ID, artisanID, uuid.Nil, req.ScheduledDate); err != nil {
+			return slotError(c, err)
+		}
 
 		bookingNumber := fmt.Sprintf("NDZ-BK-%d", time.Now().UnixNano()/1e6)
 
@@ -64,7 +98,10 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 		if callbackURL == "" {
 			callbackURL = fmt.Sprintf("%s/dashboard?tab=service_bookings", utils.GetFrontendBaseURL(c))
 		}
-		checkoutURL, _ := utils.InitializePaystackTransaction(customerEmail, fee, bookingNumber, callbackURL)
+		checkoutURL, err := utils.InitializePaystackTransaction(customerEmail, fee, bookingNumber, callbackURL)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadGateway, "Failed to start payment", err)
+		}
 
 		status := "BOOKED"
 		paymentStatus := "HELD_IN_ESCROW"
@@ -73,18 +110,11 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 			paymentStatus = "PENDING"
 		}
 
-		paymentRef := req.PaymentReference
-		if paymentRef == "" {
-			paymentRef = bookingNumber
-		}
-
-		if req.ScheduledDate.IsZero() {
-			req.ScheduledDate = time.Now().Add(24 * time.Hour)
-		}
-
-		var artisanID uuid.UUID
-		if service.UserID != nil {
-			artisanID = *service.UserID
+		// Paystack knows the payment by the reference the checkout was started with; webhooks
+		// and refunds find it by that, so a client-supplied one only counts without a checkout
+		paymentRef := bookingNumber
+		if checkoutURL == "" && req.PaymentReference != "" {
+			paymentRef = req.PaymentReference
 		}
 
 		booking := models.ServiceBooking{
@@ -95,6 +125,7 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 			BookingFee:       fee,
 			PlatformFee:      platformFee,
 			ArtisanPayout:    artisanPayout,
+			CommissionRuleID: commissionRuleID,
 			ScheduledDate:    req.ScheduledDate,
 			ServiceAddress:   req.ServiceAddress,
 			CustomerPhone:    req.CustomerPhone,
@@ -104,31 +135,52 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 			PaymentStatus:    paymentStatus,
 		}
 
-		if err := db.Create(&booking).Error; err != nil {
-			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to create service booking", err)
-		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			slot, err := utils.ReserveSlot(tx, service.ID, artisanID, uuid.Nil, booking.ScheduledDate)
+			if err != nil {
+				return err
+			}
+			booking.ScheduledEndAt = &slot.End
 
-		// Notify artisan via email
-		go func() {
-			if service.User.Email != "" {
-				customerName := customer.UserName
-				if customerName == "" {
-					customerName = "Valued Customer"
+			if err := tx.Create(&booking).Error; err != nil {
+				return err
+			}
+			// Only in payments dev mode is there no checkout; the booking goes straight into escrow
+			if booking.PaymentStatus == "HELD_IN_ESCROW" {
+				if err := ledger.RecordBookingCharge(tx, booking); err != nil {
+					return err
 				}
+			}
 
-				_ = emails.SendArtisanBookingNotificationEmail(
-					service.User.Email,
-					service.User.UserName,
-					bookingNumber,
-					service.Name,
-					customerName,
-					req.CustomerPhone,
-					req.ServiceAddress,
-					req.ScheduledDate,
-					fee,
-				)
+			// Notify the artisan by email and in the app
+			if service.User.Email == "" {
+				return nil
+			}
+			customerName := customer.UserName
+			if customerName == "" {
+				customerName = "Valued Customer"
 			}
-		}()
+			_, err = emails.Queue(tx, emails.KindArtisanBooking,
+				service.User.Email,
+				service.User.UserName,
+				bookingNumber,
+				service.Name,
+				customerName,
+				req.CustomerPhone,
+				req.ServiceAddress,
+				req.ScheduledDate,
+				booking.BookingFee,
+				booking.PlatformFee,
+				booking.ArtisanPayout,
+			)
+			if err != nil {
+				return err
+			}
+			return notifyArtisanOfBooking(tx, booking, service.Name)
+		})
+		if err != nil {
+			return slotError(c, err)
+		}
 
 		return utils.ResponseSucess(c, http.StatusCreated, "Service booking created successfully", echo.Map{
 			"booking":      booking,
@@ -137,6 +189,17 @@ func CreateServiceBooking(db *gorm.DB) echo.HandlerFunc {
 	}
 }
 
+// slotError reports a failed slot reservation, or any other booking failure.
+func slotError(c echo.Context, err error) error {
+	if errors.Is(err, utils.ErrSlotTaken) {
+		return utils.ResponseError(c, http.StatusConflict, "That time slot is already booked", err)
+	}
+	if errors.Is(err, utils.ErrSlotUnavailable) {
+		return utils.ResponseError(c, http.StatusBadRequest, "The artisan is not available at that time", err)
+	}
+	return utils.ResponseError(c, http.StatusInternalServerError, "Failed to create service booking", err)
+}
+
 func GetUserServiceBookings(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		userID := c.Get("user_id").(uuid.UUID)
@@ -176,12 +239,34 @@ func ArtisanCompleteBooking(db *gorm.DB) echo.HandlerFunc {
 		if err := db.First(&booking, "id = ? AND artisan_id = ?", bookingID, artisanID).Error; err != nil {
 			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
 		}
+		if booking.Status == "CANCELLED" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Booking has been cancelled", nil)
+		}
+		if booking.Status == models.BookingNoShow {
+			return utils.ResponseError(c, http.StatusBadRequest, "Booking has been reported as a no-show", nil)
+		}
+		if booking.PricingType == models.PricingQuote {
+			return utils.ResponseError(c, http.StatusBadRequest, "Quoted jobs are completed milestone by milestone", nil)
+		}
 
 		now := time.Now()
 		booking.Status = "ARTISAN_COMPLETED"
 		booking.ArtisanCompletedAt = &now
 
-		if err := db.Save(&booking).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&booking).Error; err != nil {
+				return err
+			}
+			return notifications.Notify(tx, models.Notification{
+				UserID:   booking.UserID,
+				Kind:     models.NotificationBooking,
+				Title:    "Booking " + booking.BookingNumber + " is done",
+				Body:     "The artisan marked your booking as completed. Confirm it, or open a dispute within 24 hours if something is wrong.",
+				Link:     "/dashboard?tab=service_bookings",
+				EntityID: &booking.ID,
+			})
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update booking", err)
 		}
 
@@ -202,18 +287,143 @@ func CustomerCompleteBooking(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
 		}
 
-		now := time.Now()
-		booking.Status = "COMPLETED"
-		booking.CompletedAt = &now
-		booking.PaymentStatus = "RELEASED_TO_ARTISAN"
+		if booking.PaymentStatus != "HELD_IN_ESCROW" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Booking payment is not held in escrow", nil)
+		}
+		if booking.Status == models.BookingDisputed {
+			return utils.ResponseError(c, http.StatusBadRequest, "Booking is under dispute and will be settled by our team", nil)
+		}
 
-		if err := db.Save(&booking).Error; err != nil {
+		payout, err := utils.ReleaseBookingEscrow(db, &booking)
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to release escrow payout", err)
 		}
 
+		go utils.ProcessPayout(db, payout.ID)
+
 		return c.JSON(http.StatusOK, echo.Map{
 			"message": "Service completed successfully! Payout released to artisan.",
 			"booking": booking,
 		})
 	}
 }
+
+// lockBooking scopes tx to the booking with id, locking its row.
+func lockBooking(tx *gorm.DB, id string) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id)
+}
+
+// CancelServiceBooking lets the customer cancel up to the cancellation cutoff before the
+// scheduled date, or the artisan cancel any job they have not finished. Payments held in
+// escrow are refunded to the customer.
+func CancelServiceBooking(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var body CancelRequest
+		if err := c.Bind(&body); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid body", err)
+		}
+
+		var booking models.ServiceBooking
+		var refund *models.Refund
+		var milestoneRefunds []*models.Refund
+		var actor string
+		var notFound bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockBooking(tx, c.Param("id")).Where("user_id = ? OR artisan_id = ?", userID, userID).
+				First(&booking).Error; err != nil {
+				notFound = err == gorm.ErrRecordNotFound
+				return err
+			}
+
+			actor = models.ActorCustomer
+			if booking.ArtisanID == userID {
+				actor = models.ActorVendor
+			}
+
+			switch {
+			case booking.Status == models.BookingQuoteRequested:
+				// nothing is booked or paid until a quote is accepted
+			case actor == models.ActorCustomer && booking.Status != "PENDING" && booking.Status != "BOOKED":
+				return fmt.Errorf("a %s booking cannot be cancelled", strings.ToLower(booking.Status))
+			case actor == models.ActorCustomer && booking.Status == "BOOKED" && time.Until(booking.ScheduledDate) < utils.BookingCancelCutoff():
+				return fmt.Errorf("bookings can only be cancelled up to %d hours before the scheduled date", int(utils.BookingCancelCutoff().Hours()))
+			case actor == models.ActorVendor && booking.Status != "PENDING" && booking.Status != "BOOKED" && booking.Status != "IN_PROGRESS":
+				return fmt.Errorf("a %s booking cannot be cancelled", strings.ToLower(booking.Status))
+			}
+
+			if err := tx.Model(&booking).Update("status", "CANCELLED").Error; err != nil {
+				return err
+			}
+
+			reason := body.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("Booking %s cancelled by %s", booking.BookingNumber, strings.ToLower(actor))
+			}
+			var err error
+			switch booking.PaymentStatus {
+			case "HELD_IN_ESCROW":
+				refund, err = utils.RequestBookingRefund(tx, &booking, reason, actor, &userID)
+			case models.PaymentByMilestone:
+				milestoneRefunds, err = utils.CancelMilestones(tx, &booking, reason, actor, &userID)
+			}
+			if err != nil {
+				return err
+			}
+			return notifyOfCancelledBooking(tx, booking.ID, actor, body.Reason)
+		})
+		if notFound {
+			return utils.ResponseError(c, http.StatusNotFound, "Booking not found", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Failed to cancel booking", err)
+		}
+
+		if refund != nil {
+			go utils.ProcessRefund(db, refund.ID)
+		}
+		for _, r := range milestoneRefunds {
+			go utils.ProcessRefund(db, r.ID)
+		}
+
+		return c.JSON(http.StatusOK, echo.Map{
+			"message":           "Booking cancelled",
+			"booking":           booking,
+			"refund":            refund,
+			"milestone_refunds": milestoneRefunds,
+		})
+	}
+}
+
+// notifyOfCancelledBooking tells whichever party did not cancel the booking, by email and in
+// the app.
+func notifyOfCancelledBooking(tx *gorm.DB, bookingID uuid.UUID, cancelledBy, reason string) error {
+	var booking models.ServiceBooking
+	if err := tx.Preload("User").Preload("Artisan").First(&booking, "id = ?", bookingID).Error; err != nil {
+		return err
+	}
+
+	recipient, who := booking.Artisan, "customer"
+	if cancelledBy == models.ActorVendor {
+		recipient, who = booking.User, "artisan"
+	}
+	if recipient.Email == "" {
+		return nil
+	}
+	if _, err := emails.Queue(tx, emails.KindBookingCancelled, recipient.Email, recipient.UserName, booking.BookingNumber, who, reason); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("The %s cancelled booking %s.", who, booking.BookingNumber)
+	if reason != "" {
+		message += " Reason: " + reason
+	}
+	return notifications.Notify(tx, models.Notification{
+		UserID:   recipient.ID,
+		Kind:     models.NotificationBooking,
+		Title:    "Booking " + booking.BookingNumber + " was cancelled",
+		Body:     message,
+		Link:     "/dashboard?tab=service_bookings",
+		EntityID: &booking.ID,
+	})
+}
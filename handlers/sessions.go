@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"api/models"
+	"api/sessions"
+	"api/twofactor"
+	"api/utils"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+func sessionClient(c echo.Context) sessions.Client {
+	return sessions.Client{UserAgent: c.Request().UserAgent(), IP: c.RealIP()}
+}
+
+// loginResponse signs in a user who proved their password or social account. Users with
+// two-factor authentication get a challenge to complete with a code instead of tokens.
+func loginResponse(c echo.Context, db *gorm.DB, user models.User) error {
+	enabled, err := twofactor.Enabled(db, user.ID)
+	if err != nil {
+		return utils.ResponseError(c, http.StatusInternalServerError, "Failed to check two-factor authentication", err)
+	}
+	if !enabled {
+		return sessionResponse(c, db, user, false)
+	}
+
+	challenge, expiresAt, err := twofactor.NewChallenge(db, user.ID)
+	if err != nil {
+		return utils.ResponseError(c, http.StatusInternalServerError, "Failed to start two-factor challenge", err)
+	}
+	return utils.ResponseSucess(c, http.StatusOK, "Enter the code from your authenticator app", echo.Map{
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_at":          expiresAt,
+	})
+}
+
+// sessionResponse starts a session for a user who has fully proved who they are and returns
+// its tokens with the user's profile.
+func sessionResponse(c echo.Context, db *gorm.DB, user models.User, twoFactor bool) error {
+	tokens, err := sessions.Start(db, user, sessionClient(c), twoFactor)
+	if err == sessions.ErrUserBlocked {
+		return utils.ResponseError(c, http.StatusForbidden, "Your account is not active", err)
+	}
+	if err != nil {
+		return utils.ResponseError(c, http.StatusInternalServerError, "Failed to generate token", err)
+	}
+
+	return utils.ResponseSucess(c, http.StatusOK, "Login successfully", echo.Map{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_at":         tokens.ExpiresAt,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"session_id":         tokens.SessionID,
+		// Roles that must use two-factor authentication are told to set it up
+		"two_factor_setup_required": !twoFactor && twofactor.Required(user.Role),
+		"user": map[string]string{
+			"user_name":      user.UserName,
+			"email":          user.Email,
+			"phone_number":   user.PhoneNumber,
+			"role":           string(user.Role),
+			"referral_count": fmt.Sprintf("%d", user.ReferralCount),
+		},
+	})
+}
+
+// RefreshSession exchanges a refresh token for a new access token and refresh token. The old
+// refresh token stops working.
+func RefreshSession(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+
+		tokens, err := sessions.Refresh(db, req.RefreshToken, sessionClient(c))
+		switch err {
+		case nil:
+		case sessions.ErrInvalidToken, sessions.ErrTokenReused:
+			return utils.ResponseError(c, http.StatusUnauthorized, "Invalid or expired refresh token", err)
+		case sessions.ErrUserBlocked:
+			return utils.ResponseError(c, http.StatusForbidden, "Your account is not active", err)
+		default:
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to refresh session", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Session refreshed", tokens)
+	}
+}
+
+// Logout ends the session the request was made with.
+func Logout(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		sessionID := c.Get("session_id").(uuid.UUID)
+
+		if err := sessions.Revoke(db, userID, sessionID, models.SessionLoggedOut); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to log out", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Logged out successfully", nil)
+	}
+}
+
+// LogoutAll ends every session of the user, this one included.
+func LogoutAll(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		revoked, err := sessions.RevokeAll(db, userID, models.SessionLoggedOutAll)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to log out", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Logged out of all devices", echo.Map{"revoked": revoked})
+	}
+}
+
+// GetSessions lists the devices the user is signed in on.
+func GetSessions(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		sessionID := c.Get("session_id").(uuid.UUID)
+
+		active, err := sessions.Active(db, userID)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve sessions", err)
+		}
+
+		type sessionEntry struct {
+			models.Session
+			Current bool `json:"current"`
+		}
+		list := make([]sessionEntry, len(active))
+		for i, s := range active {
+			list[i] = sessionEntry{Session: s, Current: s.ID == sessionID}
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Sessions fetched successfully", list)
+	}
+}
+
+// RevokeSession signs one of the user's other devices out.
+func RevokeSession(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid session ID", err)
+		}
+
+		reason := models.SessionRevokedByUser
+		if id == c.Get("session_id").(uuid.UUID) {
+			reason = models.SessionLoggedOut
+		}
+		if err := sessions.Revoke(db, userID, id, reason); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to end session", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Session ended", nil)
+	}
+}
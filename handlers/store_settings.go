@@ -36,9 +36,7 @@ func convertToStoreResponse(settings models.StoreSetting) StoreResponse {
 		publicUserPtr = &models.PublicUser{
 			ID:            settings.User.ID,
 			UserName:      settings.User.UserName,
-			Email:         settings.User.Email,
 			Role:          string(settings.User.Role),
-			PhoneNumber:   settings.User.PhoneNumber,
 			ImageUrl:      settings.User.ImageUrl,
 			Location:      settings.User.Location,
 			Status:        settings.User.Status,
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"api/models"
+	"api/sessions"
+	"api/twofactor"
+	"api/utils"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// VerifyTwoFactorLogin is the second step of signing in: it exchanges the challenge token
+// from Login and a code from the authenticator app, or a backup code, for a session.
+func VerifyTwoFactorLogin(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			ChallengeToken string `json:"challenge_token"`
+			Code           string `json:"code"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+		if req.ChallengeToken == "" || req.Code == "" {
+			return utils.ResponseError(c, http.StatusBadRequest, "Challenge token and code are required", nil)
+		}
+
+		userID, err := twofactor.CompleteChallenge(db, req.ChallengeToken, req.Code)
+		switch err {
+		case nil:
+		case twofactor.ErrInvalidCode:
+			return utils.ResponseError(c, http.StatusUnauthorized, "Invalid authentication code", err)
+		case twofactor.ErrChallenge, twofactor.ErrNotEnrolled:
+			return utils.ResponseError(c, http.StatusUnauthorized, "Sign-in expired, please log in again", err)
+		default:
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to verify code", err)
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusUnauthorized, "Sign-in expired, please log in again", err)
+		}
+		return sessionResponse(c, db, user, true)
+	}
+}
+
+// GetTwoFactorStatus returns whether the user has two-factor authentication on and how many
+// backup codes they have left.
+func GetTwoFactorStatus(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+		status, err := twofactor.GetStatus(db, user)
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to fetch two-factor status", err)
+		}
+		return utils.ResponseSucess(c, http.StatusOK, "Two-factor status fetched successfully", status)
+	}
+}
+
+// SetupTwoFactor starts enrolling an authenticator app. The returned URI is shown as a QR
+// code; the secret is for typing in by hand. Nothing changes until ConfirmTwoFactor, which
+// for staff also takes a code emailed to them, so a stolen password alone cannot enroll a
+// new app on a staff account.
+func SetupTwoFactor(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+
+		secret, uri, err := twofactor.Begin(db, user)
+		if err == twofactor.ErrAlreadyEnabled {
+			return utils.ResponseError(c, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		}
+		if err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to start two-factor setup", err)
+		}
+		message := "Scan the QR code with your authenticator app, then confirm with a code"
+		if twofactor.Required(user.Role) {
+			message = "Scan the QR code with your authenticator app, then confirm with a code from it and the code we emailed you"
+		}
+		return utils.ResponseSucess(c, http.StatusOK, message, echo.Map{
+			"secret":              secret,
+			"provisioning_uri":    uri,
+			"email_code_required": twofactor.Required(user.Role),
+		})
+	}
+}
+
+// ConfirmTwoFactor turns two-factor authentication on with a code from the newly set up app
+// and returns the backup codes. The current session counts as signed in with two factors.
+func ConfirmTwoFactor(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+		sessionID := c.Get("session_id").(uuid.UUID)
+
+		var req struct {
+			Code      string `json:"code"`
+			EmailCode string `json:"email_code"`
+		}
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+
+		codes, err := twofactor.Confirm(db, user, req.Code, req.EmailCode, func(tx *gorm.DB) error {
+			return sessions.MarkTwoFactorVerified(tx, sessionID)
+		})
+		switch err {
+		case nil:
+		case twofactor.ErrInvalidCode:
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid authentication code", err)
+		case twofactor.ErrEmailCode:
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid or expired email confirmation code", err)
+		case twofactor.ErrTooMany:
+			return utils.ResponseError(c, http.StatusTooManyRequests, "Too many wrong codes. Start two-factor setup again", err)
+		case twofactor.ErrNotEnrolled:
+			return utils.ResponseError(c, http.StatusBadRequest, "Start two-factor setup first", err)
+		case twofactor.ErrAlreadyEnabled:
+			return utils.ResponseError(c, http.StatusConflict, "Two-factor authentication is already enabled", err)
+		default:
+			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to enable two-factor authentication", err)
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Two-factor authentication enabled. Store these backup codes somewhere safe.", echo.Map{
+			"backup_codes": codes,
+		})
+	}
+}
+
+// RegenerateBackupCodes replaces the user's backup codes. It takes a current code so that a
+// stolen session alone cannot mint new ones.
+func RegenerateBackupCodes(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req twoFactorCodeRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+
+		var codes []string
+		err := twofactor.Reauthenticate(db, userID, req.Code, func(tx *gorm.DB) error {
+			var err error
+			codes, err = twofactor.RegenerateBackupCodes(tx, userID)
+			return err
+		})
+		if err != nil {
+			return twoFactorCodeError(c, db, err, "Failed to regenerate backup codes")
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "New backup codes generated. The old ones no longer work.", echo.Map{
+			"backup_codes": codes,
+		})
+	}
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a current code. Roles
+// that require it cannot turn it off.
+func DisableTwoFactor(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID := c.Get("user_id").(uuid.UUID)
+
+		var req twoFactorCodeRequest
+		if err := c.Bind(&req); err != nil {
+			return utils.ResponseError(c, http.StatusBadRequest, "Invalid input", err)
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
+		}
+		if twofactor.Required(user.Role) {
+			return utils.ResponseError(c, http.StatusForbidden, "Two-factor authentication is required for your account", nil)
+		}
+
+		err := twofactor.Reauthenticate(db, userID, req.Code, func(tx *gorm.DB) error {
+			return twofactor.Disable(tx, userID)
+		})
+		if err != nil {
+			return twoFactorCodeError(c, db, err, "Failed to disable two-factor authentication")
+		}
+
+		return utils.ResponseSucess(c, http.StatusOK, "Two-factor authentication disabled", nil)
+	}
+}
+
+// twoFactorCodeError responds to an error from twofactor.Reauthenticate. Once there have been
+// too many wrong codes the session is ended, since whoever holds it may not be the user.
+func twoFactorCodeError(c echo.Context, db *gorm.DB, err error, message string) error {
+	switch err {
+	case twofactor.ErrInvalidCode:
+		return utils.ResponseError(c, http.StatusBadRequest, "Invalid authentication code", err)
+	case twofactor.ErrTooMany:
+		userID := c.Get("user_id").(uuid.UUID)
+		if err := sessions.Revoke(db, userID, c.Get("session_id").(uuid.UUID), models.SessionTwoFactorFails); err != nil {
+			return utils.ResponseError(c, http.StatusInternalServerError, message, err)
+		}
+		return utils.ResponseError(c, http.StatusUnauthorized, "Too many wrong codes. Please log in again", err)
+	case twofactor.ErrNotEnrolled:
+		return utils.ResponseError(c, http.StatusBadRequest, "Two-factor authentication is not enabled", err)
+	default:
+		return utils.ResponseError(c, http.StatusInternalServerError, message, err)
+	}
+}
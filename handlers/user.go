@@ -4,7 +4,10 @@ import (
 	"api/db"
 	"api/emails"
 	"api/models"
+	"api/notifications"
+	"api/otp"
 	"api/utils"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +19,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func GetUsers(db *gorm.DB) echo.HandlerFunc {
@@ -28,14 +32,14 @@ func GetUsers(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to retrieve users", err)
 		}
 
-		// convert to public format
+		// convert to public format; email addresses are for staff who manage users
+		showEmail := canManageUsers(c)
 		publicUsers := make([]models.PublicUser, len(users))
 
 		for i, u := range users {
 			publicUsers[i] = models.PublicUser{
 				ID:            u.ID,
 				UserName:      u.UserName,
-				Email:         u.Email,
 				Role:          string(u.Role),
 				ImageUrl:      u.ImageUrl,
 				Location:      u.Location,
@@ -47,6 +51,9 @@ func GetUsers(db *gorm.DB) echo.HandlerFunc {
 				CreatedAt:     u.CreatedAt,
 				UpdatedAt:     u.UpdatedAt,
 			}
+			if showEmail {
+				publicUsers[i].Email = u.Email
+			}
 
 		}
 		return utils.ResponseSucess(c, http.StatusOK, "Users retrieved successfully", publicUsers)
@@ -70,15 +77,10 @@ func GetUserById(db *gorm.DB) echo.HandlerFunc {
 		response := models.PublicUser{
 			ID:            user.ID,
 			UserName:      user.UserName,
-			Email:         user.Email,
 			Role:          string(user.Role),
 			ImageUrl:      user.ImageUrl,
-			PhoneNumber:   user.PhoneNumber,
+			PhoneVerified: user.PhoneVerified,
 			Location:      user.Location,
-			BankName:      user.BankName,
-			AccountNumber: user.AccountNumber,
-			AccountName:   user.AccountName,
-			BankAccounts:  user.BankAccounts,
 			Status:        user.Status,
 			IsVerified:    user.IsVerified,
 			ReferralCode:  user.ReferralCode,
@@ -87,12 +89,31 @@ func GetUserById(db *gorm.DB) echo.HandlerFunc {
 			CreatedAt:     user.CreatedAt,
 			UpdatedAt:     user.UpdatedAt,
 		}
+		// Contact and bank details are only for the user themselves and staff; other
+		// users reach each other through conversations.
+		if callerID, _ := c.Get("user_id").(uuid.UUID); callerID == user.ID || canManageUsers(c) {
+			response.Email = user.Email
+			response.PhoneNumber = user.PhoneNumber
+			response.BankName = user.BankName
+			response.BankCode = user.BankCode
+			response.AccountNumber = user.AccountNumber
+			response.AccountName = user.AccountName
+			response.BankAccounts = user.BankAccounts
+		}
 
 		return utils.ResponseSucess(c, http.StatusOK, "User retrieved successfully", response)
 	}
 
 }
 
+// canManageUsers reports whether the caller is staff allowed to manage users, signed in
+// with two-factor authentication as back-office access requires.
+func canManageUsers(c echo.Context) bool {
+	role, _ := c.Get("role").(string)
+	twoFactor, _ := c.Get("two_factor").(bool)
+	return twoFactor && models.HasPermission(models.Role(role), models.PermUsersManage)
+}
+
 func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		id := c.Get("user_id").(uuid.UUID)
@@ -103,13 +124,14 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 			return utils.ResponseError(c, http.StatusNotFound, "User not found", err)
 		}
 
+		previousEmail := user.Email
 		name := c.FormValue("user_name")
 		email := c.FormValue("email")
 		phone := c.FormValue("phone_number")
 		location := c.FormValue("location")
 		bankName := c.FormValue("bank_name")
+		bankCode := c.FormValue("bank_code")
 		accountNumber := c.FormValue("account_number")
-		accountName := c.FormValue("account_name")
 		bankAccounts := c.FormValue("bank_accounts")
 
 		// update only if new values provided
@@ -119,8 +141,10 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 		if email != "" {
 			user.Email = email
 		}
-		if phone != "" {
+		if phone != "" && !samePhone(phone, user.PhoneNumber) {
+			// A new number has to be verified again
 			user.PhoneNumber = phone
+			user.PhoneVerified = false
 		}
 		if location != "" {
 			user.Location = location
@@ -128,14 +152,29 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 		if bankName != "" {
 			user.BankName = bankName
 		}
-		if accountNumber != "" {
-			user.AccountNumber = accountNumber
-		}
-		if accountName != "" {
-			user.AccountName = accountName
+		if (bankCode != "" && bankCode != user.BankCode) || (accountNumber != "" && accountNumber != user.AccountNumber) {
+			if bankCode != "" {
+				user.BankCode = bankCode
+			}
+			if accountNumber != "" {
+				user.AccountNumber = accountNumber
+			}
+			// Payouts go to this account, so its name comes from the bank rather than the form
+			if len(user.AccountNumber) != 10 || user.BankCode == "" {
+				return utils.ResponseError(c, http.StatusBadRequest, "Enter a 10-digit account number and its bank", nil)
+			}
+			resolved, err := utils.ResolveBankAccount(user.AccountNumber, user.BankCode)
+			if err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Could not verify the bank account", err)
+			}
+			user.AccountName = resolved
 		}
 		if bankAccounts != "" {
-			user.BankAccounts = datatypes.JSON(bankAccounts)
+			resolved, err := resolveBankAccounts(bankAccounts)
+			if err != nil {
+				return utils.ResponseError(c, http.StatusBadRequest, "Could not verify the bank accounts", err)
+			}
+			user.BankAccounts = resolved
 		}
 
 		// handle optional image upload
@@ -171,9 +210,14 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 			os.Remove(tempFilePath)
 		}
 
-		// save changes
-
-		if err := db.Save(&user).Error; err != nil {
+		// save changes, keeping email preferences with the user if the address changed
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			return emails.CopyOptOuts(tx, previousEmail, user.Email)
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to update user", err)
 		}
 
@@ -182,10 +226,12 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 			UserName:      user.UserName,
 			Email:         user.Email,
 			PhoneNumber:   user.PhoneNumber,
+			PhoneVerified: user.PhoneVerified,
 			Role:          string(user.Role),
 			ImageUrl:      user.ImageUrl,
 			Location:      user.Location,
 			BankName:      user.BankName,
+			BankCode:      user.BankCode,
 			AccountNumber: user.AccountNumber,
 			AccountName:   user.AccountName,
 			BankAccounts:  user.BankAccounts,
@@ -199,6 +245,17 @@ func UpdateUser(db *gorm.DB) echo.HandlerFunc {
 	}
 }
 
+// samePhone reports whether two phone numbers are the same however they were typed, e.g.
+// "0801 234 5678" and "+2348012345678".
+func samePhone(a, b string) bool {
+	na, errA := otp.NormalizePhone(a)
+	nb, errB := otp.NormalizePhone(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return na == nb
+}
+
 func Me(c echo.Context) error {
 	// Get user ID from context (set by middleware)
 	userID, ok := c.Get("user_id").(uuid.UUID)
@@ -218,9 +275,11 @@ func Me(c echo.Context) error {
 		Email:         user.Email,
 		Role:          string(user.Role),
 		PhoneNumber:   user.PhoneNumber,
+		PhoneVerified: user.PhoneVerified,
 		ImageUrl:      user.ImageUrl,
 		Location:      user.Location,
 		BankName:      user.BankName,
+		BankCode:      user.BankCode,
 		AccountNumber: user.AccountNumber,
 		AccountName:   user.AccountName,
 		BankAccounts:  user.BankAccounts,
@@ -266,14 +325,24 @@ func DeleteUser(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		var user models.User
-		result := db.Delete(&user, "id = ?", id)
-		if result.Error != nil {
-			return utils.ResponseError(c, 500, "Failed to delete User", result.Error)
-		}
-
-		if result.RowsAffected == 0 {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", id).Error; err != nil {
+				return err
+			}
+			if err := guardAccountChange(tx, c, user, true); err != nil {
+				return err
+			}
+			return tx.Delete(&user).Error
+		})
+		if err == gorm.ErrRecordNotFound {
 			return utils.ResponseError(c, 404, "User not found", nil)
 		}
+		if handled, resp := accountChangeError(c, err); handled {
+			return resp
+		}
+		if err != nil {
+			return utils.ResponseError(c, 500, "Failed to delete User", err)
+		}
 
 		return utils.ResponseSucess(c, 200, "User deleted successfully", nil)
 	}
@@ -295,11 +364,52 @@ func VerifyUser(db *gorm.DB) echo.HandlerFunc {
 
 		user.IsVerified = true
 
-		if err := db.Save(&user).Error; err != nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			if _, err := emails.Queue(tx, emails.KindAccountVerified, user.Email, user.UserName); err != nil {
+				return err
+			}
+			return notifications.Notify(tx, models.Notification{
+				UserID: user.ID,
+				Kind:   models.NotificationAccount,
+				Title:  "Your account has been verified",
+				Body:   "Your NedZl account has been fully verified. You can now start listing your products.",
+				Link:   "/dashboard",
+			})
+		})
+		if err != nil {
 			return utils.ResponseError(c, http.StatusInternalServerError, "Failed to verify user", err)
 		}
-		emails.SendAccountVerifiedMail(user.Email, user.UserName)
 
 		return utils.ResponseSucess(c, http.StatusOK, "User verified successfully", nil)
 	}
 }
+
+// resolveBankAccounts checks every entry of a submitted bank_accounts list with
+// Paystack and replaces its account name with the one the bank returns, since
+// payouts may go to any of them.
+func resolveBankAccounts(raw string) (datatypes.JSON, error) {
+	var accounts []models.BankAccountItem
+	if err := json.Unmarshal([]byte(raw), &accounts); err != nil {
+		return nil, fmt.Errorf("bank_accounts must be a list of accounts: %w", err)
+	}
+
+	for i, a := range accounts {
+		if len(a.AccountNumber) != 10 || a.BankCode == "" {
+			return nil, fmt.Errorf("account %d needs a 10-digit account number and its bank code", i+1)
+		}
+		name, err := utils.ResolveBankAccount(a.AccountNumber, a.BankCode)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", a.AccountNumber, err)
+		}
+		accounts[i].AccountName = name
+	}
+
+	out, err := json.Marshal(accounts)
+	if err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(out), nil
+}
@@ -3,10 +3,12 @@ package handlers
 import (
 	"api/emails"
 	"api/models"
+	"api/sessions"
 	"api/utils"
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func UpdateUserStatus(db *gorm.DB) echo.HandlerFunc {
@@ -32,12 +34,35 @@ func UpdateUserStatus(db *gorm.DB) echo.HandlerFunc {
 		}
 
 		// Update status directly
-		result := db.Model(&user).Update("status", body.Status)
-		if result.Error != nil {
-			return utils.ResponseError(c, 500, "Failed to update product status", result.Error)
+		var result *gorm.DB
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", user.ID).Error; err != nil {
+				return err
+			}
+			if err := guardAccountChange(tx, c, user, models.Status(body.Status) != models.UserActive); err != nil {
+				return err
+			}
+			result = tx.Model(&user).Update("status", body.Status)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			// Blocking a user signs them out everywhere; reactivating them does not sign them back in
+			if models.Status(body.Status) != models.UserActive {
+				if _, err := sessions.RevokeAll(tx, user.ID, models.SessionAccountBlocked); err != nil {
+					return err
+				}
+			}
+			if models.Status(body.Status) == models.StatusRejected {
+				_, err := emails.Queue(tx, emails.KindUserDeactivation, user.Email, user.UserName)
+				return err
+			}
+			return nil
+		})
+		if handled, resp := accountChangeError(c, err); handled {
+			return resp
 		}
-		if models.Status(body.Status) == models.StatusRejected {
-			go emails.SendUserDeactivationEmail(user.Email, user.UserName)
+		if err != nil {
+			return utils.ResponseError(c, 500, "Failed to update product status", err)
 		}
 
 		if result.RowsAffected == 0 {
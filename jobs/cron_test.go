@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func at(s string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		// Steps, ranges and lists
+		{"*/15 * * * *", "2026-10-17 10:07", "2026-10-17 10:15"},
+		{"*/15 * * * *", "2026-10-17 10:45", "2026-10-17 11:00"},
+		{"0-30/10 9 * * *", "2026-10-17 09:25", "2026-10-17 09:30"},
+		{"0-30/10 9 * * *", "2026-10-17 09:31", "2026-10-18 09:00"},
+		{"5,35 * * * *", "2026-10-17 10:05", "2026-10-17 10:35"},
+		{"10/20 * * * *", "2026-10-17 10:31", "2026-10-17 10:50"},
+		// Next is strictly after the given minute
+		{"0 * * * *", "2026-10-17 10:00", "2026-10-17 11:00"},
+		// Weekdays: Friday evening rolls over to Monday morning
+		{"0 9-17 * * 1-5", "2026-10-16 17:30", "2026-10-19 09:00"},
+		// 0 and 7 are both Sunday
+		{"0 0 * * 0", "2026-10-17 12:00", "2026-10-18 00:00"},
+		{"0 0 * * 7", "2026-10-17 12:00", "2026-10-18 00:00"},
+		{"0 0 * * 5-7", "2026-10-17 12:00", "2026-10-18 00:00"},
+		// A restricted day of month and day of week match either one
+		{"0 0 13 * 5", "2026-10-17 00:00", "2026-10-23 00:00"},
+		{"0 0 1 * 1", "2026-10-27 00:00", "2026-11-01 00:00"},
+		// With day of week *, only the day of month counts
+		{"0 0 13 * *", "2026-10-17 00:00", "2026-11-13 00:00"},
+		// Month rollover, skipping months without the day
+		{"0 0 31 * *", "2026-10-31 00:00", "2026-12-31 00:00"},
+		{"30 23 31 12 *", "2026-12-31 23:30", "2027-12-31 23:30"},
+		{"0 12 29 2 *", "2026-03-01 00:00", "2028-02-29 12:00"},
+		// Shorthands
+		{"@daily", "2026-10-17 10:07", "2026-10-18 00:00"},
+		{"@weekly", "2026-10-17 10:07", "2026-10-18 00:00"},
+		{"@monthly", "2026-10-17 10:07", "2026-11-01 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.from, got.Format("2006-01-02 15:04 Mon"), tt.want)
+		}
+	}
+}
+
+func TestCronNextInLocation(t *testing.T) {
+	lagos := time.FixedZone("WAT", 60*60)
+	c, err := ParseCron("0 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.Next(time.Date(2026, 10, 17, 3, 0, 0, 0, lagos))
+	if want := time.Date(2026, 10, 18, 2, 0, 0, 0, lagos); !got.Equal(want) {
+		t.Errorf("Next = %s, want %s", got, want)
+	}
+}
+
+func TestParseCronRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"1,,2 * * * *",
+		"@yearly",
+	} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("ParseCron(%q) accepted an invalid expression", spec)
+		}
+	}
+}
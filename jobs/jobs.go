@@ -0,0 +1,388 @@
+// Package jobs runs background work from a Postgres-backed queue so that any number of API
+// replicas can share it: each run is a row in the jobs table that exactly one worker claims
+// with FOR UPDATE SKIP LOCKED, recurring jobs are enqueued from cron schedules stored in the
+// database, and failed runs are retried with exponential backoff until they are dead-lettered.
+package jobs
+
+import (
+	"api/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultTimeout     = 10 * time.Minute
+	baseBackoff        = 30 * time.Second
+	maxBackoff         = time.Hour
+	scheduleInterval   = 30 * time.Second
+)
+
+// Handler runs one job. A returned error (or panic) fails the attempt. Its db and ctx are
+// cancelled when the run's Timeout is up, since another worker may then take the job over.
+type Handler func(ctx context.Context, db *gorm.DB, payload []byte) error
+
+// Definition describes how a named job runs.
+type Definition struct {
+	Handler     Handler
+	MaxAttempts int           // attempts before the job is dead-lettered, 5 by default
+	Timeout     time.Duration // how long a worker holds a run before another may take it over, 10 minutes by default
+}
+
+// Location is the timezone cron schedules are evaluated in.
+var Location = time.UTC
+
+var (
+	mu        sync.RWMutex
+	registry  = map[string]Definition{}
+	schedules = map[string]string{} // job name → cron expression
+)
+
+// Register makes a job runnable by this process's workers.
+func Register(name string, def Definition) {
+	if def.MaxAttempts < 1 {
+		def.MaxAttempts = defaultMaxAttempts
+	}
+	if def.Timeout <= 0 {
+		def.Timeout = defaultTimeout
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	registry[name] = def
+}
+
+// Schedule runs a registered job on a cron schedule. Call it before Start.
+func Schedule(name, spec string) error {
+	if _, err := ParseCron(spec); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[name]; !ok {
+		return fmt.Errorf("jobs: %s is not registered", name)
+	}
+	schedules[name] = spec
+	return nil
+}
+
+func definition(name string) (Definition, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	def, ok := registry[name]
+	return def, ok
+}
+
+func registeredNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Enqueue adds a one-off run of a registered job, due at runAt. Call it inside the
+// transaction whose commit should trigger the job. payload is stored as JSON.
+func Enqueue(tx *gorm.DB, name string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	return enqueue(tx, name, nil, payload, runAt)
+}
+
+// EnqueueUnique is Enqueue for runs identified by key; enqueuing the same key again is a
+// no-op that returns the existing run.
+func EnqueueUnique(tx *gorm.DB, name, key string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	return enqueue(tx, name, &key, payload, runAt)
+}
+
+func enqueue(tx *gorm.DB, name string, key *string, payload interface{}, runAt time.Time) (*models.Job, error) {
+	def, ok := definition(name)
+	if !ok {
+		return nil, fmt.Errorf("jobs: %s is not registered", name)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.Job{
+		Name:        name,
+		Payload:     raw,
+		UniqueKey:   key,
+		Status:      models.JobQueued,
+		RunAt:       runAt,
+		MaxAttempts: def.MaxAttempts,
+	}
+	if key == nil {
+		return &job, tx.Create(&job).Error
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, tx.Where("unique_key = ?", *key).First(&job).Error
+}
+
+// Retry puts a dead-lettered job back in the queue with a fresh set of attempts.
+func Retry(db *gorm.DB, id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&job, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if job.Status != models.JobDead {
+			return fmt.Errorf("only dead jobs can be retried; this one is %s", job.Status)
+		}
+		job.Status = models.JobQueued
+		job.Attempts = 0
+		job.RunAt = time.Now()
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"attempts":     0,
+			"run_at":       job.RunAt,
+			"locked_by":    "",
+			"locked_until": nil,
+		}).Error
+	})
+	return &job, err
+}
+
+func backoff(attempts int) time.Duration {
+	d := time.Duration(float64(baseBackoff) * math.Pow(2, float64(attempts-1)))
+	if d > maxBackoff || d <= 0 {
+		return maxBackoff
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// Start syncs the cron schedules to the database and starts the scheduler and workers
+// (JOB_WORKERS, 2 by default, polling every JOB_POLL_SECONDS, 5 by default).
+func Start(db *gorm.DB) {
+	if err := syncSchedules(db); err != nil {
+		log.Println("Jobs: Error saving job schedules:", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+		for {
+			enqueueDue(db)
+			<-ticker.C
+		}
+	}()
+
+	hostname, _ := os.Hostname()
+	poll := time.Duration(envInt("JOB_POLL_SECONDS", 5)) * time.Second
+	for i := 0; i < envInt("JOB_WORKERS", 2); i++ {
+		workerID := fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), i)
+		go work(db, workerID, poll)
+	}
+	log.Println("Jobs: Scheduler and workers started")
+}
+
+// syncSchedules records each schedule, recomputing its next run when its expression changed.
+func syncSchedules(db *gorm.DB) error {
+	mu.RLock()
+	specs := make(map[string]string, len(schedules))
+	for name, spec := range schedules {
+		specs[name] = spec
+	}
+	mu.RUnlock()
+
+	now := time.Now().In(Location)
+	for name, spec := range specs {
+		cron, _ := ParseCron(spec)
+		schedule := models.JobSchedule{Name: name, Cron: spec, NextRunAt: cron.Next(now)}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&schedule).Error; err != nil {
+			return err
+		}
+		if err := db.Model(&models.JobSchedule{}).Where("name = ? AND cron <> ?", name, spec).
+			Updates(map[string]interface{}{"cron": spec, "next_run_at": cron.Next(now)}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueDue enqueues a run of every schedule whose time has come. A run is skipped while an
+// earlier run of the same job is still queued or running, so slow jobs never pile up.
+func enqueueDue(db *gorm.DB) {
+	var due []models.JobSchedule
+	if err := db.Where("next_run_at <= ?", time.Now()).Find(&due).Error; err != nil {
+		log.Println("Jobs: Error fetching due schedules:", err)
+		return
+	}
+
+	for _, s := range due {
+		if _, ok := definition(s.Name); !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var schedule models.JobSchedule
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("name = ? AND next_run_at <= ?", s.Name, time.Now()).First(&schedule).Error
+			if err == gorm.ErrRecordNotFound {
+				return nil // another replica got there first
+			}
+			if err != nil {
+				return err
+			}
+			cron, err := ParseCron(schedule.Cron)
+			if err != nil {
+				return err
+			}
+
+			var active int64
+			if err := tx.Model(&models.Job{}).Where("name = ? AND status IN ?", schedule.Name,
+				[]string{models.JobQueued, models.JobRunning}).Count(&active).Error; err != nil {
+				return err
+			}
+			now := time.Now()
+			if active == 0 {
+				key := fmt.Sprintf("%s@%s", schedule.Name, schedule.NextRunAt.UTC().Format(time.RFC3339))
+				if _, err := EnqueueUnique(tx, schedule.Name, key, nil, now); err != nil {
+					return err
+				}
+			}
+			return tx.Model(&schedule).Updates(map[string]interface{}{
+				"next_run_at": cron.Next(now.In(Location)),
+				"last_run_at": &now,
+			}).Error
+		})
+		if err != nil {
+			log.Printf("Jobs: Error enqueuing scheduled job %s: %v\n", s.Name, err)
+		}
+	}
+}
+
+func work(db *gorm.DB, workerID string, poll time.Duration) {
+	for {
+		ran, err := runNext(db, workerID)
+		if err != nil {
+			log.Printf("Jobs: Worker %s error: %v\n", workerID, err)
+		}
+		if !ran {
+			time.Sleep(poll)
+		}
+	}
+}
+
+// runNext claims and runs one due job. Runs whose worker died (lease expired) are claimed
+// again as a new attempt. It reports whether a job was claimed.
+func runNext(db *gorm.DB, workerID string) (bool, error) {
+	names := registeredNames()
+	if len(names) == 0 {
+		return false, nil
+	}
+
+	var job models.Job
+	var def Definition
+	claimed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("name IN ?", names).
+			Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)", models.JobQueued, now, models.JobRunning, now).
+			Order("run_at ASC").First(&job).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		claimed = true
+		def, _ = definition(job.Name)
+
+		if abandonedOnLastAttempt(job) {
+			job.Status = models.JobDead
+			return tx.Model(&job).Updates(map[string]interface{}{
+				"status":       models.JobDead,
+				"last_error":   "worker stopped responding on the final attempt",
+				"locked_until": nil,
+				"finished_at":  &now,
+			}).Error
+		}
+
+		lockedUntil := now.Add(def.Timeout)
+		job.Attempts++
+		job.Status = models.JobRunning
+		job.LockedBy = workerID
+		job.LockedUntil = &lockedUntil
+		job.StartedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"locked_by":    workerID,
+			"locked_until": &lockedUntil,
+			"started_at":   &now,
+		}).Error
+	})
+	if err != nil || !claimed || job.Status != models.JobRunning {
+		return claimed, err
+	}
+
+	runErr := run(db, def, job)
+	return true, finish(db, &job, workerID, runErr)
+}
+
+// abandonedOnLastAttempt reports whether a claimed job is a run whose worker stopped
+// responding after it had already used its final attempt, so it is dead-lettered rather
+// than started again.
+func abandonedOnLastAttempt(job models.Job) bool {
+	return job.Status == models.JobRunning && job.Attempts >= job.MaxAttempts
+}
+
+func run(db *gorm.DB, def Definition, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), def.Timeout)
+	defer cancel()
+	return def.Handler(ctx, db.WithContext(ctx), job.Payload)
+}
+
+// finish records the outcome of an attempt, unless the run was taken over by another worker.
+func finish(db *gorm.DB, job *models.Job, workerID string, runErr error) error {
+	return db.Model(&models.Job{}).Where("id = ? AND status = ? AND locked_by = ?", job.ID, models.JobRunning, workerID).
+		Updates(attemptOutcome(job, runErr, time.Now())).Error
+}
+
+// attemptOutcome is the update that ends an attempt: success, a retry after backoff, or the
+// dead letter once the job has used all its attempts.
+func attemptOutcome(job *models.Job, runErr error, now time.Time) map[string]interface{} {
+	updates := map[string]interface{}{"locked_until": nil, "finished_at": &now}
+	switch {
+	case runErr == nil:
+		updates["status"] = models.JobSucceeded
+		updates["last_error"] = ""
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("Jobs: %s (%s) dead after %d attempts: %v\n", job.Name, job.ID, job.Attempts, runErr)
+		updates["status"] = models.JobDead
+		updates["last_error"] = runErr.Error()
+	default:
+		log.Printf("Jobs: %s (%s) attempt %d failed: %v\n", job.Name, job.ID, job.Attempts, runErr)
+		updates["status"] = models.JobQueued
+		updates["last_error"] = runErr.Error()
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+	}
+	return updates
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"api/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour}, // 64 minutes, capped
+		{20, time.Hour},
+		{200, time.Hour}, // overflows without the cap
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestAttemptOutcome(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	failure := errors.New("smtp timeout")
+
+	tests := []struct {
+		name     string
+		attempts int
+		runErr   error
+		status   string
+		retryAt  time.Time
+	}{
+		{"success", 1, nil, models.JobSucceeded, time.Time{}},
+		{"success on the last attempt", 5, nil, models.JobSucceeded, time.Time{}},
+		{"first failure is retried", 1, failure, models.JobQueued, now.Add(30 * time.Second)},
+		{"later failure backs off further", 3, failure, models.JobQueued, now.Add(2 * time.Minute)},
+		{"failure on the last attempt is dead", 5, failure, models.JobDead, time.Time{}},
+	}
+	for _, tt := range tests {
+		job := &models.Job{Name: "test", Attempts: tt.attempts, MaxAttempts: 5}
+		updates := attemptOutcome(job, tt.runErr, now)
+
+		if updates["status"] != tt.status {
+			t.Errorf("%s: status = %v, want %s", tt.name, updates["status"], tt.status)
+		}
+		if v, ok := updates["locked_until"]; !ok || v != nil {
+			t.Errorf("%s: lease not released: locked_until = %v", tt.name, v)
+		}
+		runAt, retried := updates["run_at"].(time.Time)
+		if retried != !tt.retryAt.IsZero() || (retried && !runAt.Equal(tt.retryAt)) {
+			t.Errorf("%s: run_at = %v, want %v", tt.name, updates["run_at"], tt.retryAt)
+		}
+		wantErr := ""
+		if tt.runErr != nil {
+			wantErr = tt.runErr.Error()
+		}
+		if updates["last_error"] != wantErr {
+			t.Errorf("%s: last_error = %q, want %q", tt.name, updates["last_error"], wantErr)
+		}
+	}
+}
+
+func TestAbandonedOnLastAttempt(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		attempts int
+		want     bool
+	}{
+		{"queued retry", models.JobQueued, 4, false},
+		{"expired lease with attempts left is taken over", models.JobRunning, 4, false},
+		{"expired lease on the last attempt is dead", models.JobRunning, 5, true},
+		{"expired lease past the limit is dead", models.JobRunning, 6, true},
+	}
+	for _, tt := range tests {
+		job := models.Job{Status: tt.status, Attempts: tt.attempts, MaxAttempts: 5}
+		if got := abandonedOnLastAttempt(job); got != tt.want {
+			t.Errorf("%s: abandonedOnLastAttempt = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
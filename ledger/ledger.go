@@ -0,0 +1,275 @@
+// Package ledger keeps the double-entry record of money moving through the platform:
+// customer charges into escrow, escrow releases to platform revenue and vendor payables,
+// refunds back to customers and payouts settled out to vendors' banks.
+package ledger
+
+import (
+	"api/models"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AccountCustomer         = "CUSTOMER"          // owned by the paying customer
+	AccountEscrow           = "ESCROW"            // owned by the vendor/artisan the funds are held for
+	AccountPlatformRevenue  = "PLATFORM_REVENUE"  // platform-wide
+	AccountVendorPayable    = "VENDOR_PAYABLE"    // owned by the vendor/artisan
+	AccountPayoutSettlement = "PAYOUT_SETTLEMENT" // owned by the vendor/artisan, money sent to their bank
+)
+
+const (
+	KindCharge         = "CHARGE"
+	KindRelease        = "RELEASE"
+	KindRefund         = "REFUND"
+	KindPayout         = "PAYOUT"
+	KindPayoutReversal = "PAYOUT_REVERSAL"
+)
+
+const (
+	SourceFoodOrder        = "FOOD_ORDER"
+	SourceServiceBooking   = "SERVICE_BOOKING"
+	SourceBookingMilestone = "BOOKING_MILESTONE"
+	SourcePayout           = "PAYOUT"
+)
+
+// Line is one leg of a journal entry. Positive amounts credit the account, negative debit it.
+type Line struct {
+	AccountType string
+	OwnerID     uuid.UUID
+	Amount      int64 // kobo
+}
+
+func account(tx *gorm.DB, accountType string, ownerID uuid.UUID) (models.LedgerAccount, error) {
+	acc := models.LedgerAccount{Type: accountType, OwnerID: ownerID, Currency: models.CurrencyNGN}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&acc).Error; err != nil {
+		return acc, err
+	}
+	err := tx.Where("type = ? AND owner_id = ?", accountType, ownerID).First(&acc).Error
+	return acc, err
+}
+
+// Post writes a balanced journal entry. Entries are keyed by idempotencyKey, so posting the
+// same business event twice (e.g. on a webhook retry) is a no-op.
+func Post(tx *gorm.DB, idempotencyKey, kind, sourceType string, sourceID uuid.UUID, memo string, lines ...Line) error {
+	var sum int64
+	for _, l := range lines {
+		sum += l.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("ledger: entry %s is unbalanced by %d kobo", idempotencyKey, sum)
+	}
+
+	entry := models.JournalEntry{
+		IdempotencyKey: idempotencyKey,
+		Kind:           kind,
+		SourceType:     sourceType,
+		SourceID:       sourceID,
+		Memo:           memo,
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	for _, l := range lines {
+		if l.Amount == 0 {
+			continue
+		}
+		acc, err := account(tx, l.AccountType, l.OwnerID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&models.JournalLine{EntryID: entry.ID, AccountID: acc.ID, Amount: l.Amount}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func posted(tx *gorm.DB, idempotencyKey string) (bool, error) {
+	var count int64
+	err := tx.Model(&models.JournalEntry{}).Where("idempotency_key = ?", idempotencyKey).Count(&count).Error
+	return count > 0, err
+}
+
+func chargeKey(sourceType string, sourceID uuid.UUID) string {
+	return fmt.Sprintf("charge:%s:%s", sourceType, sourceID)
+}
+
+func releaseKey(sourceType string, sourceID uuid.UUID) string {
+	return fmt.Sprintf("release:%s:%s", sourceType, sourceID)
+}
+
+func refundKey(sourceType string, sourceID uuid.UUID) string {
+	return fmt.Sprintf("refund:%s:%s", sourceType, sourceID)
+}
+
+// recordCharge moves a customer payment into the vendor's escrow account.
+func recordCharge(tx *gorm.DB, sourceType string, sourceID, customerID, vendorID uuid.UUID, amount int64, memo string) error {
+	return Post(tx, chargeKey(sourceType, sourceID), KindCharge, sourceType, sourceID, memo,
+		Line{AccountType: AccountCustomer, OwnerID: customerID, Amount: -amount},
+		Line{AccountType: AccountEscrow, OwnerID: vendorID, Amount: amount},
+	)
+}
+
+// recordRelease splits escrowed funds between platform revenue and the vendor's payable balance.
+func recordRelease(tx *gorm.DB, sourceType string, sourceID, vendorID uuid.UUID, amount, fee int64, memo string) error {
+	return Post(tx, releaseKey(sourceType, sourceID), KindRelease, sourceType, sourceID, memo,
+		Line{AccountType: AccountEscrow, OwnerID: vendorID, Amount: -amount},
+		Line{AccountType: AccountPlatformRevenue, OwnerID: uuid.Nil, Amount: fee},
+		Line{AccountType: AccountVendorPayable, OwnerID: vendorID, Amount: amount - fee},
+	)
+}
+
+// recordRefund returns funds to the customer, taking them back out of escrow or, when the
+// funds were already released, out of platform revenue and the vendor's payable balance.
+func recordRefund(tx *gorm.DB, sourceType string, sourceID, customerID, vendorID uuid.UUID, amount, fee int64, memo string) error {
+	released, err := posted(tx, releaseKey(sourceType, sourceID))
+	if err != nil {
+		return err
+	}
+
+	lines := []Line{{AccountType: AccountCustomer, OwnerID: customerID, Amount: amount}}
+	if released {
+		lines = append(lines,
+			Line{AccountType: AccountPlatformRevenue, OwnerID: uuid.Nil, Amount: -fee},
+			Line{AccountType: AccountVendorPayable, OwnerID: vendorID, Amount: -(amount - fee)},
+		)
+	} else {
+		lines = append(lines, Line{AccountType: AccountEscrow, OwnerID: vendorID, Amount: -amount})
+	}
+
+	return Post(tx, refundKey(sourceType, sourceID), KindRefund, sourceType, sourceID, memo, lines...)
+}
+
+func RecordFoodOrderCharge(tx *gorm.DB, order models.FoodOrder) error {
+	return recordCharge(tx, SourceFoodOrder, order.ID, order.UserID, order.VendorID, order.TotalAmount.Kobo,
+		fmt.Sprintf("Payment for food order %s", order.OrderNumber))
+}
+
+func RecordBookingCharge(tx *gorm.DB, booking models.ServiceBooking) error {
+	return recordCharge(tx, SourceServiceBooking, booking.ID, booking.UserID, booking.ArtisanID, booking.BookingFee.Kobo,
+		fmt.Sprintf("Payment for booking %s", booking.BookingNumber))
+}
+
+func RecordFoodOrderRelease(tx *gorm.DB, order models.FoodOrder) error {
+	return recordRelease(tx, SourceFoodOrder, order.ID, order.VendorID, order.TotalAmount.Kobo, order.PlatformFee.Kobo,
+		fmt.Sprintf("Release of food order %s", order.OrderNumber))
+}
+
+func RecordBookingRelease(tx *gorm.DB, booking models.ServiceBooking) error {
+	return recordRelease(tx, SourceServiceBooking, booking.ID, booking.ArtisanID, booking.BookingFee.Kobo, booking.PlatformFee.Kobo,
+		fmt.Sprintf("Release of booking %s", booking.BookingNumber))
+}
+
+func RecordFoodOrderRefund(tx *gorm.DB, order models.FoodOrder) error {
+	return recordRefund(tx, SourceFoodOrder, order.ID, order.UserID, order.VendorID, order.TotalAmount.Kobo, order.PlatformFee.Kobo,
+		fmt.Sprintf("Refund of food order %s", order.OrderNumber))
+}
+
+func RecordBookingRefund(tx *gorm.DB, booking models.ServiceBooking) error {
+	return recordRefund(tx, SourceServiceBooking, booking.ID, booking.UserID, booking.ArtisanID, booking.BookingFee.Kobo, booking.PlatformFee.Kobo,
+		fmt.Sprintf("Refund of booking %s", booking.BookingNumber))
+}
+
+// RecordBookingPartialRelease releases part of a disputed booking's escrow to platform revenue
+// and the artisan. The remainder stays in escrow until RecordBookingPartialRefund.
+func RecordBookingPartialRelease(tx *gorm.DB, booking models.ServiceBooking, amount, fee int64) error {
+	return recordRelease(tx, SourceServiceBooking, booking.ID, booking.ArtisanID, amount, fee,
+		fmt.Sprintf("Partial release of booking %s", booking.BookingNumber))
+}
+
+// RecordBookingPartialRefund returns what is left in escrow after a partial release to the customer.
+func RecordBookingPartialRefund(tx *gorm.DB, booking models.ServiceBooking, amount int64) error {
+	return Post(tx, refundKey(SourceServiceBooking, booking.ID), KindRefund, SourceServiceBooking, booking.ID,
+		fmt.Sprintf("Partial refund of booking %s", booking.BookingNumber),
+		Line{AccountType: AccountEscrow, OwnerID: booking.ArtisanID, Amount: -amount},
+		Line{AccountType: AccountCustomer, OwnerID: booking.UserID, Amount: amount},
+	)
+}
+
+func RecordMilestoneCharge(tx *gorm.DB, milestone models.Milestone) error {
+	return recordCharge(tx, SourceBookingMilestone, milestone.ID, milestone.CustomerID, milestone.ArtisanID, milestone.Amount.Kobo,
+		fmt.Sprintf("Payment for milestone %d: %s", milestone.Sequence, milestone.Title))
+}
+
+func RecordMilestoneRelease(tx *gorm.DB, milestone models.Milestone) error {
+	return recordRelease(tx, SourceBookingMilestone, milestone.ID, milestone.ArtisanID, milestone.Amount.Kobo, milestone.PlatformFee.Kobo,
+		fmt.Sprintf("Release of milestone %d: %s", milestone.Sequence, milestone.Title))
+}
+
+func RecordMilestoneRefund(tx *gorm.DB, milestone models.Milestone) error {
+	return recordRefund(tx, SourceBookingMilestone, milestone.ID, milestone.CustomerID, milestone.ArtisanID, milestone.Amount.Kobo, milestone.PlatformFee.Kobo,
+		fmt.Sprintf("Refund of milestone %d: %s", milestone.Sequence, milestone.Title))
+}
+
+// RecordPayoutSettled moves a vendor's payable balance out to their bank once a transfer succeeds.
+func RecordPayoutSettled(tx *gorm.DB, payout models.Payout) error {
+	amount := payout.Amount.Kobo
+	return Post(tx, fmt.Sprintf("payout:%s:%s", payout.ID, payout.Reference), KindPayout, SourcePayout, payout.ID,
+		fmt.Sprintf("Transfer %s to vendor bank account", payout.Reference),
+		Line{AccountType: AccountVendorPayable, OwnerID: payout.UserID, Amount: -amount},
+		Line{AccountType: AccountPayoutSettlement, OwnerID: payout.UserID, Amount: amount},
+	)
+}
+
+// RecordPayoutReversed undoes a settled payout whose transfer Paystack later reversed.
+func RecordPayoutReversed(tx *gorm.DB, payout models.Payout) error {
+	settled, err := posted(tx, fmt.Sprintf("payout:%s:%s", payout.ID, payout.Reference))
+	if err != nil || !settled {
+		return err
+	}
+
+	amount := payout.Amount.Kobo
+	return Post(tx, fmt.Sprintf("payout-reversal:%s:%s", payout.ID, payout.Reference), KindPayoutReversal, SourcePayout, payout.ID,
+		fmt.Sprintf("Reversal of transfer %s", payout.Reference),
+		Line{AccountType: AccountPayoutSettlement, OwnerID: payout.UserID, Amount: -amount},
+		Line{AccountType: AccountVendorPayable, OwnerID: payout.UserID, Amount: amount},
+	)
+}
+
+// VendorBalance summarises a vendor's position in kobo.
+type VendorBalance struct {
+	VendorID     uuid.UUID `json:"vendor_id"`
+	HeldInEscrow int64     `json:"held_in_escrow"`
+	Payable      int64     `json:"payable"`
+	PaidOut      int64     `json:"paid_out"`
+	Currency     string    `json:"currency"`
+}
+
+// Balance returns the sum of all lines posted to an account type, optionally for one owner.
+func Balance(db *gorm.DB, accountType string, ownerID *uuid.UUID) (int64, error) {
+	var total int64
+	query := db.Model(&models.JournalLine{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = journal_lines.account_id").
+		Where("ledger_accounts.type = ?", accountType)
+	if ownerID != nil {
+		query = query.Where("ledger_accounts.owner_id = ?", *ownerID)
+	}
+	err := query.Select("COALESCE(SUM(journal_lines.amount), 0)").Scan(&total).Error
+	return total, err
+}
+
+func GetVendorBalance(db *gorm.DB, vendorID uuid.UUID) (VendorBalance, error) {
+	balance := VendorBalance{VendorID: vendorID, Currency: models.CurrencyNGN}
+
+	var err error
+	if balance.HeldInEscrow, err = Balance(db, AccountEscrow, &vendorID); err != nil {
+		return balance, err
+	}
+	if balance.Payable, err = Balance(db, AccountVendorPayable, &vendorID); err != nil {
+		return balance, err
+	}
+	if balance.PaidOut, err = Balance(db, AccountPayoutSettlement, &vendorID); err != nil {
+		return balance, err
+	}
+
+	return balance, nil
+}
@@ -4,6 +4,10 @@ import (
 	"api/db"
 	"api/emails"
 	"api/handlers"
+	"api/models"
+	"api/notifications"
+	"api/otp"
+	"api/ratelimit"
 	"api/utils"
 
 	// "fmt"
@@ -11,6 +15,7 @@ import (
 	jwtMiddleware "api/middleware"
 	"os"
 	"strconv"
+	"time"
 
 	"log"
 
@@ -32,23 +37,25 @@ func main() {
 		log.Println(".env file loaded successfully")
 	}
 
-	// Verify API key is loaded
-	apiKey := os.Getenv("RESEND_API_KEY")
-	if apiKey == "" {
-		log.Fatal("RESEND_API_KEY not found in environment")
-	}
-	// log.Printf("RESEND_API_KEY loaded: %s...\n", apiKey[:10])
-
 	// Initialize database
 	db.ConnectDb()
 
 	// db.SyncReferralCounts(db.DB)
 	// db.ResetDatabase(db.DB)
 
+	// Picks Resend, SMTP or the local file sink from EMAIL_TRANSPORT / RESEND_API_KEY
 	emails.InitEmailClient()
+	// Counts in memory, or in Postgres with RATE_LIMIT_STORE=postgres when running several replicas
+	ratelimit.Init(db.DB)
+	// Logs SMS instead of sending them unless SMS_PROVIDER says otherwise
+	otp.InitSMS()
 	utils.StartJobs(db.DB)
+	// Pushes committed in-app notifications to the streams open on this instance
+	notifications.Listen(db.DB)
 
 	e := echo.New()
+	// Client IPs for rate limits and sessions come only from proxies we trust
+	e.IPExtractor = jwtMiddleware.ClientIPExtractor()
 
 	// Global middleware to return JSON
 	e.Use(middleware.Logger())
@@ -69,15 +76,35 @@ func main() {
 		}
 	})
 
+	// Rate limits per route group; each limit counts separately, per IP or per identity
+	loginLimit := jwtMiddleware.RateLimit("login",
+		jwtMiddleware.PerIP(30, 15*time.Minute), jwtMiddleware.PerField("email", 10, 15*time.Minute))
+	passwordResetLimit := jwtMiddleware.RateLimit("password-reset",
+		jwtMiddleware.PerIP(10, time.Hour), jwtMiddleware.PerField("email", 3, time.Hour))
+	authLimit := jwtMiddleware.RateLimit("auth", jwtMiddleware.PerIP(20, 15*time.Minute))
+	contactLimit := jwtMiddleware.RateLimit("contact",
+		jwtMiddleware.PerIP(5, time.Hour), jwtMiddleware.PerField("email", 3, time.Hour))
+	communityLimit := jwtMiddleware.RateLimit("community",
+		jwtMiddleware.PerIP(20, time.Minute), jwtMiddleware.PerUser(10, time.Minute))
+	phoneCodeLimit := jwtMiddleware.RateLimit("phone-code",
+		jwtMiddleware.PerIP(10, time.Hour), jwtMiddleware.PerUser(10, time.Hour))
+	guestListingLimit := jwtMiddleware.RateLimit("guest-listing",
+		jwtMiddleware.PerIP(5, time.Hour), jwtMiddleware.PerField("guest_phone", 3, 24*time.Hour))
+
 	// Routes
-	e.POST("/auth/register", handlers.Register(db.DB))
-	e.POST("/auth/login", handlers.Login(db.DB))
+	e.POST("/auth/register", handlers.Register(db.DB), authLimit)
+	e.POST("/auth/login", handlers.Login(db.DB), loginLimit)
 	e.POST("/auth/verify-email", handlers.VerifyEmail(db.DB))
-	e.POST("/auth/forgot-password", handlers.ForgotPassword(db.DB))
-	e.POST("/auth/reset-password", handlers.ResetPassword(db.DB))
+	e.POST("/auth/forgot-password", handlers.ForgotPassword(db.DB), passwordResetLimit)
+	e.POST("/auth/reset-password", handlers.ResetPassword(db.DB), authLimit)
 	e.POST("/auth/google", handlers.GoogleLogin(db.DB))
 	e.POST("/auth/facebook", handlers.FacebookLogin(db.DB))
-	e.POST("/contact", handlers.Contact(db.DB))
+	e.POST("/auth/refresh", handlers.RefreshSession(db.DB))
+	e.POST("/auth/2fa/verify", handlers.VerifyTwoFactorLogin(db.DB), authLimit)
+	e.POST("/contact", handlers.Contact(db.DB), contactLimit)
+	e.GET("/unsubscribe", handlers.GetUnsubscribeStatus(db.DB))
+	e.POST("/unsubscribe", handlers.Unsubscribe(db.DB))
+	e.POST("/resubscribe", handlers.Resubscribe(db.DB))
 
 	auth := e.Group("")
 	auth.Use(jwtMiddleware.AuthMiddleware)
@@ -107,6 +134,20 @@ func main() {
 	auth.GET("/food-orders/user", handlers.GetUserFoodOrders(db.DB))
 	auth.GET("/food-orders/vendor", handlers.GetVendorFoodOrders(db.DB))
 	auth.PATCH("/food-orders/:id/status", handlers.UpdateFoodOrderStatus(db.DB))
+	auth.PATCH("/food-orders/:id/customer-status", handlers.CustomerUpdateFoodOrderStatus(db.DB))
+	auth.GET("/food-orders/:id/history", handlers.GetFoodOrderHistory(db.DB))
+	auth.POST("/food-orders/:id/cancel", handlers.CancelFoodOrder(db.DB))
+	auth.POST("/food-orders/:id/confirm-delivery", handlers.ConfirmFoodOrderDelivery(db.DB))
+	auth.POST("/food-orders/:id/report-problem", handlers.ReportFoodOrderProblem(db.DB))
+
+	// -- CART & CHECKOUT ROUTES -- >
+	auth.GET("/cart", handlers.GetCart(db.DB))
+	auth.POST("/cart/items", handlers.AddCartItem(db.DB))
+	auth.PATCH("/cart/items/:id", handlers.UpdateCartItem(db.DB))
+	auth.DELETE("/cart/items/:id", handlers.RemoveCartItem(db.DB))
+	auth.DELETE("/cart", handlers.ClearCart(db.DB))
+	auth.POST("/cart/checkout", handlers.CheckoutCart(db.DB))
+	auth.GET("/food-checkouts/user", handlers.GetUserFoodCheckouts(db.DB))
 
 	// -- SERVICE BOOKINGS ROUTES -- >
 	auth.POST("/service-bookings", handlers.CreateServiceBooking(db.DB))
@@ -114,38 +155,99 @@ func main() {
 	auth.GET("/service-bookings/artisan", handlers.GetArtisanServiceBookings(db.DB))
 	auth.PATCH("/service-bookings/:id/artisan-complete", handlers.ArtisanCompleteBooking(db.DB))
 	auth.PATCH("/service-bookings/:id/customer-complete", handlers.CustomerCompleteBooking(db.DB))
+	auth.POST("/service-bookings/:id/cancel", handlers.CancelServiceBooking(db.DB))
+	auth.POST("/service-bookings/:id/reschedule", handlers.ProposeBookingReschedule(db.DB))
+	auth.GET("/service-bookings/:id/reschedules", handlers.GetBookingReschedules(db.DB))
+	auth.POST("/service-bookings/reschedules/:id/accept", handlers.AcceptBookingReschedule(db.DB))
+	auth.POST("/service-bookings/reschedules/:id/decline", handlers.DeclineBookingReschedule(db.DB))
+	auth.POST("/service-bookings/:id/no-show", handlers.ReportBookingNoShow(db.DB))
+	auth.POST("/service-bookings/quote-request", handlers.RequestServiceQuote(db.DB))
+	auth.POST("/service-bookings/:id/quotes", handlers.SendServiceQuote(db.DB))
+	auth.GET("/service-bookings/:id/quotes", handlers.GetBookingQuotes(db.DB))
+	auth.POST("/service-bookings/quotes/:id/accept", handlers.AcceptServiceQuote(db.DB))
+	auth.POST("/service-bookings/quotes/:id/decline", handlers.DeclineServiceQuote(db.DB))
+	auth.GET("/service-bookings/:id/milestones", handlers.GetBookingMilestones(db.DB))
+	auth.POST("/service-bookings/milestones/:id/pay", handlers.PayMilestone(db.DB))
+	auth.PATCH("/service-bookings/milestones/:id/artisan-complete", handlers.ArtisanCompleteMilestone(db.DB))
+	auth.PATCH("/service-bookings/milestones/:id/release", handlers.ReleaseMilestonePayment(db.DB))
+	auth.POST("/service-bookings/:id/dispute", handlers.RaiseBookingDispute(db.DB))
+	auth.GET("/service-bookings/:id/dispute", handlers.GetBookingDispute(db.DB))
+	auth.POST("/disputes/:id/messages", handlers.AddDisputeMessage(db.DB))
+	e.GET("/services/:id/availability", handlers.GetServiceAvailability(db.DB))
+	e.GET("/services/:id/slots", handlers.GetServiceSlots(db.DB))
+	auth.PUT("/services/:id/availability", handlers.SetServiceAvailability(db.DB))
+	auth.GET("/artisan/blackout-dates", handlers.GetBlackoutDates(db.DB))
+	auth.POST("/artisan/blackout-dates", handlers.AddBlackoutDate(db.DB))
+	auth.DELETE("/artisan/blackout-dates/:id", handlers.DeleteBlackoutDate(db.DB))
+
+	// -- PAYOUT ROUTES -- >
+	auth.GET("/payouts/user", handlers.GetUserPayouts(db.DB))
+	auth.GET("/ledger/balance", handlers.GetMyLedgerBalance(db.DB))
+
+	// -- SESSION & TWO-FACTOR ROUTES -->
+	auth.POST("/auth/logout", handlers.Logout(db.DB))
+	auth.POST("/auth/logout-all", handlers.LogoutAll(db.DB))
+	auth.GET("/auth/sessions", handlers.GetSessions(db.DB))
+	auth.DELETE("/auth/sessions/:id", handlers.RevokeSession(db.DB))
+	auth.GET("/auth/2fa", handlers.GetTwoFactorStatus(db.DB))
+	auth.POST("/auth/2fa/setup", handlers.SetupTwoFactor(db.DB))
+	auth.POST("/auth/2fa/confirm", handlers.ConfirmTwoFactor(db.DB))
+	auth.POST("/auth/2fa/backup-codes", handlers.RegenerateBackupCodes(db.DB))
+	auth.POST("/auth/2fa/disable", handlers.DisableTwoFactor(db.DB))
 
 	// -- USER ROUTES -->
 	auth.GET("/me", handlers.Me)
 
 	auth.PATCH("/users/update", handlers.UpdateUser(db.DB))
 	auth.POST("/store-settings", handlers.CreateStoreSettings(db.DB))
-	auth.PATCH("/products/update/:id/status", handlers.UpdateProductStatus(db.DB))
+	auth.PATCH("/products/update/:id/status", handlers.UpdateOwnProductStatus(db.DB))
+	auth.GET("/users/notification-preferences", handlers.GetNotificationPreferences(db.DB))
+	auth.PUT("/users/notification-preferences", handlers.UpdateNotificationPreferences(db.DB))
 	auth.GET("/users", handlers.GetUsers(db.DB))
 	auth.GET("/users/:id", handlers.GetUserById(db.DB))
 
-	// -- ADMIN ROUTES (Secure with AdminMiddleware) -->
+	// -- MESSAGING ROUTES -->
+	auth.POST("/products/:id/conversations", handlers.StartConversation(db.DB))
+	auth.GET("/conversations", handlers.GetConversations(db.DB))
+	auth.GET("/conversations/unread-count", handlers.GetUnreadMessageCount(db.DB))
+	auth.GET("/conversations/:id/messages", handlers.GetConversationMessages(db.DB))
+	auth.POST("/conversations/:id/messages", handlers.SendConversationMessage(db.DB))
+	auth.PATCH("/conversations/:id/read", handlers.MarkConversationRead(db.DB))
+
+	// -- PHONE VERIFICATION ROUTES -->
+	auth.POST("/auth/phone/send-code", handlers.SendPhoneCode(db.DB), phoneCodeLimit)
+	auth.POST("/auth/phone/verify", handlers.VerifyPhone(db.DB), phoneCodeLimit)
+
+	// -- NOTIFICATIONS ROUTES -->
+	auth.GET("/notifications", handlers.GetNotifications(db.DB))
+	auth.GET("/notifications/unread-count", handlers.GetUnreadNotificationCount(db.DB))
+	auth.GET("/notifications/stream", handlers.StreamNotifications(db.DB))
+	auth.PATCH("/notifications/read-all", handlers.MarkAllNotificationsRead(db.DB))
+	auth.PATCH("/notifications/:id/read", handlers.MarkNotificationRead(db.DB))
+
+	// -- ADMIN ROUTES (Secure with StaffMiddleware; each route names the permission it needs) -->
 	admin := auth.Group("/admin")
-	admin.Use(jwtMiddleware.IsAdminMiddleware)
-
-	admin.GET("/overview", handlers.GetDashboardOverview(db.DB))
-	admin.GET("/user/overview", handlers.GetUserDashboardOverview(db.DB))
-	admin.GET("/users", handlers.GetDashboardUsers(db.DB))
-	admin.GET("/products", handlers.GetAdminProducts(db.DB))
-	admin.GET("/user/:id", handlers.GetUserDetails(db.DB))
-	admin.POST("/feature-products/:box_number", handlers.UpdateFeaturedSection(db.DB))
-	admin.GET("/feature-products", handlers.GetFeaturedSections(db.DB))
-	admin.GET("/contact", handlers.GetContact(db.DB))
-	admin.DELETE("/contact/:id", handlers.DeleteContact(db.DB))
-	admin.DELETE("/feature-products", handlers.DeleteFeaturedProducts(db.DB))
-	admin.DELETE("/product/:id/delete", handlers.DeleteAdminProduct(db.DB))
-	admin.DELETE("/users/:id/delete", handlers.DeleteUser(db.DB))
+	admin.Use(jwtMiddleware.StaffMiddleware)
+	can := jwtMiddleware.RequirePermission
+
+	admin.GET("/overview", handlers.GetDashboardOverview(db.DB), can(models.PermDashboardView))
+	admin.GET("/user/overview", handlers.GetUserDashboardOverview(db.DB), can(models.PermDashboardView))
+	admin.GET("/users", handlers.GetDashboardUsers(db.DB), can(models.PermDashboardView))
+	admin.GET("/products", handlers.GetAdminProducts(db.DB), can(models.PermDashboardView))
+	admin.GET("/user/:id", handlers.GetUserDetails(db.DB), can(models.PermDashboardView))
+	admin.POST("/feature-products/:box_number", handlers.UpdateFeaturedSection(db.DB), can(models.PermContentManage))
+	admin.GET("/feature-products", handlers.GetFeaturedSections(db.DB), can(models.PermContentManage))
+	admin.GET("/contact", handlers.GetContact(db.DB), can(models.PermContactManage))
+	admin.DELETE("/contact/:id", handlers.DeleteContact(db.DB), can(models.PermContactManage))
+	admin.DELETE("/feature-products", handlers.DeleteFeaturedProducts(db.DB), can(models.PermContentManage))
+	admin.DELETE("/product/:id/delete", handlers.DeleteAdminProduct(db.DB), can(models.PermProductsModerate))
+	admin.DELETE("/users/:id/delete", handlers.DeleteUser(db.DB), can(models.PermUsersManage))
 
 	// Banner management
-	admin.GET("/banners/all", handlers.GetAdminBanners(db.DB))
-	admin.POST("/banners", handlers.CreateBanner(db.DB))
-	admin.DELETE("/banners/:id", handlers.DeleteBanner(db.DB))
-	admin.PATCH("/banners/:id/status", handlers.ToggleBannerStatus(db.DB))
+	admin.GET("/banners/all", handlers.GetAdminBanners(db.DB), can(models.PermContentManage))
+	admin.POST("/banners", handlers.CreateBanner(db.DB), can(models.PermContentManage))
+	admin.DELETE("/banners/:id", handlers.DeleteBanner(db.DB), can(models.PermContentManage))
+	admin.PATCH("/banners/:id/status", handlers.ToggleBannerStatus(db.DB), can(models.PermContentManage))
 
 	// Global featured products access (optional auth)
 	e.GET("/feature-products", handlers.GetFeaturedSections(db.DB), jwtMiddleware.OptionalAuthMiddleware)
@@ -153,10 +255,54 @@ func main() {
 	e.GET("/public-stats", handlers.GetPublicStats(db.DB))
 
 	// Admin-only verification and status updates
-	admin.POST("/users/verify/:id", handlers.VerifyUser(db.DB))
-	admin.PATCH("/users/update/:id/status", handlers.UpdateUserStatus(db.DB))
-	admin.PATCH("/products/update/:id/status", handlers.UpdateProductStatus(db.DB))
-	admin.POST("/newsletter", handlers.SendNewsletter(db.DB))
+	admin.POST("/users/verify/:id", handlers.VerifyUser(db.DB), can(models.PermUsersManage))
+	admin.PATCH("/users/update/:id/status", handlers.UpdateUserStatus(db.DB), can(models.PermUsersManage))
+	admin.GET("/roles", handlers.GetRoles(db.DB), can(models.PermRolesManage))
+	admin.PATCH("/users/:id/role", handlers.AssignUserRole(db.DB), can(models.PermRolesManage))
+	admin.PATCH("/products/update/:id/status", handlers.UpdateProductStatus(db.DB), can(models.PermProductsModerate))
+	admin.POST("/newsletter", handlers.SendNewsletter(db.DB), can(models.PermContentManage))
+	admin.GET("/paystack/events", handlers.GetPaystackEvents(db.DB), can(models.PermLedgerView))
+	admin.GET("/payouts", handlers.GetAdminPayouts(db.DB), can(models.PermPayoutsManage))
+	admin.POST("/payouts/:id/retry", handlers.RetryPayout(db.DB), can(models.PermPayoutsManage))
+
+	// Ledger & reconciliation
+	admin.GET("/ledger/summary", handlers.GetLedgerSummary(db.DB), can(models.PermLedgerView))
+	admin.GET("/ledger/entries", handlers.GetJournalEntries(db.DB), can(models.PermLedgerView))
+	admin.GET("/ledger/vendors/:id/balance", handlers.GetVendorLedgerBalance(db.DB), can(models.PermLedgerView))
+
+	// Commission rules
+	admin.GET("/commission-rules", handlers.GetCommissionRules(db.DB), can(models.PermCommissionManage))
+	admin.POST("/commission-rules", handlers.CreateCommissionRule(db.DB), can(models.PermCommissionManage))
+	admin.PUT("/commission-rules/:id", handlers.UpdateCommissionRule(db.DB), can(models.PermCommissionManage))
+	admin.DELETE("/commission-rules/:id", handlers.DeleteCommissionRule(db.DB), can(models.PermCommissionManage))
+
+	// Food orders
+	admin.PATCH("/food-orders/:id/status", handlers.AdminUpdateFoodOrderStatus(db.DB), can(models.PermOrdersManage))
+
+	// Refunds
+	admin.GET("/refunds", handlers.GetAdminRefunds(db.DB), can(models.PermRefundsManage))
+	admin.POST("/refunds/:id/retry", handlers.RetryRefund(db.DB), can(models.PermRefundsManage))
+	admin.POST("/food-orders/:id/refund", handlers.AdminRefundFoodOrder(db.DB), can(models.PermRefundsManage))
+	admin.POST("/food-orders/:id/release", handlers.AdminReleaseFoodOrder(db.DB), can(models.PermRefundsManage))
+	admin.POST("/service-bookings/:id/refund", handlers.AdminRefundServiceBooking(db.DB), can(models.PermRefundsManage))
+	admin.POST("/milestones/:id/release", handlers.AdminReleaseMilestone(db.DB), can(models.PermRefundsManage))
+	admin.POST("/milestones/:id/refund", handlers.AdminRefundMilestone(db.DB), can(models.PermRefundsManage))
+
+	// Background jobs
+	admin.GET("/jobs", handlers.GetAdminJobRuns(db.DB), can(models.PermSystemManage))
+	admin.POST("/jobs/:id/retry", handlers.RetryJobRun(db.DB), can(models.PermSystemManage))
+
+	// Transactional emails
+	admin.GET("/emails", handlers.GetAdminEmails(db.DB), can(models.PermSystemManage))
+	admin.POST("/emails/:id/retry", handlers.RetryEmail(db.DB), can(models.PermSystemManage))
+	admin.GET("/emails/templates", handlers.GetEmailTemplates(), can(models.PermSystemManage))
+	admin.GET("/emails/templates/:name/preview", handlers.PreviewEmailTemplate(), can(models.PermSystemManage))
+
+	// Booking disputes
+	admin.GET("/disputes", handlers.GetAdminDisputes(db.DB), can(models.PermDisputesManage))
+	admin.GET("/disputes/:id", handlers.GetAdminDispute(db.DB), can(models.PermDisputesManage))
+	admin.POST("/disputes/:id/messages", handlers.AdminAddDisputeMessage(db.DB), can(models.PermDisputesManage))
+	admin.POST("/disputes/:id/resolve", handlers.ResolveDispute(db.DB), can(models.PermDisputesManage))
 
 	// -- REVIEW ROUTES -->
 
@@ -172,11 +318,11 @@ func main() {
 
 	// -- NEDZL COMMUNITY ROUTES -->
 	e.GET("/community/messages", handlers.GetCommunityMessages)
-	e.POST("/community/send", handlers.SendCommunityMessage, jwtMiddleware.OptionalAuthMiddleware)
+	e.POST("/community/send", handlers.SendCommunityMessage, jwtMiddleware.OptionalAuthMiddleware, communityLimit)
 	e.POST("/community/messages/:id/react", handlers.ReactToCommunityMessage)
 
 	// -- GUEST PRODUCT LISTING ROUTE -->
-	e.POST("/products/guest-create", handlers.CreateGuestProduct(db.DB))
+	e.POST("/products/guest-create", handlers.CreateGuestProduct(db.DB), guestListingLimit)
 
 	// Get port from environment variable (Railway provides PORT)
 	port := os.Getenv("PORT")
@@ -1,54 +1,45 @@
 package middleware
 
 import (
+	"api/db"
+	"api/models"
+	"api/sessions"
 	"net/http"
 	"strings"
 
-	"os"
-
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return []byte("supersecretkey") // Fallback for dev, but should be set in production
+// bearerToken returns the token of an "Authorization: Bearer" header, or "".
+func bearerToken(c echo.Context) string {
+	authHeader := c.Request().Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return ""
 	}
-	return []byte(secret)
+	return strings.TrimPrefix(authHeader, "Bearer ")
 }
 
+// AuthMiddleware requires an access token of a live session of an active user and sets
+// user_id, role and session_id on the context.
 func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		tokenStr := bearerToken(c)
+		if tokenStr == "" {
 			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired token"})
 		}
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return getJWTSecret(), nil
-		})
 
-		if err != nil || !token.Valid {
+		principal, err := sessions.Authenticate(db.DB, tokenStr)
+		if err == sessions.ErrUserBlocked {
+			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Your account is not active"})
+		}
+		if err != nil {
 			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired token"})
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		if userIDStr, ok := claims["user_id"].(string); ok {
-			uid, err := uuid.Parse(userIDStr)
-			if err != nil {
-				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token user id"})
-			}
-			c.Set("user_id", uid)
-		} else {
-			return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid token claims"})
-		}
-
-		if role, ok := claims["role"].(string); ok {
-			c.Set("role", role)
-		}
+		c.Set("user_id", principal.UserID)
+		c.Set("role", string(principal.Role))
+		c.Set("session_id", principal.SessionID)
+		c.Set("two_factor", principal.TwoFactor)
 
 		return next(c)
 
@@ -56,46 +47,54 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 }
 
+// OptionalAuthMiddleware identifies the caller like AuthMiddleware when it can, and treats
+// them as a guest otherwise.
 func OptionalAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		authHeader := c.Request().Header.Get("Authorization")
-
-		// If no header or invalid format, just proceed without setting user_id
-		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+		tokenStr := bearerToken(c)
+		if tokenStr == "" {
 			return next(c)
 		}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return getJWTSecret(), nil
-		})
-
-		// If invalid token, just proceed (or maybe we should log it? For now, treat as guest)
-		if err != nil || !token.Valid {
-			return next(c)
-		}
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			if userIDStr, ok := claims["user_id"].(string); ok {
-				if uid, err := uuid.Parse(userIDStr); err == nil {
-					c.Set("user_id", uid)
-				}
-			}
-			if role, ok := claims["role"].(string); ok {
-				c.Set("role", role)
-			}
+		if principal, err := sessions.Authenticate(db.DB, tokenStr); err == nil {
+			c.Set("user_id", principal.UserID)
+			c.Set("role", string(principal.Role))
+			c.Set("session_id", principal.SessionID)
+			c.Set("two_factor", principal.TwoFactor)
 		}
 
 		return next(c)
 	}
 }
 
-func IsAdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+// StaffMiddleware allows staff roles whose session was signed in with two-factor
+// authentication; a password alone is not enough for back-office access. Routes behind it
+// also check a specific permission with RequirePermission.
+func StaffMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		role, ok := c.Get("role").(string)
-		if !ok || role != "ADMIN" {
-			return c.JSON(http.StatusForbidden, echo.Map{"error": "Admin access required"})
+		role, _ := c.Get("role").(string)
+		if !models.IsStaff(models.Role(role)) {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": "Staff access required"})
+		}
+		if twoFactor, _ := c.Get("two_factor").(bool); !twoFactor {
+			return c.JSON(http.StatusForbidden, echo.Map{
+				"error":               "Two-factor authentication is required for staff access",
+				"two_factor_required": true,
+			})
 		}
 		return next(c)
 	}
 }
+
+// RequirePermission allows callers whose role grants perm.
+func RequirePermission(perm models.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("role").(string)
+			if !models.HasPermission(models.Role(role), perm) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "You do not have permission to do this", "permission": perm})
+			}
+			return next(c)
+		}
+	}
+}
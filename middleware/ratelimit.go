@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"api/ratelimit"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Limit is one bucket of a rate limit: at most Requests per Window for each value of its key.
+type Limit struct {
+	scope    string
+	key      func(c echo.Context) string // "" means the bucket does not apply to the request
+	Requests int
+	Window   time.Duration
+}
+
+// ClientIPExtractor reads the client IP from X-Forwarded-For, trusting only the hops added by
+// proxies in loopback or private ranges or in TRUSTED_PROXIES (comma-separated CIDRs). Without
+// it Echo believes whatever X-Forwarded-For or X-Real-IP the client sends, and a fresh header
+// on every request would get around the per-IP limits.
+func ClientIPExtractor() echo.IPExtractor {
+	var trust []echo.TrustOption
+	for _, cidr := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("❌ Invalid TRUSTED_PROXIES range %q: %v", cidr, err)
+		}
+		trust = append(trust, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(trust...)
+}
+
+// PerIP limits each client IP address. It relies on ClientIPExtractor being set on the server.
+func PerIP(requests int, window time.Duration) Limit {
+	return Limit{scope: "ip", key: func(c echo.Context) string { return c.RealIP() }, Requests: requests, Window: window}
+}
+
+// PerUser limits each signed-in user. It must come after AuthMiddleware or
+// OptionalAuthMiddleware; guests are left to the other limits.
+func PerUser(requests int, window time.Duration) Limit {
+	return Limit{scope: "user", key: func(c echo.Context) string {
+		if id, ok := c.Get("user_id").(uuid.UUID); ok {
+			return id.String()
+		}
+		return ""
+	}, Requests: requests, Window: window}
+}
+
+// PerField limits each value of a JSON or form field of the request, such as the email being
+// logged in to, so that spreading requests over many IPs doesn't get around the limit.
+func PerField(field string, requests int, window time.Duration) Limit {
+	return Limit{scope: field, key: func(c echo.Context) string {
+		return strings.ToLower(strings.TrimSpace(requestField(c, field)))
+	}, Requests: requests, Window: window}
+}
+
+// maxPeekBody is how much of a JSON body PerField reads; larger bodies are not keyed.
+const maxPeekBody = 64 << 10
+
+// requestField reads field from a JSON or form body and leaves the body for the handler.
+func requestField(c echo.Context, field string) string {
+	req := c.Request()
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return c.FormValue(field)
+	}
+	if req.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxPeekBody+1))
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	if err != nil || len(body) > maxPeekBody {
+		return ""
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	value, _ := fields[field].(string)
+	return value
+}
+
+// RateLimit refuses requests with 429 once any of limits is used up. group names the
+// buckets, so routes sharing a group share their counts. Requests go through if the store
+// fails, rather than taking the routes down with it.
+func RateLimit(group string, limits ...Limit) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			remaining, resetAt, limit := math.MaxInt, time.Time{}, 0
+			for _, l := range limits {
+				value := l.key(c)
+				if value == "" {
+					continue
+				}
+				key := fmt.Sprintf("rl:%s:%s:%s", group, l.scope, value)
+				count, reset, err := ratelimit.Default().Incr(key, l.Window)
+				if err != nil {
+					log.Printf("Rate limit: Error counting %s: %v\n", key, err)
+					continue
+				}
+
+				left := l.Requests - int(count)
+				if left < remaining {
+					remaining, resetAt, limit = left, reset, l.Requests
+				}
+				if left < 0 {
+					retryAfter := int(math.Ceil(time.Until(reset).Seconds()))
+					c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					return c.JSON(http.StatusTooManyRequests, echo.Map{
+						"error":       "Too many requests, please try again later",
+						"retry_after": retryAfter,
+					})
+				}
+			}
+
+			if limit > 0 {
+				h := c.Response().Header()
+				h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+				h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+				h.Set("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+			}
+			return next(c)
+		}
+	}
+}
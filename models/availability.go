@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultSlotMinutes is the length of a booking slot for services without a schedule.
+const DefaultSlotMinutes = 60
+
+// ServiceSchedule is when an artisan takes bookings for one service and how long each booking lasts.
+// Services without a schedule can be booked at any time.
+type ServiceSchedule struct {
+	ID          uuid.UUID            `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServiceID   uuid.UUID            `gorm:"type:uuid;uniqueIndex;not null" json:"service_id"`
+	ArtisanID   uuid.UUID            `gorm:"type:uuid;index;not null" json:"artisan_id"`
+	SlotMinutes int                  `gorm:"not null;default:60" json:"slot_minutes"`
+	Windows     []AvailabilityWindow `gorm:"foreignKey:ScheduleID;constraint:OnDelete:CASCADE;" json:"windows"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// AvailabilityWindow is a weekly block of working hours, e.g. Monday 09:00–17:00, in Lagos time.
+type AvailabilityWindow struct {
+	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ScheduleID uuid.UUID `gorm:"type:uuid;index;not null" json:"schedule_id"`
+	Weekday    int       `gorm:"not null" json:"weekday"`                    // 0 = Sunday … 6 = Saturday
+	StartTime  string    `gorm:"type:varchar(5);not null" json:"start_time"` // HH:MM
+	EndTime    string    `gorm:"type:varchar(5);not null" json:"end_time"`   // HH:MM
+}
+
+// BlackoutDate is a day an artisan takes no bookings for any of their services.
+type BlackoutDate struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ArtisanID uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_blackout_artisan_date;not null" json:"artisan_id"`
+	Date      string    `gorm:"type:varchar(10);uniqueIndex:idx_blackout_artisan_date;not null" json:"date"` // YYYY-MM-DD, Lagos time
+	Reason    string    `gorm:"type:varchar(255)" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
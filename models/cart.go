@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// CartItem is a food product waiting in a user's cart. SubMenus holds the selected option names.
+type CartItem struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"`
+	ProductID uuid.UUID      `gorm:"type:uuid;index;not null" json:"product_id"`
+	Product   Products       `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product"`
+	Quantity  int            `gorm:"default:1" json:"quantity"`
+	SubMenus  datatypes.JSON `json:"sub_menus"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// FoodCheckout is a single Paystack payment covering one food order per vendor in the cart.
+type FoodCheckout struct {
+	ID            uuid.UUID   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID        uuid.UUID   `gorm:"type:uuid;index;not null" json:"user_id"`
+	Reference     string      `gorm:"type:varchar(100);uniqueIndex;not null" json:"reference"`
+	TotalAmount   Money       `json:"total_amount"`
+	PaymentStatus string      `gorm:"type:varchar(30);default:'PENDING'" json:"payment_status"` // PENDING, SUCCESS, FAILED, REFUNDED
+	Orders        []FoodOrder `gorm:"foreignKey:CheckoutID" json:"orders"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// FoodOrderItem is one line of a food order placed from the cart.
+type FoodOrderItem struct {
+	ID               uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	FoodOrderID      uuid.UUID      `gorm:"type:uuid;index;not null" json:"food_order_id"`
+	ProductID        uuid.UUID      `gorm:"type:uuid;index;not null" json:"product_id"`
+	Product          Products       `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product"`
+	Quantity         int            `json:"quantity"`
+	SubMenus         datatypes.JSON `json:"sub_menus"`
+	UnitPrice        Money          `json:"unit_price"` // product price plus options
+	LineTotal        Money          `json:"line_total"`
+	PlatformFee      Money          `json:"platform_fee"`
+	CommissionRuleID *uuid.UUID     `gorm:"type:uuid" json:"commission_rule_id"`
+	CreatedAt        time.Time      `json:"created_at"`
+}
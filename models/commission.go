@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CommissionRule sets the platform fee taken from food orders and service bookings.
+// Empty ProductType/CategoryName and a nil VendorID match everything; the most specific
+// active rule wins (vendor, then category, then product type), ties broken by Priority.
+type CommissionRule struct {
+	ID           uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name         string         `gorm:"size:150;not null" json:"name"`
+	ProductType  string         `gorm:"type:varchar(20);default:'';index" json:"product_type"` // MARKET, FOOD, SERVICE or empty for any
+	CategoryName string         `gorm:"size:150;default:''" json:"category_name"`
+	VendorID     *uuid.UUID     `gorm:"type:uuid;index" json:"vendor_id"`
+	Percent      float64        `gorm:"default:0" json:"percent"`  // e.g. 10 for 10%
+	FlatFee      Money          `gorm:"default:0" json:"flat_fee"` // added on top of the percentage
+	MinFee       Money          `gorm:"default:0" json:"min_fee"`
+	MaxFee       Money          `gorm:"default:0" json:"max_fee"` // 0 means uncapped
+	StartsAt     *time.Time     `json:"starts_at"`
+	EndsAt       *time.Time     `json:"ends_at"`
+	Priority     int            `gorm:"default:0" json:"priority"`
+	IsActive     bool           `gorm:"default:true" json:"is_active"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+}
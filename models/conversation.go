@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// Conversation is the private thread between a buyer and the seller of one product. There
+// is at most one per buyer and product.
+type Conversation struct {
+	ID               uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProductID        uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_conversations_product_buyer" json:"product_id"`
+	Product          Products   `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	BuyerID          uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_conversations_product_buyer;index" json:"buyer_id"`
+	Buyer            User       `gorm:"foreignKey:BuyerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	SellerID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"seller_id"`
+	Seller           User       `gorm:"foreignKey:SellerID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	BuyerLastReadAt  *time.Time `json:"buyer_last_read_at"`
+	SellerLastReadAt *time.Time `json:"seller_last_read_at"`
+	LastMessageAt    *time.Time `gorm:"index" json:"last_message_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// ConversationMessage is one message in a conversation, optionally with images.
+type ConversationMessage struct {
+	ID             uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ConversationID uuid.UUID      `gorm:"type:uuid;not null;index:idx_conversation_messages_created" json:"conversation_id"`
+	SenderID       uuid.UUID      `gorm:"type:uuid;not null" json:"sender_id"`
+	Message        string         `gorm:"type:text" json:"message"`
+	Images         datatypes.JSON `json:"images"` // Cloudinary image URLs
+	CreatedAt      time.Time      `gorm:"index:idx_conversation_messages_created" json:"created_at"`
+}
+
+// ConversationParticipant is what each side of a conversation sees of the other. Contact
+// details stay private; the conversation replaces them.
+type ConversationParticipant struct {
+	ID         uuid.UUID `json:"id"`
+	UserName   string    `json:"user_name"`
+	ImageUrl   string    `json:"image_url"`
+	IsVerified bool      `json:"is_verified"`
+}
+
+// ConversationProduct is the listing a conversation is about.
+type ConversationProduct struct {
+	ID           uuid.UUID      `json:"id"`
+	Name         string         `json:"product_name"`
+	ProductPrice Money          `json:"product_price"`
+	ImageUrls    datatypes.JSON `json:"image_urls"`
+	Status       Status         `json:"status"`
+}
+
+// ConversationSummary is a conversation as listed in a user's inbox.
+type ConversationSummary struct {
+	ID            uuid.UUID               `json:"id"`
+	Role          string                  `json:"role"` // BUYER or SELLER: the viewer's side
+	Product       ConversationProduct     `json:"product"`
+	Counterpart   ConversationParticipant `json:"counterpart"`
+	LastMessage   *ConversationMessage    `json:"last_message"`
+	Unread        int64                   `json:"unread"`
+	LastMessageAt *time.Time              `json:"last_message_at"`
+	CreatedAt     time.Time               `json:"created_at"`
+}
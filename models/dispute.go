@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// BookingDisputed is the status of a booking whose completion the customer contests.
+// Escrow is not auto-released while a booking is disputed.
+const BookingDisputed = "DISPUTED"
+
+const (
+	DisputeOpen     = "OPEN"
+	DisputeResolved = "RESOLVED"
+)
+
+// How an admin settles a dispute.
+const (
+	DisputeRelease       = "RELEASE"        // artisan is paid in full
+	DisputePartialRefund = "PARTIAL_REFUND" // customer gets part of the fee back, artisan is paid the rest
+	DisputeFullRefund    = "FULL_REFUND"    // customer gets the whole fee back
+)
+
+// Dispute is a customer's challenge to a booking the artisan marked as completed.
+// There is at most one dispute per booking.
+type Dispute struct {
+	ID             uuid.UUID        `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	BookingID      uuid.UUID        `gorm:"type:uuid;uniqueIndex;not null" json:"booking_id"`
+	Booking        ServiceBooking   `gorm:"foreignKey:BookingID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"booking"`
+	CustomerID     uuid.UUID        `gorm:"type:uuid;index;not null" json:"customer_id"`
+	ArtisanID      uuid.UUID        `gorm:"type:uuid;index;not null" json:"artisan_id"`
+	Reason         string           `gorm:"type:text;not null" json:"reason"`
+	Status         string           `gorm:"type:varchar(20);default:'OPEN';index" json:"status"`
+	Resolution     string           `gorm:"type:varchar(20)" json:"resolution"` // RELEASE, PARTIAL_REFUND, FULL_REFUND
+	RefundAmount   Money            `json:"refund_amount"`
+	ResolutionNote string           `gorm:"type:text" json:"resolution_note"`
+	ResolvedByID   *uuid.UUID       `gorm:"type:uuid" json:"resolved_by_id"`
+	ResolvedAt     *time.Time       `json:"resolved_at"`
+	Messages       []DisputeMessage `gorm:"foreignKey:DisputeID" json:"messages,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// DisputeMessage is one post in a dispute thread, optionally with evidence images.
+type DisputeMessage struct {
+	ID         uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	DisputeID  uuid.UUID      `gorm:"type:uuid;index;not null" json:"dispute_id"`
+	SenderID   uuid.UUID      `gorm:"type:uuid;not null" json:"sender_id"`
+	Sender     User           `gorm:"foreignKey:SenderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"sender"`
+	SenderRole string         `gorm:"type:varchar(20);not null" json:"sender_role"` // CUSTOMER, VENDOR (artisan), ADMIN
+	Message    string         `gorm:"type:text" json:"message"`
+	Evidence   datatypes.JSON `json:"evidence"` // Cloudinary image URLs
+	CreatedAt  time.Time      `json:"created_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	EmailPending = "PENDING" // queued, or waiting to be retried after a failed attempt
+	EmailSent    = "SENT"
+	EmailFailed  = "FAILED" // every attempt failed, an admin can retry it
+)
+
+// OutboxEmail is a transactional email written in the same transaction as the change that
+// triggers it. A background job delivers it through the emails package, retrying with backoff.
+type OutboxEmail struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Kind      string         `gorm:"type:varchar(60);index;not null" json:"kind"`
+	Recipient string         `gorm:"type:varchar(255);index" json:"recipient"`
+	Args      datatypes.JSON `json:"-"` // arguments of the emails.Send* function, in order; never listed, they hold reset and verification tokens
+	Status    string         `gorm:"type:varchar(20);default:'PENDING';index" json:"status"`
+	Attempts  int            `gorm:"default:0" json:"attempts"`
+	LastError string         `gorm:"type:text" json:"last_error"`
+	JobID     *uuid.UUID     `gorm:"type:uuid" json:"job_id"` // delivery job of the latest attempt series
+	SentAt    *time.Time     `json:"sent_at"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
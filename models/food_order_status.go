@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FoodOrderPending        = "PENDING"
+	FoodOrderPaid           = "PAID"
+	FoodOrderPreparing      = "PREPARING"
+	FoodOrderOutForDelivery = "OUT_FOR_DELIVERY"
+	FoodOrderDelivered      = "DELIVERED"
+	FoodOrderCancelled      = "CANCELLED"
+	FoodOrderRefunded       = "REFUNDED"
+)
+
+// Actors that can move an order along its lifecycle. SYSTEM covers Paystack webhooks and jobs.
+const (
+	ActorCustomer = "CUSTOMER"
+	ActorVendor   = "VENDOR"
+	ActorAdmin    = "ADMIN"
+	ActorSystem   = "SYSTEM"
+)
+
+// foodOrderTransitions lists, for each status, the statuses it may move to and who may move it.
+var foodOrderTransitions = map[string]map[string][]string{
+	FoodOrderPending: {
+		FoodOrderPaid:      {ActorSystem},
+		FoodOrderCancelled: {ActorCustomer, ActorAdmin, ActorSystem},
+	},
+	FoodOrderPaid: {
+		FoodOrderPreparing: {ActorVendor, ActorAdmin},
+		FoodOrderCancelled: {ActorCustomer, ActorVendor, ActorAdmin},
+		FoodOrderRefunded:  {ActorAdmin, ActorSystem},
+	},
+	FoodOrderPreparing: {
+		FoodOrderOutForDelivery: {ActorVendor, ActorAdmin},
+		FoodOrderCancelled:      {ActorVendor, ActorAdmin},
+		FoodOrderRefunded:       {ActorAdmin, ActorSystem},
+	},
+	FoodOrderOutForDelivery: {
+		FoodOrderDelivered: {ActorVendor, ActorCustomer, ActorAdmin},
+		FoodOrderRefunded:  {ActorAdmin, ActorSystem},
+	},
+	FoodOrderDelivered: {
+		FoodOrderRefunded: {ActorAdmin, ActorSystem},
+	},
+	FoodOrderCancelled: {
+		FoodOrderRefunded: {ActorAdmin, ActorSystem},
+	},
+	FoodOrderRefunded: {},
+}
+
+// CanTransitionFoodOrder reports whether actor may move an order from one status to another.
+func CanTransitionFoodOrder(from, to, actor string) error {
+	next, ok := foodOrderTransitions[from]
+	if !ok {
+		return fmt.Errorf("unknown order status %q", from)
+	}
+	if _, ok := foodOrderTransitions[to]; !ok {
+		return fmt.Errorf("unknown order status %q", to)
+	}
+	actors, ok := next[to]
+	if !ok {
+		return fmt.Errorf("an order cannot move from %s to %s", from, to)
+	}
+	for _, a := range actors {
+		if a == actor {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s cannot move an order from %s to %s", actor, from, to)
+}
+
+// NextFoodOrderStatuses lists the statuses actor may move an order in status from to.
+func NextFoodOrderStatuses(from, actor string) []string {
+	var statuses []string
+	for _, to := range []string{FoodOrderPaid, FoodOrderPreparing, FoodOrderOutForDelivery, FoodOrderDelivered, FoodOrderCancelled, FoodOrderRefunded} {
+		if CanTransitionFoodOrder(from, to, actor) == nil {
+			statuses = append(statuses, to)
+		}
+	}
+	return statuses
+}
+
+// FoodOrderStatusHistory records every status change of a food order. FromStatus is empty
+// for the entry written when the order is placed.
+type FoodOrderStatusHistory struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	FoodOrderID uuid.UUID  `gorm:"type:uuid;index;not null" json:"food_order_id"`
+	FromStatus  string     `gorm:"type:varchar(30)" json:"from_status"`
+	ToStatus    string     `gorm:"type:varchar(30);not null" json:"to_status"`
+	Actor       string     `gorm:"type:varchar(20);not null" json:"actor"` // CUSTOMER, VENDOR, ADMIN, SYSTEM
+	ActorID     *uuid.UUID `gorm:"type:uuid" json:"actor_id"`
+	Note        string     `gorm:"type:text" json:"note"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
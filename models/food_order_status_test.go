@@ -0,0 +1,105 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	foodOrderStatuses = []string{FoodOrderPending, FoodOrderPaid, FoodOrderPreparing, FoodOrderOutForDelivery,
+		FoodOrderDelivered, FoodOrderCancelled, FoodOrderRefunded}
+	foodOrderActors = []string{ActorCustomer, ActorVendor, ActorAdmin, ActorSystem}
+)
+
+func TestCanTransitionFoodOrder(t *testing.T) {
+	// Every allowed move; anything not listed must be refused.
+	allowed := map[[3]string]bool{
+		{FoodOrderPending, FoodOrderPaid, ActorSystem}:        true,
+		{FoodOrderPending, FoodOrderCancelled, ActorCustomer}: true,
+		{FoodOrderPending, FoodOrderCancelled, ActorAdmin}:    true,
+		{FoodOrderPending, FoodOrderCancelled, ActorSystem}:   true,
+
+		{FoodOrderPaid, FoodOrderPreparing, ActorVendor}:   true,
+		{FoodOrderPaid, FoodOrderPreparing, ActorAdmin}:    true,
+		{FoodOrderPaid, FoodOrderCancelled, ActorCustomer}: true,
+		{FoodOrderPaid, FoodOrderCancelled, ActorVendor}:   true,
+		{FoodOrderPaid, FoodOrderCancelled, ActorAdmin}:    true,
+		{FoodOrderPaid, FoodOrderRefunded, ActorAdmin}:     true,
+		{FoodOrderPaid, FoodOrderRefunded, ActorSystem}:    true,
+
+		{FoodOrderPreparing, FoodOrderOutForDelivery, ActorVendor}: true,
+		{FoodOrderPreparing, FoodOrderOutForDelivery, ActorAdmin}:  true,
+		{FoodOrderPreparing, FoodOrderCancelled, ActorVendor}:      true,
+		{FoodOrderPreparing, FoodOrderCancelled, ActorAdmin}:       true,
+		{FoodOrderPreparing, FoodOrderRefunded, ActorAdmin}:        true,
+		{FoodOrderPreparing, FoodOrderRefunded, ActorSystem}:       true,
+
+		{FoodOrderOutForDelivery, FoodOrderDelivered, ActorVendor}:   true,
+		{FoodOrderOutForDelivery, FoodOrderDelivered, ActorCustomer}: true,
+		{FoodOrderOutForDelivery, FoodOrderDelivered, ActorAdmin}:    true,
+		{FoodOrderOutForDelivery, FoodOrderRefunded, ActorAdmin}:     true,
+		{FoodOrderOutForDelivery, FoodOrderRefunded, ActorSystem}:    true,
+
+		{FoodOrderDelivered, FoodOrderRefunded, ActorAdmin}:  true,
+		{FoodOrderDelivered, FoodOrderRefunded, ActorSystem}: true,
+
+		{FoodOrderCancelled, FoodOrderRefunded, ActorAdmin}:  true,
+		{FoodOrderCancelled, FoodOrderRefunded, ActorSystem}: true,
+	}
+
+	for _, from := range foodOrderStatuses {
+		for _, to := range foodOrderStatuses {
+			for _, actor := range foodOrderActors {
+				err := CanTransitionFoodOrder(from, to, actor)
+				if want := allowed[[3]string{from, to, actor}]; want != (err == nil) {
+					t.Errorf("%s %s → %s: allowed = %v, want %v (%v)", actor, from, to, err == nil, want, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCanTransitionFoodOrderRefusals(t *testing.T) {
+	tests := []struct {
+		name          string
+		from, to, who string
+	}{
+		{"customer cannot cancel once the vendor is preparing", FoodOrderPreparing, FoodOrderCancelled, ActorCustomer},
+		{"vendor cannot refund", FoodOrderPaid, FoodOrderRefunded, ActorVendor},
+		{"vendor cannot refund a delivered order", FoodOrderDelivered, FoodOrderRefunded, ActorVendor},
+		{"customer cannot refund", FoodOrderCancelled, FoodOrderRefunded, ActorCustomer},
+		{"only payment marks an order paid", FoodOrderPending, FoodOrderPaid, ActorAdmin},
+		{"vendor cannot skip preparing", FoodOrderPaid, FoodOrderOutForDelivery, ActorVendor},
+		{"delivered orders cannot be cancelled", FoodOrderDelivered, FoodOrderCancelled, ActorAdmin},
+		{"refunded is final", FoodOrderRefunded, FoodOrderPaid, ActorSystem},
+		{"no move to the same status", FoodOrderPreparing, FoodOrderPreparing, ActorVendor},
+		{"unknown from status", "SHIPPED", FoodOrderDelivered, ActorAdmin},
+		{"unknown to status", FoodOrderPaid, "SHIPPED", ActorAdmin},
+		{"unknown actor", FoodOrderPaid, FoodOrderPreparing, "GUEST"},
+	}
+	for _, tt := range tests {
+		if err := CanTransitionFoodOrder(tt.from, tt.to, tt.who); err == nil {
+			t.Errorf("%s: %s %s → %s was allowed", tt.name, tt.who, tt.from, tt.to)
+		}
+	}
+}
+
+func TestNextFoodOrderStatuses(t *testing.T) {
+	tests := []struct {
+		from, actor string
+		want        []string
+	}{
+		{FoodOrderPaid, ActorCustomer, []string{FoodOrderCancelled}},
+		{FoodOrderPaid, ActorVendor, []string{FoodOrderPreparing, FoodOrderCancelled}},
+		{FoodOrderPreparing, ActorCustomer, nil},
+		{FoodOrderPreparing, ActorVendor, []string{FoodOrderOutForDelivery, FoodOrderCancelled}},
+		{FoodOrderOutForDelivery, ActorCustomer, []string{FoodOrderDelivered}},
+		{FoodOrderDelivered, ActorAdmin, []string{FoodOrderRefunded}},
+		{FoodOrderRefunded, ActorAdmin, nil},
+	}
+	for _, tt := range tests {
+		if got := NextFoodOrderStatuses(tt.from, tt.actor); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NextFoodOrderStatuses(%s, %s) = %v, want %v", tt.from, tt.actor, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	JobQueued    = "QUEUED"  // waiting for RunAt, including retries after a failed attempt
+	JobRunning   = "RUNNING" // claimed by a worker until LockedUntil
+	JobSucceeded = "SUCCEEDED"
+	JobDead      = "DEAD" // retries exhausted, needs admin attention
+)
+
+// Job is one run of a background job. Scheduled jobs get a new row every time their cron
+// schedule fires; one-off jobs are enqueued directly. Workers on any replica claim due rows
+// with FOR UPDATE SKIP LOCKED, so each run executes once.
+type Job struct {
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string         `gorm:"type:varchar(100);index;not null" json:"name"`
+	Payload     datatypes.JSON `json:"payload"`
+	UniqueKey   *string        `gorm:"type:varchar(200);uniqueIndex" json:"unique_key"` // e.g. schedule name and fire time
+	Status      string         `gorm:"type:varchar(20);default:'QUEUED';index:idx_job_due" json:"status"`
+	RunAt       time.Time      `gorm:"index:idx_job_due;not null" json:"run_at"`
+	Attempts    int            `gorm:"default:0" json:"attempts"`
+	MaxAttempts int            `gorm:"default:5" json:"max_attempts"`
+	LockedBy    string         `gorm:"type:varchar(100)" json:"locked_by"`
+	LockedUntil *time.Time     `json:"locked_until"`
+	LastError   string         `gorm:"type:text" json:"last_error"`
+	StartedAt   *time.Time     `json:"started_at"`
+	FinishedAt  *time.Time     `json:"finished_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// JobSchedule is the cron schedule of a recurring job, shared by every replica. Whichever
+// replica locks the row once NextRunAt has passed enqueues the run.
+type JobSchedule struct {
+	Name      string     `gorm:"type:varchar(100);primaryKey" json:"name"`
+	Cron      string     `gorm:"type:varchar(100);not null" json:"cron"`
+	NextRunAt time.Time  `json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at"` // when a run was last enqueued
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrImmutableJournal = errors.New("journal entries are immutable")
+
+// LedgerAccount is a single account in the double-entry ledger. Platform-wide accounts
+// use uuid.Nil as OwnerID; customer, escrow and vendor accounts are owned by a user.
+type LedgerAccount struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Type      string    `gorm:"type:varchar(30);uniqueIndex:idx_ledger_account_owner;not null" json:"type"` // CUSTOMER, ESCROW, PLATFORM_REVENUE, VENDOR_PAYABLE, PAYOUT_SETTLEMENT
+	OwnerID   uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_ledger_account_owner;not null" json:"owner_id"`
+	Currency  string    `gorm:"type:varchar(3);default:'NGN'" json:"currency"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// JournalEntry groups balanced ledger lines for one business event (charge, release, refund, payout).
+type JournalEntry struct {
+	ID             uuid.UUID     `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	IdempotencyKey string        `gorm:"type:varchar(150);uniqueIndex;not null" json:"idempotency_key"`
+	Kind           string        `gorm:"type:varchar(30);index;not null" json:"kind"` // CHARGE, RELEASE, REFUND, PAYOUT, PAYOUT_REVERSAL
+	SourceType     string        `gorm:"type:varchar(30);index:idx_journal_source" json:"source_type"`
+	SourceID       uuid.UUID     `gorm:"type:uuid;index:idx_journal_source" json:"source_id"`
+	Memo           string        `json:"memo"`
+	Lines          []JournalLine `gorm:"foreignKey:EntryID" json:"lines"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// JournalLine moves Amount kobo into (positive) or out of (negative) an account.
+// The lines of an entry always sum to zero.
+type JournalLine struct {
+	ID        uuid.UUID     `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	EntryID   uuid.UUID     `gorm:"type:uuid;index;not null" json:"entry_id"`
+	AccountID uuid.UUID     `gorm:"type:uuid;index;not null" json:"account_id"`
+	Account   LedgerAccount `gorm:"foreignKey:AccountID" json:"account"`
+	Amount    int64         `gorm:"not null" json:"amount"` // kobo
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+func (JournalEntry) BeforeUpdate(tx *gorm.DB) error { return ErrImmutableJournal }
+func (JournalEntry) BeforeDelete(tx *gorm.DB) error { return ErrImmutableJournal }
+func (JournalLine) BeforeUpdate(tx *gorm.DB) error  { return ErrImmutableJournal }
+func (JournalLine) BeforeDelete(tx *gorm.DB) error  { return ErrImmutableJournal }
@@ -28,13 +28,20 @@ const (
 )
 
 const (
-	RoleAdmin Role = "ADMIN"
-	RoleUser  Role = "USER"
+	RoleAdmin     Role = "ADMIN"
+	RoleModerator Role = "MODERATOR" // reviews listings and users
+	RoleSupport   Role = "SUPPORT"   // handles contact messages, orders and disputes
+	RoleFinance   Role = "FINANCE"   // handles payouts, refunds and the ledger
+	RoleVendor    Role = "VENDOR"    // seller approved by the team; no back-office access
+	RoleUser      Role = "USER"
 )
 
+// MarketplaceRoles are the roles of people buying and selling, as opposed to staff.
+var MarketplaceRoles = []Role{RoleUser, RoleVendor}
+
 func IsValidRole(r Role) bool {
 	switch r {
-	case RoleAdmin, RoleUser:
+	case RoleAdmin, RoleModerator, RoleSupport, RoleFinance, RoleVendor, RoleUser:
 		return true
 
 	default:
@@ -80,7 +87,6 @@ type RegisterRequest struct {
 	UserName    string `json:"user_name" form:"user_name"`
 	Email       string `json:"email" form:"email"`
 	PhoneNumber string `json:"phone_number" form:"phone_number"`
-	Role        Role   `json:"role" form:"role"`
 	Password    string `json:"password" form:"password"`
 	ReferalCode string `json:"referral_code" form:"referral_code"`
 }
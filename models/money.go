@@ -0,0 +1,167 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const CurrencyNGN = "NGN"
+
+// Money is an exact amount in the currency's minor unit (kobo for NGN).
+// It is stored as a BIGINT of kobo; the platform only settles in NGN, so the currency is
+// carried in memory for formatting and Paystack calls rather than persisted per column.
+// In JSON it is written as a Naira number (e.g. 2500.5) so API clients keep working.
+type Money struct {
+	Kobo     int64
+	Currency string
+}
+
+// NGN returns an amount of kobo in Naira.
+func NGN(kobo int64) Money {
+	return Money{Kobo: kobo, Currency: CurrencyNGN}
+}
+
+// ParseNaira parses a Naira amount such as "2500", "2,500.50" or "₦2500.5" without going
+// through float64. More than two decimal places is an error.
+func ParseNaira(s string) (Money, error) {
+	raw := strings.TrimSpace(s)
+	raw = strings.TrimPrefix(raw, "₦")
+	raw = strings.ReplaceAll(raw, ",", "")
+	if raw == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	negative := strings.HasPrefix(raw, "-")
+	raw = strings.TrimPrefix(raw, "-")
+
+	whole, frac, _ := strings.Cut(raw, ".")
+	if len(frac) > 2 {
+		return Money{}, fmt.Errorf("invalid amount %q: at most two decimal places", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+
+	naira, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	kobo, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	total := naira*100 + kobo
+	if negative {
+		total = -total
+	}
+	return NGN(total), nil
+}
+
+// CurrencyCode returns the ISO currency code, defaulting to NGN for zero values.
+func (m Money) CurrencyCode() string {
+	if m.Currency == "" {
+		return CurrencyNGN
+	}
+	return m.Currency
+}
+
+func (m Money) Add(o Money) Money { return Money{Kobo: m.Kobo + o.Kobo, Currency: m.CurrencyCode()} }
+func (m Money) Sub(o Money) Money { return Money{Kobo: m.Kobo - o.Kobo, Currency: m.CurrencyCode()} }
+
+// Mul multiplies the amount by a whole quantity.
+func (m Money) Mul(n int64) Money { return Money{Kobo: m.Kobo * n, Currency: m.CurrencyCode()} }
+
+// Percent returns pct percent of the amount, rounded half away from zero to the nearest kobo.
+func (m Money) Percent(pct float64) Money {
+	return Money{Kobo: int64(math.Round(float64(m.Kobo) * pct / 100)), Currency: m.CurrencyCode()}
+}
+
+func (m Money) IsZero() bool     { return m.Kobo == 0 }
+func (m Money) IsPositive() bool { return m.Kobo > 0 }
+
+// Naira formats the amount in major units with two decimals, e.g. "2500.50".
+func (m Money) Naira() string {
+	kobo := m.Kobo
+	sign := ""
+	if kobo < 0 {
+		sign = "-"
+		kobo = -kobo
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, kobo/100, kobo%100)
+}
+
+func (m Money) String() string {
+	return m.Naira() + " " + m.CurrencyCode()
+}
+
+func (Money) GormDataType() string {
+	return "bigint"
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.Kobo, nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	m.Currency = CurrencyNGN
+	switch v := value.(type) {
+	case nil:
+		m.Kobo = 0
+	case int64:
+		m.Kobo = v
+	case []byte:
+		kobo, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("money: cannot scan %q", v)
+		}
+		m.Kobo = kobo
+	case string:
+		kobo, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("money: cannot scan %q", v)
+		}
+		m.Kobo = kobo
+	default:
+		return fmt.Errorf("money: cannot scan %T", value)
+	}
+	return nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.Naira()
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-" {
+		s = "0"
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalJSON accepts a Naira amount as a JSON number or string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		*m = NGN(0)
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if strings.TrimSpace(s) == "" {
+			*m = NGN(0)
+			return nil
+		}
+	}
+	parsed, err := ParseNaira(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
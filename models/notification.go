@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of in-app notification.
+const (
+	NotificationAccount   = "ACCOUNT"    // account verified
+	NotificationProduct   = "PRODUCT"    // listing viewed, removed, closed or reactivated
+	NotificationFoodOrder = "FOOD_ORDER" // new orders for vendors, status updates for customers
+	NotificationBooking   = "BOOKING"    // new, completed, cancelled or rescheduled bookings
+	NotificationDispute   = "DISPUTE"
+	NotificationRefund    = "REFUND"
+	NotificationMessage   = "MESSAGE" // new message from a buyer or seller
+)
+
+// Notification is an entry in a user's in-app notification center. It is written in the
+// transaction of the event it reports and pushed to the user's open streams once that commits.
+type Notification struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index:idx_notifications_user_created" json:"user_id"`
+	Kind      string     `gorm:"type:varchar(30);not null" json:"kind"`
+	Title     string     `gorm:"type:varchar(200);not null" json:"title"`
+	Body      string     `gorm:"type:text" json:"body"`
+	Link      string     `gorm:"type:varchar(255)" json:"link"` // frontend path to open, e.g. /dashboard?tab=food_orders
+	EntityID  *uuid.UUID `gorm:"type:uuid" json:"entity_id"`    // the product, order or booking it is about
+	ReadAt    *time.Time `gorm:"index" json:"read_at"`          // nil while unread
+	CreatedAt time.Time  `gorm:"index:idx_notifications_user_created" json:"created_at"`
+}
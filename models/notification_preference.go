@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Categories of optional email a recipient can opt out of. Account, security and payment
+// emails are not in any category and always go out.
+const (
+	NotifyMarketing    = "MARKETING"     // admin newsletters
+	NotifyNewProducts  = "NEW_PRODUCTS"  // the new listings digest
+	NotifyPriceDrops   = "PRICE_DROPS"   // price drop alerts on saved searches
+	NotifyOrderUpdates = "ORDER_UPDATES" // food order progress (preparing, on its way, delivered)
+)
+
+// NotificationCategories lists every category, in the order they are shown to users.
+var NotificationCategories = []string{NotifyMarketing, NotifyNewProducts, NotifyPriceDrops, NotifyOrderUpdates}
+
+// NotificationOptOut records that an address unsubscribed from a category. Preferences are
+// kept per address rather than per account, so guests who only left an email on a search
+// alert can unsubscribe too; a missing row means subscribed.
+type NotificationOptOut struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Email     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_opt_out_email_category" json:"email"` // lower-cased
+	Category  string    `gorm:"type:varchar(30);not null;uniqueIndex:idx_opt_out_email_category" json:"category"`
+	Source    string    `gorm:"type:varchar(20)" json:"source"` // LINK or SETTINGS
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationPreferences is a user's subscription to each category.
+type NotificationPreferences struct {
+	Marketing    bool `json:"marketing"`
+	NewProducts  bool `json:"new_products"`
+	PriceDrops   bool `json:"price_drops"`
+	OrderUpdates bool `json:"order_updates"`
+}
@@ -18,17 +18,23 @@ type FoodOrder struct {
 	ProductID        uuid.UUID      `gorm:"type:uuid;index;not null" json:"product_id"`
 	Product          Products       `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product"`
 	SubMenus         datatypes.JSON `json:"sub_menus"`
-	MealPrice        float64        `json:"meal_price"`
-	DeliveryFee      float64        `json:"delivery_fee"`
-	TotalAmount      float64        `json:"total_amount"`
-	PlatformFee      float64        `json:"platform_fee"` // 10%
-	VendorPayout     float64        `json:"vendor_payout"`// 90% + delivery_fee
+	CheckoutID       *uuid.UUID     `gorm:"type:uuid;index" json:"checkout_id"` // set when the order is one vendor's part of a cart checkout
+	Items            []FoodOrderItem `gorm:"foreignKey:FoodOrderID" json:"items,omitempty"`
+	MealPrice        Money          `json:"meal_price"`
+	DeliveryFee      Money          `json:"delivery_fee"`
+	TotalAmount      Money          `json:"total_amount"`
+	PlatformFee      Money          `json:"platform_fee"` // per CommissionRule, 10% by default
+	VendorPayout     Money          `json:"vendor_payout"`// meal price - platform_fee + delivery_fee
+	CommissionRuleID *uuid.UUID     `gorm:"type:uuid" json:"commission_rule_id"`
 	CustomerName     string         `json:"customer_name"`
 	CustomerPhone    string         `json:"customer_phone"`
 	DeliveryAddress  string         `json:"delivery_address"`
 	PaymentReference string         `gorm:"type:varchar(100)" json:"payment_reference"`
-	Status           string         `gorm:"type:varchar(30);default:'PAID'" json:"status"` // PAID, PREPARING, OUT_FOR_DELIVERY, DELIVERED, CANCELLED
+	Status           string         `gorm:"type:varchar(30);default:'PAID'" json:"status"` // see FoodOrderPending..FoodOrderRefunded; change only via utils.TransitionFoodOrder
 	PaymentStatus    string         `gorm:"type:varchar(30);default:'SUCCESS'" json:"payment_status"`
+	ReleaseAt        *time.Time     `gorm:"index" json:"release_at"`          // after a vendor-reported delivery: when the vendor's share is released unless the customer confirms or objects first
+	DeliveryIssue    string         `gorm:"type:text" json:"delivery_issue"` // the customer's objection to a vendor-reported delivery; an admin releases or refunds
+	ReleasedAt       *time.Time     `json:"released_at"`                     // when the vendor's share was released to them
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
@@ -43,18 +49,25 @@ type ServiceBooking struct {
 	Artisan            User           `gorm:"foreignKey:ArtisanID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"artisan"`
 	ServiceID          uuid.UUID      `gorm:"type:uuid;index;not null" json:"service_id"` // Product item
 	Service            Products       `gorm:"foreignKey:ServiceID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"service"`
-	BookingFee         float64        `json:"booking_fee"`
-	PlatformFee        float64        `json:"platform_fee"` // 10%
-	ArtisanPayout      float64        `json:"artisan_payout"` // 90%
+	PricingType        string         `gorm:"type:varchar(10);default:'FIXED'" json:"pricing_type"` // FIXED, or QUOTE for jobs paid in milestones
+	QuoteID            *uuid.UUID     `gorm:"type:uuid" json:"quote_id"`                              // accepted quote of a QUOTE booking
+	BookingFee         Money          `json:"booking_fee"`
+	PlatformFee        Money          `json:"platform_fee"` // per CommissionRule, 10% by default
+	ArtisanPayout      Money          `json:"artisan_payout"` // booking_fee - platform_fee
+	CommissionRuleID   *uuid.UUID     `gorm:"type:uuid" json:"commission_rule_id"`
 	ScheduledDate      time.Time      `json:"scheduled_date"`
+	ScheduledEndAt     *time.Time     `json:"scheduled_end_at"` // end of the booked slot; nil for bookings made before slots existed
 	ServiceAddress     string         `json:"service_address"`
 	CustomerPhone      string         `json:"customer_phone"`
 	Notes              string         `json:"notes"`
 	PaymentReference   string         `gorm:"type:varchar(100)" json:"payment_reference"`
-	Status             string         `gorm:"type:varchar(30);default:'BOOKED'" json:"status"` // BOOKED, IN_PROGRESS, ARTISAN_COMPLETED, COMPLETED, CANCELLED
+	Status             string         `gorm:"type:varchar(30);default:'BOOKED'" json:"status"` // QUOTE_REQUESTED, PENDING, BOOKED, IN_PROGRESS, ARTISAN_COMPLETED, DISPUTED, NO_SHOW, COMPLETED, CANCELLED
+	RescheduleCount    int            `gorm:"default:0" json:"reschedule_count"`
+	NoShowParty        string         `gorm:"type:varchar(20)" json:"no_show_party"` // CUSTOMER or VENDOR (artisan) who missed the booking
+	NoShowReportedAt   *time.Time     `json:"no_show_reported_at"`
 	ArtisanCompletedAt *time.Time     `json:"artisan_completed_at"`
 	CompletedAt        *time.Time     `json:"completed_at"`
-	PaymentStatus      string         `gorm:"type:varchar(30);default:'HELD_IN_ESCROW'" json:"payment_status"` // HELD_IN_ESCROW, RELEASED_TO_ARTISAN, REFUNDED
+	PaymentStatus      string         `gorm:"type:varchar(30);default:'HELD_IN_ESCROW'" json:"payment_status"` // HELD_IN_ESCROW, RELEASED_TO_ARTISAN, REFUND_PENDING, PARTIALLY_REFUNDED, REFUNDED, BY_MILESTONE
 	CreatedAt          time.Time      `json:"created_at"`
 	UpdatedAt          time.Time      `json:"updated_at"`
 	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PayoutSourceFoodOrder      = "FOOD_ORDER"
+	PayoutSourceServiceBooking = "SERVICE_BOOKING"
+)
+
+const (
+	PayoutPending    = "PENDING"    // waiting for (re)submission to Paystack
+	PayoutProcessing = "PROCESSING" // transfer initiated, waiting for the transfer webhook
+	PayoutSuccess    = "SUCCESS"
+	PayoutFailed     = "FAILED"    // retries exhausted, needs admin attention
+	PayoutCancelled  = "CANCELLED" // source was refunded before the transfer went out
+	PayoutReversed   = "REVERSED"  // transfer reversed after it was paid, held for finance review
+)
+
+// Payout is a transfer of released escrow funds to a vendor or artisan.
+// There is at most one payout per food order or service booking.
+type Payout struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID        uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"` // Vendor/Artisan being paid
+	User          User       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"user"`
+	SourceType    string     `gorm:"type:varchar(30);uniqueIndex:idx_payout_source;not null" json:"source_type"` // FOOD_ORDER, SERVICE_BOOKING, BOOKING_MILESTONE
+	SourceID      uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_payout_source;not null" json:"source_id"`
+	Amount        Money      `json:"amount"`
+	Currency      string     `gorm:"type:varchar(3);default:'NGN'" json:"currency"`
+	Reason        string     `json:"reason"`
+	Reference     string     `gorm:"type:varchar(100);uniqueIndex" json:"reference"` // reference of the current transfer attempt
+	RecipientCode string     `gorm:"type:varchar(100)" json:"recipient_code"`
+	TransferCode  string     `gorm:"type:varchar(100)" json:"transfer_code"`
+	Status        string     `gorm:"type:varchar(20);default:'PENDING';index" json:"status"` // PENDING, PROCESSING, SUCCESS, FAILED, CANCELLED, REVERSED
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	PaidAt        *time.Time `json:"paid_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// TransferRecipient caches the Paystack recipient code created for a user's bank account.
+type TransferRecipient struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_transfer_recipient_account;not null" json:"user_id"`
+	AccountNumber string    `gorm:"type:varchar(20);uniqueIndex:idx_transfer_recipient_account;not null" json:"account_number"`
+	BankCode      string    `gorm:"type:varchar(20);uniqueIndex:idx_transfer_recipient_account;not null" json:"bank_code"`
+	AccountName   string    `json:"account_name"`
+	RecipientCode string    `gorm:"type:varchar(100);not null" json:"recipient_code"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
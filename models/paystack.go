@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+const (
+	PaystackEventReceived  = "RECEIVED"
+	PaystackEventProcessed = "PROCESSED"
+	PaystackEventIgnored   = "IGNORED"
+	PaystackEventFailed    = "FAILED"
+)
+
+// PaystackEvent is the audit log of every verified webhook delivery received from Paystack.
+// EventKey is derived from the event name, transaction reference and Paystack's own data id,
+// so retried deliveries of the same event collapse onto a single row.
+type PaystackEvent struct {
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	EventKey    string         `gorm:"type:varchar(255);uniqueIndex;not null" json:"event_key"`
+	Event       string         `gorm:"type:varchar(50);index" json:"event"`
+	Reference   string         `gorm:"type:varchar(100);index" json:"reference"`
+	Payload     datatypes.JSON `gorm:"type:jsonb" json:"payload"`
+	Status      string         `gorm:"type:varchar(20);default:'RECEIVED';index" json:"status"` // RECEIVED, PROCESSED, IGNORED, FAILED
+	Note        string         `gorm:"type:text" json:"note"`
+	Deliveries  int            `gorm:"default:1" json:"deliveries"`
+	ProcessedAt *time.Time     `json:"processed_at"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+// Permission is a back-office capability. Routes under /admin each require one.
+type Permission string
+
+const (
+	PermDashboardView    Permission = "dashboard:view"    // overview stats, user and product lists
+	PermUsersManage      Permission = "users:manage"      // verify, suspend and delete users
+	PermRolesManage      Permission = "roles:manage"      // assign roles
+	PermProductsModerate Permission = "products:moderate" // approve, reject and delete listings
+	PermContentManage    Permission = "content:manage"    // banners, featured products, newsletter
+	PermContactManage    Permission = "contact:manage"    // contact form messages
+	PermOrdersManage     Permission = "orders:manage"     // food order status and history
+	PermDisputesManage   Permission = "disputes:manage"   // booking disputes
+	PermRefundsManage    Permission = "refunds:manage"    // refunds and milestone releases
+	PermPayoutsManage    Permission = "payouts:manage"    // vendor payouts
+	PermLedgerView       Permission = "ledger:view"       // ledger and Paystack events
+	PermCommissionManage Permission = "commission:manage" // commission rules
+	PermSystemManage     Permission = "system:manage"     // background jobs and outgoing email
+)
+
+// AllPermissions lists every permission, in the order the admin UI shows them.
+var AllPermissions = []Permission{
+	PermDashboardView, PermUsersManage, PermRolesManage, PermProductsModerate, PermContentManage,
+	PermContactManage, PermOrdersManage, PermDisputesManage, PermRefundsManage, PermPayoutsManage,
+	PermLedgerView, PermCommissionManage, PermSystemManage,
+}
+
+// RolePermissions is the permission matrix. Roles not listed, like USER and VENDOR, have no
+// back-office access.
+var RolePermissions = map[Role][]Permission{
+	RoleAdmin: AllPermissions,
+	RoleModerator: {
+		PermDashboardView, PermUsersManage, PermProductsModerate, PermContentManage,
+	},
+	RoleSupport: {
+		PermDashboardView, PermContactManage, PermOrdersManage, PermDisputesManage,
+	},
+	RoleFinance: {
+		PermDashboardView, PermRefundsManage, PermPayoutsManage, PermLedgerView, PermCommissionManage,
+	},
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role Role, perm Permission) bool {
+	for _, p := range RolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether role has any back-office access.
+func IsStaff(role Role) bool {
+	return len(RolePermissions[role]) > 0
+}
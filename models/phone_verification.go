@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PhoneVerification is a one-time code sent by SMS to prove a user owns a phone number. The
+// code is stored hashed.
+type PhoneVerification struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	PhoneNumber string     `gorm:"type:varchar(20);not null" json:"phone_number"`
+	CodeHash    string     `gorm:"type:varchar(64);not null" json:"-"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	ExpiresAt   time.Time  `gorm:"index" json:"expires_at"`
+	VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,9 +21,9 @@ type ProductLike struct {
 type Products struct {
 	ID                uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
 	Name              string         `gorm:"column:name" json:"product_name"`
-	ProductPrice      float64        `json:"product_price"`
-	MarketPriceFrom   float64        `json:"market_price_from"`
-	MarketPriceTo     float64        `json:"market_price_to"`
+	ProductPrice      Money          `json:"product_price"`
+	MarketPriceFrom   Money          `json:"market_price_from"`
+	MarketPriceTo     Money          `json:"market_price_to"`
 	CategoryName      string         `json:"category_name"`
 	IsNegotiable      bool           `json:"is_negotiable"`
 	Description       string         `json:"description"`
@@ -45,8 +48,8 @@ type Products struct {
 	IsNotified        bool           `json:"is_notified" gorm:"default:false"`
 	ProductType       string         `json:"product_type" gorm:"type:varchar(20);default:'MARKET'"` // MARKET, FOOD, SERVICE
 	SubMenus          datatypes.JSON `json:"sub_menus"`
-	DeliveryFee       float64        `json:"delivery_fee" gorm:"default:0"`
-	OldPrice          float64        `json:"old_price" gorm:"default:0"`
+	DeliveryFee       Money          `json:"delivery_fee" gorm:"default:0"`
+	OldPrice          Money          `json:"old_price" gorm:"default:0"`
 	DiscountPercent   int            `json:"discount_percent" gorm:"default:0"`
 	GuestEmail        string         `json:"guest_email" gorm:"size:255"`
 	GuestPhone        string         `json:"guest_phone" gorm:"size:50"`
@@ -54,12 +57,42 @@ type Products struct {
 	ServiceType       string         `json:"service_type" gorm:"type:varchar(100);default:''"`
 }
 
+// SubMenuOption is an add-on a food vendor offers with a product, e.g. extra protein.
+// Products store their options as a JSON array of these in SubMenus.
+type SubMenuOption struct {
+	Name  string `json:"name"`
+	Price Money  `json:"price"`
+}
+
+// ParseSubMenuOptions decodes a SubMenus JSON array. Empty input yields no options.
+func ParseSubMenuOptions(raw []byte) ([]SubMenuOption, error) {
+	trimmed := strings.TrimSpace(string(raw))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+
+	var options []SubMenuOption
+	if err := json.Unmarshal([]byte(trimmed), &options); err != nil {
+		return nil, fmt.Errorf("sub_menus must be a list of {name, price} options: %w", err)
+	}
+	for i, o := range options {
+		options[i].Name = strings.TrimSpace(o.Name)
+		if options[i].Name == "" {
+			return nil, fmt.Errorf("sub_menus option %d has no name", i+1)
+		}
+		if o.Price.Kobo < 0 {
+			return nil, fmt.Errorf("sub_menus option %q has a negative price", o.Name)
+		}
+	}
+	return options, nil
+}
+
 type ProductResponse struct {
 	ID                uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid()" json:"id"`
 	Name              string         `json:"product_name"`
-	ProductPrice      float64        `json:"product_price"`
-	MarketPriceFrom   float64        `json:"market_price_from"`
-	MarketPriceTo     float64        `json:"market_price_to"`
+	ProductPrice      Money          `json:"product_price"`
+	MarketPriceFrom   Money          `json:"market_price_from"`
+	MarketPriceTo     Money          `json:"market_price_to"`
 	CategoryName      string         `json:"category_name"`
 	IsNegotiable      bool           `json:"is_negotiable"`
 	Description       string         `json:"description"`
@@ -82,11 +115,9 @@ type ProductResponse struct {
 	IsDeletedByUser   bool           `json:"is_deleted_by_user"`
 	ProductType       string         `json:"product_type"`
 	SubMenus          datatypes.JSON `json:"sub_menus"`
-	DeliveryFee       float64        `json:"delivery_fee"`
-	OldPrice          float64        `json:"old_price"`
+	DeliveryFee       Money          `json:"delivery_fee"`
+	OldPrice          Money          `json:"old_price"`
 	DiscountPercent   int            `json:"discount_percent"`
-	GuestEmail        string         `json:"guest_email"`
-	GuestPhone        string         `json:"guest_phone"`
 	IsGuestListing    bool           `json:"is_guest_listing"`
 	ServiceType       string         `json:"service_type"`
 }
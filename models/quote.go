@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How a booking is priced.
+const (
+	PricingFixed = "FIXED" // one booking fee taken from the service price
+	PricingQuote = "QUOTE" // the artisan quotes the job and it is paid in milestones
+)
+
+// BookingQuoteRequested is the status of a booking waiting for the artisan's quote.
+const BookingQuoteRequested = "QUOTE_REQUESTED"
+
+// PaymentByMilestone is the payment status of a quoted booking. Its money is tracked on
+// each Milestone instead of the booking.
+const PaymentByMilestone = "BY_MILESTONE"
+
+const (
+	QuoteSent       = "SENT"
+	QuoteAccepted   = "ACCEPTED"
+	QuoteDeclined   = "DECLINED"
+	QuoteSuperseded = "SUPERSEDED" // replaced by a newer quote for the same booking
+)
+
+const (
+	MilestonePending          = "PENDING"
+	MilestoneArtisanCompleted = "ARTISAN_COMPLETED"
+	MilestoneCompleted        = "COMPLETED"
+	MilestoneCancelled        = "CANCELLED"
+)
+
+const (
+	RefundSourceBookingMilestone = "BOOKING_MILESTONE"
+	PayoutSourceBookingMilestone = "BOOKING_MILESTONE"
+)
+
+// Quote is an artisan's priced proposal for a quoted booking: line items adding up to the
+// total and the milestones the customer pays it in.
+type Quote struct {
+	ID          uuid.UUID   `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	BookingID   uuid.UUID   `gorm:"type:uuid;index;not null" json:"booking_id"`
+	ArtisanID   uuid.UUID   `gorm:"type:uuid;index;not null" json:"artisan_id"`
+	CustomerID  uuid.UUID   `gorm:"type:uuid;index;not null" json:"customer_id"`
+	Total       Money       `json:"total"`
+	Notes       string      `gorm:"type:text" json:"notes"`
+	ValidUntil  *time.Time  `json:"valid_until"`
+	Status      string      `gorm:"type:varchar(20);default:'SENT';index" json:"status"`
+	Items       []QuoteItem `gorm:"foreignKey:QuoteID;constraint:OnDelete:CASCADE;" json:"items"`
+	Milestones  []Milestone `gorm:"foreignKey:QuoteID;constraint:OnDelete:CASCADE;" json:"milestones"`
+	RespondedAt *time.Time  `json:"responded_at"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// QuoteItem is one priced line of a quote.
+type QuoteItem struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	QuoteID     uuid.UUID `gorm:"type:uuid;index;not null" json:"quote_id"`
+	Description string    `gorm:"type:varchar(255);not null" json:"description"`
+	Quantity    int       `gorm:"not null;default:1" json:"quantity"`
+	UnitPrice   Money     `json:"unit_price"`
+	Amount      Money     `json:"amount"` // quantity × unit price
+}
+
+// Milestone is one separately paid part of a quoted job. Each milestone is paid into escrow
+// on its own and released to the artisan once the customer approves the work.
+type Milestone struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	QuoteID            uuid.UUID  `gorm:"type:uuid;index;not null" json:"quote_id"`
+	BookingID          uuid.UUID  `gorm:"type:uuid;index;not null" json:"booking_id"`
+	CustomerID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"customer_id"`
+	ArtisanID          uuid.UUID  `gorm:"type:uuid;index;not null" json:"artisan_id"`
+	Sequence           int        `gorm:"not null" json:"sequence"` // 1-based; milestones are paid in order
+	Title              string     `gorm:"type:varchar(255);not null" json:"title"`
+	Description        string     `gorm:"type:text" json:"description"`
+	Amount             Money      `json:"amount"`
+	PlatformFee        Money      `json:"platform_fee"`   // set when the quote is accepted
+	ArtisanPayout      Money      `json:"artisan_payout"` // amount - platform_fee
+	DueDate            *time.Time `json:"due_date"`
+	PaymentReference   string     `gorm:"type:varchar(100);index" json:"payment_reference"`
+	Status             string     `gorm:"type:varchar(30);default:'PENDING'" json:"status"`         // PENDING, ARTISAN_COMPLETED, COMPLETED, CANCELLED
+	PaymentStatus      string     `gorm:"type:varchar(30);default:'PENDING'" json:"payment_status"` // PENDING, FAILED, HELD_IN_ESCROW, RELEASED_TO_ARTISAN, REFUND_PENDING, REFUNDED
+	PaidAt             *time.Time `json:"paid_at"`
+	ArtisanCompletedAt *time.Time `json:"artisan_completed_at"`
+	ReleasedAt         *time.Time `json:"released_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RateLimitBucket is a request counter or block shared by all replicas, used when
+// RATE_LIMIT_STORE is postgres.
+type RateLimitBucket struct {
+	Key          string     `gorm:"type:varchar(255);primaryKey"`
+	Count        int64      `gorm:"not null;default:0"`
+	ResetAt      time.Time  `gorm:"index;not null"`
+	BlockedUntil *time.Time `gorm:"index"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RefundSourceFoodOrder      = "FOOD_ORDER"
+	RefundSourceServiceBooking = "SERVICE_BOOKING"
+)
+
+const (
+	RefundPending    = "PENDING"    // recorded, not yet accepted by Paystack
+	RefundProcessing = "PROCESSING" // submitted to Paystack, waiting for the refund webhook; unconfirmed while PaystackRefundID is empty
+	RefundProcessed  = "PROCESSED"
+	RefundFailed     = "FAILED" // Paystack rejected or failed the refund, needs admin attention
+)
+
+// PaymentRefundPending is the payment status of an order or booking while its refund is in flight.
+const PaymentRefundPending = "REFUND_PENDING"
+
+// PaymentPartiallyRefunded is the payment status of a booking whose dispute was settled by
+// refunding part of the fee and paying the artisan the rest.
+const PaymentPartiallyRefunded = "PARTIALLY_REFUNDED"
+
+// Refund is the return of a customer's payment for a cancelled food order or booking.
+// There is at most one refund per order or booking, for the full amount paid unless a
+// booking dispute was settled with a partial refund.
+type Refund struct {
+	ID                   uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SourceType           string     `gorm:"type:varchar(30);uniqueIndex:idx_refund_source;not null" json:"source_type"` // FOOD_ORDER, SERVICE_BOOKING, BOOKING_MILESTONE
+	SourceID             uuid.UUID  `gorm:"type:uuid;uniqueIndex:idx_refund_source;not null" json:"source_id"`
+	UserID               uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"` // customer being refunded
+	TransactionReference string     `gorm:"type:varchar(100);index" json:"transaction_reference"`
+	Amount               Money      `json:"amount"`
+	Reason               string     `gorm:"type:text" json:"reason"`
+	RequestedBy          string     `gorm:"type:varchar(20)" json:"requested_by"` // CUSTOMER, VENDOR, ADMIN, SYSTEM
+	RequestedByID        *uuid.UUID `gorm:"type:uuid" json:"requested_by_id"`
+	Status               string     `gorm:"type:varchar(20);default:'PENDING';index" json:"status"`
+	PaystackRefundID     string     `gorm:"type:varchar(50);index" json:"paystack_refund_id"`
+	LastError            string     `gorm:"type:text" json:"last_error"`
+	ProcessedAt          *time.Time `json:"processed_at"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
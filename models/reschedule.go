@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BookingNoShow is the status of a booking one party reported the other missed.
+const BookingNoShow = "NO_SHOW"
+
+const (
+	RescheduleProposed   = "PROPOSED"
+	RescheduleAccepted   = "ACCEPTED"
+	RescheduleDeclined   = "DECLINED"
+	RescheduleSuperseded = "SUPERSEDED" // replaced by a newer proposal from the same party
+)
+
+// RescheduleProposal is a request by the customer or artisan to move a booking to a new
+// time. It takes effect only once the other party accepts it.
+type RescheduleProposal struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	BookingID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"booking_id"`
+	ProposedByID  uuid.UUID  `gorm:"type:uuid;not null" json:"proposed_by_id"`
+	ProposedBy    string     `gorm:"type:varchar(20);not null" json:"proposed_by"` // CUSTOMER, VENDOR (artisan)
+	PreviousDate  time.Time  `json:"previous_date"`
+	ProposedDate  time.Time  `gorm:"not null" json:"proposed_date"`
+	Reason        string     `gorm:"type:text" json:"reason"`
+	Status        string     `gorm:"type:varchar(20);default:'PROPOSED';index" json:"status"`
+	RespondedByID *uuid.UUID `gorm:"type:uuid" json:"responded_by_id"`
+	RespondedAt   *time.Time `json:"responded_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Why a session was revoked.
+const (
+	SessionLoggedOut      = "LOGGED_OUT"
+	SessionLoggedOutAll   = "LOGGED_OUT_ALL"
+	SessionRevokedByUser  = "REVOKED_BY_USER" // ended from the sessions list on another device
+	SessionTokenReuse     = "TOKEN_REUSE"     // a rotated refresh token was presented again
+	SessionPasswordReset  = "PASSWORD_RESET"
+	SessionAccountBlocked = "ACCOUNT_BLOCKED"  // user suspended, deactivated or rejected
+	SessionTwoFactorFails = "TWO_FACTOR_FAILS" // too many wrong codes while changing two-factor settings
+)
+
+// Session is one signed-in device. Access tokens carry its ID and are only accepted while it
+// is not revoked; its refresh token is stored hashed and replaced on every refresh.
+type Session struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID            uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	RefreshTokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	PreviousTokenHash string     `gorm:"type:varchar(64);index" json:"-"` // the token the last refresh replaced
+	RotatedAt         *time.Time `json:"-"`
+	UserAgent         string     `gorm:"type:text" json:"user_agent"`
+	Device            string     `gorm:"type:varchar(100)" json:"device"` // e.g. "Chrome on Android"
+	IPAddress         string     `gorm:"type:varchar(64)" json:"ip_address"`
+	TwoFactorVerified bool       `gorm:"default:false" json:"two_factor_verified"` // signed in with a second factor
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	ExpiresAt         time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt         *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	RevokedReason     string     `gorm:"type:varchar(30)" json:"revoked_reason,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
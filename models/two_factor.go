@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TwoFactor is a user's authenticator app enrollment. It is pending until the user confirms
+// it with a code, and for staff also a code emailed to them; only then does signing in ask
+// for one.
+type TwoFactor struct {
+	UserID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Secret             string     `gorm:"type:text;not null" json:"-"` // TOTP secret, encrypted
+	EnabledAt          *time.Time `json:"enabled_at"`                  // nil while pending
+	LastUsedStep       int64      `json:"-"`                           // TOTP time step of the last accepted code, to refuse replays
+	EmailCodeHash      string     `json:"-"`                           // bcrypt of the code emailed to staff to confirm enrollment
+	EmailCodeExpiresAt *time.Time `json:"-"`
+	Attempts           int        `gorm:"default:0" json:"-"` // wrong codes in a row outside of signing in
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// BackupCode is a single-use code for signing in without the authenticator app.
+type BackupCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"` // bcrypt
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TwoFactorChallenge is the second step of signing in: the password was right, and the
+// holder of its token has a few tries to give a code.
+type TwoFactorChallenge struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Attempts  int        `gorm:"default:0" json:"attempts"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -10,6 +10,7 @@ import (
 
 type BankAccountItem struct {
 	BankName      string `json:"bank_name"`
+	BankCode      string `json:"bank_code"`
 	AccountNumber string `json:"account_number"`
 	AccountName   string `json:"account_name"`
 	IsDefault     bool   `json:"is_default"`
@@ -21,9 +22,11 @@ type PublicUser struct {
 	Email         string         `json:"email"`
 	Role          string         `json:"role"`
 	PhoneNumber   string         `json:"phone_number"`
+	PhoneVerified bool           `json:"phone_verified"`
 	ImageUrl      string         `json:"image_url"`
 	Location      string         `json:"location"`
 	BankName      string         `json:"bank_name"`
+	BankCode      string         `json:"bank_code"`
 	AccountNumber string         `json:"account_number"`
 	AccountName   string         `json:"account_name"`
 	BankAccounts  datatypes.JSON `gorm:"type:jsonb" json:"bank_accounts"`
@@ -43,11 +46,13 @@ type User struct {
 	UserName                 string         `json:"user_name"`
 	Email                    string         `json:"email"`
 	PhoneNumber              string         `json:"phone_number"`
+	PhoneVerified            bool           `gorm:"default:false" json:"phone_verified"` // confirmed with a code sent by SMS
 	Role                     Role           `json:"role"`
 	Password                 string         `json:"-"`
 	ImageUrl                 string         `json:"image_url"`
 	Location                 string         `json:"location"`
 	BankName                 string         `json:"bank_name"`
+	BankCode                 string         `json:"bank_code"`
 	AccountNumber            string         `json:"account_number"`
 	AccountName              string         `json:"account_name"`
 	BankAccounts             datatypes.JSON `gorm:"type:jsonb" json:"bank_accounts"`
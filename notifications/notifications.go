@@ -0,0 +1,64 @@
+// Package notifications is the in-app notification center. Notify records a notification in
+// the caller's transaction, and Listen pushes it to the recipient's open streams after commit.
+package notifications
+
+import (
+	"api/models"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// channel is the Postgres NOTIFY channel new notifications are announced on.
+const channel = "notifications"
+
+type announcement struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// Notify saves n for n.UserID and announces it with pg_notify. Postgres delivers the
+// announcement only when tx commits, so a rolled-back change never reaches anyone's screen.
+func Notify(tx *gorm.DB, n models.Notification) error {
+	if n.UserID == uuid.Nil {
+		return fmt.Errorf("notifications: no recipient for %q", n.Title)
+	}
+	if err := tx.Create(&n).Error; err != nil {
+		return err
+	}
+	payload, err := json.Marshal(announcement{ID: n.ID, UserID: n.UserID})
+	if err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", channel, string(payload)).Error
+}
+
+// UnreadCount is how many of the user's notifications are unread.
+func UnreadCount(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// MarkRead marks one of the user's notifications read. Marking it again is not an error.
+func MarkRead(db *gorm.DB, userID, id uuid.UUID) (*models.Notification, error) {
+	var n models.Notification
+	if err := db.First(&n, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		return nil, err
+	}
+	if n.ReadAt != nil {
+		return &n, nil
+	}
+	now := time.Now()
+	n.ReadAt = &now
+	return &n, db.Model(&n).Update("read_at", now).Error
+}
+
+// MarkAllRead marks every unread notification of the user read and returns how many were.
+func MarkAllRead(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	result := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
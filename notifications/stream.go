@@ -0,0 +1,115 @@
+package notifications
+
+import (
+	"api/models"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// streamBuffer is how many notifications a slow stream may fall behind before it misses
+// some; clients refetch the list on reconnect anyway.
+const streamBuffer = 16
+
+var (
+	mu          sync.RWMutex
+	subscribers = map[uuid.UUID]map[chan models.Notification]struct{}{}
+)
+
+// Subscribe opens a stream of the user's new notifications on this replica. Call the
+// returned function to close it.
+func Subscribe(userID uuid.UUID) (<-chan models.Notification, func()) {
+	ch := make(chan models.Notification, streamBuffer)
+
+	mu.Lock()
+	if subscribers[userID] == nil {
+		subscribers[userID] = map[chan models.Notification]struct{}{}
+	}
+	subscribers[userID][ch] = struct{}{}
+	mu.Unlock()
+
+	return ch, func() {
+		mu.Lock()
+		delete(subscribers[userID], ch)
+		if len(subscribers[userID]) == 0 {
+			delete(subscribers, userID)
+		}
+		mu.Unlock()
+	}
+}
+
+func subscribed(userID uuid.UUID) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(subscribers[userID]) > 0
+}
+
+func publish(n models.Notification) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for ch := range subscribers[n.UserID] {
+		select {
+		case ch <- n:
+		default: // the stream is not keeping up; drop rather than block the listener
+		}
+	}
+}
+
+// Listen forwards committed notifications to the streams open on this replica. It holds a
+// dedicated LISTEN connection to DATABASE_URL and reconnects when that drops, so every
+// replica hears every notification and delivers those for its own subscribers.
+func Listen(db *gorm.DB) {
+	go func() {
+		delay := time.Second
+		for {
+			err := listen(context.Background(), db, func() { delay = time.Second })
+			log.Printf("Notifications: Listener stopped: %v, reconnecting in %s\n", err, delay)
+			time.Sleep(delay)
+			if delay < time.Minute {
+				delay *= 2
+			}
+		}
+	}()
+}
+
+func listen(ctx context.Context, db *gorm.DB, connected func()) error {
+	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	connected()
+	log.Println("Notifications: Listening for new notifications")
+
+	for {
+		msg, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var a announcement
+		if err := json.Unmarshal([]byte(msg.Payload), &a); err != nil {
+			log.Printf("Notifications: Ignoring malformed announcement %q: %v\n", msg.Payload, err)
+			continue
+		}
+		if !subscribed(a.UserID) {
+			continue
+		}
+		var n models.Notification
+		if err := db.First(&n, "id = ?", a.ID).Error; err != nil {
+			log.Printf("Notifications: Error loading notification %s: %v\n", a.ID, err)
+			continue
+		}
+		publish(n)
+	}
+}
@@ -0,0 +1,226 @@
+// Package otp verifies phone numbers with one-time codes sent by SMS.
+package otp
+
+import (
+	"api/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// CodeTTL is how long a code can be used.
+	CodeTTL = 10 * time.Minute
+	// ResendAfter is how long a user waits before asking for another code.
+	ResendAfter = time.Minute
+	// maxSendsPerHour caps the codes a user can have sent in an hour.
+	maxSendsPerHour = 5
+	// maxAttempts is how many wrong codes use a code up; the user asks for a new one.
+	maxAttempts = 5
+	codeDigits  = 6
+
+	// verifiedPhoneIndex is the partial unique index on users' verified phone numbers.
+	verifiedPhoneIndex = "idx_users_verified_phone"
+	uniqueViolation    = "23505"
+)
+
+var (
+	ErrInvalidPhone = errors.New("invalid phone number")
+	ErrPhoneTaken   = errors.New("phone number is verified on another account")
+	ErrTooSoon      = errors.New("a code was sent recently; wait before asking for another")
+	ErrTooMany      = errors.New("too many codes requested; try again later")
+	ErrNoCode       = errors.New("no active code; request a new one")
+	ErrInvalidCode  = errors.New("invalid verification code")
+)
+
+// NormalizePhone returns phone in international form, e.g. "+2348012345678". Local numbers
+// starting with 0 are taken to be Nigerian.
+func NormalizePhone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(phone), "+"):
+	case strings.HasPrefix(digits, "0") && len(digits) == 11:
+		digits = "234" + digits[1:]
+	case strings.HasPrefix(digits, "234"):
+	default:
+		return "", ErrInvalidPhone
+	}
+	if len(digits) < 10 || len(digits) > 15 {
+		return "", ErrInvalidPhone
+	}
+	return "+" + digits, nil
+}
+
+// PhoneDigitForms returns the digits of a normalized number as it may have been typed: in
+// international form and, for Nigerian numbers, local form.
+func PhoneDigitForms(phone string) []string {
+	digits := strings.TrimPrefix(phone, "+")
+	forms := []string{digits}
+	if strings.HasPrefix(digits, "234") {
+		forms = append(forms, "0"+digits[3:])
+	}
+	return forms
+}
+
+func secret() []byte {
+	if s := os.Getenv("JWT_SECRET"); s != "" {
+		return []byte(s)
+	}
+	return []byte("supersecretkey") // Fallback for dev, but should be set in production
+}
+
+// hashCode keys the hash with the server secret and the verification's ID, so a leaked table
+// can't be brute-forced over the million possible codes.
+func hashCode(id uuid.UUID, code string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(id.String() + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", codeDigits, n.Int64()), nil
+}
+
+// Send texts a new code to phone for userID to verify it with, replacing any code sent before.
+func Send(db *gorm.DB, userID uuid.UUID, phone string) (*models.PhoneVerification, error) {
+	phone, err := NormalizePhone(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var taken int64
+	if err := db.Model(&models.User{}).
+		Where("phone_number = ? AND phone_verified = ? AND id <> ?", phone, true, userID).
+		Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrPhoneTaken
+	}
+
+	var recent []models.PhoneVerification
+	if err := db.Where("user_id = ? AND created_at > ?", userID, time.Now().Add(-time.Hour)).
+		Order("created_at DESC").Find(&recent).Error; err != nil {
+		return nil, err
+	}
+	if len(recent) > 0 && time.Since(recent[0].CreatedAt) < ResendAfter {
+		return nil, ErrTooSoon
+	}
+	if len(recent) >= maxSendsPerHour {
+		return nil, ErrTooMany
+	}
+
+	code, err := newCode()
+	if err != nil {
+		return nil, err
+	}
+	verification := models.PhoneVerification{
+		ID:          uuid.New(),
+		UserID:      userID,
+		PhoneNumber: phone,
+		ExpiresAt:   time.Now().Add(CodeTTL),
+	}
+	verification.CodeHash = hashCode(verification.ID, code)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the latest code works
+		if err := tx.Model(&models.PhoneVerification{}).
+			Where("user_id = ? AND verified_at IS NULL AND expires_at > ?", userID, time.Now()).
+			Update("expires_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&verification).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	body := fmt.Sprintf("Your Nedzl verification code is %s. It expires in %d minutes. Don't share it with anyone.", code, int(CodeTTL/time.Minute))
+	if err := sender.Send(phone, body); err != nil {
+		// Not delivered, so it shouldn't hold up asking again
+		db.Delete(&verification)
+		return nil, fmt.Errorf("sending verification SMS: %w", err)
+	}
+	return &verification, nil
+}
+
+// Verify checks code against the user's latest code and, if it matches, marks the number it
+// was sent to as the user's verified phone number, which it returns. Wrong codes count against
+// the code; after maxAttempts it stops working.
+func Verify(db *gorm.DB, userID uuid.UUID, code string) (string, error) {
+	code = strings.TrimSpace(code)
+	var phone string
+	var verifyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var verification models.PhoneVerification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND verified_at IS NULL AND expires_at > ? AND attempts < ?", userID, time.Now(), maxAttempts).
+			Order("created_at DESC").First(&verification).Error
+		if err == gorm.ErrRecordNotFound {
+			return ErrNoCode
+		}
+		if err != nil {
+			return err
+		}
+
+		if !hmac.Equal([]byte(hashCode(verification.ID, code)), []byte(verification.CodeHash)) {
+			verifyErr = ErrInvalidCode
+			// Committed so that the failure counts
+			return tx.Model(&verification).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).
+			Where("phone_number = ? AND phone_verified = ? AND id <> ?", verification.PhoneNumber, true, userID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrPhoneTaken
+		}
+
+		if err := tx.Model(&verification).Update("verified_at", time.Now()).Error; err != nil {
+			return err
+		}
+		phone = verification.PhoneNumber
+		err = tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"phone_number": phone, "phone_verified": true}).Error
+		// Another account verified the number since the check above
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == verifiedPhoneIndex {
+			return ErrPhoneTaken
+		}
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return phone, verifyErr
+}
+
+// Prune deletes codes that expired over a day ago.
+func Prune(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.PhoneVerification{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// freeLoginFailures is the number of wrong passwords in a row that first locks an account.
+	freeLoginFailures = 5
+	// Each failure past freeLoginFailures doubles the lockout, from baseLockout up to maxLockout.
+	baseLockout = time.Minute
+	maxLockout  = time.Hour
+	// failureWindow is how long failures are remembered without a successful login.
+	failureWindow = 24 * time.Hour
+)
+
+func loginKey(email string) string {
+	return "login:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// lockoutFor is how long the account is locked after its nth failure in a row.
+func lockoutFor(failures int64) time.Duration {
+	if failures < freeLoginFailures {
+		return 0
+	}
+	d := baseLockout
+	for i := int64(freeLoginFailures); i < failures && d < maxLockout; i++ {
+		d *= 2
+	}
+	return min(d, maxLockout)
+}
+
+// LoginLockedUntil returns when the account with email can try to log in again, or the zero
+// time if it is not locked.
+func LoginLockedUntil(email string) (time.Time, error) {
+	return store.BlockedUntil(loginKey(email))
+}
+
+// LoginFailed records a wrong password for email and, once there have been too many, locks
+// the account for a time that doubles with each further failure. It returns when the lock
+// ends, or the zero time if the account is not locked.
+func LoginFailed(email string) (time.Time, error) {
+	key := loginKey(email)
+	failures, _, err := store.Incr(key, failureWindow)
+	if err != nil {
+		return time.Time{}, err
+	}
+	d := lockoutFor(failures)
+	if d == 0 {
+		return time.Time{}, nil
+	}
+	until := time.Now().Add(d)
+	return until, store.Block(key, until)
+}
+
+// LoginSucceeded clears the failures recorded for email.
+func LoginSucceeded(email string) error {
+	return store.Reset(loginKey(email))
+}
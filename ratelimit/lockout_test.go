@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// useMemoryStore gives the test a fresh MemoryStore, restoring the store in use after it.
+func useMemoryStore(t *testing.T) *MemoryStore {
+	t.Helper()
+	prev := Default()
+	t.Cleanup(func() { SetStore(prev) })
+	s := NewMemoryStore()
+	SetStore(s)
+	return s
+}
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		failures int64
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{7, 4 * time.Minute},
+		{10, 32 * time.Minute},
+		{11, time.Hour},
+		{12, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutFor(tt.failures); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	useMemoryStore(t)
+	email := "Ada@Example.com"
+
+	for i := 1; i < freeLoginFailures; i++ {
+		until, err := LoginFailed(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !until.IsZero() {
+			t.Fatalf("failure %d locked the account until %v", i, until)
+		}
+	}
+
+	until, err := LoginFailed(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(until); d <= 0 || d > baseLockout {
+		t.Fatalf("failure %d locked the account for %v, want up to %v", freeLoginFailures, d, baseLockout)
+	}
+
+	// The same address however it was typed
+	locked, err := LoginLockedUntil(" ada@example.com ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked.Equal(until) {
+		t.Errorf("LoginLockedUntil = %v, want %v", locked, until)
+	}
+
+	if err := LoginSucceeded(email); err != nil {
+		t.Fatal(err)
+	}
+	if locked, _ := LoginLockedUntil(email); !locked.IsZero() {
+		t.Errorf("account still locked until %v after a successful login", locked)
+	}
+	if until, _ := LoginFailed(email); !until.IsZero() {
+		t.Errorf("first failure after a successful login locked the account until %v", until)
+	}
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often a MemoryStore drops counters and blocks that have run out.
+const sweepEvery = time.Minute
+
+type memoryEntry struct {
+	count        int64
+	resetAt      time.Time
+	blockedUntil time.Time
+}
+
+// MemoryStore keeps counters in this process. Each replica counts on its own, so with N
+// replicas a client gets up to N times the limit.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryStore) Incr(key string, window time.Duration) (int64, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+
+	e := s.entries[key]
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	if !now.Before(e.resetAt) {
+		e.count, e.resetAt = 0, now.Add(window)
+	}
+	e.count++
+	return e.count, e.resetAt, nil
+}
+
+func (s *MemoryStore) Block(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entries[key]
+	if e == nil {
+		e = &memoryEntry{}
+		s.entries[key] = e
+	}
+	e.blockedUntil = until
+	return nil
+}
+
+func (s *MemoryStore) BlockedUntil(key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.entries[key]; e != nil && time.Now().Before(e.blockedUntil) {
+		return e.blockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep drops expired entries so that keys seen once don't pile up. Callers hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepEvery {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if !now.Before(e.resetAt) && !now.Before(e.blockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreWindowReset(t *testing.T) {
+	s := useMemoryStore(t)
+	const window = 50 * time.Millisecond
+
+	for want := int64(1); want <= 3; want++ {
+		count, _, err := s.Incr("k", window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != want {
+			t.Fatalf("count = %d, want %d", count, want)
+		}
+	}
+
+	time.Sleep(window + 10*time.Millisecond)
+	count, resetAt, err := s.Incr("k", window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("count after the window = %d, want 1", count)
+	}
+	if !resetAt.After(time.Now()) {
+		t.Errorf("new window resets at %v, want a time in the future", resetAt)
+	}
+}
+
+func TestMemoryStoreBlock(t *testing.T) {
+	s := useMemoryStore(t)
+
+	until := time.Now().Add(50 * time.Millisecond)
+	if err := s.Block("k", until); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.BlockedUntil("k"); !got.Equal(until) {
+		t.Errorf("BlockedUntil = %v, want %v", got, until)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if got, _ := s.BlockedUntil("k"); !got.IsZero() {
+		t.Errorf("BlockedUntil after the block ended = %v, want zero", got)
+	}
+
+	if err := s.Block("k", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reset("k"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.BlockedUntil("k"); !got.IsZero() {
+		t.Errorf("BlockedUntil after Reset = %v, want zero", got)
+	}
+}
@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"api/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps counters in the rate_limit_buckets table so that all replicas share
+// them. Each call is a single statement.
+type PostgresStore struct {
+	DB *gorm.DB
+}
+
+func (s *PostgresStore) Incr(key string, window time.Duration) (int64, time.Time, error) {
+	now := time.Now()
+	var row struct {
+		Count   int64
+		ResetAt time.Time
+	}
+	err := s.DB.Raw(`
+		INSERT INTO rate_limit_buckets (key, count, reset_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit_buckets.reset_at <= ? THEN 1 ELSE rate_limit_buckets.count + 1 END,
+			reset_at = CASE WHEN rate_limit_buckets.reset_at <= ? THEN EXCLUDED.reset_at ELSE rate_limit_buckets.reset_at END
+		RETURNING count, reset_at`,
+		key, now.Add(window), now, now).Scan(&row).Error
+	return row.Count, row.ResetAt, err
+}
+
+func (s *PostgresStore) Block(key string, until time.Time) error {
+	return s.DB.Exec(`
+		INSERT INTO rate_limit_buckets (key, count, reset_at, blocked_until) VALUES (?, 0, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET blocked_until = EXCLUDED.blocked_until`,
+		key, time.Now(), until).Error
+}
+
+func (s *PostgresStore) BlockedUntil(key string) (time.Time, error) {
+	var buckets []models.RateLimitBucket
+	err := s.DB.Where("key = ? AND blocked_until > ?", key, time.Now()).Limit(1).Find(&buckets).Error
+	if err != nil || len(buckets) == 0 {
+		return time.Time{}, err
+	}
+	return *buckets[0].BlockedUntil, nil
+}
+
+func (s *PostgresStore) Reset(key string) error {
+	return s.DB.Where("key = ?", key).Delete(&models.RateLimitBucket{}).Error
+}
+
+// Prune deletes buckets whose window and block are both over.
+func Prune(db *gorm.DB) (int64, error) {
+	now := time.Now()
+	result := db.Where("reset_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", now, now).Delete(&models.RateLimitBucket{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,61 @@
+// Package ratelimit counts requests in fixed windows and blocks keys for a while, for
+// throttling endpoints and locking accounts out after failed logins. Counters live in
+// memory by default, or in Postgres so that every replica shares them.
+package ratelimit
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store keeps the counters and blocks.
+type Store interface {
+	// Incr adds one to key's counter and returns the new count and when the counter resets.
+	// A counter whose window is over starts again at 1 with a new window.
+	Incr(key string, window time.Duration) (int64, time.Time, error)
+	// Block refuses key until the given time.
+	Block(key string, until time.Time) error
+	// BlockedUntil returns when key's block ends, or the zero time if it is not blocked.
+	BlockedUntil(key string) (time.Time, error)
+	// Reset forgets key's counter and block.
+	Reset(key string) error
+}
+
+var (
+	store Store = NewMemoryStore()
+	once  sync.Once
+)
+
+// Init picks the store from RATE_LIMIT_STORE: "memory" (the default) keeps counters in this
+// process, "postgres" shares them between replicas through the database.
+func Init(db *gorm.DB) {
+	once.Do(func() {
+		kind := strings.ToLower(os.Getenv("RATE_LIMIT_STORE"))
+		switch kind {
+		case "postgres":
+			store = &PostgresStore{DB: db}
+		default:
+			if kind != "" && kind != "memory" {
+				log.Printf("Rate limit: Unknown RATE_LIMIT_STORE %q, counting in memory instead\n", kind)
+			}
+			kind = "memory"
+		}
+		log.Printf("Rate limit: Counting in %s\n", kind)
+	})
+}
+
+// SetStore replaces the store, e.g. with a fresh MemoryStore in tests.
+func SetStore(s Store) {
+	once.Do(func() {})
+	store = s
+}
+
+// Default returns the store in use.
+func Default() Store {
+	return store
+}
@@ -0,0 +1,62 @@
+package sessions
+
+import "strings"
+
+// Substrings of a User-Agent naming the browser or app, checked in order: Edge and Opera
+// also claim to be Chrome, and Chrome claims to be Safari.
+var browsers = []struct{ token, name string }{
+	{"EdgA/", "Edge"},
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"okhttp/", "Android app"},
+	{"Dart/", "Mobile app"},
+	{"PostmanRuntime/", "Postman"},
+	{"curl/", "curl"},
+}
+
+// Substrings naming the operating system, checked in order: iPadOS and Android user agents
+// also mention Mac OS and Linux.
+var platforms = []struct{ token, name string }{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// describeDevice turns a User-Agent into a label for the sessions list, e.g.
+// "Chrome on Android".
+func describeDevice(userAgent string) string {
+	browser, platform := "", ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,285 @@
+// Package sessions signs users in per device. Each sign-in is a Session row: short-lived JWT
+// access tokens name it, and its refresh token, stored hashed, is rotated on every use.
+// Revoking the row or blocking the user cuts off the access tokens already handed out.
+package sessions
+
+import (
+	"api/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// AccessTTL is how long an access token is accepted; clients refresh before it runs out.
+	AccessTTL = 15 * time.Minute
+	// RefreshTTL is how long a session lasts without being refreshed.
+	RefreshTTL = 30 * 24 * time.Hour
+	// reuseGrace is how long after a rotation the replaced refresh token is rejected without
+	// revoking the session, so two tabs refreshing at once don't sign the user out.
+	reuseGrace = 30 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrTokenReused  = errors.New("refresh token was already used; the session has been revoked")
+	ErrUserBlocked  = errors.New("account is not active")
+)
+
+// Tokens is what a client keeps after signing in or refreshing.
+type Tokens struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	SessionID        uuid.UUID `json:"session_id"`
+}
+
+// Client is the device signing in or refreshing.
+type Client struct {
+	UserAgent string
+	IP        string
+}
+
+// Principal is the caller an access token authenticates.
+type Principal struct {
+	UserID    uuid.UUID
+	SessionID uuid.UUID
+	Role      models.Role
+	TwoFactor bool // the session was signed in with a second factor
+}
+
+func secret() []byte {
+	if s := os.Getenv("JWT_SECRET"); s != "" {
+		return []byte(s)
+	}
+	return []byte("supersecretkey") // Fallback for dev, but should be set in production
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func accessToken(user models.User, sessionID uuid.UUID, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(AccessTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID.String(),
+		"sid":     sessionID.String(),
+		"role":    string(user.Role),
+		"iat":     now.Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+	signed, err := token.SignedString(secret())
+	return signed, expiresAt, err
+}
+
+// Start signs user in on client and returns the new session's tokens. twoFactor records
+// that the user also proved a second factor.
+func Start(db *gorm.DB, user models.User, client Client, twoFactor bool) (*Tokens, error) {
+	// Status is empty on a user created in this request; the column defaults to ACTIVE
+	if user.Status != "" && user.Status != models.UserActive {
+		return nil, ErrUserBlocked
+	}
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:            user.ID,
+		RefreshTokenHash:  hashToken(refresh),
+		UserAgent:         client.UserAgent,
+		Device:            describeDevice(client.UserAgent),
+		IPAddress:         client.IP,
+		TwoFactorVerified: twoFactor,
+		LastUsedAt:        now,
+		ExpiresAt:         now.Add(RefreshTTL),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	access, expiresAt, err := accessToken(user, session.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: access, RefreshToken: refresh, ExpiresAt: expiresAt, RefreshExpiresAt: session.ExpiresAt, SessionID: session.ID}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token. A
+// refresh token works once: presenting a replaced one again means it leaked, so the session
+// is revoked.
+func Refresh(db *gorm.DB, refreshToken string, client Client) (*Tokens, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+	hash := hashToken(refreshToken)
+	now := time.Now()
+
+	var session models.Session
+	err := db.Where("refresh_token_hash = ?", hash).First(&session).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, replayed(db, hash, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", session.UserID).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	if user.Status != models.UserActive {
+		return nil, ErrUserBlocked
+	}
+
+	next, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := now.Add(RefreshTTL)
+	// Conditional on the old hash so that of two concurrent refreshes only one rotates
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  hashToken(next),
+			"previous_token_hash": hash,
+			"rotated_at":          now,
+			"last_used_at":        now,
+			"expires_at":          expiresAt,
+			"ip_address":          client.IP,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	access, accessExpiresAt, err := accessToken(user, session.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{AccessToken: access, RefreshToken: next, ExpiresAt: accessExpiresAt, RefreshExpiresAt: expiresAt, SessionID: session.ID}, nil
+}
+
+// replayed handles a refresh token that matches no live session. If it is one a session
+// already rotated away from, outside the grace period, that session is revoked.
+func replayed(db *gorm.DB, hash string, now time.Time) error {
+	var session models.Session
+	if err := db.Where("previous_token_hash = ? AND revoked_at IS NULL", hash).First(&session).Error; err != nil {
+		return ErrInvalidToken
+	}
+	if session.RotatedAt != nil && now.Sub(*session.RotatedAt) < reuseGrace {
+		return ErrInvalidToken
+	}
+	if err := Revoke(db, session.UserID, session.ID, models.SessionTokenReuse); err != nil {
+		return err
+	}
+	return ErrTokenReused
+}
+
+// Authenticate checks an access token and that its session is live and its user active.
+func Authenticate(db *gorm.DB, tokenStr string) (*Principal, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	userID, err := uuid.Parse(stringClaim(claims, "user_id"))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sessionID, err := uuid.Parse(stringClaim(claims, "sid"))
+	if err != nil {
+		return nil, ErrInvalidToken // tokens from before sessions existed
+	}
+
+	var row struct {
+		Status            models.Status
+		Role              models.Role
+		TwoFactorVerified bool
+	}
+	err = db.Table("sessions").
+		Select("users.status, users.role, sessions.two_factor_verified").
+		Joins("JOIN users ON users.id = sessions.user_id AND users.deleted_at IS NULL").
+		Where("sessions.id = ? AND sessions.user_id = ? AND sessions.revoked_at IS NULL AND sessions.expires_at > ?", sessionID, userID, time.Now()).
+		Take(&row).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if row.Status != models.UserActive {
+		return nil, ErrUserBlocked
+	}
+
+	// The role comes from the database so role changes apply without signing in again
+	return &Principal{UserID: userID, SessionID: sessionID, Role: row.Role, TwoFactor: row.TwoFactorVerified}, nil
+}
+
+func stringClaim(claims jwt.MapClaims, key string) string {
+	s, _ := claims[key].(string)
+	return s
+}
+
+// MarkTwoFactorVerified records that the user proved a second factor in a session, e.g. by
+// confirming their authenticator app in it.
+func MarkTwoFactorVerified(db *gorm.DB, sessionID uuid.UUID) error {
+	return db.Model(&models.Session{}).Where("id = ?", sessionID).Update("two_factor_verified", true).Error
+}
+
+// Active lists the user's live sessions, most recently used first.
+func Active(db *gorm.DB, userID uuid.UUID) ([]models.Session, error) {
+	var list []models.Session
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&list).Error
+	return list, err
+}
+
+// Revoke ends one of the user's sessions. Ending one that has already ended is not an error.
+func Revoke(db *gorm.DB, userID, sessionID uuid.UUID, reason string) error {
+	return db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RevokeAll ends every live session of the user and returns how many there were.
+func RevokeAll(db *gorm.DB, userID uuid.UUID, reason string) (int64, error) {
+	result := db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason})
+	return result.RowsAffected, result.Error
+}
+
+// Prune deletes sessions that expired or were revoked more than retention ago.
+func Prune(db *gorm.DB, retention time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-retention)
+	result := db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{})
+	return result.RowsAffected, result.Error
+}
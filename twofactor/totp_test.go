@@ -0,0 +1,109 @@
+package twofactor
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 key of the RFC 4226 and RFC 6238 test vectors.
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp(rfcKey, int64(counter)); got != code {
+			t.Errorf("hotp(counter %d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+
+	// RFC 6238 appendix B, SHA-1. The RFC gives 8 digits; a 6-digit code is the last 6.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		s, ok := validateTOTP(secret, tt.code, at, 0)
+		if !ok {
+			t.Errorf("validateTOTP(%s at %d) refused a valid code", tt.code, tt.unix)
+			continue
+		}
+		if s != step(at) {
+			t.Errorf("validateTOTP(%s at %d) matched step %d, want %d", tt.code, tt.unix, s, step(at))
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	at := time.Unix(1111111111, 0)
+	now := step(at)
+
+	tests := []struct {
+		name string
+		step int64
+		ok   bool
+	}{
+		{"previous step", now - 1, true},
+		{"next step", now + 1, true},
+		{"two steps behind", now - 2, false},
+		{"two steps ahead", now + 2, false},
+	}
+	for _, tt := range tests {
+		_, ok := validateTOTP(secret, hotp(rfcKey, tt.step), at, 0)
+		if ok != tt.ok {
+			t.Errorf("%s: validateTOTP ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPRefusesReplay(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	at := time.Unix(59, 0)
+
+	s, ok := validateTOTP(secret, "287082", at, 0)
+	if !ok {
+		t.Fatal("validateTOTP refused a valid code")
+	}
+
+	tests := []struct {
+		name     string
+		lastStep int64
+		ok       bool
+	}{
+		{"before the code's step", s - 1, true},
+		{"the code's step", s, false},
+		{"after the code's step", s + 1, false},
+	}
+	for _, tt := range tests {
+		if _, ok := validateTOTP(secret, "287082", at, tt.lastStep); ok != tt.ok {
+			t.Errorf("lastStep %s: validateTOTP ok = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformed(t *testing.T) {
+	secret := b32.EncodeToString(rfcKey)
+	at := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "94287082"} {
+		if _, ok := validateTOTP(secret, code, at, 0); ok {
+			t.Errorf("validateTOTP accepted %q", code)
+		}
+	}
+	if _, ok := validateTOTP("not base32!", "287082", at, 0); ok {
+		t.Error("validateTOTP accepted a code for an invalid secret")
+	}
+}
@@ -0,0 +1,391 @@
+// Package twofactor is TOTP two-factor authentication: enrolling an authenticator app,
+// single-use backup codes, and the challenge that makes up the second step of signing in.
+package twofactor
+
+import (
+	"api/emails"
+	"api/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// BackupCodeCount is how many backup codes a user gets at a time.
+	BackupCodeCount = 10
+	// ChallengeTTL is how long the second step of signing in may take.
+	ChallengeTTL = 5 * time.Minute
+	// maxChallengeAttempts is how many wrong codes end a challenge; the user signs in again.
+	maxChallengeAttempts = 5
+	// maxCodeAttempts is how many wrong codes in a row use up a pending enrollment, or stop a
+	// signed-in user changing their settings until they sign in again.
+	maxCodeAttempts = 5
+	// EmailCodeTTL is how long the code emailed to staff to confirm enrollment can be used.
+	EmailCodeTTL    = 15 * time.Minute
+	emailCodeDigits = 8
+)
+
+var (
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrInvalidCode    = errors.New("invalid authentication code")
+	ErrChallenge      = errors.New("sign-in challenge is invalid, expired or used up")
+	ErrEmailCode      = errors.New("invalid or expired email confirmation code")
+	ErrTooMany        = errors.New("too many wrong codes")
+)
+
+// Required reports whether users with role must use two-factor authentication. Every staff
+// role does, since they all reach the back office.
+func Required(role models.Role) bool {
+	return models.IsStaff(role)
+}
+
+// Status is a user's two-factor setup as shown in their security settings.
+type Status struct {
+	Enabled              bool       `json:"enabled"`
+	Required             bool       `json:"required"`
+	EnabledAt            *time.Time `json:"enabled_at"`
+	BackupCodesRemaining int64      `json:"backup_codes_remaining"`
+}
+
+// Enabled reports whether the user confirmed an authenticator app.
+func Enabled(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.TwoFactor{}).Where("user_id = ? AND enabled_at IS NOT NULL", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetStatus returns the user's two-factor setup.
+func GetStatus(db *gorm.DB, user models.User) (Status, error) {
+	status := Status{Required: Required(user.Role)}
+
+	var tf models.TwoFactor
+	err := db.First(&tf, "user_id = ? AND enabled_at IS NOT NULL", user.ID).Error
+	if err == gorm.ErrRecordNotFound {
+		return status, nil
+	}
+	if err != nil {
+		return status, err
+	}
+	status.Enabled, status.EnabledAt = true, tf.EnabledAt
+
+	err = db.Model(&models.BackupCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&status.BackupCodesRemaining).Error
+	return status, err
+}
+
+// Begin starts enrolling an authenticator app, replacing any unconfirmed attempt. It
+// returns the secret and the otpauth:// URI to show as a QR code. A password is all it takes
+// to get this far, so for roles that require two-factor authentication it also emails the
+// user a code that Confirm asks for.
+func Begin(db *gorm.DB, user models.User) (string, string, error) {
+	enabled, err := Enabled(db, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if enabled {
+		return "", "", ErrAlreadyEnabled
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+	tf := models.TwoFactor{UserID: user.ID, Secret: sealed}
+	var emailCode string
+	if Required(user.Role) {
+		if emailCode, err = newEmailCode(); err != nil {
+			return "", "", err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(emailCode), bcrypt.DefaultCost)
+		if err != nil {
+			return "", "", err
+		}
+		expiresAt := time.Now().Add(EmailCodeTTL)
+		tf.EmailCodeHash, tf.EmailCodeExpiresAt = string(hash), &expiresAt
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"secret":                sealed,
+				"last_used_step":        0,
+				"email_code_hash":       tf.EmailCodeHash,
+				"email_code_expires_at": tf.EmailCodeExpiresAt,
+				"attempts":              0,
+				"updated_at":            time.Now(),
+			}),
+		}).Create(&tf).Error
+		if err != nil || emailCode == "" {
+			return err
+		}
+		_, err = emails.Queue(tx, emails.KindTwoFactorEnrollment, user.Email, user.UserName, emailCode, *tf.EmailCodeExpiresAt)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, provisioningURI(secret, user.Email), nil
+}
+
+func newEmailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(100_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", emailCodeDigits, n.Int64()), nil
+}
+
+func checkEmailCode(tf models.TwoFactor, code string) error {
+	if tf.EmailCodeHash == "" || tf.EmailCodeExpiresAt == nil || time.Now().After(*tf.EmailCodeExpiresAt) {
+		return ErrEmailCode
+	}
+	if bcrypt.CompareHashAndPassword([]byte(tf.EmailCodeHash), []byte(strings.TrimSpace(code))) != nil {
+		return ErrEmailCode
+	}
+	return nil
+}
+
+// Confirm enables the pending enrollment once the user proves their app shows the right
+// code, along with the emailed code for roles that require it, then runs then in the same
+// transaction. It returns the user's first backup codes. Wrong codes count against the
+// enrollment; after maxCodeAttempts the user starts setup again.
+func Confirm(db *gorm.DB, user models.User, code, emailCode string, then func(tx *gorm.DB) error) ([]string, error) {
+	var codes []string
+	var confirmErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var tf models.TwoFactor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tf, "user_id = ?", user.ID).Error; err != nil {
+			return ErrNotEnrolled
+		}
+		if tf.EnabledAt != nil {
+			return ErrAlreadyEnabled
+		}
+		if tf.Attempts >= maxCodeAttempts {
+			return ErrTooMany
+		}
+
+		s, err := checkTOTP(tf, code)
+		if err == nil && Required(user.Role) {
+			err = checkEmailCode(tf, emailCode)
+		}
+		if err == ErrInvalidCode || err == ErrEmailCode {
+			confirmErr = err
+			// Committed so that the failure counts
+			return tx.Model(&tf).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&tf).Updates(map[string]interface{}{
+			"enabled_at":            time.Now(),
+			"last_used_step":        s,
+			"email_code_hash":       "",
+			"email_code_expires_at": nil,
+			"attempts":              0,
+		}).Error; err != nil {
+			return err
+		}
+		if codes, err = RegenerateBackupCodes(tx, user.ID); err != nil {
+			return err
+		}
+		return then(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, confirmErr
+}
+
+// Disable removes the user's enrollment and backup codes.
+func Disable(tx *gorm.DB, userID uuid.UUID) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.BackupCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+}
+
+func checkTOTP(tf models.TwoFactor, code string) (int64, error) {
+	secret, err := open(tf.Secret)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := validateTOTP(secret, normalize(code), time.Now(), tf.LastUsedStep)
+	if !ok {
+		return 0, ErrInvalidCode
+	}
+	return s, nil
+}
+
+// Verify accepts a code from the user's authenticator app or one of their unused backup
+// codes, and uses it up.
+func Verify(tx *gorm.DB, userID uuid.UUID, code string) error {
+	var tf models.TwoFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tf, "user_id = ? AND enabled_at IS NOT NULL", userID).Error; err != nil {
+		return ErrNotEnrolled
+	}
+
+	code = normalize(code)
+	if len(code) == digits {
+		s, err := checkTOTP(tf, code)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&tf).Updates(map[string]interface{}{"last_used_step": s, "attempts": 0}).Error
+	}
+
+	var backups []models.BackupCode
+	if err := tx.Where("user_id = ? AND used_at IS NULL", userID).Find(&backups).Error; err != nil {
+		return err
+	}
+	for _, b := range backups {
+		if bcrypt.CompareHashAndPassword([]byte(b.CodeHash), []byte(code)) == nil {
+			if err := tx.Model(&b).Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+			return tx.Model(&tf).Update("attempts", 0).Error
+		}
+	}
+	return ErrInvalidCode
+}
+
+// Reauthenticate checks a current code from a signed-in user, as Verify does, before then
+// runs in the same transaction to change their settings. Wrong codes in a row count against
+// the user; after maxCodeAttempts it returns ErrTooMany without checking, until they sign in
+// again with a code.
+func Reauthenticate(db *gorm.DB, userID uuid.UUID, code string, then func(tx *gorm.DB) error) error {
+	var verifyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var tf models.TwoFactor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tf, "user_id = ? AND enabled_at IS NOT NULL", userID).Error; err != nil {
+			return ErrNotEnrolled
+		}
+		if tf.Attempts >= maxCodeAttempts {
+			return ErrTooMany
+		}
+
+		verifyErr = Verify(tx, userID, code)
+		if verifyErr == ErrInvalidCode {
+			// Committed so that the failure counts
+			return tx.Model(&tf).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		if verifyErr != nil {
+			return verifyErr
+		}
+		return then(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// backupAlphabet leaves out characters that are easy to misread: 0/o, 1/l/i.
+const backupAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// RegenerateBackupCodes replaces the user's backup codes with BackupCodeCount new ones and
+// returns them. They are stored hashed, so this is the only time they can be shown.
+func RegenerateBackupCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.BackupCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, BackupCodeCount)
+	rows := make([]models.BackupCode, BackupCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j, b := range raw {
+			raw[j] = backupAlphabet[int(b)%len(backupAlphabet)]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+
+		hash, err := bcrypt.GenerateFromPassword(raw, bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = models.BackupCode{UserID: userID, CodeHash: string(hash)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalize strips the spaces and dashes people type or paste into codes.
+func normalize(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewChallenge starts the second step of signing in for a user whose password was right.
+// The returned token stands in for the password while they fetch a code.
+func NewChallenge(db *gorm.DB, userID uuid.UUID) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	expiresAt := time.Now().Add(ChallengeTTL)
+
+	err := db.Create(&models.TwoFactorChallenge{UserID: userID, TokenHash: hashToken(token), ExpiresAt: expiresAt}).Error
+	return token, expiresAt, err
+}
+
+// CompleteChallenge checks the code given for a challenge and returns the user signing in.
+// Wrong codes count against the challenge; after maxChallengeAttempts it stops working.
+func CompleteChallenge(db *gorm.DB, token, code string) (uuid.UUID, error) {
+	var userID uuid.UUID
+	var verifyErr error
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var challenge models.TwoFactorChallenge
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&challenge, "token_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?", hashToken(token), time.Now(), maxChallengeAttempts).Error
+		if err != nil {
+			return ErrChallenge
+		}
+
+		verifyErr = Verify(tx, challenge.UserID, code)
+		if verifyErr == ErrInvalidCode {
+			// Committed so that the failure counts
+			return tx.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		if verifyErr != nil {
+			return verifyErr
+		}
+		userID = challenge.UserID
+		return tx.Model(&challenge).Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return userID, verifyErr
+}
+
+// PruneChallenges deletes challenges that expired over a day ago.
+func PruneChallenges(db *gorm.DB) (int64, error) {
+	result := db.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.TwoFactorChallenge{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"api/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Lagos is the timezone artisans' working hours and blackout dates are written in.
+var Lagos = loadLagos()
+
+func loadLagos() *time.Location {
+	loc, err := time.LoadLocation("Africa/Lagos")
+	if err != nil {
+		return time.FixedZone("WAT", 60*60)
+	}
+	return loc
+}
+
+// pendingBookingHold is how long an unpaid booking keeps its slot while the customer pays.
+const pendingBookingHold = 30 * time.Minute
+
+var (
+	ErrSlotUnavailable = errors.New("the artisan is not available at that time")
+	ErrSlotTaken       = errors.New("that time slot is already booked")
+)
+
+// Slot is a bookable period of an artisan's time.
+type Slot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func (s Slot) overlaps(o Slot) bool {
+	return s.Start.Before(o.End) && o.Start.Before(s.End)
+}
+
+// ParseClock parses an HH:MM time of day into minutes after midnight.
+func ParseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || len(hh) != 2 || len(mm) != 2 || errH != nil || errM != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// ValidateSchedule checks a slot length and set of weekly windows before they are saved.
+func ValidateSchedule(slotMinutes int, windows []models.AvailabilityWindow) error {
+	if slotMinutes < 15 || slotMinutes > 24*60 {
+		return fmt.Errorf("slot duration must be between 15 minutes and 24 hours")
+	}
+
+	byDay := map[int][][2]int{}
+	for _, w := range windows {
+		if w.Weekday < 0 || w.Weekday > 6 {
+			return fmt.Errorf("weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		start, err := ParseClock(w.StartTime)
+		if err != nil {
+			return err
+		}
+		end, err := ParseClock(w.EndTime)
+		if err != nil {
+			return err
+		}
+		if end-start < slotMinutes {
+			return fmt.Errorf("%s %s–%s is shorter than one %d minute slot", time.Weekday(w.Weekday), w.StartTime, w.EndTime, slotMinutes)
+		}
+		for _, other := range byDay[w.Weekday] {
+			if start < other[1] && other[0] < end {
+				return fmt.Errorf("%s has overlapping windows", time.Weekday(w.Weekday))
+			}
+		}
+		byDay[w.Weekday] = append(byDay[w.Weekday], [2]int{start, end})
+	}
+	return nil
+}
+
+// scheduleSlots lists every slot a schedule offers on days from..to (Lagos dates, inclusive),
+// skipping blackout dates. Bookings are not taken into account.
+func scheduleSlots(schedule models.ServiceSchedule, blackouts map[string]bool, from, to time.Time) []Slot {
+	length := time.Duration(schedule.SlotMinutes) * time.Minute
+	var slots []Slot
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if blackouts[day.Format("2006-01-02")] {
+			continue
+		}
+		for _, w := range schedule.Windows {
+			if time.Weekday(w.Weekday) != day.Weekday() {
+				continue
+			}
+			start, _ := ParseClock(w.StartTime)
+			end, _ := ParseClock(w.EndTime)
+			windowEnd := day.Add(time.Duration(end) * time.Minute)
+			for t := day.Add(time.Duration(start) * time.Minute); !t.Add(length).After(windowEnd); t = t.Add(length) {
+				slots = append(slots, Slot{Start: t, End: t.Add(length)})
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots
+}
+
+// LagosDay returns midnight in Lagos of the day t falls on.
+func LagosDay(t time.Time) time.Time {
+	y, m, d := t.In(Lagos).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, Lagos)
+}
+
+func blackoutSet(db *gorm.DB, artisanID uuid.UUID, from, to time.Time) (map[string]bool, error) {
+	var dates []string
+	if err := db.Model(&models.BlackoutDate{}).Where("artisan_id = ? AND date BETWEEN ? AND ?", artisanID,
+		from.Format("2006-01-02"), to.Format("2006-01-02")).Pluck("date", &dates).Error; err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(dates))
+	for _, d := range dates {
+		set[d] = true
+	}
+	return set, nil
+}
+
+// busySlots returns the periods the artisan is booked between from and to, ignoring the
+// booking exclude (uuid.Nil for none). Unpaid bookings only hold their slot for a short while.
+func busySlots(db *gorm.DB, artisanID, exclude uuid.UUID, from, to time.Time) ([]Slot, error) {
+	var bookings []models.ServiceBooking
+	err := db.Select("id", "scheduled_date", "scheduled_end_at").
+		Where("artisan_id = ? AND id <> ?", artisanID, exclude).
+		Where("scheduled_date < ?", to).
+		Where("COALESCE(scheduled_end_at, scheduled_date + make_interval(mins => ?)) > ?", models.DefaultSlotMinutes, from).
+		Where("(status IN ? OR (status = ? AND created_at > ?))",
+			[]string{"BOOKED", "IN_PROGRESS"}, "PENDING", time.Now().Add(-pendingBookingHold)).
+		Find(&bookings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make([]Slot, 0, len(bookings))
+	for _, b := range bookings {
+		end := b.ScheduledDate.Add(models.DefaultSlotMinutes * time.Minute)
+		if b.ScheduledEndAt != nil {
+			end = *b.ScheduledEndAt
+		}
+		busy = append(busy, Slot{Start: b.ScheduledDate, End: end})
+	}
+	return busy, nil
+}
+
+// OpenSlots returns the free future slots a service's schedule offers on Lagos dates from..to.
+func OpenSlots(db *gorm.DB, schedule models.ServiceSchedule, from, to time.Time) ([]Slot, error) {
+	from, to = LagosDay(from), LagosDay(to)
+	blackouts, err := blackoutSet(db, schedule.ArtisanID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := busySlots(db, schedule.ArtisanID, uuid.Nil, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	open := []Slot{}
+	for _, slot := range scheduleSlots(schedule, blackouts, from, to) {
+		if !slot.Start.After(now) {
+			continue
+		}
+		free := true
+		for _, b := range busy {
+			if slot.overlaps(b) {
+				free = false
+				break
+			}
+		}
+		if free {
+			open = append(open, slot)
+		}
+	}
+	return open, nil
+}
+
+// ReserveSlot checks that a booking of service starting at start fits the artisan's schedule
+// and does not overlap their other bookings, and returns the booked slot. bookingID is the
+// booking being moved when rescheduling, or uuid.Nil for a new booking. Call it inside the
+// transaction that saves the booking: it holds a per-artisan lock until commit so concurrent
+// bookings cannot take the same slot.
+func ReserveSlot(tx *gorm.DB, serviceID, artisanID, bookingID uuid.UUID, start time.Time) (Slot, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "artisan-slots:"+artisanID.String()).Error; err != nil {
+		return Slot{}, err
+	}
+	if !start.After(time.Now()) {
+		return Slot{}, fmt.Errorf("%w: the scheduled date is in the past", ErrSlotUnavailable)
+	}
+
+	// Services without a schedule can be booked at any time, for a default-length slot
+	var schedule models.ServiceSchedule
+	if err := tx.Preload("Windows").Where("service_id = ?", serviceID).First(&schedule).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return Slot{}, err
+	}
+
+	day := LagosDay(start)
+	blackouts, err := blackoutSet(tx, artisanID, day, day)
+	if err != nil {
+		return Slot{}, err
+	}
+	if len(blackouts) > 0 {
+		return Slot{}, fmt.Errorf("%w: the artisan is away on %s", ErrSlotUnavailable, day.Format("2 Jan 2006"))
+	}
+
+	slot := Slot{Start: start, End: start.Add(models.DefaultSlotMinutes * time.Minute)}
+	if schedule.ID != uuid.Nil {
+		found := false
+		for _, s := range scheduleSlots(schedule, blackouts, day, day) {
+			if s.Start.Equal(start) {
+				slot, found = s, true
+				break
+			}
+		}
+		if !found {
+			return Slot{}, ErrSlotUnavailable
+		}
+	}
+
+	busy, err := busySlots(tx, artisanID, bookingID, slot.Start, slot.End)
+	if err != nil {
+		return Slot{}, err
+	}
+	if len(busy) > 0 {
+		return Slot{}, ErrSlotTaken
+	}
+	return slot, nil
+}
+
+// ConfirmPaidSlot is called when payment lands for a PENDING booking. While the booking is
+// within pendingBookingHold its slot is still reserved; after that another booking may have
+// taken it, so the overlap check runs again under the per-artisan lock and ErrSlotTaken is
+// returned if the slot has gone. Call it inside the transaction that marks the booking paid.
+func ConfirmPaidSlot(tx *gorm.DB, booking *models.ServiceBooking) error {
+	if time.Since(booking.CreatedAt) < pendingBookingHold {
+		return nil
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "artisan-slots:"+booking.ArtisanID.String()).Error; err != nil {
+		return err
+	}
+
+	end := booking.ScheduledDate.Add(models.DefaultSlotMinutes * time.Minute)
+	if booking.ScheduledEndAt != nil {
+		end = *booking.ScheduledEndAt
+	}
+	busy, err := busySlots(tx, booking.ArtisanID, booking.ID, booking.ScheduledDate, end)
+	if err != nil {
+		return err
+	}
+	if len(busy) > 0 {
+		return ErrSlotTaken
+	}
+	return nil
+}
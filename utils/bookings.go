@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"api/models"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// noShowGrace is how long after the scheduled start a party may be reported as a no-show.
+const noShowGrace = 30 * time.Minute
+
+// BookingRescheduleLimit is how many times a booking can be moved (BOOKING_RESCHEDULE_LIMIT,
+// 2 by default).
+func BookingRescheduleLimit() int {
+	if limit, err := strconv.Atoi(os.Getenv("BOOKING_RESCHEDULE_LIMIT")); err == nil && limit >= 0 {
+		return limit
+	}
+	return 2
+}
+
+// BookingParty returns the actor userID is on booking (CUSTOMER or VENDOR for the artisan).
+func BookingParty(booking models.ServiceBooking, userID uuid.UUID) string {
+	if booking.ArtisanID == userID {
+		return models.ActorVendor
+	}
+	return models.ActorCustomer
+}
+
+// ProposeReschedule records a proposal by actor to move a locked booking to date. A party's
+// earlier open proposal is superseded; one from the other party must be answered first.
+func ProposeReschedule(tx *gorm.DB, booking *models.ServiceBooking, actor string, actorID uuid.UUID, date time.Time, reason string) (*models.RescheduleProposal, error) {
+	if booking.Status != "BOOKED" {
+		return nil, fmt.Errorf("only booked services can be rescheduled")
+	}
+	if limit := BookingRescheduleLimit(); booking.RescheduleCount >= limit {
+		return nil, fmt.Errorf("this booking has already been rescheduled %d times, the maximum allowed", limit)
+	}
+	if date.Equal(booking.ScheduledDate) {
+		return nil, fmt.Errorf("the proposed date is the current scheduled date")
+	}
+
+	var open []models.RescheduleProposal
+	if err := tx.Where("booking_id = ? AND status = ?", booking.ID, models.RescheduleProposed).Find(&open).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range open {
+		if p.ProposedBy != actor {
+			return nil, fmt.Errorf("respond to the other party's reschedule proposal first")
+		}
+	}
+
+	// Proposals must fit the artisan's calendar now; the slot is only taken on acceptance
+	if _, err := ReserveSlot(tx, booking.ServiceID, booking.ArtisanID, booking.ID, date); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&models.RescheduleProposal{}).
+		Where("booking_id = ? AND status = ? AND proposed_by = ?", booking.ID, models.RescheduleProposed, actor).
+		Update("status", models.RescheduleSuperseded).Error; err != nil {
+		return nil, err
+	}
+
+	proposal := models.RescheduleProposal{
+		BookingID:    booking.ID,
+		ProposedByID: actorID,
+		ProposedBy:   actor,
+		PreviousDate: booking.ScheduledDate,
+		ProposedDate: date,
+		Reason:       reason,
+		Status:       models.RescheduleProposed,
+	}
+	if err := tx.Create(&proposal).Error; err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// RespondToReschedule accepts or declines a proposal on behalf of the other party. Accepting
+// moves the booking, as long as the new slot is still free. Both rows should be locked.
+func RespondToReschedule(tx *gorm.DB, proposal *models.RescheduleProposal, booking *models.ServiceBooking, accept bool, responderID uuid.UUID) error {
+	if proposal.Status != models.RescheduleProposed {
+		return fmt.Errorf("this proposal is already %s", strings.ToLower(proposal.Status))
+	}
+	if BookingParty(*booking, responderID) == proposal.ProposedBy {
+		return fmt.Errorf("the other party must respond to this proposal")
+	}
+
+	now := time.Now()
+	status := models.RescheduleDeclined
+	if accept {
+		if booking.Status != "BOOKED" {
+			return fmt.Errorf("only booked services can be rescheduled")
+		}
+		if limit := BookingRescheduleLimit(); booking.RescheduleCount >= limit {
+			return fmt.Errorf("this booking has already been rescheduled %d times, the maximum allowed", limit)
+		}
+
+		slot, err := ReserveSlot(tx, booking.ServiceID, booking.ArtisanID, booking.ID, proposal.ProposedDate)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(booking).Updates(map[string]interface{}{
+			"scheduled_date":   slot.Start,
+			"scheduled_end_at": slot.End,
+			"reschedule_count": gorm.Expr("reschedule_count + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		booking.ScheduledDate = slot.Start
+		booking.ScheduledEndAt = &slot.End
+		booking.RescheduleCount++
+		status = models.RescheduleAccepted
+	}
+
+	proposal.Status = status
+	proposal.RespondedByID = &responderID
+	proposal.RespondedAt = &now
+	return tx.Model(proposal).Updates(map[string]interface{}{
+		"status":          status,
+		"responded_by_id": responderID,
+		"responded_at":    &now,
+	}).Error
+}
+
+// ReportNoShow records that the other party missed a locked booking. Both directions are
+// treated alike: the escrow stays held for a 24-hour window in which the reported party can
+// dispute the report. If they don't, a customer no-show releases the escrow to the artisan and
+// an artisan no-show refunds it to the customer (AutoReleaseEscrowBookings). Milestones of a
+// quoted booking stay in escrow until the team settles them.
+func ReportNoShow(tx *gorm.DB, booking *models.ServiceBooking, reporterID uuid.UUID) error {
+	if booking.Status != "BOOKED" {
+		return fmt.Errorf("only booked services that have not started can be reported as a no-show")
+	}
+	if time.Now().Before(booking.ScheduledDate.Add(noShowGrace)) {
+		return fmt.Errorf("a no-show can be reported from %d minutes after the scheduled time", int(noShowGrace.Minutes()))
+	}
+
+	reporter := BookingParty(*booking, reporterID)
+	missing := models.ActorVendor
+	if reporter == models.ActorVendor {
+		missing = models.ActorCustomer
+	}
+
+	now := time.Now()
+	if err := tx.Model(booking).Updates(map[string]interface{}{
+		"status":              models.BookingNoShow,
+		"no_show_party":       missing,
+		"no_show_reported_at": &now,
+	}).Error; err != nil {
+		return err
+	}
+	booking.Status = models.BookingNoShow
+	booking.NoShowParty = missing
+	booking.NoShowReportedAt = &now
+	return nil
+}
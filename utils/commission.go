@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"api/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultCommissionPercent applies when no commission rule matches.
+const DefaultCommissionPercent = 10.0
+
+// ResolveCommissionRule returns the commission rule that applies to a product sold at the
+// given time. When no rule matches, an unsaved rule with the default percentage is returned.
+func ResolveCommissionRule(db *gorm.DB, product models.Products, at time.Time) (models.CommissionRule, error) {
+	query := db.Where("is_active = ?", true).
+		Where("product_type = '' OR product_type = ?", product.ProductType).
+		Where("category_name = '' OR LOWER(category_name) = ?", strings.ToLower(product.CategoryName)).
+		Where("starts_at IS NULL OR starts_at <= ?", at).
+		Where("ends_at IS NULL OR ends_at > ?", at)
+
+	if product.UserID != nil {
+		query = query.Where("vendor_id IS NULL OR vendor_id = ?", *product.UserID)
+	} else {
+		query = query.Where("vendor_id IS NULL")
+	}
+
+	var rule models.CommissionRule
+	err := query.
+		Order("(vendor_id IS NOT NULL) DESC").
+		Order("(category_name <> '') DESC").
+		Order("(product_type <> '') DESC").
+		Order("priority DESC").
+		Order("created_at DESC").
+		First(&rule).Error
+
+	if err == gorm.ErrRecordNotFound {
+		return models.CommissionRule{Name: "Default", Percent: DefaultCommissionPercent, IsActive: true}, nil
+	}
+	return rule, err
+}
+
+// CalculateCommission applies a rule to an amount and returns the platform fee,
+// clamped to the rule's bounds and never more than the amount itself.
+func CalculateCommission(rule models.CommissionRule, amount models.Money) models.Money {
+	if !amount.IsPositive() {
+		return models.NGN(0)
+	}
+
+	fee := amount.Percent(rule.Percent).Add(rule.FlatFee)
+	if fee.Kobo < rule.MinFee.Kobo {
+		fee = rule.MinFee
+	}
+	if rule.MaxFee.IsPositive() && fee.Kobo > rule.MaxFee.Kobo {
+		fee = rule.MaxFee
+	}
+	if fee.Kobo > amount.Kobo {
+		fee = amount
+	}
+
+	return models.NGN(fee.Kobo)
+}
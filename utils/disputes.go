@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"api/ledger"
+	"api/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CanDispute reports whether party may dispute a booking while its escrow is still held. The
+// customer may dispute one the artisan marked as completed or reported the customer missed;
+// the artisan may dispute one the customer reported the artisan missed.
+func CanDispute(booking models.ServiceBooking, party string) error {
+	reportedNoShow := booking.Status == models.BookingNoShow && booking.NoShowParty == party
+	if party == models.ActorVendor && !reportedNoShow {
+		return fmt.Errorf("only bookings the customer reported you missed can be disputed")
+	}
+	if party == models.ActorCustomer && booking.Status != "ARTISAN_COMPLETED" && !reportedNoShow {
+		return fmt.Errorf("only bookings marked as completed by the artisan or reported as a customer no-show can be disputed")
+	}
+	if booking.PaymentStatus != "HELD_IN_ESCROW" {
+		return fmt.Errorf("booking payment is %s, not held in escrow", booking.PaymentStatus)
+	}
+	return nil
+}
+
+// OpenDispute records party's challenge to a booking awaiting settlement of its escrow and
+// moves the booking to DISPUTED, which keeps the escrow from being auto-released or refunded.
+// The caller should hold a lock on the booking row.
+func OpenDispute(tx *gorm.DB, booking *models.ServiceBooking, party, reason string, evidence []byte) (*models.Dispute, error) {
+	if err := CanDispute(*booking, party); err != nil {
+		return nil, err
+	}
+	senderID := booking.UserID
+	if party == models.ActorVendor {
+		senderID = booking.ArtisanID
+	}
+
+	if err := tx.Model(booking).Update("status", models.BookingDisputed).Error; err != nil {
+		return nil, err
+	}
+	booking.Status = models.BookingDisputed
+
+	dispute := models.Dispute{
+		BookingID:  booking.ID,
+		CustomerID: booking.UserID,
+		ArtisanID:  booking.ArtisanID,
+		Reason:     reason,
+		Status:     models.DisputeOpen,
+	}
+	if err := tx.Create(&dispute).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&models.DisputeMessage{
+		DisputeID:  dispute.ID,
+		SenderID:   senderID,
+		SenderRole: party,
+		Message:    reason,
+		Evidence:   evidence,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &dispute, nil
+}
+
+// ResolveDispute settles an open dispute on behalf of an admin. RELEASE pays the artisan in
+// full, FULL_REFUND returns the whole fee to the customer and PARTIAL_REFUND returns
+// refundAmount to the customer and pays the artisan the rest, with the platform fee reduced
+// in proportion. The returned payout and refund must be processed after commit.
+func ResolveDispute(tx *gorm.DB, dispute *models.Dispute, resolution string, refundAmount models.Money, note string, adminID uuid.UUID) (*models.Payout, *models.Refund, error) {
+	if dispute.Status != models.DisputeOpen {
+		return nil, nil, fmt.Errorf("dispute is already %s", dispute.Status)
+	}
+
+	var booking models.ServiceBooking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, "id = ?", dispute.BookingID).Error; err != nil {
+		return nil, nil, err
+	}
+	if booking.PaymentStatus != "HELD_IN_ESCROW" {
+		return nil, nil, fmt.Errorf("booking payment is %s, not held in escrow", booking.PaymentStatus)
+	}
+
+	reason := note
+	if reason == "" {
+		reason = fmt.Sprintf("Dispute on booking %s resolved", booking.BookingNumber)
+	}
+
+	var payout *models.Payout
+	var refund *models.Refund
+	var err error
+	switch resolution {
+	case models.DisputeRelease:
+		refundAmount = models.NGN(0)
+		payout, err = releaseBookingEscrow(tx, &booking)
+
+	case models.DisputeFullRefund:
+		refundAmount = booking.BookingFee
+		refund, err = RequestBookingRefund(tx, &booking, reason, models.ActorAdmin, &adminID)
+
+	case models.DisputePartialRefund:
+		if !refundAmount.IsPositive() || refundAmount.Kobo >= booking.BookingFee.Kobo {
+			return nil, nil, fmt.Errorf("a partial refund must be more than 0 and less than the booking fee of %s", booking.BookingFee)
+		}
+		payout, refund, err = splitBookingEscrow(tx, &booking, refundAmount, reason, adminID)
+
+	default:
+		return nil, nil, fmt.Errorf("unknown resolution %q", resolution)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(dispute).Updates(map[string]interface{}{
+		"status":          models.DisputeResolved,
+		"resolution":      resolution,
+		"refund_amount":   refundAmount,
+		"resolution_note": note,
+		"resolved_by_id":  adminID,
+		"resolved_at":     &now,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	dispute.Status = models.DisputeResolved
+	dispute.Resolution = resolution
+	dispute.RefundAmount = refundAmount
+	dispute.ResolutionNote = note
+	dispute.ResolvedByID = &adminID
+	dispute.ResolvedAt = &now
+
+	return payout, refund, nil
+}
+
+// splitBookingEscrow completes a disputed booking by releasing all but refundAmount of its
+// escrow to the artisan and requesting a refund of refundAmount to the customer.
+func splitBookingEscrow(tx *gorm.DB, booking *models.ServiceBooking, refundAmount models.Money, reason string, adminID uuid.UUID) (*models.Payout, *models.Refund, error) {
+	released := booking.BookingFee.Sub(refundAmount)
+	fee := models.Money{Kobo: booking.PlatformFee.Kobo * released.Kobo / booking.BookingFee.Kobo, Currency: booking.BookingFee.Currency}
+
+	now := time.Now()
+	if err := tx.Model(booking).Updates(map[string]interface{}{
+		"status":         "COMPLETED",
+		"completed_at":   &now,
+		"payment_status": models.PaymentRefundPending,
+	}).Error; err != nil {
+		return nil, nil, err
+	}
+	booking.Status = "COMPLETED"
+	booking.CompletedAt = &now
+	booking.PaymentStatus = models.PaymentRefundPending
+
+	if err := ledger.RecordBookingPartialRelease(tx, *booking, released.Kobo, fee.Kobo); err != nil {
+		return nil, nil, err
+	}
+	payout, err := QueuePayout(tx, models.PayoutSourceServiceBooking, booking.ID, booking.ArtisanID, released.Sub(fee),
+		fmt.Sprintf("Nedzl payout for booking %s", booking.BookingNumber))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refund, err := RequestRefund(tx, models.RefundSourceServiceBooking, booking.ID, booking.UserID, booking.PaymentReference, refundAmount,
+		reason, models.ActorAdmin, &adminID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payout, refund, nil
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"api/emails"
+	"api/ledger"
+	"api/models"
+	"api/notifications"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RecordFoodOrderPlaced writes the opening history entry for a newly created order.
+func RecordFoodOrderPlaced(tx *gorm.DB, order models.FoodOrder, actor string, actorID *uuid.UUID) error {
+	return tx.Create(&models.FoodOrderStatusHistory{
+		FoodOrderID: order.ID,
+		ToStatus:    order.Status,
+		Actor:       actor,
+		ActorID:     actorID,
+		Note:        "Order placed",
+	}).Error
+}
+
+// FoodOrderEffects are the money movements a status change started. Process them after commit.
+type FoodOrderEffects struct {
+	Payout *models.Payout
+	Refund *models.Refund
+}
+
+// TransitionFoodOrder moves order to status on behalf of actor and records the change.
+// The caller should hold a lock on the order row. When the customer or an admin marks a paid
+// order delivered the vendor's share is released in the ledger and a payout is queued; when
+// the vendor does, the release is held for the customer (see ReleaseHeldFoodOrders). When a
+// paid order is cancelled or refunded a refund to the customer is requested.
+func TransitionFoodOrder(tx *gorm.DB, order *models.FoodOrder, to, actor string, actorID *uuid.UUID, note string) (FoodOrderEffects, error) {
+	var effects FoodOrderEffects
+	from := order.Status
+	if err := models.CanTransitionFoodOrder(from, to, actor); err != nil {
+		return effects, err
+	}
+	if actor == models.ActorCustomer && to == models.FoodOrderCancelled && from == models.FoodOrderPaid {
+		if window := FoodOrderCancelWindow(); time.Since(order.CreatedAt) > window {
+			return effects, fmt.Errorf("paid orders can only be cancelled within %d minutes of ordering", int(window.Minutes()))
+		}
+	}
+	// SYSTEM moves orders to REFUNDED once the money is back; anyone else starts a refund
+	if to == models.FoodOrderRefunded && actor != models.ActorSystem && order.PaymentStatus != "SUCCESS" {
+		return effects, fmt.Errorf("order payment is %s, not refundable", order.PaymentStatus)
+	}
+
+	if err := tx.Model(order).Update("status", to).Error; err != nil {
+		return effects, err
+	}
+	order.Status = to
+
+	if err := tx.Create(&models.FoodOrderStatusHistory{
+		FoodOrderID: order.ID,
+		FromStatus:  from,
+		ToStatus:    to,
+		Actor:       actor,
+		ActorID:     actorID,
+		Note:        note,
+	}).Error; err != nil {
+		return effects, err
+	}
+
+	var err error
+	switch {
+	// The vendor's word alone does not release their share: the customer confirms delivery,
+	// or it is released after FoodOrderReleaseDelay unless they report a problem first
+	case to == models.FoodOrderDelivered && order.PaymentStatus == "SUCCESS" && actor == models.ActorVendor:
+		releaseAt := time.Now().Add(FoodOrderReleaseDelay())
+		order.ReleaseAt = &releaseAt
+		err = tx.Model(order).Update("release_at", &releaseAt).Error
+
+	// Delivery confirmed by the customer or an admin releases the vendor's share
+	case to == models.FoodOrderDelivered && order.PaymentStatus == "SUCCESS":
+		effects.Payout, err = ReleaseFoodOrder(tx, order)
+
+	// Cancelling or refunding a paid order gives the customer their money back
+	case (to == models.FoodOrderCancelled || to == models.FoodOrderRefunded) && order.PaymentStatus == "SUCCESS":
+		reason := note
+		if reason == "" {
+			reason = fmt.Sprintf("Food order %s %s", order.OrderNumber, strings.ToLower(to))
+		}
+		effects.Refund, err = RequestFoodOrderRefund(tx, order, reason, actor, actorID)
+	}
+
+	return effects, err
+}
+
+// FoodOrderReleaseDelay is how long after a vendor reports an order delivered its payment is
+// released if the customer neither confirms nor reports a problem (FOOD_ORDER_RELEASE_HOURS,
+// 24 hours by default).
+func FoodOrderReleaseDelay() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("FOOD_ORDER_RELEASE_HOURS")); err == nil && hours >= 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// ReleaseFoodOrder releases a delivered, paid order's vendor share in the ledger and queues the
+// payout. The caller should hold a lock on the order row.
+func ReleaseFoodOrder(tx *gorm.DB, order *models.FoodOrder) (*models.Payout, error) {
+	if order.Status != models.FoodOrderDelivered || order.PaymentStatus != "SUCCESS" {
+		return nil, fmt.Errorf("order is %s with payment %s, not releasable", strings.ToLower(order.Status), order.PaymentStatus)
+	}
+	if order.ReleasedAt != nil {
+		return nil, fmt.Errorf("order %s has already been released", order.OrderNumber)
+	}
+
+	now := time.Now()
+	order.ReleaseAt = nil
+	order.ReleasedAt = &now
+	if err := tx.Model(order).Updates(map[string]interface{}{"release_at": nil, "released_at": &now}).Error; err != nil {
+		return nil, err
+	}
+	if err := ledger.RecordFoodOrderRelease(tx, *order); err != nil {
+		return nil, err
+	}
+	return QueuePayout(tx, models.PayoutSourceFoodOrder, order.ID, order.VendorID, order.VendorPayout,
+		fmt.Sprintf("Nedzl payout for food order %s", order.OrderNumber))
+}
+
+// FoodOrderAwaitingRelease reports whether order was reported delivered by its vendor and is
+// waiting for the customer's confirmation, the release delay or an admin.
+func FoodOrderAwaitingRelease(order models.FoodOrder) bool {
+	return order.Status == models.FoodOrderDelivered && order.PaymentStatus == "SUCCESS" && order.ReleasedAt == nil &&
+		(order.ReleaseAt != nil || order.DeliveryIssue != "")
+}
+
+// ReleaseHeldFoodOrders releases vendor-reported deliveries whose release time has come
+// without the customer objecting. An order that fails to release is logged and picked up
+// again by the next run.
+func ReleaseHeldFoodOrders(db *gorm.DB) error {
+	var due []models.FoodOrder
+	if err := db.Select("id", "order_number").Where("status = ? AND payment_status = ? AND released_at IS NULL AND release_at <= ?",
+		models.FoodOrderDelivered, "SUCCESS", time.Now()).Find(&due).Error; err != nil {
+		return fmt.Errorf("fetching food orders due for release: %w", err)
+	}
+
+	for _, o := range due {
+		var payout *models.Payout
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Re-read under lock: the customer may have confirmed or objected since the query
+			var order models.FoodOrder
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", o.ID).Error; err != nil {
+				return err
+			}
+			if !FoodOrderAwaitingRelease(order) || order.ReleaseAt == nil || order.ReleaseAt.After(time.Now()) {
+				return nil
+			}
+			var err error
+			payout, err = ReleaseFoodOrder(tx, &order)
+			return err
+		})
+		if err != nil {
+			log.Printf("Jobs: Error releasing food order #%s: %v\n", o.OrderNumber, err)
+			continue
+		}
+		if payout == nil {
+			continue
+		}
+
+		log.Printf("Jobs: Released food order #%s to the vendor after an unchallenged delivery\n", o.OrderNumber)
+		if err := ProcessPayout(db, payout.ID); err != nil {
+			log.Printf("Jobs: Error processing payout for food order #%s: %v\n", o.OrderNumber, err)
+		}
+	}
+	return nil
+}
+
+// RequestFoodOrderRefund marks a paid order's payment as being refunded and records the refund.
+// A delivered order is only refundable while the vendor's payout has not gone out.
+func RequestFoodOrderRefund(tx *gorm.DB, order *models.FoodOrder, reason, actor string, actorID *uuid.UUID) (*models.Refund, error) {
+	if order.PaymentStatus != "SUCCESS" {
+		return nil, fmt.Errorf("order payment is %s, not refundable", order.PaymentStatus)
+	}
+	if err := cancelPayoutForRefund(tx, models.PayoutSourceFoodOrder, order.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Model(order).Update("payment_status", models.PaymentRefundPending).Error; err != nil {
+		return nil, err
+	}
+	order.PaymentStatus = models.PaymentRefundPending
+
+	return RequestRefund(tx, models.RefundSourceFoodOrder, order.ID, order.UserID, order.PaymentReference, order.TotalAmount,
+		reason, actor, actorID)
+}
+
+// progressStatuses are the order updates a customer can opt out of. Payment, cancellation
+// and refund emails always go out.
+var progressStatuses = map[string]bool{
+	models.FoodOrderPreparing:      true,
+	models.FoodOrderOutForDelivery: true,
+	models.FoodOrderDelivered:      true,
+}
+
+// NotifyFoodOrderStatus tells the customer the order's current status in the app and, unless
+// they opted out of progress updates, by email.
+func NotifyFoodOrderStatus(tx *gorm.DB, orderID uuid.UUID, note string) error {
+	var order models.FoodOrder
+	if err := tx.Preload("User").First(&order, "id = ?", orderID).Error; err != nil {
+		return err
+	}
+
+	headline, message := emails.FoodOrderStatusCopy(order.Status)
+	if note != "" {
+		message += " " + note
+	}
+	if order.Status == models.FoodOrderDelivered && order.ReleaseAt != nil {
+		message += fmt.Sprintf(" Confirm the delivery or report a problem before %s, when the vendor is paid.",
+			order.ReleaseAt.In(Lagos).Format("Mon, 02 Jan 2006 at 03:04 PM"))
+	}
+	err := notifications.Notify(tx, models.Notification{
+		UserID:   order.UserID,
+		Kind:     models.NotificationFoodOrder,
+		Title:    fmt.Sprintf("Order %s: %s", order.OrderNumber, headline),
+		Body:     message,
+		Link:     "/dashboard?tab=my_orders",
+		EntityID: &order.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if order.User.Email == "" {
+		return nil
+	}
+	if progressStatuses[order.Status] {
+		subscribed, err := emails.Subscribed(tx, order.User.Email, models.NotifyOrderUpdates)
+		if err != nil || !subscribed {
+			return err
+		}
+	}
+
+	name := order.CustomerName
+	if name == "" {
+		name = order.User.UserName
+	}
+	_, err = emails.Queue(tx, emails.KindFoodOrderStatus, order.User.Email, name, order.OrderNumber, order.Status, note)
+	return err
+}
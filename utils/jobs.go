@@ -2,80 +2,198 @@ package utils
 
 import (
 	"api/emails"
+	"api/jobs"
 	"api/models"
+	"api/otp"
+	"api/ratelimit"
+	"api/sessions"
+	"api/twofactor"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// Names of the recurring background jobs.
+const (
+	JobBulkProductEmails = "bulk-product-emails"
+	JobEscrowAutoRelease = "escrow-auto-release"
+	JobFoodOrderRelease  = "food-order-release"
+	JobPayoutRetry       = "payout-retry"
+	JobPayoutReconcile   = "payout-reconcile"
+	JobRefundReconcile   = "refund-reconcile"
+	JobSessionCleanup    = "session-cleanup"
+	JobRateLimitCleanup  = "rate-limit-cleanup"
+)
+
+// StartJobs registers the recurring jobs and email delivery on the shared Postgres queue and
+// starts this replica's scheduler and workers. Schedules are in Lagos time.
 func StartJobs(db *gorm.DB) {
-	go func() {
-		log.Println("Jobs: Running initial bulk email check on startup...")
-		CheckAndSendBulkEmails(db)
-
-		// Run every 24 hours
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-
-		for {
-			<-ticker.C
-			log.Println("Jobs: Running periodic bulk email check...")
-			CheckAndSendBulkEmails(db)
+	jobs.Location = Lagos
+
+	jobs.Register(JobBulkProductEmails, jobs.Definition{
+		Handler:     func(ctx context.Context, db *gorm.DB, _ []byte) error { return CheckAndSendBulkEmails(db) },
+		MaxAttempts: 3,
+		Timeout:     30 * time.Minute,
+	})
+	jobs.Register(JobEscrowAutoRelease, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return AutoReleaseEscrowBookings(db) },
+	})
+	jobs.Register(JobFoodOrderRelease, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return ReleaseHeldFoodOrders(db) },
+	})
+	jobs.Register(JobPayoutRetry, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return RetryPendingPayouts(db) },
+	})
+	jobs.Register(JobPayoutReconcile, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return ReconcileProcessingPayouts(db) },
+	})
+	jobs.Register(JobRefundReconcile, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return ReconcileRefunds(db) },
+	})
+	jobs.Register(JobSessionCleanup, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return PruneSessions(db) },
+	})
+	jobs.Register(JobRateLimitCleanup, jobs.Definition{
+		Handler: func(ctx context.Context, db *gorm.DB, _ []byte) error { return PruneRateLimits(db) },
+	})
+	jobs.Register(emails.DeliveryJob, jobs.Definition{
+		Handler:     emails.Deliver,
+		MaxAttempts: emails.DeliveryAttempts,
+		Timeout:     2 * time.Minute,
+	})
+
+	for name, spec := range map[string]string{
+		JobBulkProductEmails: "0 8 * * *",    // daily at 08:00
+		JobEscrowAutoRelease: "*/15 * * * *", // every 15 minutes
+		JobFoodOrderRelease:  "*/15 * * * *", // every 15 minutes
+		JobPayoutRetry:       "*/5 * * * *",  // every 5 minutes
+		JobPayoutReconcile:   "*/10 * * * *", // every 10 minutes
+		JobRefundReconcile:   "*/10 * * * *", // every 10 minutes
+		JobSessionCleanup:    "30 3 * * *",   // daily at 03:30
+		JobRateLimitCleanup:  "0 * * * *",    // hourly
+	} {
+		if err := jobs.Schedule(name, spec); err != nil {
+			log.Printf("Jobs: Error scheduling %s: %v\n", name, err)
 		}
-	}()
+	}
 
-	go func() {
-		log.Println("Jobs: Starting Escrow Auto-Release background worker...")
-		AutoReleaseEscrowBookings(db)
+	jobs.Start(db)
+}
 
-		// Check every 15 minutes
-		ticker := time.NewTicker(15 * time.Minute)
-		defer ticker.Stop()
+// sessionRetention is how long ended sessions are kept, e.g. to look into a reused token.
+const sessionRetention = 30 * 24 * time.Hour
 
-		for {
-			<-ticker.C
-			AutoReleaseEscrowBookings(db)
-		}
-	}()
+// PruneSessions deletes sessions that expired or were revoked over sessionRetention ago, and
+// stale two-factor sign-in challenges and phone verification codes.
+func PruneSessions(db *gorm.DB) error {
+	pruned, err := sessions.Prune(db, sessionRetention)
+	if err != nil {
+		return fmt.Errorf("pruning sessions: %w", err)
+	}
+	if pruned > 0 {
+		log.Printf("Jobs: Pruned %d ended sessions\n", pruned)
+	}
+	if _, err := twofactor.PruneChallenges(db); err != nil {
+		return fmt.Errorf("pruning two-factor challenges: %w", err)
+	}
+	if _, err := otp.Prune(db); err != nil {
+		return fmt.Errorf("pruning phone verification codes: %w", err)
+	}
+	return nil
 }
 
-func AutoReleaseEscrowBookings(db *gorm.DB) {
+// PruneRateLimits deletes the shared rate limit counters and lockouts that have run out.
+func PruneRateLimits(db *gorm.DB) error {
+	pruned, err := ratelimit.Prune(db)
+	if err != nil {
+		return fmt.Errorf("pruning rate limits: %w", err)
+	}
+	if pruned > 0 {
+		log.Printf("Jobs: Pruned %d expired rate limit counters\n", pruned)
+	}
+	return nil
+}
+
+// AutoReleaseEscrowBookings settles escrow nobody contested within 24 hours: it is released
+// to the artisan for completed jobs and customer no-shows, and refunded to the customer for
+// artisan no-shows. A booking that fails to settle is logged and picked up again by the next run.
+func AutoReleaseEscrowBookings(db *gorm.DB) error {
 	cutoff := time.Now().Add(-24 * time.Hour)
 	var pendingBookings []models.ServiceBooking
 
-	err := db.Where("status = ? AND artisan_completed_at <= ?", "ARTISAN_COMPLETED", cutoff).Find(&pendingBookings).Error
+	err := db.Where("payment_status = ?", "HELD_IN_ESCROW").
+		Where("(status = ? AND artisan_completed_at <= ?) OR (status = ? AND no_show_party = ? AND no_show_reported_at <= ?)",
+			"ARTISAN_COMPLETED", cutoff, models.BookingNoShow, models.ActorCustomer, cutoff).
+		Find(&pendingBookings).Error
 	if err != nil {
-		log.Println("Jobs: Error fetching pending escrow bookings for auto-release:", err)
-		return
+		return fmt.Errorf("fetching pending escrow bookings for auto-release: %w", err)
+	}
+
+	for _, b := range pendingBookings {
+		payout, err := ReleaseBookingEscrow(db, &b)
+		if err != nil {
+			log.Printf("Jobs: Error auto-releasing booking #%s: %v\n", b.BookingNumber, err)
+			continue
+		}
+
+		log.Printf("Jobs: Auto-completed booking #%s and queued payout to artisan after 24h\n", b.BookingNumber)
+		if err := ProcessPayout(db, payout.ID); err != nil {
+			log.Printf("Jobs: Error processing payout for booking #%s: %v\n", b.BookingNumber, err)
+		}
 	}
+	return refundArtisanNoShows(db, cutoff)
+}
 
-	if len(pendingBookings) == 0 {
-		return
+// refundArtisanNoShows refunds bookings the customer reported the artisan missed before cutoff
+// and the artisan did not dispute.
+func refundArtisanNoShows(db *gorm.DB, cutoff time.Time) error {
+	var bookings []models.ServiceBooking
+	if err := db.Where("payment_status = ? AND status = ? AND no_show_party = ? AND no_show_reported_at <= ?",
+		"HELD_IN_ESCROW", models.BookingNoShow, models.ActorVendor, cutoff).Find(&bookings).Error; err != nil {
+		return fmt.Errorf("fetching artisan no-shows for auto-refund: %w", err)
 	}
 
-	now := time.Now()
-	for _, b := range pendingBookings {
-		b.Status = "COMPLETED"
-		b.CompletedAt = &now
-		b.PaymentStatus = "RELEASED_TO_ARTISAN"
+	for _, b := range bookings {
+		var refund *models.Refund
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Re-read under lock: a dispute may have been opened since the query
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, "id = ?", b.ID).Error; err != nil {
+				return err
+			}
+			if b.Status != models.BookingNoShow || b.PaymentStatus != "HELD_IN_ESCROW" {
+				return nil
+			}
+			var err error
+			refund, err = RequestBookingRefund(tx, &b, fmt.Sprintf("Artisan did not show up for booking %s", b.BookingNumber), models.ActorSystem, nil)
+			return err
+		})
+		if err != nil {
+			log.Printf("Jobs: Error refunding artisan no-show booking #%s: %v\n", b.BookingNumber, err)
+			continue
+		}
+		if refund == nil {
+			continue
+		}
 
-		if err := db.Save(&b).Error; err != nil {
-			log.Printf("Jobs: Error auto-releasing booking #%s: %v\n", b.BookingNumber, err)
-		} else {
-			log.Printf("Jobs: Auto-completed booking #%s and released 90%% payout to artisan after 24h\n", b.BookingNumber)
+		log.Printf("Jobs: Refunding booking #%s to the customer after an undisputed artisan no-show\n", b.BookingNumber)
+		if err := ProcessRefund(db, refund.ID); err != nil {
+			log.Printf("Jobs: Error processing refund for booking #%s: %v\n", b.BookingNumber, err)
 		}
 	}
+	return nil
 }
 
-func CheckAndSendBulkEmails(db *gorm.DB) {
+func CheckAndSendBulkEmails(db *gorm.DB) error {
 	log.Println("Jobs: Checking database for unnotified products...")
 	var unnotifiedProducts []models.Products
 	if err := db.Where("is_notified = ?", false).Order("created_at desc").Find(&unnotifiedProducts).Error; err != nil {
-		log.Println("Error fetching unnotified products:", err)
-		return
+		return fmt.Errorf("fetching unnotified products: %w", err)
 	}
 
 	log.Printf("Jobs: Found %d unnotified products in the database", len(unnotifiedProducts))
@@ -113,11 +231,11 @@ func CheckAndSendBulkEmails(db *gorm.DB) {
 			}
 		}
 
-		// Fetch all active users
+		// Fetch all active users who haven't unsubscribed from the digest
 		var users []models.User
-		if err := db.Where("status = ?", "ACTIVE").Select("email", "user_name").Find(&users).Error; err != nil {
-			log.Println("Error fetching active users:", err)
-			return
+		if err := db.Scopes(emails.Subscribers(models.NotifyNewProducts, "email")).
+			Where("status = ?", "ACTIVE").Select("email", "user_name").Find(&users).Error; err != nil {
+			return fmt.Errorf("fetching active users: %w", err)
 		}
 
 		var recipients []emails.BulkEmailRecipient
@@ -129,18 +247,26 @@ func CheckAndSendBulkEmails(db *gorm.DB) {
 		}
 
 		if len(recipients) > 0 {
-			err := emails.SendNewProductsBulkMail(recipients, emailProducts)
+			// Queue the mailing and mark the products in one go, so they are announced once
+			err := db.Transaction(func(tx *gorm.DB) error {
+				for _, batch := range emails.RecipientBatches(recipients) {
+					if _, err := emails.Queue(tx, emails.KindNewProductsBulk, batch, emailProducts); err != nil {
+						return err
+					}
+				}
+				ids := make([]uuid.UUID, 0, len(unnotifiedProducts))
+				for _, p := range unnotifiedProducts {
+					ids = append(ids, p.ID)
+				}
+				return tx.Model(&models.Products{}).Where("id IN ?", ids).Update("is_notified", true).Error
+			})
 			if err != nil {
-				log.Println("Error sending bulk email:", err)
-				return
-			}
-			fmt.Printf("Bulk email sent to %d users for %d new products\n", len(recipients), len(unnotifiedProducts))
-
-			for _, p := range unnotifiedProducts {
-				db.Model(&p).Update("is_notified", true)
+				return fmt.Errorf("queueing bulk email: %w", err)
 			}
+			fmt.Printf("Bulk email queued for %d users for %d new products\n", len(recipients), len(unnotifiedProducts))
 		}
 	} else {
 		log.Printf("Jobs: Threshold of 5 unnotified products not met (have %d). Skipping email sending.", len(unnotifiedProducts))
 	}
+	return nil
 }
@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"api/ledger"
+	"api/models"
+	"api/notifications"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	payoutMaxAttempts = 5
+	payoutBaseBackoff = 15 * time.Minute
+	payoutMaxBackoff  = 24 * time.Hour
+)
+
+// QueuePayout records a pending payout for released escrow funds. It is safe to call
+// more than once for the same source; only the first call creates a payout.
+// Call it inside the transaction that releases the funds, then ProcessPayout after commit.
+func QueuePayout(tx *gorm.DB, sourceType string, sourceID, userID uuid.UUID, amount models.Money, reason string) (*models.Payout, error) {
+	if userID == uuid.Nil {
+		return nil, fmt.Errorf("payout recipient is missing")
+	}
+
+	now := time.Now()
+	payout := models.Payout{
+		UserID:        userID,
+		SourceType:    sourceType,
+		SourceID:      sourceID,
+		Amount:        amount,
+		Currency:      amount.CurrencyCode(),
+		Reason:        reason,
+		Reference:     newPayoutReference(),
+		Status:        models.PayoutPending,
+		NextAttemptAt: &now,
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&payout).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).First(&payout).Error; err != nil {
+		return nil, err
+	}
+
+	return &payout, nil
+}
+
+func newPayoutReference() string {
+	return "ndz-po-" + strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+func payoutBackoff(attempts int) time.Duration {
+	backoff := payoutBaseBackoff * time.Duration(math.Pow(2, float64(attempts-1)))
+	if backoff > payoutMaxBackoff {
+		return payoutMaxBackoff
+	}
+	return backoff
+}
+
+// payoutBankAccount picks the account a user should be paid into: the default entry of
+// BankAccounts, then the first entry, then the legacy single-account fields.
+func payoutBankAccount(user models.User) (models.BankAccountItem, error) {
+	var accounts []models.BankAccountItem
+	if len(user.BankAccounts) > 0 {
+		_ = json.Unmarshal(user.BankAccounts, &accounts)
+	}
+
+	for _, a := range accounts {
+		if a.IsDefault && a.AccountNumber != "" && a.BankCode != "" {
+			return a, nil
+		}
+	}
+	for _, a := range accounts {
+		if a.AccountNumber != "" && a.BankCode != "" {
+			return a, nil
+		}
+	}
+
+	if user.AccountNumber != "" && user.BankCode != "" {
+		return models.BankAccountItem{
+			BankName:      user.BankName,
+			BankCode:      user.BankCode,
+			AccountNumber: user.AccountNumber,
+			AccountName:   user.AccountName,
+		}, nil
+	}
+
+	return models.BankAccountItem{}, fmt.Errorf("user has no bank account with a bank code on file")
+}
+
+// ensureTransferRecipient returns the cached Paystack recipient code for the account,
+// creating it on Paystack the first time it is needed.
+func ensureTransferRecipient(db *gorm.DB, userID uuid.UUID, account models.BankAccountItem) (string, error) {
+	var recipient models.TransferRecipient
+	err := db.Where("user_id = ? AND account_number = ? AND bank_code = ?", userID, account.AccountNumber, account.BankCode).First(&recipient).Error
+	if err == nil {
+		return recipient.RecipientCode, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return "", err
+	}
+
+	code, err := CreateTransferRecipient(account.AccountName, account.AccountNumber, account.BankCode)
+	if err != nil {
+		return "", err
+	}
+
+	recipient = models.TransferRecipient{
+		UserID:        userID,
+		AccountNumber: account.AccountNumber,
+		BankCode:      account.BankCode,
+		AccountName:   account.AccountName,
+		RecipientCode: code,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "account_number"}, {Name: "bank_code"}},
+		DoUpdates: clause.AssignmentColumns([]string{"recipient_code", "account_name", "updated_at"}),
+	}).Create(&recipient).Error; err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ProcessPayout submits a pending payout to Paystack. Failures are recorded on the payout
+// and scheduled for retry with exponential backoff until payoutMaxAttempts is reached.
+func ProcessPayout(db *gorm.DB, payoutID uuid.UUID) error {
+	var payout models.Payout
+	claimed := false
+
+	// Claim the payout so two workers never submit the same transfer
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			First(&payout, "id = ?", payoutID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if payout.Status != models.PayoutPending {
+			return nil
+		}
+
+		payout.Attempts++
+		claimed = true
+		return tx.Model(&payout).Updates(map[string]interface{}{
+			"status":   models.PayoutProcessing,
+			"attempts": payout.Attempts,
+		}).Error
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	transferCode, transferStatus, err := submitPayout(db, &payout)
+	if errors.Is(err, errTransferUnconfirmed) {
+		// Paystack may have started the transfer: stay PROCESSING until the transfer webhook
+		// or ReconcileProcessingPayouts settles it
+		log.Printf("Payouts: Transfer for payout %s unconfirmed (attempt %d): %v\n", payout.ID, payout.Attempts, err)
+		return db.Model(&payout).Update("last_error", err.Error()).Error
+	}
+	if err != nil {
+		log.Printf("Payouts: Transfer for payout %s failed (attempt %d): %v\n", payout.ID, payout.Attempts, err)
+		return failPayoutAttempt(db, &payout, err.Error(), false)
+	}
+
+	switch transferStatus {
+	case "success":
+		return db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Model(&payout).Updates(map[string]interface{}{
+				"transfer_code": transferCode,
+				"status":        models.PayoutSuccess,
+				"paid_at":       &now,
+				"last_error":    "",
+			}).Error; err != nil {
+				return err
+			}
+			return ledger.RecordPayoutSettled(tx, payout)
+		})
+	case "failed", "reversed":
+		return failPayoutAttempt(db, &payout, "Paystack reported transfer as "+transferStatus, true)
+	}
+
+	// pending/otp/queued transfers stay PROCESSING until the transfer webhook arrives
+	return db.Model(&payout).Updates(map[string]interface{}{
+		"transfer_code": transferCode,
+		"last_error":    "",
+	}).Error
+}
+
+func submitPayout(db *gorm.DB, payout *models.Payout) (string, string, error) {
+	if err := db.First(&payout.User, "id = ?", payout.UserID).Error; err != nil {
+		return "", "", err
+	}
+
+	account, err := payoutBankAccount(payout.User)
+	if err != nil {
+		return "", "", err
+	}
+
+	recipientCode, err := ensureTransferRecipient(db, payout.UserID, account)
+	if err != nil {
+		return "", "", err
+	}
+	db.Model(payout).Update("recipient_code", recipientCode)
+
+	code, status, err := InitiatePaystackTransfer(payout.Amount, recipientCode, payout.Reference, payout.Reason)
+	if err != nil && !errors.Is(err, ErrPaystackRejected) {
+		return "", "", fmt.Errorf("%w: %v", errTransferUnconfirmed, err)
+	}
+	return code, status, err
+}
+
+// errTransferUnconfirmed marks a transfer request whose outcome is unknown, e.g. one that
+// timed out after it was sent.
+var errTransferUnconfirmed = errors.New("transfer unconfirmed")
+
+// failPayoutAttempt schedules the next retry, or marks the payout FAILED once attempts run out.
+// newReference must be true when Paystack confirmed the transfer failed, since a reference
+// cannot be reused for a second transfer; when the outcome is unknown the same reference is
+// kept so a retry cannot pay twice.
+func failPayoutAttempt(db *gorm.DB, payout *models.Payout, reason string, newReference bool) error {
+	updates := map[string]interface{}{
+		"last_error": reason,
+	}
+	if newReference {
+		updates["reference"] = newPayoutReference()
+	}
+
+	if payout.Attempts >= payoutMaxAttempts {
+		updates["status"] = models.PayoutFailed
+		updates["next_attempt_at"] = nil
+	} else {
+		next := time.Now().Add(payoutBackoff(payout.Attempts))
+		updates["status"] = models.PayoutPending
+		updates["next_attempt_at"] = &next
+	}
+
+	return db.Model(payout).Updates(updates).Error
+}
+
+// ApplyTransferOutcome updates the payout owning reference from a transfer webhook.
+// It runs inside the webhook transaction and returns nil when no payout matches.
+func ApplyTransferOutcome(tx *gorm.DB, reference string, succeeded bool, reason string) (*models.Payout, error) {
+	var payout models.Payout
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("reference = ?", reference).First(&payout).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if succeeded {
+		if payout.Status == models.PayoutSuccess {
+			return &payout, nil
+		}
+
+		now := time.Now()
+		payout.Status = models.PayoutSuccess
+		payout.PaidAt = &now
+		if err := tx.Model(&payout).Updates(map[string]interface{}{
+			"status":     models.PayoutSuccess,
+			"paid_at":    &now,
+			"last_error": "",
+		}).Error; err != nil {
+			return nil, err
+		}
+		return &payout, ledger.RecordPayoutSettled(tx, payout)
+	}
+
+	if reason == "" {
+		reason = "Transfer failed"
+	}
+
+	// A transfer reversed after it was paid is parked for finance to look into rather than
+	// paid out again automatically
+	if payout.Status == models.PayoutSuccess {
+		if err := ledger.RecordPayoutReversed(tx, payout); err != nil {
+			return nil, err
+		}
+		payout.Status = models.PayoutReversed
+		return &payout, tx.Model(&payout).Updates(map[string]interface{}{
+			"status":          models.PayoutReversed,
+			"reference":       newPayoutReference(),
+			"last_error":      reason,
+			"next_attempt_at": nil,
+		}).Error
+	}
+	if payout.Status != models.PayoutProcessing && payout.Status != models.PayoutPending {
+		return &payout, nil
+	}
+
+	// A failed transfer goes back for retry
+	if err := failPayoutAttempt(tx, &payout, reason, true); err != nil {
+		return nil, err
+	}
+	return &payout, tx.First(&payout, "id = ?", payout.ID).Error
+}
+
+// ReleaseBookingEscrow completes a booking whose funds are held in escrow and queues
+// the artisan payout in the same transaction.
+func ReleaseBookingEscrow(db *gorm.DB, booking *models.ServiceBooking) (*models.Payout, error) {
+	var payout *models.Payout
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(booking, "id = ?", booking.ID).Error; err != nil {
+			return err
+		}
+		if booking.Status == models.BookingDisputed {
+			return fmt.Errorf("booking %s is under dispute", booking.BookingNumber)
+		}
+
+		var err error
+		payout, err = releaseBookingEscrow(tx, booking)
+		return err
+	})
+	return payout, err
+}
+
+// releaseBookingEscrow completes a locked booking and pays its escrow out to the artisan.
+func releaseBookingEscrow(tx *gorm.DB, booking *models.ServiceBooking) (*models.Payout, error) {
+	if booking.PaymentStatus != "HELD_IN_ESCROW" {
+		return nil, fmt.Errorf("booking payment is %s, not held in escrow", booking.PaymentStatus)
+	}
+
+	now := time.Now()
+	booking.Status = "COMPLETED"
+	booking.CompletedAt = &now
+	booking.PaymentStatus = "RELEASED_TO_ARTISAN"
+	if err := tx.Save(booking).Error; err != nil {
+		return nil, err
+	}
+	if err := ledger.RecordBookingRelease(tx, *booking); err != nil {
+		return nil, err
+	}
+	err := notifications.Notify(tx, models.Notification{
+		UserID:   booking.ArtisanID,
+		Kind:     models.NotificationBooking,
+		Title:    "Booking " + booking.BookingNumber + " is complete",
+		Body:     fmt.Sprintf("%s has been released from escrow and is on its way to your bank account.", booking.ArtisanPayout),
+		Link:     "/dashboard?tab=service_bookings",
+		EntityID: &booking.ID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return QueuePayout(tx, models.PayoutSourceServiceBooking, booking.ID, booking.ArtisanID, booking.ArtisanPayout,
+		fmt.Sprintf("Nedzl payout for booking %s", booking.BookingNumber))
+}
+
+// payoutConfirmAfter is how long a payout may stay PROCESSING, waiting for its transfer
+// webhook, before ReconcileProcessingPayouts asks Paystack about it.
+const payoutConfirmAfter = 30 * time.Minute
+
+// ReconcileProcessingPayouts verifies payouts that have been PROCESSING for longer than
+// payoutConfirmAfter with Paystack: after a crash, a transfer request that timed out or a
+// transfer webhook that never came. Settled transfers are recorded, failed ones and those
+// Paystack never created go back for retry, and pending ones are left for a later run.
+func ReconcileProcessingPayouts(db *gorm.DB) error {
+	var stuck []models.Payout
+	if err := db.Select("id", "reference").Where("status = ? AND updated_at <= ?", models.PayoutProcessing, time.Now().Add(-payoutConfirmAfter)).
+		Order("updated_at ASC").Limit(100).Find(&stuck).Error; err != nil {
+		return fmt.Errorf("fetching processing payouts: %w", err)
+	}
+
+	for _, p := range stuck {
+		transferCode, status, err := VerifyPaystackTransfer(p.Reference)
+		if err != nil && !errors.Is(err, ErrTransferNotFound) {
+			log.Printf("Jobs: Error verifying transfer for payout %s: %v\n", p.ID, err)
+			continue
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var payout models.Payout
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payout, "id = ?", p.ID).Error; err != nil {
+				return err
+			}
+			// A webhook or retry may have moved it on since it was verified
+			if payout.Status != models.PayoutProcessing || payout.Reference != p.Reference {
+				return nil
+			}
+
+			switch {
+			case status == "":
+				// Never created, so the same reference is safe to use again
+				return failPayoutAttempt(tx, &payout, "Paystack has no record of the transfer", false)
+			case status == "success":
+				if err := tx.Model(&payout).Update("transfer_code", transferCode).Error; err != nil {
+					return err
+				}
+				_, err := ApplyTransferOutcome(tx, payout.Reference, true, "")
+				return err
+			case status == "failed" || status == "reversed":
+				_, err := ApplyTransferOutcome(tx, payout.Reference, false, "Paystack reported transfer as "+status)
+				return err
+			}
+			log.Printf("Jobs: Transfer for payout %s is still %s at Paystack\n", payout.ID, status)
+			return tx.Model(&payout).Update("transfer_code", transferCode).Error
+		})
+		if err != nil {
+			log.Printf("Jobs: Error reconciling payout %s: %v\n", p.ID, err)
+		}
+	}
+	return nil
+}
+
+// RetryPendingPayouts submits every payout whose retry time has come.
+func RetryPendingPayouts(db *gorm.DB) error {
+	var due []models.Payout
+	if err := db.Select("id").Where("status = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", models.PayoutPending, time.Now()).
+		Order("created_at ASC").Limit(100).Find(&due).Error; err != nil {
+		return fmt.Errorf("fetching pending payouts: %w", err)
+	}
+
+	for _, p := range due {
+		if err := ProcessPayout(db, p.ID); err != nil {
+			log.Printf("Jobs: Error processing payout %s: %v\n", p.ID, err)
+		}
+	}
+	return nil
+}
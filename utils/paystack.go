@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"api/models"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -13,6 +15,15 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+// PaystackBaseURL returns the Paystack API origin. PAYSTACK_BASE_URL overrides it so the
+// client can be pointed at a local stub server.
+func PaystackBaseURL() string {
+	if baseURL := os.Getenv("PAYSTACK_BASE_URL"); baseURL != "" {
+		return strings.TrimRight(baseURL, "/")
+	}
+	return "https://api.paystack.co"
+}
+
 // GetFrontendBaseURL determines the frontend origin for Paystack callbacks
 func GetFrontendBaseURL(c echo.Context) string {
 	if frontendURL := os.Getenv("FRONTEND_URL"); frontendURL != "" {
@@ -42,16 +53,36 @@ type PaystackInitResponse struct {
 	} `json:"data"`
 }
 
-// InitializePaystackTransaction initializes transaction with Paystack API and returns checkout authorization URL
-func InitializePaystackTransaction(email string, amountNGN float64, reference string, callbackURL string) (string, error) {
+// ErrPaystackNotConfigured is returned when a payment is started without PAYSTACK_SECRET_KEY
+// outside payments dev mode.
+var ErrPaystackNotConfigured = errors.New("PAYSTACK_SECRET_KEY is not configured")
+
+// ErrPaystackRejected wraps errors where Paystack answered and declined a request, as opposed
+// to timeouts and server errors after which it is unknown whether Paystack acted on it.
+var ErrPaystackRejected = errors.New("paystack rejected the request")
+
+// PaymentsDevMode reports whether payments may be settled without a Paystack checkout, for
+// local development: only when PAYSTACK_SECRET_KEY is unset and PAYMENTS_DEV_MODE=true.
+func PaymentsDevMode() bool {
+	return os.Getenv("PAYSTACK_SECRET_KEY") == "" && os.Getenv("PAYMENTS_DEV_MODE") == "true"
+}
+
+// InitializePaystackTransaction initializes transaction with Paystack API and returns checkout authorization URL.
+// The URL is empty, with no error, only in PaymentsDevMode; callers then settle the payment
+// themselves. Any other failure is an error and nothing may be marked paid.
+func InitializePaystackTransaction(email string, amount models.Money, reference string, callbackURL string) (string, error) {
 	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
 	if secretKey == "" {
-		return "", nil
+		if PaymentsDevMode() {
+			return "", nil
+		}
+		return "", ErrPaystackNotConfigured
 	}
 
 	payload := map[string]interface{}{
 		"email":        email,
-		"amount":       int64(amountNGN * 100),
+		"amount":       amount.Kobo,
+		"currency":     amount.CurrencyCode(),
 		"reference":    reference,
 		"callback_url": callbackURL,
 	}
@@ -61,7 +92,7 @@ func InitializePaystackTransaction(email string, amountNGN float64, reference st
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.paystack.co/transaction/initialize", bytes.NewBuffer(jsonBytes))
+	req, err := http.NewRequest("POST", PaystackBaseURL()+"/transaction/initialize", bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return "", err
 	}
@@ -84,6 +115,9 @@ func InitializePaystackTransaction(email string, amountNGN float64, reference st
 	if !initResp.Status {
 		return "", fmt.Errorf("paystack initialization error: %s", initResp.Message)
 	}
+	if initResp.Data.AuthorizationURL == "" {
+		return "", fmt.Errorf("paystack initialization returned no checkout URL")
+	}
 
 	return initResp.Data.AuthorizationURL, nil
 }
@@ -96,7 +130,7 @@ type PaystackVerifyResponse struct {
 		Domain          string    `json:"domain"`
 		Status          string    `json:"status"` // "success"
 		Reference       string    `json:"reference"`
-		Amount          float64   `json:"amount"` // in kobo (divide by 100)
+		Amount          int64     `json:"amount"` // in kobo
 		GatewayResponse string    `json:"gateway_response"`
 		PaidAt          time.Time `json:"paid_at"`
 		Channel         string    `json:"channel"`
@@ -111,7 +145,7 @@ type PaystackVerifyResponse struct {
 // VerifyPaystackTransaction verifies transaction reference with Paystack API.
 // If PAYSTACK_SECRET_KEY is not configured or in testing environment without key,
 // it validates the reference format gracefully.
-func VerifyPaystackTransaction(reference string, expectedAmountNGN float64) (bool, string, error) {
+func VerifyPaystackTransaction(reference string, expected models.Money) (bool, string, error) {
 	// If test/mock reference prefix used in development or frontend demo
 	if strings.HasPrefix(reference, "PS_REF_") || strings.HasPrefix(reference, "PS_BK_") || strings.HasPrefix(reference, "TEST_") || strings.HasPrefix(reference, "DEMO_") {
 		return true, "Payment verified (Development Mock Reference)", nil
@@ -126,7 +160,7 @@ func VerifyPaystackTransaction(reference string, expectedAmountNGN float64) (boo
 		return false, "Invalid payment reference", fmt.Errorf("payment reference required")
 	}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.paystack.co/transaction/verify/%s", reference), nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/transaction/verify/%s", PaystackBaseURL(), reference), nil)
 	if err != nil {
 		return false, "Failed to create Paystack request", err
 	}
@@ -153,10 +187,15 @@ func VerifyPaystackTransaction(reference string, expectedAmountNGN float64) (boo
 		return false, fmt.Sprintf("Payment verification failed: %s", verifyResp.Message), nil
 	}
 
-	// Verify amount (Paystack amount is in kobo -> NGN * 100)
-	paidNGN := verifyResp.Data.Amount / 100.0
-	if expectedAmountNGN > 0 && paidNGN < expectedAmountNGN-1.0 {
-		return false, fmt.Sprintf("Paid amount (₦%.2f) does not match expected amount (₦%.2f)", paidNGN, expectedAmountNGN), nil
+	// Verify amount exactly in kobo; no tolerance is needed now that amounts are never floats
+	paid := models.Money{Kobo: verifyResp.Data.Amount, Currency: verifyResp.Data.Currency}
+	if expected.IsPositive() {
+		if paid.Currency != "" && paid.Currency != expected.CurrencyCode() {
+			return false, fmt.Sprintf("Paid currency (%s) does not match expected currency (%s)", paid.Currency, expected.CurrencyCode()), nil
+		}
+		if paid.Kobo < expected.Kobo {
+			return false, fmt.Sprintf("Paid amount (₦%s) does not match expected amount (₦%s)", paid.Naira(), expected.Naira()), nil
+		}
 	}
 
 	return true, "Payment verified successfully", nil
@@ -176,6 +215,9 @@ type PaystackResolveBankResponse struct {
 func ResolveBankAccount(accountNumber string, bankCode string) (string, error) {
 	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
 	if secretKey == "" {
+		if !PaymentsDevMode() {
+			return "", ErrPaystackNotConfigured
+		}
 		// Fallback for development/testing if secret key is not set
 		if len(accountNumber) == 10 {
 			return "VERIFIED ACCOUNT HOLDER", nil
@@ -183,7 +225,7 @@ func ResolveBankAccount(accountNumber string, bankCode string) (string, error) {
 		return "", fmt.Errorf("invalid account number format")
 	}
 
-	reqURL := fmt.Sprintf("https://api.paystack.co/bank/resolve?account_number=%s&bank_code=%s", accountNumber, bankCode)
+	reqURL := fmt.Sprintf("%s/bank/resolve?account_number=%s&bank_code=%s", PaystackBaseURL(), accountNumber, bankCode)
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
 		return "", err
@@ -208,3 +250,271 @@ func ResolveBankAccount(accountNumber string, bankCode string) (string, error) {
 
 	return resolveResp.Data.AccountName, nil
 }
+
+type PaystackTransferRecipientResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		RecipientCode string `json:"recipient_code"`
+		Name          string `json:"name"`
+	} `json:"data"`
+}
+
+// CreateTransferRecipient registers a NUBAN account with Paystack and returns its recipient code
+func CreateTransferRecipient(accountName, accountNumber, bankCode string) (string, error) {
+	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
+	if secretKey == "" {
+		return "", fmt.Errorf("PAYSTACK_SECRET_KEY is not configured")
+	}
+
+	payload := map[string]interface{}{
+		"type":           "nuban",
+		"name":           accountName,
+		"account_number": accountNumber,
+		"bank_code":      bankCode,
+		"currency":       "NGN",
+	}
+
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", PaystackBaseURL()+"/transferrecipient", bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+secretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var recipientResp PaystackTransferRecipientResponse
+	if err := json.NewDecoder(resp.Body).Decode(&recipientResp); err != nil {
+		return "", err
+	}
+
+	if !recipientResp.Status || recipientResp.Data.RecipientCode == "" {
+		return "", fmt.Errorf("paystack transfer recipient error: %s", recipientResp.Message)
+	}
+
+	return recipientResp.Data.RecipientCode, nil
+}
+
+type PaystackTransferResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Reference    string `json:"reference"`
+		TransferCode string `json:"transfer_code"`
+		Status       string `json:"status"` // pending, success, failed, otp
+	} `json:"data"`
+}
+
+// InitiatePaystackTransfer sends amount from the Paystack balance to recipientCode.
+// It returns the transfer code and the transfer status reported by Paystack.
+func InitiatePaystackTransfer(amount models.Money, recipientCode, reference, reason string) (string, string, error) {
+	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
+	if secretKey == "" {
+		return "", "", fmt.Errorf("PAYSTACK_SECRET_KEY is not configured")
+	}
+
+	payload := map[string]interface{}{
+		"source":    "balance",
+		"amount":    amount.Kobo,
+		"currency":  amount.CurrencyCode(),
+		"recipient": recipientCode,
+		"reference": reference,
+		"reason":    reason,
+	}
+
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", PaystackBaseURL()+"/transfer", bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return "", "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+secretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	var transferResp PaystackTransferResponse
+	if err := json.NewDecoder(resp.Body).Decode(&transferResp); err != nil {
+		return "", "", err
+	}
+
+	if !transferResp.Status {
+		if resp.StatusCode >= 500 {
+			return "", "", fmt.Errorf("paystack transfer error (HTTP %d): %s", resp.StatusCode, transferResp.Message)
+		}
+		return "", "", fmt.Errorf("%w: %s", ErrPaystackRejected, transferResp.Message)
+	}
+
+	return transferResp.Data.TransferCode, transferResp.Data.Status, nil
+}
+
+type PaystackRefundResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		ID     json.Number `json:"id"`
+		Status string      `json:"status"` // pending, processing, processed, failed
+	} `json:"data"`
+}
+
+// CreatePaystackRefund asks Paystack to refund amount of the transaction with reference.
+// It returns Paystack's refund id and the refund status it reported.
+func CreatePaystackRefund(reference string, amount models.Money, note string) (string, string, error) {
+	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
+	if secretKey == "" {
+		return "", "", fmt.Errorf("PAYSTACK_SECRET_KEY is not configured")
+	}
+
+	payload := map[string]interface{}{
+		"transaction":   reference,
+		"amount":        amount.Kobo,
+		"currency":      amount.CurrencyCode(),
+		"merchant_note": note,
+	}
+
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", "", err
+	}
+
+	req, err := http.NewRequest("POST", PaystackBaseURL()+"/refund", bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return "", "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+secretKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	var refundResp PaystackRefundResponse
+	if err := json.NewDecoder(resp.Body).Decode(&refundResp); err != nil {
+		return "", "", err
+	}
+
+	if !refundResp.Status {
+		if resp.StatusCode >= 500 {
+			return "", "", fmt.Errorf("paystack refund error (HTTP %d): %s", resp.StatusCode, refundResp.Message)
+		}
+		return "", "", fmt.Errorf("%w: %s", ErrPaystackRejected, refundResp.Message)
+	}
+
+	return refundResp.Data.ID.String(), refundResp.Data.Status, nil
+}
+
+// PaystackRefund is a refund as listed by Paystack.
+type PaystackRefund struct {
+	ID       json.Number `json:"id"`
+	Amount   int64       `json:"amount"`
+	Currency string      `json:"currency"`
+	Status   string      `json:"status"` // pending, processing, processed, failed
+}
+
+type PaystackRefundListResponse struct {
+	Status  bool             `json:"status"`
+	Message string           `json:"message"`
+	Data    []PaystackRefund `json:"data"`
+}
+
+// ListPaystackRefunds returns the refunds Paystack holds for the transaction with reference.
+// Paystack lists refunds by transaction id, so the transaction is looked up first.
+func ListPaystackRefunds(reference string) ([]PaystackRefund, error) {
+	var verifyResp PaystackVerifyResponse
+	if _, err := paystackGet("/transaction/verify/"+url.PathEscape(reference), &verifyResp); err != nil {
+		return nil, err
+	}
+	if !verifyResp.Status || verifyResp.Data.ID == 0 {
+		return nil, fmt.Errorf("paystack transaction lookup error: %s", verifyResp.Message)
+	}
+
+	var listResp PaystackRefundListResponse
+	if _, err := paystackGet(fmt.Sprintf("/refund?transaction=%d", verifyResp.Data.ID), &listResp); err != nil {
+		return nil, err
+	}
+	if !listResp.Status {
+		return nil, fmt.Errorf("paystack refund list error: %s", listResp.Message)
+	}
+	return listResp.Data, nil
+}
+
+// paystackGet sends an authenticated GET to the Paystack API, decodes the response into out
+// and returns the HTTP status code.
+func paystackGet(path string, out interface{}) (int, error) {
+	secretKey := os.Getenv("PAYSTACK_SECRET_KEY")
+	if secretKey == "" {
+		return 0, ErrPaystackNotConfigured
+	}
+
+	req, err := http.NewRequest("GET", PaystackBaseURL()+path, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+secretKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ErrTransferNotFound is returned by VerifyPaystackTransfer when Paystack has no transfer
+// with the reference, i.e. the transfer was never created.
+var ErrTransferNotFound = errors.New("paystack has no transfer with this reference")
+
+type PaystackTransferVerifyResponse struct {
+	Status  bool   `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Reference    string `json:"reference"`
+		TransferCode string `json:"transfer_code"`
+		Status       string `json:"status"` // pending, success, failed, reversed, otp, ...
+		Reason       string `json:"reason"`
+	} `json:"data"`
+}
+
+// VerifyPaystackTransfer looks up the transfer with reference and returns its transfer code
+// and status.
+func VerifyPaystackTransfer(reference string) (string, string, error) {
+	var verifyResp PaystackTransferVerifyResponse
+	code, err := paystackGet("/transfer/verify/"+url.PathEscape(reference), &verifyResp)
+	if err != nil {
+		return "", "", err
+	}
+	if code == http.StatusNotFound {
+		return "", "", ErrTransferNotFound
+	}
+	if !verifyResp.Status {
+		return "", "", fmt.Errorf("paystack transfer verify error: %s", verifyResp.Message)
+	}
+	return verifyResp.Data.TransferCode, verifyResp.Data.Status, nil
+}
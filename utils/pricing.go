@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"api/models"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FoodOrderPrice is a food order priced from the product as stored, never from the client.
+type FoodOrderPrice struct {
+	ProductPrice models.Money
+	Options      []models.SubMenuOption // selected options at the product's own prices
+	OptionsTotal models.Money
+	MealPrice    models.Money // product price plus options; the commission base
+	DeliveryFee  models.Money
+	Total        models.Money
+}
+
+// PriceFoodOrder prices one portion of product with the selected sub-menu options.
+// selection is the client's sub_menus: a JSON array of option names or of {name} objects;
+// any price the client sends alongside a name is ignored.
+func PriceFoodOrder(product models.Products, selection []byte) (FoodOrderPrice, error) {
+	price := FoodOrderPrice{
+		ProductPrice: product.ProductPrice,
+		OptionsTotal: models.NGN(0),
+		DeliveryFee:  product.DeliveryFee,
+	}
+	if !product.ProductPrice.IsPositive() {
+		return price, fmt.Errorf("%s has no price set", product.Name)
+	}
+
+	names, err := selectedSubMenuNames(selection)
+	if err != nil {
+		return price, err
+	}
+
+	if len(names) > 0 {
+		offered, err := models.ParseSubMenuOptions(product.SubMenus)
+		if err != nil {
+			return price, fmt.Errorf("%s has invalid sub-menu options", product.Name)
+		}
+		byName := make(map[string]models.SubMenuOption, len(offered))
+		for _, o := range offered {
+			byName[strings.ToLower(o.Name)] = o
+		}
+
+		for _, name := range names {
+			option, ok := byName[strings.ToLower(name)]
+			if !ok {
+				return price, fmt.Errorf("%q is not an option for %s", name, product.Name)
+			}
+			price.Options = append(price.Options, option)
+			price.OptionsTotal = price.OptionsTotal.Add(option.Price)
+		}
+	}
+
+	price.MealPrice = price.ProductPrice.Add(price.OptionsTotal)
+	price.Total = price.MealPrice.Add(price.DeliveryFee)
+	return price, nil
+}
+
+func selectedSubMenuNames(selection []byte) ([]string, error) {
+	trimmed := strings.TrimSpace(string(selection))
+	if trimmed == "" || trimmed == "null" || trimmed == `""` {
+		return nil, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+		return nil, fmt.Errorf("sub_menus must be a list of option names")
+	}
+
+	names := make([]string, 0, len(raw))
+	for _, item := range raw {
+		var name string
+		if err := json.Unmarshal(item, &name); err != nil {
+			var option struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(item, &option); err != nil {
+				return nil, fmt.Errorf("sub_menus must be a list of option names")
+			}
+			name = option.Name
+		}
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// SubMenusJSON encodes the selected options for storage on an order.
+func (p FoodOrderPrice) SubMenusJSON() []byte {
+	if len(p.Options) == 0 {
+		return []byte("[]")
+	}
+	b, _ := json.Marshal(p.Options)
+	return b
+}
+
+// CartLine is one priced cart item.
+type CartLine struct {
+	Item             models.CartItem
+	Price            FoodOrderPrice // price of a single portion
+	LineTotal        models.Money   // meal price × quantity, excluding delivery
+	PlatformFee      models.Money
+	CommissionRuleID *uuid.UUID
+}
+
+// VendorSubOrder is one vendor's share of a cart checkout. A vendor delivers everything in
+// one trip, so the sub-order charges the highest delivery fee among its products, once.
+type VendorSubOrder struct {
+	VendorID     uuid.UUID
+	Lines        []CartLine
+	MealPrice    models.Money
+	DeliveryFee  models.Money
+	PlatformFee  models.Money
+	VendorPayout models.Money
+	Total        models.Money
+}
+
+// IsFoodProduct mirrors the FOOD filter used when listing products.
+func IsFoodProduct(p models.Products) bool {
+	if p.ProductType == "FOOD" {
+		return true
+	}
+	switch p.CategoryName {
+	case "prepared-food", "foodstuffs", "fruits-vegetables":
+		return true
+	}
+	return false
+}
+
+// CheckFoodProductOrderable reports why product cannot be ordered as food: it was removed,
+// is no longer on sale or is not a food product.
+func CheckFoodProductOrderable(product models.Products) error {
+	switch {
+	case product.ID == uuid.Nil || product.DeletedAt.Valid:
+		return fmt.Errorf("this product has been removed")
+	case product.IsDeletedByUser:
+		return fmt.Errorf("%s has been removed by the vendor", product.Name)
+	case product.Status != models.StatusOngoing:
+		return fmt.Errorf("%s is no longer on sale", product.Name)
+	case !IsFoodProduct(product):
+		return fmt.Errorf("%s is not a food product", product.Name)
+	}
+	return nil
+}
+
+// StaleCartItem is a cart item whose product can no longer be ordered.
+type StaleCartItem struct {
+	ItemID    uuid.UUID `json:"item_id"`
+	ProductID uuid.UUID `json:"product_id"`
+	Name      string    `json:"product_name"`
+	Reason    string    `json:"reason"`
+}
+
+// StaleCartError lists the cart items that have to be removed before the cart can be priced.
+type StaleCartError struct {
+	Items []StaleCartItem
+}
+
+func (e *StaleCartError) Error() string {
+	names := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		names = append(names, item.Reason)
+	}
+	return strings.Join(names, "; ")
+}
+
+// PriceFoodCart prices cart items (with Product loaded) and groups them by vendor, in the
+// order the vendors first appear in the cart. Commission is resolved per product. Items whose
+// product can no longer be ordered fail the whole cart with a *StaleCartError.
+func PriceFoodCart(db *gorm.DB, items []models.CartItem) ([]VendorSubOrder, models.Money, error) {
+	total := models.NGN(0)
+	var groups []VendorSubOrder
+	index := map[uuid.UUID]int{}
+	now := time.Now()
+
+	// The product may have changed since it was added to the cart
+	var stale []StaleCartItem
+	for _, item := range items {
+		if err := CheckFoodProductOrderable(item.Product); err != nil {
+			stale = append(stale, StaleCartItem{ItemID: item.ID, ProductID: item.ProductID, Name: item.Product.Name, Reason: err.Error()})
+		}
+	}
+	if len(stale) > 0 {
+		return nil, total, &StaleCartError{Items: stale}
+	}
+
+	for _, item := range items {
+		if item.Product.UserID == nil {
+			return nil, total, fmt.Errorf("%s has no vendor", item.Product.Name)
+		}
+		if item.Quantity < 1 {
+			return nil, total, fmt.Errorf("quantity for %s must be at least 1", item.Product.Name)
+		}
+
+		price, err := PriceFoodOrder(item.Product, item.SubMenus)
+		if err != nil {
+			return nil, total, err
+		}
+
+		rule, err := ResolveCommissionRule(db, item.Product, now)
+		if err != nil {
+			return nil, total, err
+		}
+
+		line := CartLine{Item: item, Price: price, LineTotal: price.MealPrice.Mul(int64(item.Quantity))}
+		line.PlatformFee = CalculateCommission(rule, line.LineTotal)
+		if rule.ID != uuid.Nil {
+			ruleID := rule.ID
+			line.CommissionRuleID = &ruleID
+		}
+
+		vendorID := *item.Product.UserID
+		i, ok := index[vendorID]
+		if !ok {
+			i = len(groups)
+			index[vendorID] = i
+			groups = append(groups, VendorSubOrder{
+				VendorID:    vendorID,
+				MealPrice:   models.NGN(0),
+				DeliveryFee: models.NGN(0),
+				PlatformFee: models.NGN(0),
+			})
+		}
+
+		g := &groups[i]
+		g.Lines = append(g.Lines, line)
+		g.MealPrice = g.MealPrice.Add(line.LineTotal)
+		g.PlatformFee = g.PlatformFee.Add(line.PlatformFee)
+		if price.DeliveryFee.Kobo > g.DeliveryFee.Kobo {
+			g.DeliveryFee = price.DeliveryFee
+		}
+	}
+
+	for i := range groups {
+		g := &groups[i]
+		g.Total = g.MealPrice.Add(g.DeliveryFee)
+		g.VendorPayout = g.MealPrice.Sub(g.PlatformFee).Add(g.DeliveryFee)
+		total = total.Add(g.Total)
+	}
+
+	return groups, total, nil
+}
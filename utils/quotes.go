@@ -0,0 +1,384 @@
+package utils
+
+import (
+	"api/ledger"
+	"api/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	quoteValidity      = 7 * 24 * time.Hour // how long a quote can be accepted when the artisan sets no date
+	maxQuoteItems      = 50
+	maxQuoteMilestones = 10
+)
+
+// SendQuote validates and saves the artisan's quote for a locked booking waiting for one.
+// Line item and quote totals are computed here; a quote sent without milestones is paid in
+// one. Earlier quotes the customer has not answered are superseded.
+func SendQuote(tx *gorm.DB, booking *models.ServiceBooking, quote *models.Quote) error {
+	if booking.PricingType != models.PricingQuote || booking.Status != models.BookingQuoteRequested {
+		return fmt.Errorf("this booking is not waiting for a quote")
+	}
+	if len(quote.Items) == 0 || len(quote.Items) > maxQuoteItems {
+		return fmt.Errorf("a quote needs between 1 and %d line items", maxQuoteItems)
+	}
+
+	total := models.NGN(0)
+	for i := range quote.Items {
+		item := &quote.Items[i]
+		if item.Description == "" || item.Quantity < 1 || !item.UnitPrice.IsPositive() {
+			return fmt.Errorf("line item %d needs a description, a quantity of at least 1 and a price", i+1)
+		}
+		item.Amount = models.Money{Kobo: item.UnitPrice.Kobo * int64(item.Quantity), Currency: item.UnitPrice.Currency}
+		total = total.Add(item.Amount)
+	}
+
+	if len(quote.Milestones) == 0 {
+		quote.Milestones = []models.Milestone{{Title: "Full payment", Amount: total}}
+	}
+	if len(quote.Milestones) > maxQuoteMilestones {
+		return fmt.Errorf("a quote can have at most %d milestones", maxQuoteMilestones)
+	}
+	milestoneTotal := models.NGN(0)
+	for i := range quote.Milestones {
+		m := &quote.Milestones[i]
+		if m.Title == "" || !m.Amount.IsPositive() {
+			return fmt.Errorf("milestone %d needs a title and an amount", i+1)
+		}
+		m.BookingID = booking.ID
+		m.CustomerID = booking.UserID
+		m.ArtisanID = booking.ArtisanID
+		m.Sequence = i + 1
+		m.Status = models.MilestonePending
+		m.PaymentStatus = "PENDING"
+		milestoneTotal = milestoneTotal.Add(m.Amount)
+	}
+	if milestoneTotal.Kobo != total.Kobo {
+		return fmt.Errorf("milestones add up to %s but the line items total %s", milestoneTotal, total)
+	}
+
+	if quote.ValidUntil == nil {
+		validUntil := time.Now().Add(quoteValidity)
+		quote.ValidUntil = &validUntil
+	} else if !quote.ValidUntil.After(time.Now()) {
+		return fmt.Errorf("valid_until must be in the future")
+	}
+
+	if err := tx.Model(&models.Quote{}).Where("booking_id = ? AND status = ?", booking.ID, models.QuoteSent).
+		Update("status", models.QuoteSuperseded).Error; err != nil {
+		return err
+	}
+
+	quote.BookingID = booking.ID
+	quote.ArtisanID = booking.ArtisanID
+	quote.CustomerID = booking.UserID
+	quote.Total = total
+	quote.Status = models.QuoteSent
+	return tx.Create(quote).Error
+}
+
+// AcceptQuote books the job at the quoted price, reserving its slot in the artisan's schedule
+// like any other booking. The commission is worked out per milestone so each release pays the
+// platform its share. Both rows should be locked.
+func AcceptQuote(tx *gorm.DB, quote *models.Quote, booking *models.ServiceBooking) error {
+	if quote.Status != models.QuoteSent {
+		return fmt.Errorf("this quote is %s", quote.Status)
+	}
+	if quote.ValidUntil != nil && time.Now().After(*quote.ValidUntil) {
+		return fmt.Errorf("this quote expired on %s; ask the artisan for a new one", quote.ValidUntil.In(Lagos).Format("2 Jan 2006"))
+	}
+	if booking.Status != models.BookingQuoteRequested {
+		return fmt.Errorf("this booking is not waiting for a quote")
+	}
+
+	var service models.Products
+	if err := tx.First(&service, "id = ?", booking.ServiceID).Error; err != nil {
+		return err
+	}
+	rule, err := ResolveCommissionRule(tx, service, time.Now())
+	if err != nil {
+		return err
+	}
+	var commissionRuleID *uuid.UUID
+	if rule.ID != uuid.Nil {
+		commissionRuleID = &rule.ID
+	}
+
+	var milestones []models.Milestone
+	if err := tx.Where("quote_id = ?", quote.ID).Order("sequence ASC").Find(&milestones).Error; err != nil {
+		return err
+	}
+	platformFee := models.NGN(0)
+	for i := range milestones {
+		m := &milestones[i]
+		m.PlatformFee = CalculateCommission(rule, m.Amount)
+		m.ArtisanPayout = m.Amount.Sub(m.PlatformFee)
+		if err := tx.Model(m).Updates(map[string]interface{}{
+			"platform_fee":   m.PlatformFee,
+			"artisan_payout": m.ArtisanPayout,
+		}).Error; err != nil {
+			return err
+		}
+		platformFee = platformFee.Add(m.PlatformFee)
+	}
+
+	now := time.Now()
+	quote.Status = models.QuoteAccepted
+	quote.RespondedAt = &now
+	quote.Milestones = milestones
+	if err := tx.Model(quote).Updates(map[string]interface{}{"status": models.QuoteAccepted, "responded_at": &now}).Error; err != nil {
+		return err
+	}
+
+	slot, err := ReserveSlot(tx, booking.ServiceID, booking.ArtisanID, booking.ID, booking.ScheduledDate)
+	if err != nil {
+		return err
+	}
+
+	booking.Status = "BOOKED"
+	booking.ScheduledEndAt = &slot.End
+	booking.QuoteID = &quote.ID
+	booking.BookingFee = quote.Total
+	booking.PlatformFee = platformFee
+	booking.ArtisanPayout = quote.Total.Sub(platformFee)
+	booking.CommissionRuleID = commissionRuleID
+	return tx.Model(booking).Updates(map[string]interface{}{
+		"status":             booking.Status,
+		"scheduled_end_at":   booking.ScheduledEndAt,
+		"quote_id":           booking.QuoteID,
+		"booking_fee":        booking.BookingFee,
+		"platform_fee":       booking.PlatformFee,
+		"artisan_payout":     booking.ArtisanPayout,
+		"commission_rule_id": booking.CommissionRuleID,
+	}).Error
+}
+
+// DeclineQuote turns a quote down. The booking keeps waiting so the artisan can send another.
+func DeclineQuote(tx *gorm.DB, quote *models.Quote) error {
+	if quote.Status != models.QuoteSent {
+		return fmt.Errorf("this quote is %s", quote.Status)
+	}
+	now := time.Now()
+	quote.Status = models.QuoteDeclined
+	quote.RespondedAt = &now
+	return tx.Model(quote).Updates(map[string]interface{}{"status": models.QuoteDeclined, "responded_at": &now}).Error
+}
+
+// BookingMilestones returns the milestones of a quoted booking's accepted quote, in order.
+func BookingMilestones(db *gorm.DB, booking models.ServiceBooking) ([]models.Milestone, error) {
+	milestones := []models.Milestone{}
+	if booking.QuoteID == nil {
+		return milestones, nil
+	}
+	err := db.Where("quote_id = ?", *booking.QuoteID).Order("sequence ASC").Find(&milestones).Error
+	return milestones, err
+}
+
+// CanPayMilestone checks that a milestone is next in line to be paid: its booking is active
+// and every earlier milestone has been paid.
+func CanPayMilestone(tx *gorm.DB, milestone models.Milestone, booking models.ServiceBooking) error {
+	if booking.QuoteID == nil || *booking.QuoteID != milestone.QuoteID {
+		return fmt.Errorf("this milestone is not part of the accepted quote")
+	}
+	if booking.Status != "BOOKED" && booking.Status != "IN_PROGRESS" {
+		return fmt.Errorf("milestones cannot be paid on a %s booking", booking.Status)
+	}
+	if milestone.Status != models.MilestonePending || (milestone.PaymentStatus != "PENDING" && milestone.PaymentStatus != "FAILED") {
+		return fmt.Errorf("this milestone is already paid")
+	}
+
+	var unpaid int64
+	if err := tx.Model(&models.Milestone{}).
+		Where("quote_id = ? AND sequence < ? AND status <> ? AND payment_status IN ?", milestone.QuoteID, milestone.Sequence,
+			models.MilestoneCancelled, []string{"PENDING", "FAILED"}).
+		Count(&unpaid).Error; err != nil {
+		return err
+	}
+	if unpaid > 0 {
+		return fmt.Errorf("pay the earlier milestones first")
+	}
+	return nil
+}
+
+// NewMilestoneReference returns a fresh Paystack reference for a payment attempt on a milestone.
+func NewMilestoneReference(booking models.ServiceBooking, milestone models.Milestone) string {
+	return fmt.Sprintf("%s-M%d-%d", booking.BookingNumber, milestone.Sequence, time.Now().UnixNano()/1e6)
+}
+
+// FundMilestone records a confirmed payment for a locked milestone and holds it in escrow.
+func FundMilestone(tx *gorm.DB, milestone *models.Milestone) error {
+	now := time.Now()
+	milestone.PaymentStatus = "HELD_IN_ESCROW"
+	milestone.PaidAt = &now
+	if err := tx.Model(milestone).Updates(map[string]interface{}{
+		"payment_status": milestone.PaymentStatus,
+		"paid_at":        &now,
+	}).Error; err != nil {
+		return err
+	}
+	return ledger.RecordMilestoneCharge(tx, *milestone)
+}
+
+// CompleteMilestone records the artisan finishing the work a funded milestone covers.
+func CompleteMilestone(tx *gorm.DB, milestone *models.Milestone) error {
+	if milestone.PaymentStatus != "HELD_IN_ESCROW" {
+		return fmt.Errorf("milestone payment is %s, not held in escrow", milestone.PaymentStatus)
+	}
+	if milestone.Status != models.MilestonePending {
+		return fmt.Errorf("this milestone is already %s", milestone.Status)
+	}
+	now := time.Now()
+	milestone.Status = models.MilestoneArtisanCompleted
+	milestone.ArtisanCompletedAt = &now
+	return tx.Model(milestone).Updates(map[string]interface{}{
+		"status":               milestone.Status,
+		"artisan_completed_at": &now,
+	}).Error
+}
+
+// ReleaseMilestone pays a locked milestone's escrow out to the artisan and completes the
+// booking once none of its milestones are outstanding. The payout must be processed after commit.
+func ReleaseMilestone(tx *gorm.DB, milestone *models.Milestone, booking *models.ServiceBooking) (*models.Payout, error) {
+	if milestone.PaymentStatus != "HELD_IN_ESCROW" {
+		return nil, fmt.Errorf("milestone payment is %s, not held in escrow", milestone.PaymentStatus)
+	}
+
+	now := time.Now()
+	milestone.Status = models.MilestoneCompleted
+	milestone.PaymentStatus = "RELEASED_TO_ARTISAN"
+	milestone.ReleasedAt = &now
+	if err := tx.Model(milestone).Updates(map[string]interface{}{
+		"status":         milestone.Status,
+		"payment_status": milestone.PaymentStatus,
+		"released_at":    &now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := ledger.RecordMilestoneRelease(tx, *milestone); err != nil {
+		return nil, err
+	}
+
+	payout, err := QueuePayout(tx, models.PayoutSourceBookingMilestone, milestone.ID, milestone.ArtisanID, milestone.ArtisanPayout,
+		fmt.Sprintf("Nedzl payout for booking %s, milestone %d", booking.BookingNumber, milestone.Sequence))
+	if err != nil {
+		return nil, err
+	}
+	return payout, settleQuotedBooking(tx, booking)
+}
+
+// settleQuotedBooking completes a quoted booking once every milestone is completed or
+// cancelled, or cancels it if none was completed.
+func settleQuotedBooking(tx *gorm.DB, booking *models.ServiceBooking) error {
+	if booking.QuoteID == nil || booking.Status == "COMPLETED" || booking.Status == "CANCELLED" {
+		return nil
+	}
+
+	var open, completed int64
+	if err := tx.Model(&models.Milestone{}).Where("quote_id = ? AND status IN ?", *booking.QuoteID,
+		[]string{models.MilestonePending, models.MilestoneArtisanCompleted}).Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+	if err := tx.Model(&models.Milestone{}).Where("quote_id = ? AND status = ?", *booking.QuoteID, models.MilestoneCompleted).
+		Count(&completed).Error; err != nil {
+		return err
+	}
+
+	if completed == 0 {
+		booking.Status = "CANCELLED"
+		return tx.Model(booking).Update("status", booking.Status).Error
+	}
+	now := time.Now()
+	booking.Status = "COMPLETED"
+	booking.CompletedAt = &now
+	return tx.Model(booking).Updates(map[string]interface{}{"status": booking.Status, "completed_at": &now}).Error
+}
+
+// RequestMilestoneRefund cancels a paid milestone and records a refund of its amount.
+// Released milestones can be refunded too while their payout has not gone out; the ledger
+// claws the release back.
+func RequestMilestoneRefund(tx *gorm.DB, milestone *models.Milestone, reason, actor string, actorID *uuid.UUID) (*models.Refund, error) {
+	if milestone.PaymentStatus != "HELD_IN_ESCROW" && milestone.PaymentStatus != "RELEASED_TO_ARTISAN" {
+		return nil, fmt.Errorf("milestone payment is %s, not refundable", milestone.PaymentStatus)
+	}
+	if err := cancelPayoutForRefund(tx, models.PayoutSourceBookingMilestone, milestone.ID); err != nil {
+		return nil, err
+	}
+	milestone.Status = models.MilestoneCancelled
+	milestone.PaymentStatus = models.PaymentRefundPending
+	if err := tx.Model(milestone).Updates(map[string]interface{}{
+		"status":         milestone.Status,
+		"payment_status": milestone.PaymentStatus,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return RequestRefund(tx, models.RefundSourceBookingMilestone, milestone.ID, milestone.CustomerID, milestone.PaymentReference,
+		milestone.Amount, reason, actor, actorID)
+}
+
+// CancelMilestones winds down the milestones of a quoted booking being cancelled: unpaid ones
+// are cancelled and those held in escrow are refunded. Released milestones are left alone.
+func CancelMilestones(tx *gorm.DB, booking *models.ServiceBooking, reason, actor string, actorID *uuid.UUID) ([]*models.Refund, error) {
+	if booking.QuoteID == nil {
+		return nil, nil
+	}
+
+	var milestones []models.Milestone
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("quote_id = ? AND status IN ?", *booking.QuoteID, []string{models.MilestonePending, models.MilestoneArtisanCompleted}).
+		Order("sequence ASC").Find(&milestones).Error; err != nil {
+		return nil, err
+	}
+
+	var refunds []*models.Refund
+	for i := range milestones {
+		m := &milestones[i]
+		if m.PaymentStatus == "HELD_IN_ESCROW" {
+			refund, err := RequestMilestoneRefund(tx, m, reason, actor, actorID)
+			if err != nil {
+				return nil, err
+			}
+			refunds = append(refunds, refund)
+			continue
+		}
+		if err := tx.Model(m).Update("status", models.MilestoneCancelled).Error; err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
+}
+
+// MarkMilestoneRefunded records a completed refund on a milestone and settles its booking.
+func MarkMilestoneRefunded(tx *gorm.DB, milestone *models.Milestone) error {
+	if milestone.PaymentStatus == "REFUNDED" {
+		return nil
+	}
+	milestone.Status = models.MilestoneCancelled
+	milestone.PaymentStatus = "REFUNDED"
+	if err := tx.Model(milestone).Updates(map[string]interface{}{
+		"status":         milestone.Status,
+		"payment_status": milestone.PaymentStatus,
+	}).Error; err != nil {
+		return err
+	}
+	if err := ledger.RecordMilestoneRefund(tx, *milestone); err != nil {
+		return err
+	}
+	if err := cancelPendingPayouts(tx, models.PayoutSourceBookingMilestone, milestone.ID); err != nil {
+		return err
+	}
+
+	var booking models.ServiceBooking
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, "id = ?", milestone.BookingID).Error; err != nil {
+		return err
+	}
+	return settleQuotedBooking(tx, &booking)
+}
@@ -0,0 +1,508 @@
+package utils
+
+import (
+	"api/emails"
+	"api/ledger"
+	"api/models"
+	"api/notifications"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FoodOrderCancelWindow is how long after ordering a customer may still cancel a paid food
+// order (FOOD_ORDER_CANCEL_WINDOW_MINUTES, 10 minutes by default).
+func FoodOrderCancelWindow() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("FOOD_ORDER_CANCEL_WINDOW_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+// BookingCancelCutoff is how long before the scheduled date a customer may still cancel a
+// booking (BOOKING_CANCEL_CUTOFF_HOURS, 24 hours by default).
+func BookingCancelCutoff() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("BOOKING_CANCEL_CUTOFF_HOURS")); err == nil && hours >= 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// RequestRefund records a full refund of a paid order or booking. It is safe to call more
+// than once for the same source; only the first call creates a refund.
+// Call it inside the transaction that cancels the source, then ProcessRefund after commit.
+func RequestRefund(tx *gorm.DB, sourceType string, sourceID, userID uuid.UUID, reference string, amount models.Money, reason, actor string, actorID *uuid.UUID) (*models.Refund, error) {
+	refund := models.Refund{
+		SourceType:           sourceType,
+		SourceID:             sourceID,
+		UserID:               userID,
+		TransactionReference: reference,
+		Amount:               amount,
+		Reason:               reason,
+		RequestedBy:          actor,
+		RequestedByID:        actorID,
+		Status:               models.RefundPending,
+	}
+
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&refund).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).First(&refund).Error; err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// ErrPayoutSent is returned when a refund is requested for money already transferred to the
+// vendor or artisan, which would have the platform pay it out twice.
+var ErrPayoutSent = errors.New("the payout for this has already been sent; settle it with the vendor before refunding")
+
+// cancelPayoutForRefund stops the payout of a source being refunded. It refuses with
+// ErrPayoutSent once the transfer is in flight or done, and cancels it otherwise; the row lock
+// keeps ProcessPayout from claiming it meanwhile.
+func cancelPayoutForRefund(tx *gorm.DB, sourceType string, sourceID uuid.UUID) error {
+	var payout models.Payout
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("source_type = ? AND source_id = ?", sourceType, sourceID).First(&payout).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch payout.Status {
+	case models.PayoutCancelled:
+		return nil
+	case models.PayoutPending, models.PayoutFailed, models.PayoutReversed:
+		return tx.Model(&payout).Updates(map[string]interface{}{"status": models.PayoutCancelled, "next_attempt_at": nil}).Error
+	}
+	return fmt.Errorf("%w (payout %s)", ErrPayoutSent, strings.ToLower(payout.Status))
+}
+
+// RequestBookingRefund marks a paid booking's payment as being refunded and records the refund.
+// Escrowed payments can be refunded, and released ones while their payout has not gone out; the
+// payout is cancelled and the ledger claws back the release.
+func RequestBookingRefund(tx *gorm.DB, booking *models.ServiceBooking, reason, actor string, actorID *uuid.UUID) (*models.Refund, error) {
+	if booking.PaymentStatus != "HELD_IN_ESCROW" && booking.PaymentStatus != "RELEASED_TO_ARTISAN" {
+		return nil, fmt.Errorf("booking payment is %s, not refundable", booking.PaymentStatus)
+	}
+	if err := cancelPayoutForRefund(tx, models.PayoutSourceServiceBooking, booking.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Model(booking).Update("payment_status", models.PaymentRefundPending).Error; err != nil {
+		return nil, err
+	}
+	booking.PaymentStatus = models.PaymentRefundPending
+
+	return RequestRefund(tx, models.RefundSourceServiceBooking, booking.ID, booking.UserID, booking.PaymentReference, booking.BookingFee,
+		reason, actor, actorID)
+}
+
+// ProcessRefund submits a pending (or previously failed) refund to Paystack. In payments dev
+// mode no payment went through Paystack, so the refund completes locally; otherwise a missing
+// Paystack key leaves the refund pending and returns ErrPaystackNotConfigured.
+func ProcessRefund(db *gorm.DB, refundID uuid.UUID) error {
+	var refund models.Refund
+	claimed := false
+	local := PaymentsDevMode()
+	if !local && os.Getenv("PAYSTACK_SECRET_KEY") == "" {
+		return ErrPaystackNotConfigured
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			First(&refund, "id = ?", refundID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil
+			}
+			return err
+		}
+		if refund.Status != models.RefundPending && refund.Status != models.RefundFailed {
+			return nil
+		}
+		claimed = true
+
+		if local {
+			_, err := CompleteRefund(tx, &refund)
+			return err
+		}
+
+		refund.Status = models.RefundProcessing
+		return tx.Model(&refund).Updates(map[string]interface{}{
+			"status":     models.RefundProcessing,
+			"last_error": "",
+		}).Error
+	})
+	if err != nil || !claimed {
+		return err
+	}
+	if local {
+		return nil
+	}
+
+	refundCode, status, err := CreatePaystackRefund(refund.TransactionReference, refund.Amount, refund.Reason)
+	if err != nil {
+		log.Printf("Refunds: Paystack refund for %s failed: %v\n", refund.ID, err)
+		if !errors.Is(err, ErrPaystackRejected) {
+			// Paystack may have accepted it anyway: stay PROCESSING so it is not submitted
+			// twice, until the refund webhook or ReconcileRefunds settles it
+			return db.Model(&refund).Update("last_error", "unconfirmed: "+err.Error()).Error
+		}
+		return db.Model(&refund).Updates(map[string]interface{}{
+			"status":     models.RefundFailed,
+			"last_error": err.Error(),
+		}).Error
+	}
+
+	// Store Paystack's id on its own first: the refund webhook, and a cart checkout's sibling
+	// refunds sharing this transaction, are matched by it
+	if err := db.Model(&refund).Update("paystack_refund_id", refundCode).Error; err != nil {
+		return err
+	}
+	refund.PaystackRefundID = refundCode
+	if status != "processed" {
+		// pending refunds complete when the refund webhook arrives
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		_, err := CompleteRefund(tx, &refund)
+		return err
+	})
+}
+
+// CompleteRefund marks a refund processed, applies it to its order, booking or milestone and
+// queues the customer's email. It reports false when the refund had already been completed.
+func CompleteRefund(tx *gorm.DB, refund *models.Refund) (bool, error) {
+	if refund.Status == models.RefundProcessed {
+		return false, nil
+	}
+
+	now := time.Now()
+	refund.Status = models.RefundProcessed
+	refund.ProcessedAt = &now
+	if err := tx.Model(refund).Updates(map[string]interface{}{
+		"status":       models.RefundProcessed,
+		"processed_at": &now,
+		"last_error":   "",
+	}).Error; err != nil {
+		return false, err
+	}
+
+	var err error
+	switch refund.SourceType {
+	case models.RefundSourceFoodOrder:
+		var order models.FoodOrder
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "id = ?", refund.SourceID).Error; err != nil {
+			return false, err
+		}
+		_, err = MarkFoodOrderRefunded(tx, &order, "Refund processed")
+
+	case models.RefundSourceServiceBooking:
+		var booking models.ServiceBooking
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&booking, "id = ?", refund.SourceID).Error; err != nil {
+			return false, err
+		}
+		err = MarkBookingRefunded(tx, &booking, refund.Amount)
+
+	case models.RefundSourceBookingMilestone:
+		var milestone models.Milestone
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&milestone, "id = ?", refund.SourceID).Error; err != nil {
+			return false, err
+		}
+		err = MarkMilestoneRefunded(tx, &milestone)
+
+	default:
+		return false, fmt.Errorf("unknown refund source %q", refund.SourceType)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, NotifyRefundProcessed(tx, *refund)
+}
+
+// NotifyRefundProcessed tells the customer, by email and in the app, that their money is on
+// its way back.
+func NotifyRefundProcessed(tx *gorm.DB, refund models.Refund) error {
+	bookingID := refund.SourceID
+	switch refund.SourceType {
+	case models.RefundSourceFoodOrder:
+		return NotifyFoodOrderStatus(tx, refund.SourceID, refund.Reason)
+	case models.RefundSourceBookingMilestone:
+		var milestone models.Milestone
+		if err := tx.First(&milestone, "id = ?", refund.SourceID).Error; err != nil {
+			return err
+		}
+		bookingID = milestone.BookingID
+	}
+
+	var booking models.ServiceBooking
+	if err := tx.Preload("User").First(&booking, "id = ?", bookingID).Error; err != nil {
+		return err
+	}
+	err := notifications.Notify(tx, models.Notification{
+		UserID:   booking.UserID,
+		Kind:     models.NotificationRefund,
+		Title:    "Refund for booking " + booking.BookingNumber,
+		Body:     fmt.Sprintf("%s is on its way back to you.", refund.Amount),
+		Link:     "/dashboard?tab=service_bookings",
+		EntityID: &booking.ID,
+	})
+	if err != nil || booking.User.Email == "" {
+		return err
+	}
+	_, err = emails.Queue(tx, emails.KindBookingRefund, booking.User.Email, booking.User.UserName, booking.BookingNumber, refund.Amount, refund.Reason)
+	return err
+}
+
+// MarkFoodOrderRefunded records a completed refund on an order: payment status, ledger
+// entry and cancellation of any payout not yet sent. The order moves to REFUNDED when its
+// lifecycle allows; the result reports whether it did.
+func MarkFoodOrderRefunded(tx *gorm.DB, order *models.FoodOrder, note string) (bool, error) {
+	if order.PaymentStatus == "REFUNDED" {
+		return false, nil
+	}
+	if err := tx.Model(order).Update("payment_status", "REFUNDED").Error; err != nil {
+		return false, err
+	}
+	order.PaymentStatus = "REFUNDED"
+	if err := ledger.RecordFoodOrderRefund(tx, *order); err != nil {
+		return false, err
+	}
+	if err := cancelPendingPayouts(tx, models.PayoutSourceFoodOrder, order.ID); err != nil {
+		return false, err
+	}
+
+	if order.CheckoutID != nil {
+		if err := settleCheckoutRefund(tx, *order.CheckoutID); err != nil {
+			return false, err
+		}
+	}
+
+	if models.CanTransitionFoodOrder(order.Status, models.FoodOrderRefunded, models.ActorSystem) != nil {
+		return false, nil
+	}
+	if _, err := TransitionFoodOrder(tx, order, models.FoodOrderRefunded, models.ActorSystem, nil, note); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// settleCheckoutRefund marks a cart checkout refunded once every one of its orders is.
+func settleCheckoutRefund(tx *gorm.DB, checkoutID uuid.UUID) error {
+	var open int64
+	if err := tx.Model(&models.FoodOrder{}).Where("checkout_id = ? AND payment_status <> ?", checkoutID, "REFUNDED").
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return nil
+	}
+	return tx.Model(&models.FoodCheckout{}).Where("id = ?", checkoutID).Update("payment_status", "REFUNDED").Error
+}
+
+// MarkBookingRefunded records a completed refund of amount on a booking. A full refund
+// cancels bookings that were not completed or missed; a partial one only settles what a dispute
+// resolution left in escrow.
+func MarkBookingRefunded(tx *gorm.DB, booking *models.ServiceBooking, amount models.Money) error {
+	if booking.PaymentStatus == "REFUNDED" || booking.PaymentStatus == models.PaymentPartiallyRefunded {
+		return nil
+	}
+
+	if amount.Kobo < booking.BookingFee.Kobo {
+		if err := tx.Model(booking).Update("payment_status", models.PaymentPartiallyRefunded).Error; err != nil {
+			return err
+		}
+		booking.PaymentStatus = models.PaymentPartiallyRefunded
+		return ledger.RecordBookingPartialRefund(tx, *booking, amount.Kobo)
+	}
+
+	updates := map[string]interface{}{"payment_status": "REFUNDED"}
+	if booking.Status != "COMPLETED" && booking.Status != models.BookingNoShow {
+		updates["status"] = "CANCELLED"
+	}
+	if err := tx.Model(booking).Updates(updates).Error; err != nil {
+		return err
+	}
+	booking.PaymentStatus = "REFUNDED"
+	if err := ledger.RecordBookingRefund(tx, *booking); err != nil {
+		return err
+	}
+	return cancelPendingPayouts(tx, models.PayoutSourceServiceBooking, booking.ID)
+}
+
+// cancelPendingPayouts stops payouts that have not reached Paystack yet for a refunded source.
+func cancelPendingPayouts(tx *gorm.DB, sourceType string, sourceID uuid.UUID) error {
+	return tx.Model(&models.Payout{}).
+		Where("source_type = ? AND source_id = ? AND status = ?", sourceType, sourceID, models.PayoutPending).
+		Updates(map[string]interface{}{"status": models.PayoutCancelled, "next_attempt_at": nil}).Error
+}
+
+// ApplyRefundOutcome updates the refund a refund webhook refers to. Refunds are matched by
+// Paystack's refund id, falling back to the transaction reference and amount for a refund
+// whose id was never stored. Sub-orders of a cart checkout share one transaction, so the
+// fallback refuses to pick between several refunds of the same amount and leaves them to
+// ReconcileRefunds. It returns a nil refund when the event matches no single refund requested
+// through the platform.
+func ApplyRefundOutcome(tx *gorm.DB, reference, paystackRefundID string, amount models.Money, succeeded bool, reason string) (*models.Refund, error) {
+	var refund models.Refund
+	locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+
+	err := gorm.ErrRecordNotFound
+	if paystackRefundID != "" {
+		err = locked.Where("paystack_refund_id = ?", paystackRefundID).First(&refund).Error
+	}
+	if err == gorm.ErrRecordNotFound {
+		var candidates []models.Refund
+		if err := locked.Where("transaction_reference = ? AND amount = ? AND paystack_refund_id = ? AND status IN ?", reference, amount, "",
+			[]string{models.RefundPending, models.RefundProcessing, models.RefundFailed}).
+			Limit(2).Find(&candidates).Error; err != nil {
+			return nil, err
+		}
+		switch len(candidates) {
+		case 0:
+			return nil, nil
+		case 1:
+			refund = candidates[0]
+		default:
+			log.Printf("Refunds: Paystack refund %s for %s matches several refunds of %s; leaving it to reconciliation\n",
+				paystackRefundID, reference, amount)
+			return nil, nil
+		}
+		if paystackRefundID != "" {
+			refund.PaystackRefundID = paystackRefundID
+			if err := tx.Model(&refund).Update("paystack_refund_id", paystackRefundID).Error; err != nil {
+				return nil, err
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if succeeded {
+		_, err := CompleteRefund(tx, &refund)
+		return &refund, err
+	}
+
+	if refund.Status == models.RefundProcessed {
+		return &refund, nil
+	}
+	refund.Status = models.RefundFailed
+	return &refund, tx.Model(&refund).Updates(map[string]interface{}{
+		"status":     models.RefundFailed,
+		"last_error": reason,
+	}).Error
+}
+
+// refundConfirmAfter is how long a refund submission whose outcome is unknown is left for the
+// refund webhook before ReconcileRefunds asks Paystack about it.
+const refundConfirmAfter = 15 * time.Minute
+
+// ReconcileRefunds settles refunds stuck PROCESSING from the refunds Paystack lists for their
+// transaction: those whose submission timed out or errored before Paystack's refund id was
+// stored, and those whose refund webhook never arrived or could not be matched. A refund
+// submission Paystack has no record of is marked FAILED so that it can be resubmitted.
+func ReconcileRefunds(db *gorm.DB) error {
+	var stuck []models.Refund
+	if err := db.Where("status = ? AND updated_at <= ?",
+		models.RefundProcessing, time.Now().Add(-refundConfirmAfter)).Find(&stuck).Error; err != nil {
+		return fmt.Errorf("fetching unconfirmed refunds: %w", err)
+	}
+
+	for _, r := range stuck {
+		listed, err := ListPaystackRefunds(r.TransactionReference)
+		if err != nil {
+			log.Printf("Jobs: Error listing Paystack refunds for %s: %v\n", r.ID, err)
+			continue
+		}
+		if err := db.Transaction(func(tx *gorm.DB) error { return reconcileRefund(tx, r.ID, listed) }); err != nil {
+			log.Printf("Jobs: Error reconciling refund %s: %v\n", r.ID, err)
+		}
+	}
+	return nil
+}
+
+func reconcileRefund(tx *gorm.DB, refundID uuid.UUID, listed []PaystackRefund) error {
+	var refund models.Refund
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, "id = ?", refundID).Error; err != nil {
+		return err
+	}
+	if refund.Status != models.RefundProcessing {
+		return nil
+	}
+	if refund.PaystackRefundID != "" {
+		for _, p := range listed {
+			if p.ID.String() == refund.PaystackRefundID {
+				return settleListedRefund(tx, &refund, p)
+			}
+		}
+		return nil
+	}
+
+	// Refunds of one cart checkout share its transaction, so skip Paystack refunds already
+	// matched to another of ours and refuse to guess between several equal ones
+	var known []string
+	if err := tx.Model(&models.Refund{}).Where("transaction_reference = ? AND paystack_refund_id <> ?",
+		refund.TransactionReference, "").Pluck("paystack_refund_id", &known).Error; err != nil {
+		return err
+	}
+	matched := map[string]bool{}
+	for _, id := range known {
+		matched[id] = true
+	}
+	var candidates []PaystackRefund
+	for _, p := range listed {
+		if p.Amount == refund.Amount.Kobo && !matched[p.ID.String()] {
+			candidates = append(candidates, p)
+		}
+	}
+	var siblings int64
+	if err := tx.Model(&models.Refund{}).Where("transaction_reference = ? AND amount = ? AND status = ? AND paystack_refund_id = ?",
+		refund.TransactionReference, refund.Amount, models.RefundProcessing, "").Count(&siblings).Error; err != nil {
+		return err
+	}
+
+	switch {
+	case len(candidates) == 0:
+		refund.Status = models.RefundFailed
+		return tx.Model(&refund).Updates(map[string]interface{}{
+			"status":     models.RefundFailed,
+			"last_error": "Paystack has no record of the refund; it can be resubmitted",
+		}).Error
+	case len(candidates) > 1 || siblings > 1:
+		return tx.Model(&refund).Update("last_error", "unconfirmed: several Paystack refunds match; check the Paystack dashboard").Error
+	}
+
+	found := candidates[0]
+	refund.PaystackRefundID = found.ID.String()
+	if err := tx.Model(&refund).Update("paystack_refund_id", refund.PaystackRefundID).Error; err != nil {
+		return err
+	}
+	return settleListedRefund(tx, &refund, found)
+}
+
+// settleListedRefund applies the status Paystack lists for refund.
+func settleListedRefund(tx *gorm.DB, refund *models.Refund, found PaystackRefund) error {
+	switch found.Status {
+	case "processed":
+		_, err := CompleteRefund(tx, refund)
+		return err
+	case "failed":
+		refund.Status = models.RefundFailed
+		return tx.Model(refund).Updates(map[string]interface{}{
+			"status":     models.RefundFailed,
+			"last_error": "Paystack reported the refund failed",
+		}).Error
+	}
+	// still pending at Paystack: the refund webhook completes it
+	return tx.Model(refund).Update("last_error", "").Error
+}